@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"errors"
+
+	"github.com/elves/elvish/store"
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+// Admin requests report the health of the daemon and statistics of its
+// clients and database, and change how it runs. They are used by the
+// -daemon-admin subprogram and the daemon: module.
+
+// adminStore is implemented by stores that support the DBStats and Compact
+// requests, which include all stores of the store package.
+type adminStore interface {
+	Stats() (*storedefs.DBStats, error)
+	Compact() error
+}
+
+// ErrNoAdmin is returned by the DBStats and Compact requests when the store
+// does not support them.
+var ErrNoAdmin = errors.New("store does not support administration")
+
+// Status reports the health of the daemon, its clients and statistics of
+// requests. Unlike other requests, it succeeds when the store has an error,
+// which is reported in the response.
+func (s *Service) Status(req *StatusRequest, res *StatusResponse) error {
+	s.mutex.RLock()
+	if s.err != nil {
+		res.StoreError = s.err.Error()
+	}
+	res.HistoryEncrypted = store.IsEncrypted(s.store)
+	s.mutex.RUnlock()
+	res.Started = s.metrics.started
+	res.Clients, res.Methods = s.metrics.snapshot()
+	return nil
+}
+
+// DBStats reports statistics of the database.
+func (s *Service) DBStats(req *DBStatsRequest, res *DBStatsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	st, ok := s.store.(adminStore)
+	if !ok {
+		return ErrNoAdmin
+	}
+	stats, err := st.Stats()
+	if err != nil {
+		return err
+	}
+	res.Stats = *stats
+	return nil
+}
+
+// Compact compacts the database after all pending requests have finished.
+// Other requests wait until it is done.
+func (s *Service) Compact(req *CompactRequest, res *CompactResponse) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	st, ok := s.store.(adminStore)
+	if !ok {
+		return ErrNoAdmin
+	}
+	before, err := st.Stats()
+	if err != nil {
+		return err
+	}
+	logger.Println("compacting database", before.Path)
+	err = st.Compact()
+	if err != nil {
+		logger.Println("failed to compact database:", err)
+		return err
+	}
+	after, err := st.Stats()
+	if err != nil {
+		return err
+	}
+	logger.Printf("compacted database from %d to %d bytes", before.Size, after.Size)
+	res.SizeBefore, res.SizeAfter = before.Size, after.Size
+	return nil
+}
+
+// SetLogLevel changes the log level of the daemon.
+func (s *Service) SetLogLevel(req *SetLogLevelRequest, res *SetLogLevelResponse) error {
+	level, err := util.ParseLogLevel(req.Level)
+	if err != nil {
+		return err
+	}
+	res.Previous = util.GetLogLevel().String()
+	util.SetLogLevel(level)
+	return nil
+}
@@ -1,6 +1,8 @@
 package daemon
 
 import (
+	"time"
+
 	"github.com/elves/elvish/store/storedefs"
 )
 
@@ -8,8 +10,13 @@ const (
 	// ServiceName is the name of the RPC service exposed by the daemon.
 	ServiceName = "Daemon"
 
-	// Version is the API version. It should be bumped any time the API changes.
-	Version = -97
+	// Version is the API version. It should be bumped any time the API
+	// changes; a version must never be reused, since methodVersions relies on
+	// each version identifying one API.
+	Version = -88
+	// MinCompatibleVersion is the oldest API version of daemons that clients
+	// can still talk to, using the subset of requests that they support.
+	MinCompatibleVersion = -97
 )
 
 // Basic requests.
@@ -26,6 +33,82 @@ type PidResponse struct {
 	Pid int
 }
 
+type CapabilitiesRequest struct{}
+
+type CapabilitiesResponse struct {
+	// Names of the supported RPC methods.
+	Methods []string
+}
+
+type HandoverRequest struct {
+	// Socket on which the new daemon is about to serve.
+	SockPath string
+}
+
+type HandoverResponse struct{}
+
+// Admin requests.
+
+type StatusRequest struct{}
+
+type StatusResponse struct {
+	// When the daemon was started.
+	Started time.Time
+	// Error with the store, or an empty string if the store is healthy.
+	StoreError string
+	// Whether the command history is encrypted, i.e. whether the daemon was
+	// started with a history key. Daemons before version -88 do not report
+	// it.
+	HistoryEncrypted bool
+	Clients          []ClientInfo
+	// Statistics of requests, ordered by method names.
+	Methods []MethodStats
+}
+
+// ClientInfo describes a client connected to the daemon.
+type ClientInfo struct {
+	// ID of the connection, unique during the lifetime of the daemon.
+	ID int
+	// Process ID of the client, or 0 if unknown. It is only known on Linux.
+	Pid       int
+	Connected time.Time
+	Requests  int
+}
+
+// MethodStats contains statistics of requests of an RPC method.
+type MethodStats struct {
+	Method string
+	Count  int
+	Errors int
+	// Total and maximum latencies.
+	Total time.Duration
+	Max   time.Duration
+}
+
+type DBStatsRequest struct{}
+
+type DBStatsResponse struct {
+	Stats storedefs.DBStats
+}
+
+type CompactRequest struct{}
+
+type CompactResponse struct {
+	// Sizes of the database before and after the compaction.
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+type SetLogLevelRequest struct {
+	// Name of the log level; see util.ParseLogLevel.
+	Level string
+}
+
+type SetLogLevelResponse struct {
+	// Name of the previous log level.
+	Previous string
+}
+
 // Cmd requests.
 
 type NextCmdSeqRequest struct{}
@@ -42,6 +125,33 @@ type AddCmdResponse struct {
 	Seq int
 }
 
+type AddCmdWithMetaRequest struct {
+	Text string
+	Meta storedefs.CmdMeta
+}
+
+type AddCmdWithMetaResponse struct {
+	Seq int
+}
+
+type AddCmdsRequest struct {
+	Cmds []storedefs.Cmd
+}
+
+type AddCmdsResponse struct{}
+
+type RemoveCmdRequest struct {
+	Seq int
+}
+
+type RemoveCmdResponse struct{}
+
+type DedupCmdsRequest struct{}
+
+type DedupCmdsResponse struct {
+	Removed []int
+}
+
 type CmdRequest struct {
 	Seq int
 }
@@ -79,23 +189,47 @@ type PrevCmdResponse struct {
 	Text string
 }
 
+type CmdsWithMetaRequest struct {
+	From int
+	Upto int
+}
+
+type CmdsWithMetaResponse struct {
+	Cmds []storedefs.Cmd
+}
+
+type SetCmdMetaRequest struct {
+	Seq  int
+	Meta storedefs.CmdMeta
+}
+
+type SetCmdMetaResponse struct{}
+
 // Dir requests.
 
 type AddDirRequest struct {
 	Dir       string
 	IncFactor float64
+	HalfLife  float64
 }
 
 type AddDirResponse struct{}
 
 type DirsRequest struct {
 	Blacklist map[string]struct{}
+	HalfLife  float64
 }
 
 type DirsResponse struct {
 	Dirs []storedefs.Dir
 }
 
+type PruneDirsRequest struct{}
+
+type PruneDirsResponse struct {
+	Pruned []string
+}
+
 // SharedVar requests.
 
 type SharedVarRequest struct {
@@ -106,6 +240,12 @@ type SharedVarResponse struct {
 	Value string
 }
 
+type SharedVarNamesRequest struct{}
+
+type SharedVarNamesResponse struct {
+	Names []string
+}
+
 type SetSharedVarRequest struct {
 	Name  string
 	Value string
@@ -118,3 +258,53 @@ type DelSharedVarRequest struct {
 }
 
 type DelSharedVarResponse struct{}
+
+// Completion cache requests.
+
+type CompletionCacheRequest struct {
+	Key string
+}
+
+type CompletionCacheResponse struct {
+	Value string
+}
+
+type SetCompletionCacheRequest struct {
+	Key   string
+	Value string
+}
+
+type SetCompletionCacheResponse struct{}
+
+// Pub/sub requests.
+
+type PublishRequest struct {
+	Message Message
+}
+
+type PublishResponse struct {
+	// Number of subscriptions the message was delivered to.
+	Delivered int
+}
+
+type SubscribeRequest struct {
+	Channels []string
+}
+
+type SubscribeResponse struct {
+	ID int
+}
+
+type PollRequest struct {
+	ID int
+}
+
+type PollResponse struct {
+	Messages []Message
+}
+
+type UnsubscribeRequest struct {
+	ID int
+}
+
+type UnsubscribeResponse struct{}
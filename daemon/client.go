@@ -2,13 +2,21 @@ package daemon
 
 import (
 	"errors"
+	"io"
+	"net"
 	"net/rpc"
 	"sync"
+	"time"
 
 	"github.com/elves/elvish/store/storedefs"
 )
 
-const retriesOnShutdown = 3
+const (
+	retriesOnShutdown = 3
+	// Maximum number of times to reconnect when the daemon is handing over,
+	// handoverPollInterval apart.
+	maxHandoverWaits = int(handoverTimeout / handoverPollInterval)
+)
 
 var (
 	// ErrClientNotInitialized is returned when the Client is not initialized.
@@ -16,13 +24,29 @@ var (
 	// ErrDaemonUnreachable is returned when the daemon cannot be reached after
 	// several retries.
 	ErrDaemonUnreachable = errors.New("daemon offline")
+	// ErrClientClosed is returned for requests made after the Client has been
+	// closed.
+	ErrClientClosed = errors.New("client closed")
 )
 
 // Client is a client to the Elvish daemon. A nil *Client is safe to use.
 type Client struct {
-	sockPath  string
+	sockPath string
+	// If not nil, requests are served in the current process instead of by a
+	// daemon; see NewLocalClient.
+	local     *localService
 	rpcClient *rpc.Client
-	waits     sync.WaitGroup
+	// Outstanding requests, which Close waits for. No more requests are
+	// started once closed is set.
+	waits       sync.WaitGroup
+	closedMutex sync.Mutex
+	closed      bool
+
+	// Result of negotiating with the daemon; see Supports.
+	capMutex     sync.Mutex
+	negotiated   bool
+	version      int
+	capabilities map[string]bool
 }
 
 var _ storedefs.Store = (*Client)(nil)
@@ -30,7 +54,7 @@ var _ storedefs.Store = (*Client)(nil)
 // NewClient creates a new Client instance that talks to the socket. Connection
 // creation is deferred to the first request.
 func NewClient(sockPath string) *Client {
-	return &Client{sockPath, nil, sync.WaitGroup{}}
+	return &Client{sockPath: sockPath}
 }
 
 // SockPath returns the socket path that the Client talks to. If the client is
@@ -50,29 +74,82 @@ func (c *Client) ResetConn() error {
 	}
 	rc := c.rpcClient
 	c.rpcClient = nil
+	c.resetNegotiation()
 	return rc.Close()
 }
 
 // Close waits for all outstanding requests to finish and close the connection.
-// If the client is nil, it does nothing and returns nil.
+// A local client also closes its store. Subsequent requests fail with
+// ErrClientClosed. If the client is nil or already closed, it does nothing and
+// returns nil.
 func (c *Client) Close() error {
 	if c == nil {
 		return nil
 	}
+	c.closedMutex.Lock()
+	closed := c.closed
+	c.closed = true
+	c.closedMutex.Unlock()
+	if closed {
+		return nil
+	}
 	c.waits.Wait()
-	return c.ResetConn()
+	err := c.ResetConn()
+	if c.local != nil {
+		if closer, ok := c.local.service.store.(io.Closer); ok {
+			closeErr := closer.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// connect makes a new connection to the daemon, or to the local service of a
+// local client.
+func (c *Client) connect() (net.Conn, error) {
+	if c.local != nil {
+		return c.local.connect(), nil
+	}
+	return dial(c.sockPath)
 }
 
 func (c *Client) call(f string, req, res interface{}) error {
 	if c == nil {
 		return ErrClientNotInitialized
 	}
+	if !basicMethods[f] {
+		supported, err := c.Supports(f)
+		if err != nil {
+			return err
+		}
+		if !supported {
+			return ErrNotSupported
+		}
+	}
+	c.closedMutex.Lock()
+	if c.closed {
+		c.closedMutex.Unlock()
+		return ErrClientClosed
+	}
 	c.waits.Add(1)
+	c.closedMutex.Unlock()
 	defer c.waits.Done()
 
+	handoverWaits := 0
+	// Connection to a daemon that has handed over. It is kept open until a new
+	// connection is made, so that the new daemon does not quit in between; see
+	// Serve.
+	var handedOver *rpc.Client
+	defer func() {
+		if handedOver != nil {
+			handedOver.Close()
+		}
+	}()
 	for attempt := 0; attempt < retriesOnShutdown; attempt++ {
 		if c.rpcClient == nil {
-			conn, err := dial(c.sockPath)
+			conn, err := c.connect()
 			if err != nil {
 				return err
 			}
@@ -80,17 +157,83 @@ func (c *Client) call(f string, req, res interface{}) error {
 		}
 
 		err := c.rpcClient.Call(ServiceName+"."+f, req, res)
-		if err == rpc.ErrShutdown {
+		switch {
+		case err == rpc.ErrShutdown:
 			// Clear rpcClient so as to reconnect next time
 			c.rpcClient = nil
-			continue
-		} else {
+			c.resetNegotiation()
+		case err != nil && err.Error() == storedefs.ErrDBLocked.Error() &&
+			c.switchToDaemon():
+			// A daemon has locked the database since the local client was
+			// made; see NewLocalClient.
+			attempt--
+		case err != nil && err.Error() == ErrHandedOver.Error() &&
+			handoverWaits < maxHandoverWaits:
+			// The daemon is handing over to a new one. Reconnect after the new
+			// daemon has had some time to take over the socket, without
+			// counting this as an attempt.
+			if handedOver == nil {
+				handedOver = c.rpcClient
+			} else {
+				c.rpcClient.Close()
+			}
+			c.rpcClient = nil
+			c.resetNegotiation()
+			handoverWaits++
+			attempt--
+			time.Sleep(handoverPollInterval)
+		default:
 			return err
 		}
 	}
 	return ErrDaemonUnreachable
 }
 
+func (c *Client) Capabilities() ([]string, error) {
+	req := &CapabilitiesRequest{}
+	res := &CapabilitiesResponse{}
+	err := c.call("Capabilities", req, res)
+	return res.Methods, err
+}
+
+func (c *Client) Handover(sockPath string) error {
+	req := &HandoverRequest{sockPath}
+	res := &HandoverResponse{}
+	return c.call("Handover", req, res)
+}
+
+func (c *Client) Status() (*StatusResponse, error) {
+	req := &StatusRequest{}
+	res := &StatusResponse{}
+	err := c.call("Status", req, res)
+	return res, err
+}
+
+func (c *Client) DBStats() (*storedefs.DBStats, error) {
+	req := &DBStatsRequest{}
+	res := &DBStatsResponse{}
+	err := c.call("DBStats", req, res)
+	return &res.Stats, err
+}
+
+// Compact compacts the database, and returns its sizes before and after the
+// compaction.
+func (c *Client) Compact() (int64, int64, error) {
+	req := &CompactRequest{}
+	res := &CompactResponse{}
+	err := c.call("Compact", req, res)
+	return res.SizeBefore, res.SizeAfter, err
+}
+
+// SetLogLevel changes the log level of the daemon, and returns the previous
+// level.
+func (c *Client) SetLogLevel(level string) (string, error) {
+	req := &SetLogLevelRequest{level}
+	res := &SetLogLevelResponse{}
+	err := c.call("SetLogLevel", req, res)
+	return res.Previous, err
+}
+
 // Convenience methods for RPC methods. These are quite repetitive; when the
 // number of RPC calls grow above some threshold, a code generator should be
 // written to generate them.
@@ -123,6 +266,40 @@ func (c *Client) AddCmd(text string) (int, error) {
 	return res.Seq, err
 }
 
+// AddCmdWithMeta adds a command along with its metadata. Daemons that do not
+// support command metadata are sent an AddCmd request instead, dropping the
+// metadata.
+func (c *Client) AddCmdWithMeta(text string, meta storedefs.CmdMeta) (int, error) {
+	req := &AddCmdWithMetaRequest{text, meta}
+	res := &AddCmdWithMetaResponse{}
+	err := c.call("AddCmdWithMeta", req, res)
+	if err != ErrNotSupported {
+		return res.Seq, err
+	}
+	return c.AddCmd(text)
+}
+
+func (c *Client) AddCmds(cmds []storedefs.Cmd) error {
+	req := &AddCmdsRequest{cmds}
+	res := &AddCmdsResponse{}
+	err := c.call("AddCmds", req, res)
+	return err
+}
+
+func (c *Client) RemoveCmd(seq int) error {
+	req := &RemoveCmdRequest{seq}
+	res := &RemoveCmdResponse{}
+	err := c.call("RemoveCmd", req, res)
+	return err
+}
+
+func (c *Client) DedupCmds() ([]int, error) {
+	req := &DedupCmdsRequest{}
+	res := &DedupCmdsResponse{}
+	err := c.call("DedupCmds", req, res)
+	return res.Removed, err
+}
+
 func (c *Client) Cmd(seq int) (string, error) {
 	req := &CmdRequest{seq}
 	res := &CmdResponse{}
@@ -151,20 +328,41 @@ func (c *Client) PrevCmd(upto int, prefix string) (int, string, error) {
 	return res.Seq, res.Text, err
 }
 
-func (c *Client) AddDir(dir string, incFactor float64) error {
-	req := &AddDirRequest{dir, incFactor}
+func (c *Client) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	req := &CmdsWithMetaRequest{from, upto}
+	res := &CmdsWithMetaResponse{}
+	err := c.call("CmdsWithMeta", req, res)
+	return res.Cmds, err
+}
+
+func (c *Client) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	req := &SetCmdMetaRequest{seq, meta}
+	res := &SetCmdMetaResponse{}
+	err := c.call("SetCmdMeta", req, res)
+	return err
+}
+
+func (c *Client) AddDir(dir string, incFactor, halfLife float64) error {
+	req := &AddDirRequest{dir, incFactor, halfLife}
 	res := &AddDirResponse{}
 	err := c.call("AddDir", req, res)
 	return err
 }
 
-func (c *Client) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
-	req := &DirsRequest{blacklist}
+func (c *Client) Dirs(blacklist map[string]struct{}, halfLife float64) ([]storedefs.Dir, error) {
+	req := &DirsRequest{blacklist, halfLife}
 	res := &DirsResponse{}
 	err := c.call("Dirs", req, res)
 	return res.Dirs, err
 }
 
+func (c *Client) PruneDirs() ([]string, error) {
+	req := &PruneDirsRequest{}
+	res := &PruneDirsResponse{}
+	err := c.call("PruneDirs", req, res)
+	return res.Pruned, err
+}
+
 func (c *Client) SharedVar(name string) (string, error) {
 	req := &SharedVarRequest{name}
 	res := &SharedVarResponse{}
@@ -172,6 +370,13 @@ func (c *Client) SharedVar(name string) (string, error) {
 	return res.Value, err
 }
 
+func (c *Client) SharedVarNames() ([]string, error) {
+	req := &SharedVarNamesRequest{}
+	res := &SharedVarNamesResponse{}
+	err := c.call("SharedVarNames", req, res)
+	return res.Names, err
+}
+
 func (c *Client) SetSharedVar(name, value string) error {
 	req := &SetSharedVarRequest{name, value}
 	res := &SetSharedVarResponse{}
@@ -179,7 +384,20 @@ func (c *Client) SetSharedVar(name, value string) error {
 }
 
 func (c *Client) DelSharedVar(name string) error {
-	req := &DelSharedVarRequest{}
+	req := &DelSharedVarRequest{name}
 	res := &DelSharedVarResponse{}
 	return c.call("DelSharedVar", req, res)
 }
+
+func (c *Client) CompletionCache(key string) (string, error) {
+	req := &CompletionCacheRequest{key}
+	res := &CompletionCacheResponse{}
+	err := c.call("CompletionCache", req, res)
+	return res.Value, err
+}
+
+func (c *Client) SetCompletionCache(key, value string) error {
+	req := &SetCompletionCacheRequest{key, value}
+	res := &SetCompletionCacheResponse{}
+	return c.call("SetCompletionCache", req, res)
+}
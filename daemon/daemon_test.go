@@ -1,9 +1,12 @@
 package daemon
 
 import (
+	"os"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/elves/elvish/store/storedefs"
 	"github.com/elves/elvish/util"
 )
 
@@ -11,7 +14,7 @@ func TestDaemon(t *testing.T) {
 	util.InTempDir(func(string) {
 		serverDone := make(chan struct{})
 		go func() {
-			Serve("sock", "db")
+			Serve("sock", "db", "", "")
 			close(serverDone)
 		}()
 
@@ -30,6 +33,91 @@ func TestDaemon(t *testing.T) {
 		if err != nil {
 			t.Errorf("client.AddCmd -> error %v", err)
 		}
+
+		err = client.SetSharedVar("foo", "bar")
+		if err != nil {
+			t.Errorf("client.SetSharedVar -> error %v", err)
+		}
+		names, err := client.SharedVarNames()
+		if len(names) != 1 || names[0] != "foo" || err != nil {
+			t.Errorf("client.SharedVarNames -> (%v, %v), want ([foo], nil)", names, err)
+		}
+		err = client.DelSharedVar("foo")
+		if err != nil {
+			t.Errorf("client.DelSharedVar -> error %v", err)
+		}
+		_, err = client.SharedVar("foo")
+		if err == nil || err.Error() != storedefs.ErrNoSharedVar.Error() {
+			t.Errorf("client.SharedVar after deletion -> error %v, want %v",
+				err, storedefs.ErrNoSharedVar)
+		}
+
+		sub, err := client.Subscribe("chan")
+		if err != nil {
+			t.Fatalf("client.Subscribe -> error %v", err)
+		}
+		n, err := client.Publish("chan", "payload")
+		if n != 1 || err != nil {
+			t.Errorf("client.Publish -> (%v, %v), want (1, nil)", n, err)
+		}
+		select {
+		case msg := <-sub.Messages():
+			if msg.Channel != "chan" || msg.Payload != "payload" {
+				t.Errorf("got message %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("message not received after 1s")
+		}
+		err = sub.Close()
+		if err != nil {
+			t.Errorf("sub.Close -> error %v", err)
+		}
+		if _, ok := <-sub.Messages(); ok {
+			t.Errorf("Messages not closed after sub.Close")
+		}
+
+		status, err := client.Status()
+		if err != nil {
+			t.Errorf("client.Status -> error %v", err)
+		} else {
+			if status.StoreError != "" || len(status.Clients) == 0 {
+				t.Errorf("client.Status -> %v", status)
+			}
+			if runtime.GOOS == "linux" && status.Clients[0].Pid != os.Getpid() {
+				t.Errorf("client.Status -> client pid %d, want %d",
+					status.Clients[0].Pid, os.Getpid())
+			}
+			found := false
+			for _, m := range status.Methods {
+				if m.Method == "AddCmd" && m.Count == 1 && m.Errors == 0 {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("client.Status -> no statistics of AddCmd in %v", status.Methods)
+			}
+		}
+		stats, err := client.DBStats()
+		if stats.Backend != "bolt" || stats.Size == 0 || err != nil {
+			t.Errorf("client.DBStats -> (%v, %v)", stats, err)
+		}
+		_, after, err := client.Compact()
+		if after == 0 || err != nil {
+			t.Errorf("client.Compact -> (%v, %v)", after, err)
+		}
+		cmd, err := client.Cmd(1)
+		if cmd != "test cmd" || err != nil {
+			t.Errorf("client.Cmd after compaction -> (%q, %v)", cmd, err)
+		}
+		prev, err := client.SetLogLevel("debug")
+		if prev != "info" || err != nil {
+			t.Errorf("client.SetLogLevel -> (%q, %v), want (info, nil)", prev, err)
+		}
+		_, err = client.SetLogLevel("info")
+		if err != nil {
+			t.Errorf("client.SetLogLevel -> error %v", err)
+		}
+
 		client.Close()
 		// Wait for server to quit before returning
 		<-serverDone
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// A newly started daemon takes over from an older one serving on the same
+// socket as follows:
+//
+// 1. The new daemon listens on a temporary socket, and calls Handover on the
+//    old daemon with it. The old daemon waits for pending requests to finish,
+//    closes the database and connects to the temporary socket. Subsequent
+//    requests to the old daemon fail with ErrHandedOver, upon which clients
+//    reconnect.
+//
+// 2. The new daemon opens the database, and atomically replaces the socket of
+//    the old daemon with the temporary socket.
+//
+// 3. The old daemon notices that its socket has been replaced and stops
+//    listening. It keeps its connection to the new daemon until all its
+//    clients have disconnected, so that the new daemon does not quit while
+//    clients of the old daemon have yet to reconnect.
+//
+// Daemons that predate the Handover request cannot be taken over.
+
+const (
+	// Time the old daemon waits for the new daemon to replace the socket.
+	handoverTimeout = 5 * time.Second
+	// Interval of checking whether the socket has been replaced.
+	handoverPollInterval = 10 * time.Millisecond
+)
+
+var (
+	// ErrHandedOver is returned by a daemon that has handed over to a new
+	// daemon.
+	ErrHandedOver = errors.New("daemon has handed over to a new daemon")
+	// ErrDaemonRunning is returned when trying to take over from a daemon that
+	// is not older than the current one.
+	ErrDaemonRunning = errors.New("daemon already running")
+)
+
+// takeOver asks the daemon serving on the socket, if any, to hand over. If the
+// daemon has handed over, it returns a listener on a temporary socket that
+// should replace sockpath after opening the database. If there is no daemon to
+// take over from, it returns a nil listener.
+func takeOver(sockpath string) (net.Listener, error) {
+	if _, err := os.Stat(sockpath); err != nil {
+		return nil, nil
+	}
+	conn, err := dial(sockpath)
+	if err != nil {
+		// Nobody is serving on the socket; remove the stale socket file.
+		logger.Println("removing stale socket", sockpath)
+		os.Remove(sockpath)
+		return nil, nil
+	}
+	conn.Close()
+
+	client := NewClient(sockpath)
+	defer client.Close()
+	version, err := client.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version >= Version {
+		return nil, ErrDaemonRunning
+	}
+	supported, err := client.Supports("Handover")
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, fmt.Errorf("daemon with API version %d does not support handover", version)
+	}
+
+	logger.Printf("taking over from daemon with API version %d", version)
+	tempPath := sockpath + ".new"
+	os.Remove(tempPath)
+	listener, err := listen(tempPath)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Handover(tempPath)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// waitForNewSock waits until the socket at sockpath is no longer the one
+// described by oldInfo, or a timeout expires.
+func waitForNewSock(sockpath string, oldInfo os.FileInfo) {
+	deadline := time.Now().Add(handoverTimeout)
+	for time.Now().Before(deadline) {
+		info, err := os.Stat(sockpath)
+		if err == nil && (oldInfo == nil || !os.SameFile(info, oldInfo)) {
+			return
+		}
+		time.Sleep(handoverPollInterval)
+	}
+	logger.Println("new daemon did not replace socket in", handoverTimeout)
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestHandover(t *testing.T) {
+	util.InTempDir(func(string) {
+		handedOver := make(chan struct{})
+		old := &oldService{
+			version:      Version - 1,
+			capabilities: []string{"Version", "Pid", "Capabilities", "AddCmd", "Handover"},
+			handover: func() error {
+				close(handedOver)
+				return nil
+			},
+		}
+		listener := serveStandIn(t, "sock", old)
+		client := NewClient("sock")
+		if seq, err := client.AddCmd("cmd"); seq != 42 || err != nil {
+			t.Errorf("AddCmd to old daemon -> (%v, %v), want (42, nil)", seq, err)
+		}
+
+		// A new daemon takes over the socket.
+		serverDone := make(chan struct{})
+		go func() {
+			Serve("sock", "db", "", "")
+			close(serverDone)
+		}()
+		select {
+		case <-handedOver:
+		case <-time.After(time.Second):
+			t.Fatal("Handover not called after 1s")
+		}
+		// Requests to the old daemon now fail with ErrHandedOver; the client
+		// reconnects to the new daemon.
+		seq, err := client.AddCmd("cmd")
+		if seq == 42 || err != nil {
+			t.Errorf("AddCmd after handover -> (%v, %v), want new daemon to respond", seq, err)
+		}
+		version, err := client.DaemonVersion()
+		if version != Version || err != nil {
+			t.Errorf("DaemonVersion -> (%v, %v), want (%v, nil)", version, err, Version)
+		}
+
+		// The old daemon must not remove the socket of the new daemon.
+		if ul, ok := listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		listener.Close()
+
+		// Daemons with the same version do not take over.
+		if _, err := takeOver("sock"); err != ErrDaemonRunning {
+			t.Errorf("takeOver -> error %v, want %v", err, ErrDaemonRunning)
+		}
+
+		client.Close()
+		<-serverDone
+	})
+}
+
+func TestTakeOverStaleSocket(t *testing.T) {
+	util.InTempDir(func(string) {
+		listener, err := listen("sock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ul, ok := listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		listener.Close()
+
+		listener, err = takeOver("sock")
+		if listener != nil || err != nil {
+			t.Errorf("takeOver -> (%v, %v), want (nil, nil)", listener, err)
+		}
+		if _, err := os.Lstat("sock"); err == nil {
+			t.Errorf("stale socket not removed")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"syscall"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// localService serves requests of a local client in the current process, over
+// in-memory connections.
+type localService struct {
+	service *Service
+	server  *rpc.Server
+}
+
+// NewLocalClient returns a Client whose requests are served in the current
+// process with the given store, for use when the daemon is unavailable. Since
+// there is no daemon, messages published with the client only reach
+// subscriptions made with the same client. Closing the client closes the store.
+//
+// If sockPath is not empty and a request fails with storedefs.ErrDBLocked
+// because a daemon serving on sockPath has since opened the database, the
+// client switches to the daemon and retries the request. Subscriptions made
+// before the switch receive no more messages.
+func NewLocalClient(st storedefs.Store, sockPath string) *Client {
+	service := newService(st, nil)
+	server := rpc.NewServer()
+	server.RegisterName(ServiceName, service)
+	return &Client{sockPath: sockPath, local: &localService{service, server}}
+}
+
+// Local returns whether the client is a local client made by NewLocalClient.
+func (c *Client) Local() bool {
+	return c != nil && c.local != nil
+}
+
+// switchToDaemon switches a local client to the daemon serving on its socket,
+// closing its store. It returns whether the client has switched.
+func (c *Client) switchToDaemon() bool {
+	if c.local == nil || c.sockPath == "" {
+		return false
+	}
+	conn, err := dial(c.sockPath)
+	if err != nil {
+		return false
+	}
+	logger.Println("database is locked, switching to the daemon at", c.sockPath)
+	if c.rpcClient != nil {
+		c.rpcClient.Close()
+	}
+	c.rpcClient = rpc.NewClient(conn)
+	c.resetNegotiation()
+	if closer, ok := c.local.service.store.(io.Closer); ok {
+		closer.Close()
+	}
+	c.local = nil
+	return true
+}
+
+func (l *localService) connect() net.Conn {
+	conn, serverConn := net.Pipe()
+	go func() {
+		clientID := l.service.metrics.addClient(syscall.Getpid())
+		l.server.ServeCodec(newMetricsCodec(serverConn, l.service.metrics, clientID))
+		l.service.metrics.removeClient(clientID)
+	}()
+	return conn
+}
@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/store"
+	"github.com/elves/elvish/util"
+)
+
+func TestLocalClient(t *testing.T) {
+	util.InTempDir(func(string) {
+		st, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatalf("store.OpenShared -> error %v", err)
+		}
+		client := NewLocalClient(st, "")
+		defer client.Close()
+		if !client.Local() {
+			t.Errorf("client.Local() -> false")
+		}
+
+		seq, err := client.AddCmd("test cmd")
+		if err != nil {
+			t.Errorf("client.AddCmd -> error %v", err)
+		}
+		cmd, err := client.Cmd(seq)
+		if cmd != "test cmd" || err != nil {
+			t.Errorf("client.Cmd -> (%q, %v), want (test cmd, nil)", cmd, err)
+		}
+		pid, err := client.Pid()
+		if pid != os.Getpid() || err != nil {
+			t.Errorf("client.Pid -> (%v, %v), want (%v, nil)", pid, err, os.Getpid())
+		}
+
+		sub, err := client.Subscribe("chan")
+		if err != nil {
+			t.Fatalf("client.Subscribe -> error %v", err)
+		}
+		defer sub.Close()
+		n, err := client.Publish("chan", "payload")
+		if n != 1 || err != nil {
+			t.Errorf("client.Publish -> (%v, %v), want (1, nil)", n, err)
+		}
+		select {
+		case msg := <-sub.Messages():
+			if msg.Payload != "payload" {
+				t.Errorf("got message %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("message not received after 1s")
+		}
+
+		// The database is not kept open, so another client can use it.
+		st2, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatalf("store.OpenShared while in use -> error %v", err)
+		}
+		client2 := NewLocalClient(st2, "")
+		defer client2.Close()
+		cmd, err = client2.Cmd(seq)
+		if cmd != "test cmd" || err != nil {
+			t.Errorf("client2.Cmd -> (%q, %v), want (test cmd, nil)", cmd, err)
+		}
+	})
+}
+
+func TestStatusHistoryEncrypted(t *testing.T) {
+	util.InTempDir(func(string) {
+		st, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatalf("store.OpenShared -> error %v", err)
+		}
+		client := NewLocalClient(st, "")
+		defer client.Close()
+		if status, err := client.Status(); err != nil || status.HistoryEncrypted {
+			t.Errorf("client.Status -> (%v, %v), want history not encrypted", status, err)
+		}
+
+		encrypted, err := store.NewEncryptedStore(st, make([]byte, 32))
+		if err != nil {
+			t.Fatalf("store.NewEncryptedStore -> error %v", err)
+		}
+		client2 := NewLocalClient(encrypted, "")
+		defer client2.Close()
+		if status, err := client2.Status(); err != nil || !status.HistoryEncrypted {
+			t.Errorf("client.Status -> (%v, %v), want history encrypted", status, err)
+		}
+	})
+}
+
+func TestClientClose(t *testing.T) {
+	util.InTempDir(func(string) {
+		st, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatalf("store.OpenShared -> error %v", err)
+		}
+		client := NewLocalClient(st, "")
+
+		// Requests made concurrently with Close either finish before the
+		// client is closed or fail with ErrClientClosed.
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.AddCmd("cmd")
+				if err != nil && err != ErrClientClosed {
+					t.Errorf("client.AddCmd -> error %v", err)
+				}
+			}()
+		}
+		if err := client.Close(); err != nil {
+			t.Errorf("client.Close -> error %v", err)
+		}
+		wg.Wait()
+
+		if _, err := client.AddCmd("cmd"); err != ErrClientClosed {
+			t.Errorf("client.AddCmd after Close -> error %v, want %v", err, ErrClientClosed)
+		}
+		if err := client.Close(); err != nil {
+			t.Errorf("client.Close again -> error %v", err)
+		}
+	})
+}
+
+func TestLocalClientSwitchesToDaemon(t *testing.T) {
+	util.InTempDir(func(string) {
+		shared, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatalf("store.OpenShared -> error %v", err)
+		}
+		client := NewLocalClient(shared, "sock")
+		defer client.Close()
+		if _, err := client.AddCmd("local cmd"); err != nil {
+			t.Errorf("client.AddCmd -> error %v", err)
+		}
+
+		// A daemon starts and keeps the database open.
+		st, err := store.Open("", "db")
+		if err != nil {
+			t.Fatalf("store.Open -> error %v", err)
+		}
+		defer st.Close()
+		l := serveStandIn(t, "sock", newService(st, nil))
+		defer l.Close()
+
+		seq, err := client.AddCmd("daemon cmd")
+		if err != nil {
+			t.Fatalf("client.AddCmd while daemon is running -> error %v", err)
+		}
+		if client.Local() {
+			t.Errorf("client.Local() -> true after daemon locked the database")
+		}
+		if cmd, err := st.Cmd(seq); cmd != "daemon cmd" || err != nil {
+			t.Errorf("daemon store Cmd -> (%q, %v), want (daemon cmd, nil)", cmd, err)
+		}
+	})
+}
+
+func TestServiceReopen(t *testing.T) {
+	defer func(d time.Duration) { reopenInterval = d }(reopenInterval)
+	reopenInterval = 10 * time.Millisecond
+
+	util.InTempDir(func(string) {
+		// A session without a daemon holds the lock while the daemon starts.
+		locker, err := store.Open("", "db")
+		if err != nil {
+			t.Fatalf("store.Open -> error %v", err)
+		}
+		open := func() (store.DBStore, error) { return store.Open("", "db") }
+		_, err = open()
+		if !store.IsLocked(err) {
+			t.Fatalf("open while locked -> error %v, want a lock error", err)
+		}
+		service := newService(nil, err)
+		go service.reopen(open)
+		if err := service.Version(&VersionRequest{}, &VersionResponse{}); err == nil {
+			t.Errorf("Version while locked -> no error")
+		}
+
+		locker.Close()
+		deadline := time.Now().Add(5 * time.Second)
+		for service.Version(&VersionRequest{}, &VersionResponse{}) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("store not reopened after 5s")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := service.closeStore(); err != nil {
+			t.Errorf("closeStore -> error %v", err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net/rpc"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elves/elvish/util"
+)
+
+// metrics keeps track of the clients of the daemon and statistics of their
+// requests, which are reported by the Status request.
+type metrics struct {
+	mutex        sync.Mutex
+	started      time.Time
+	clients      map[int]*ClientInfo
+	nextClientID int
+	methods      map[string]*MethodStats
+}
+
+func newMetrics() *metrics {
+	return &metrics{started: time.Now(),
+		clients: make(map[int]*ClientInfo), methods: make(map[string]*MethodStats)}
+}
+
+// addClient records a new client and returns its ID.
+func (m *metrics) addClient(pid int) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nextClientID++
+	id := m.nextClientID
+	m.clients[id] = &ClientInfo{ID: id, Pid: pid, Connected: time.Now()}
+	return id
+}
+
+func (m *metrics) removeClient(id int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.clients, id)
+}
+
+// record records a request made by a client.
+func (m *metrics) record(clientID int, method string, latency time.Duration, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if client, ok := m.clients[clientID]; ok {
+		client.Requests++
+	}
+	stats, ok := m.methods[method]
+	if !ok {
+		stats = &MethodStats{Method: method}
+		m.methods[method] = stats
+	}
+	stats.Count++
+	if failed {
+		stats.Errors++
+	}
+	stats.Total += latency
+	if latency > stats.Max {
+		stats.Max = latency
+	}
+}
+
+// snapshot returns the clients ordered by IDs, and the statistics of requests
+// ordered by method names.
+func (m *metrics) snapshot() ([]ClientInfo, []MethodStats) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	clients := make([]ClientInfo, 0, len(m.clients))
+	for _, client := range m.clients {
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	methods := make([]MethodStats, 0, len(m.methods))
+	for _, stats := range m.methods {
+		methods = append(methods, *stats)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return clients, methods
+}
+
+// metricsCodec wraps a rpc.ServerCodec, recording the requests it serves in
+// metrics.
+type metricsCodec struct {
+	rpc.ServerCodec
+	metrics  *metrics
+	clientID int
+
+	// Methods and start times of requests being served, keyed by their
+	// sequence numbers. ReadRequestHeader and WriteResponse are called from
+	// different goroutines.
+	mutex   sync.Mutex
+	pending map[uint64]pendingRequest
+}
+
+type pendingRequest struct {
+	method string
+	start  time.Time
+}
+
+func newMetricsCodec(conn io.ReadWriteCloser, m *metrics, clientID int) *metricsCodec {
+	return &metricsCodec{newGobServerCodec(conn), m, clientID,
+		sync.Mutex{}, make(map[uint64]pendingRequest)}
+}
+
+func (c *metricsCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		method := strings.TrimPrefix(r.ServiceMethod, ServiceName+".")
+		c.mutex.Lock()
+		c.pending[r.Seq] = pendingRequest{method, time.Now()}
+		c.mutex.Unlock()
+	}
+	return err
+}
+
+func (c *metricsCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mutex.Lock()
+	req, ok := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mutex.Unlock()
+	if ok {
+		latency := time.Since(req.start)
+		c.metrics.record(c.clientID, req.method, latency, r.Error != "")
+		if util.GetLogLevel() >= util.LogDebug {
+			logger.Printf("client %d: %s took %v, error %q",
+				c.clientID, req.method, latency, r.Error)
+		}
+	}
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// gobServerCodec is the same as the default codec of net/rpc, which is not
+// exported.
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func newGobServerCodec(conn io.ReadWriteCloser) *gobServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{conn, gob.NewDecoder(conn), gob.NewEncoder(buf), buf, false}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	err := c.enc.Encode(r)
+	if err == nil {
+		err = c.enc.Encode(body)
+	}
+	if err != nil {
+		if c.encBuf.Flush() == nil {
+			logger.Println("rpc: gob error encoding response:", err)
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
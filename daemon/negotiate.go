@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotSupported is returned for requests that the daemon does not
+	// support, which happens when talking to an older daemon.
+	ErrNotSupported = errors.New("request not supported by daemon")
+	// ErrDaemonIncompatible is returned for requests to a daemon with an API
+	// version older than MinCompatibleVersion.
+	ErrDaemonIncompatible = errors.New("daemon is incompatible")
+)
+
+// basicMethods are RPC methods that can be used with daemons of any API
+// version, and are used for negotiation.
+var basicMethods = map[string]bool{
+	"Version": true, "Pid": true, "Capabilities": true,
+}
+
+// methodVersions records the API versions in which RPC methods first appeared,
+// for determining the capabilities of daemons that do not support the
+// Capabilities request. Every RPC method other than the basic ones must have an
+// entry; methods that predate the negotiation have MinCompatibleVersion.
+var methodVersions = map[string]int{
+	"NextCmdSeq":         MinCompatibleVersion,
+	"AddCmd":             MinCompatibleVersion,
+	"Cmd":                MinCompatibleVersion,
+	"Cmds":               MinCompatibleVersion,
+	"NextCmd":            MinCompatibleVersion,
+	"PrevCmd":            MinCompatibleVersion,
+	"AddDir":             MinCompatibleVersion,
+	"Dirs":               MinCompatibleVersion,
+	"SharedVar":          MinCompatibleVersion,
+	"SetSharedVar":       MinCompatibleVersion,
+	"DelSharedVar":       MinCompatibleVersion,
+	"CmdsWithMeta":       -96,
+	"SetCmdMeta":         -96,
+	"AddCmdWithMeta":     -96,
+	"AddCmds":            -95,
+	"RemoveCmd":          -95,
+	"DedupCmds":          -95,
+	"CompletionCache":    -94,
+	"SetCompletionCache": -94,
+	"PruneDirs":          -93,
+	"SharedVarNames":     -92,
+	"Publish":            -91,
+	"Subscribe":          -91,
+	"Poll":               -91,
+	"Unsubscribe":        -91,
+	"Capabilities":       -90,
+	"Handover":           -90,
+	"Status":             -89,
+	"DBStats":            -89,
+	"Compact":            -89,
+	"SetLogLevel":        -89,
+}
+
+// Supports returns whether the daemon supports an RPC method. The capabilities
+// of the daemon are queried upon the first call after (re)connecting.
+func (c *Client) Supports(method string) (bool, error) {
+	if c == nil {
+		return false, ErrClientNotInitialized
+	}
+	if basicMethods[method] {
+		return true, nil
+	}
+	c.capMutex.Lock()
+	negotiated, version, capabilities := c.negotiated, c.version, c.capabilities
+	c.capMutex.Unlock()
+
+	if !negotiated {
+		var err error
+		version, capabilities, err = c.negotiate()
+		if err != nil {
+			return false, err
+		}
+	}
+	if capabilities != nil {
+		return capabilities[method], nil
+	}
+	since, ok := methodVersions[method]
+	return ok && since <= version, nil
+}
+
+// DaemonVersion returns the API version of the daemon.
+func (c *Client) DaemonVersion() (int, error) {
+	if c == nil {
+		return 0, ErrClientNotInitialized
+	}
+	c.capMutex.Lock()
+	negotiated, version := c.negotiated, c.version
+	c.capMutex.Unlock()
+	if negotiated {
+		return version, nil
+	}
+	version, _, err := c.negotiate()
+	return version, err
+}
+
+func (c *Client) negotiate() (int, map[string]bool, error) {
+	version, err := c.Version()
+	if err != nil {
+		return 0, nil, err
+	}
+	if version < MinCompatibleVersion {
+		return 0, nil, ErrDaemonIncompatible
+	}
+	var capabilities map[string]bool
+	methods, err := c.Capabilities()
+	switch {
+	case err == nil:
+		capabilities = make(map[string]bool, len(methods))
+		for _, method := range methods {
+			capabilities[method] = true
+		}
+	case strings.HasPrefix(err.Error(), "rpc: can't find method"):
+		// The daemon predates the Capabilities request; capabilities are
+		// determined from its version.
+	default:
+		return 0, nil, err
+	}
+
+	c.capMutex.Lock()
+	defer c.capMutex.Unlock()
+	c.negotiated, c.version, c.capabilities = true, version, capabilities
+	return version, capabilities, nil
+}
+
+func (c *Client) resetNegotiation() {
+	c.capMutex.Lock()
+	defer c.capMutex.Unlock()
+	c.negotiated, c.version, c.capabilities = false, 0, nil
+}
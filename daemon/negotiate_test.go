@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+// oldService is an in-process stand-in for a daemon with an older API version,
+// which supports only a few requests.
+type oldService struct {
+	version int
+	// If not nil, returned by Capabilities.
+	capabilities []string
+	// If not nil, returned by AddCmd.
+	addCmdErr error
+	handover  func() error
+}
+
+func (s *oldService) Version(req *VersionRequest, res *VersionResponse) error {
+	res.Version = s.version
+	return nil
+}
+
+func (s *oldService) Pid(req *PidRequest, res *PidResponse) error {
+	res.Pid = syscall.Getpid()
+	return nil
+}
+
+func (s *oldService) Capabilities(req *CapabilitiesRequest, res *CapabilitiesResponse) error {
+	if s.capabilities == nil {
+		return errors.New("rpc: can't find method Daemon.Capabilities")
+	}
+	res.Methods = s.capabilities
+	return nil
+}
+
+func (s *oldService) AddCmd(req *AddCmdRequest, res *AddCmdResponse) error {
+	if s.addCmdErr != nil {
+		return s.addCmdErr
+	}
+	res.Seq = 42
+	return nil
+}
+
+func (s *oldService) Handover(req *HandoverRequest, res *HandoverResponse) error {
+	err := s.handover()
+	if err == nil {
+		s.addCmdErr = ErrHandedOver
+	}
+	return err
+}
+
+// serveStandIn serves a stand-in service on the socket, until the returned
+// listener is closed.
+func serveStandIn(t *testing.T, sockpath string, service interface{}) net.Listener {
+	listener, err := listen(sockpath)
+	if err != nil {
+		t.Fatalf("listen(%q) -> error %v", sockpath, err)
+	}
+	server := rpc.NewServer()
+	server.RegisterName(ServiceName, service)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+	return listener
+}
+
+func TestNegotiation(t *testing.T) {
+	util.InTempDir(func(string) {
+		// A daemon that predates the Capabilities request.
+		l := serveStandIn(t, "old", &oldService{version: -95})
+		defer l.Close()
+		client := NewClient("old")
+		defer client.Close()
+
+		for method, want := range map[string]bool{
+			"AddCmd": true, "CmdsWithMeta": true, "AddCmds": true,
+			"DedupCmds": true, "CompletionCache": false, "PruneDirs": false,
+			"Subscribe": false, "Handover": false, "NoSuchMethod": false,
+		} {
+			supported, err := client.Supports(method)
+			if supported != want || err != nil {
+				t.Errorf("Supports(%q) -> (%v, %v), want (%v, nil)", method, supported, err, want)
+			}
+		}
+		seq, err := client.AddCmd("cmd")
+		if seq != 42 || err != nil {
+			t.Errorf("AddCmd -> (%v, %v), want (42, nil)", seq, err)
+		}
+		if _, err := client.PruneDirs(); err != ErrNotSupported {
+			t.Errorf("PruneDirs -> error %v, want %v", err, ErrNotSupported)
+		}
+		if _, err := client.Subscribe("chan"); err != ErrNotSupported {
+			t.Errorf("Subscribe -> error %v, want %v", err, ErrNotSupported)
+		}
+
+		// A daemon that reports its capabilities.
+		l2 := serveStandIn(t, "new", &oldService{
+			version: Version, capabilities: []string{"Version", "AddCmd"}})
+		defer l2.Close()
+		client2 := NewClient("new")
+		defer client2.Close()
+		if supported, _ := client2.Supports("AddCmd"); !supported {
+			t.Errorf("Supports(AddCmd) -> false, want true")
+		}
+		if supported, _ := client2.Supports("PruneDirs"); supported {
+			t.Errorf("Supports(PruneDirs) -> true, want false")
+		}
+		// Adding a command with metadata falls back to AddCmd.
+		seq, err = client2.AddCmdWithMeta("cmd", storedefs.CmdMeta{Dir: "/"})
+		if seq != 42 || err != nil {
+			t.Errorf("AddCmdWithMeta -> (%v, %v), want (42, nil)", seq, err)
+		}
+
+		// A daemon that is too old.
+		l3 := serveStandIn(t, "ancient", &oldService{version: MinCompatibleVersion - 1})
+		defer l3.Close()
+		client3 := NewClient("ancient")
+		defer client3.Close()
+		if _, err := client3.AddCmd("cmd"); err != ErrDaemonIncompatible {
+			t.Errorf("AddCmd -> error %v, want %v", err, ErrDaemonIncompatible)
+		}
+		// Basic requests still work, for example to kill the daemon.
+		if _, err := client3.Pid(); err != nil {
+			t.Errorf("Pid -> error %v, want nil", err)
+		}
+	})
+}
+
+func TestMethodVersions(t *testing.T) {
+	methods := make(map[string]bool)
+	serviceType := reflect.TypeOf(&Service{})
+	for i := 0; i < serviceType.NumMethod(); i++ {
+		method := serviceType.Method(i).Name
+		methods[method] = true
+		if _, ok := methodVersions[method]; !ok && !basicMethods[method] {
+			t.Errorf("RPC method %s has no entry in methodVersions", method)
+		}
+	}
+	for method, version := range methodVersions {
+		if !methods[method] {
+			t.Errorf("methodVersions has an entry for nonexistent method %s", method)
+		}
+		if version < MinCompatibleVersion || version > Version {
+			t.Errorf("methodVersions[%q] = %d, not between %d and %d",
+				method, version, MinCompatibleVersion, Version)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// +build linux,go1.9
+
+package daemon
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerPid returns the process ID of the other end of a Unix socket connection,
+// or 0 if it cannot be determined.
+func peerPid(conn net.Conn) int {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	var pid int
+	raw.Control(func(fd uintptr) {
+		cred, err := syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+		if err == nil {
+			pid = int(cred.Pid)
+		}
+	})
+	return pid
+}
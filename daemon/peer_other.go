@@ -0,0 +1,11 @@
+// +build !linux !go1.9
+
+package daemon
+
+import "net"
+
+// peerPid returns 0, since the process ID of the other end of a connection is
+// only known on Linux, with Go 1.9 or later.
+func peerPid(conn net.Conn) int {
+	return 0
+}
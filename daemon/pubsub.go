@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Messages published to a channel are queued for each subscription of the
+// channel, and picked up by long polling. A Poll request returns as soon as
+// there are messages in the queue, or after pollTimeout with no messages.
+
+const (
+	pollTimeout = 10 * time.Second
+	// Subscriptions that have not been polled for this long are assumed to
+	// belong to clients that went away without unsubscribing.
+	subscriptionExpiry = 3 * pollTimeout
+	// Maximum number of queued messages of a subscription. When the queue is
+	// full, the oldest message is dropped.
+	maxQueuedMessages = 1024
+)
+
+// ErrNoSubscription is returned by Poll and Unsubscribe when the subscription
+// does not exist.
+var ErrNoSubscription = errors.New("no such subscription")
+
+// Message is a message published to a channel.
+type Message struct {
+	Channel string
+	Payload string
+	// Process ID of the publisher.
+	Pid int
+}
+
+type subscription struct {
+	channels map[string]bool
+	queue    []Message
+	// Signaled when messages are queued or the subscription is canceled.
+	wake     chan struct{}
+	lastPoll time.Time
+	polling  bool
+}
+
+// pubSub keeps track of subscriptions and delivers published messages.
+type pubSub struct {
+	mutex  sync.Mutex
+	nextID int
+	subs   map[int]*subscription
+}
+
+func newPubSub() *pubSub {
+	return &pubSub{subs: make(map[int]*subscription)}
+}
+
+func (ps *pubSub) subscribe(channels []string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.expire()
+
+	sub := &subscription{
+		channels: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+		lastPoll: time.Now(),
+	}
+	for _, channel := range channels {
+		sub.channels[channel] = true
+	}
+	ps.nextID++
+	ps.subs[ps.nextID] = sub
+	return ps.nextID
+}
+
+func (ps *pubSub) unsubscribe(id int) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	sub, ok := ps.subs[id]
+	if !ok {
+		return ErrNoSubscription
+	}
+	delete(ps.subs, id)
+	close(sub.wake)
+	return nil
+}
+
+// publish queues a message for all subscriptions of its channel and returns
+// the number of such subscriptions.
+func (ps *pubSub) publish(msg Message) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.expire()
+
+	n := 0
+	for _, sub := range ps.subs {
+		if !sub.channels[msg.Channel] {
+			continue
+		}
+		if len(sub.queue) == maxQueuedMessages {
+			sub.queue = sub.queue[1:]
+		}
+		sub.queue = append(sub.queue, msg)
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+		n++
+	}
+	return n
+}
+
+// poll waits until there are queued messages for a subscription, and returns
+// them. It returns an empty slice if there are no messages after timeout.
+func (ps *pubSub) poll(id int, timeout time.Duration) ([]Message, error) {
+	ps.mutex.Lock()
+	sub, ok := ps.subs[id]
+	if !ok {
+		ps.mutex.Unlock()
+		return nil, ErrNoSubscription
+	}
+	sub.polling = true
+	ps.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		ps.mutex.Lock()
+		if _, ok := ps.subs[id]; !ok {
+			ps.mutex.Unlock()
+			return nil, ErrNoSubscription
+		}
+		if len(sub.queue) > 0 {
+			msgs := sub.queue
+			sub.queue = nil
+			sub.polling = false
+			sub.lastPoll = time.Now()
+			ps.mutex.Unlock()
+			return msgs, nil
+		}
+		ps.mutex.Unlock()
+
+		select {
+		case <-sub.wake:
+		case <-timer.C:
+			ps.mutex.Lock()
+			sub.polling = false
+			sub.lastPoll = time.Now()
+			ps.mutex.Unlock()
+			return []Message{}, nil
+		}
+	}
+}
+
+// cancelAll removes all subscriptions. Pending polls fail with
+// ErrNoSubscription.
+func (ps *pubSub) cancelAll() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	for id, sub := range ps.subs {
+		delete(ps.subs, id)
+		close(sub.wake)
+	}
+}
+
+// expire removes subscriptions that have not been polled for a long time. It
+// must be called with ps.mutex held.
+func (ps *pubSub) expire() {
+	now := time.Now()
+	for id, sub := range ps.subs {
+		if !sub.polling && now.Sub(sub.lastPoll) > subscriptionExpiry {
+			delete(ps.subs, id)
+			close(sub.wake)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	ps := newPubSub()
+	idA := ps.subscribe([]string{"a"})
+	idAB := ps.subscribe([]string{"a", "b"})
+
+	if n := ps.publish(Message{"a", "1", 0}); n != 2 {
+		t.Errorf("publish to a -> %d, want 2", n)
+	}
+	if n := ps.publish(Message{"b", "2", 0}); n != 1 {
+		t.Errorf("publish to b -> %d, want 1", n)
+	}
+	if n := ps.publish(Message{"c", "3", 0}); n != 0 {
+		t.Errorf("publish to c -> %d, want 0", n)
+	}
+
+	msgs, err := ps.poll(idA, time.Second)
+	wantMsgs := []Message{{"a", "1", 0}}
+	if !reflect.DeepEqual(msgs, wantMsgs) || err != nil {
+		t.Errorf("poll(idA) -> (%v, %v), want (%v, nil)", msgs, err, wantMsgs)
+	}
+	msgs, err = ps.poll(idAB, time.Second)
+	wantMsgs = []Message{{"a", "1", 0}, {"b", "2", 0}}
+	if !reflect.DeepEqual(msgs, wantMsgs) || err != nil {
+		t.Errorf("poll(idAB) -> (%v, %v), want (%v, nil)", msgs, err, wantMsgs)
+	}
+
+	// Polling with no messages times out.
+	msgs, err = ps.poll(idA, time.Millisecond)
+	if len(msgs) != 0 || err != nil {
+		t.Errorf("poll(idA) -> (%v, %v), want no messages and no error", msgs, err)
+	}
+
+	// Pending polls are woken up by publishing.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ps.publish(Message{"a", "4", 0})
+	}()
+	msgs, err = ps.poll(idA, time.Second)
+	wantMsgs = []Message{{"a", "4", 0}}
+	if !reflect.DeepEqual(msgs, wantMsgs) || err != nil {
+		t.Errorf("poll(idA) -> (%v, %v), want (%v, nil)", msgs, err, wantMsgs)
+	}
+
+	// Pending polls are woken up by unsubscribing.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ps.unsubscribe(idA)
+	}()
+	_, err = ps.poll(idA, time.Second)
+	if err != ErrNoSubscription {
+		t.Errorf("poll after unsubscribe -> error %v, want %v", err, ErrNoSubscription)
+	}
+	if err := ps.unsubscribe(idA); err != ErrNoSubscription {
+		t.Errorf("unsubscribe twice -> error %v, want %v", err, ErrNoSubscription)
+	}
+}
+
+func TestPubSubDropsOldMessages(t *testing.T) {
+	ps := newPubSub()
+	id := ps.subscribe([]string{"a"})
+	for i := 0; i < maxQueuedMessages+1; i++ {
+		ps.publish(Message{"a", "", i})
+	}
+	msgs, _ := ps.poll(id, time.Second)
+	if len(msgs) != maxQueuedMessages || msgs[0].Pid != 1 {
+		t.Errorf("got %d messages starting with %v, want %d starting with pid 1",
+			len(msgs), msgs[0], maxQueuedMessages)
+	}
+}
+
+func TestPubSubExpiresSubscriptions(t *testing.T) {
+	ps := newPubSub()
+	id := ps.subscribe([]string{"a"})
+	ps.subs[id].lastPoll = time.Now().Add(-2 * subscriptionExpiry)
+	if n := ps.publish(Message{"a", "", 0}); n != 0 {
+		t.Errorf("publish -> %d, want 0", n)
+	}
+	if _, err := ps.poll(id, time.Millisecond); err != ErrNoSubscription {
+		t.Errorf("poll -> error %v, want %v", err, ErrNoSubscription)
+	}
+}
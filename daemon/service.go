@@ -1,35 +1,92 @@
 package daemon
 
 import (
+	"errors"
+	"io"
+	"net"
 	"net/rpc"
 	"os"
 	"os/signal"
+	"reflect"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/elves/elvish/store"
 	"github.com/elves/elvish/store/storedefs"
 )
 
+// reopenInterval is how often the daemon tries to open the database when it is
+// locked by other processes.
+var reopenInterval = time.Second
+
+// errStoreClosed is returned for requests after the daemon has closed the
+// store when quitting.
+var errStoreClosed = errors.New("store closed")
+
 // Serve runs the daemon service, listening on the socket specified by sockpath
-// and serving data from dbpath. It quits upon receiving SIGTERM, SIGINT or when
-// all active clients have disconnected.
-func Serve(sockpath, dbpath string) {
+// and serving data from dbpath with the given backend, or the detected backend
+// if it is empty (see store.Open). If historyKeyPath is not empty, the command
+// history is encrypted with the key in the file (see store.ReadKeyFile). It
+// quits upon receiving SIGTERM, SIGINT or
+// when all active clients have disconnected.
+//
+// If an older daemon is already serving on the socket, Serve takes over its
+// socket and database; see takeOver. If the database is locked by sessions
+// without a daemon, Serve keeps trying to open it; see Service.reopen.
+func Serve(sockpath, dbpath, backend, historyKeyPath string) {
 	logger.Println("pid is", syscall.Getpid())
-	logger.Println("going to listen", sockpath)
-	listener, err := listen(sockpath)
+
+	listener, err := takeOver(sockpath)
 	if err != nil {
-		logger.Printf("failed to listen on %s: %v", sockpath, err)
+		logger.Printf("cannot take over from the running daemon: %v", err)
 		logger.Println("aborting")
 		os.Exit(2)
 	}
+	tookOver := listener != nil
+	if !tookOver {
+		logger.Println("going to listen", sockpath)
+		listener, err = listen(sockpath)
+		if err != nil {
+			logger.Printf("failed to listen on %s: %v", sockpath, err)
+			logger.Println("aborting")
+			os.Exit(2)
+		}
+	}
 
-	st, err := store.NewStore(dbpath)
+	open := func() (store.DBStore, error) {
+		st, err := store.Open(backend, dbpath)
+		if err == nil && historyKeyPath != "" {
+			st, err = encrypt(st, historyKeyPath)
+		}
+		return st, err
+	}
+	st, err := open()
 	if err != nil {
 		logger.Printf("failed to create storage: %v", err)
 		logger.Printf("serving anyway")
 	}
 
+	if tookOver {
+		err := os.Rename(listener.Addr().String(), sockpath)
+		if err != nil {
+			logger.Printf("failed to replace socket %s: %v", sockpath, err)
+			logger.Println("aborting")
+			os.Exit(2)
+		}
+		logger.Println("took over socket", sockpath)
+	}
+	sockInfo, statErr := os.Stat(sockpath)
+	if statErr != nil {
+		logger.Printf("failed to stat socket %s: %v", sockpath, statErr)
+	}
+
+	service := newService(st, err)
+	if store.IsLocked(err) {
+		// Sessions without a daemon only lock the database briefly, and switch
+		// to the daemon once it has the database open.
+		go service.reopen(open)
+	}
 	quitSignals := make(chan os.Signal)
 	quitChan := make(chan struct{})
 	signal.Notify(quitSignals, syscall.SIGTERM, syscall.SIGINT)
@@ -39,12 +96,28 @@ func Serve(sockpath, dbpath string) {
 			logger.Printf("received signal %s", sig)
 		case <-quitChan:
 			logger.Printf("No active client, daemon exit")
+		case <-service.handedOver:
+			// The database has been closed by the Handover call. Keep
+			// accepting connections (whose requests will fail with
+			// ErrHandedOver) until the new daemon has replaced the socket,
+			// and leave the new socket alone.
+			logger.Println("handed over, waiting for new daemon")
+			waitForNewSock(sockpath, sockInfo)
+			if ul, ok := listener.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+			}
+			err := listener.Close()
+			if err != nil {
+				logger.Printf("failed to close listener: %v", err)
+			}
+			logger.Println("listener closed, waiting for clients to reconnect")
+			return
 		}
 		err := os.Remove(sockpath)
 		if err != nil {
 			logger.Printf("failed to remove socket %s: %v", sockpath, err)
 		}
-		err = st.Close()
+		err = service.closeStore()
 		if err != nil {
 			logger.Printf("failed to close storage: %v", err)
 		}
@@ -55,8 +128,8 @@ func Serve(sockpath, dbpath string) {
 		logger.Println("listener closed, waiting to exit")
 	}()
 
-	service := &Service{st, err}
-	rpc.RegisterName(ServiceName, service)
+	server := rpc.NewServer()
+	server.RegisterName(ServiceName, service)
 
 	logger.Println("starting to serve RPC calls")
 
@@ -82,25 +155,108 @@ func Serve(sockpath, dbpath string) {
 			activeClient.Add(1)
 		}
 		go func() {
-			rpc.DefaultServer.ServeConn(conn)
+			clientID := service.metrics.addClient(peerPid(conn))
+			server.ServeCodec(newMetricsCodec(conn, service.metrics, clientID))
+			service.metrics.removeClient(clientID)
 			activeClient.Done()
 		}()
 	}
 
+	if conn := service.newDaemonConn(); conn != nil {
+		// Keep the connection to the new daemon until all clients have
+		// disconnected; see comments in handover.go.
+		<-quitChan
+		conn.Close()
+	}
 	logger.Println("exiting")
 }
 
+// encrypt wraps st to encrypt the command history with the key in the given
+// file. If the key cannot be read, st is closed, so that requests fail instead
+// of storing the command history unencrypted.
+func encrypt(st store.DBStore, keyPath string) (store.DBStore, error) {
+	key, err := store.ReadKeyFile(keyPath)
+	if err == nil {
+		var encrypted store.DBStore
+		encrypted, err = store.NewEncryptedStore(st, key)
+		if err == nil {
+			return encrypted, nil
+		}
+	}
+	st.Close()
+	return nil, err
+}
+
 // Service provides the daemon RPC service. It is suitable as a service for
 // net/rpc.
+//
+// Requests that access the store hold mutex for reading, so that Handover can
+// wait for them to finish.
 type Service struct {
-	store storedefs.Store
-	err   error
+	mutex      sync.RWMutex
+	store      storedefs.Store
+	err        error
+	pubsub     *pubSub
+	handedOver chan struct{}
+	// Connection to the new daemon after handing over.
+	newConn net.Conn
+	metrics *metrics
+}
+
+func newService(st storedefs.Store, err error) *Service {
+	return &Service{store: st, err: err, pubsub: newPubSub(),
+		handedOver: make(chan struct{}), metrics: newMetrics()}
+}
+
+// reopen keeps trying to open the store until the database is no longer
+// locked by other processes, and uses the store from then on.
+func (s *Service) reopen(open func() (store.DBStore, error)) {
+	for {
+		time.Sleep(reopenInterval)
+		st, err := open()
+		if store.IsLocked(err) {
+			logger.Printf("database is still locked: %v", err)
+			continue
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.err == ErrHandedOver || s.err == errStoreClosed {
+			if err == nil {
+				st.Close()
+			}
+			return
+		}
+		s.store, s.err = st, err
+		if err != nil {
+			logger.Printf("failed to create storage: %v", err)
+		} else {
+			logger.Println("opened storage after the database was unlocked")
+		}
+		return
+	}
+}
+
+// closeStore closes the store when the daemon quits.
+func (s *Service) closeStore() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err == ErrHandedOver {
+		// Already closed by Handover.
+		return nil
+	}
+	s.err = errStoreClosed
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 // Implementations of RPC methods.
 
 // Version returns the API version number.
 func (s *Service) Version(req *VersionRequest, res *VersionResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -114,7 +270,60 @@ func (s *Service) Pid(req *PidRequest, res *PidResponse) error {
 	return nil
 }
 
+// Capabilities returns the names of all RPC methods of the daemon.
+func (s *Service) Capabilities(req *CapabilitiesRequest, res *CapabilitiesResponse) error {
+	t := reflect.TypeOf(s)
+	for i := 0; i < t.NumMethod(); i++ {
+		res.Methods = append(res.Methods, t.Method(i).Name)
+	}
+	return nil
+}
+
+// Handover closes the store after all pending requests have finished, so that
+// a new daemon can open it. Subsequent requests fail with ErrHandedOver, and
+// the daemon quits after the new daemon has taken over the socket.
+func (s *Service) Handover(req *HandoverRequest, res *HandoverResponse) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err == ErrHandedOver {
+		return s.err
+	}
+	if closer, ok := s.store.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			return err
+		}
+	}
+	s.err = ErrHandedOver
+	conn, err := dial(req.SockPath)
+	if err != nil {
+		logger.Printf("failed to connect to new daemon: %v", err)
+	}
+	s.newConn = conn
+	s.pubsub.cancelAll()
+	close(s.handedOver)
+	return nil
+}
+
+// newDaemonConn returns the connection to the new daemon made by Handover.
+func (s *Service) newDaemonConn() net.Conn {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.newConn
+}
+
+func (s *Service) checkHandedOver() error {
+	select {
+	case <-s.handedOver:
+		return ErrHandedOver
+	default:
+		return nil
+	}
+}
+
 func (s *Service) NextCmdSeq(req *NextCmdSeqRequest, res *NextCmdSeqResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -124,6 +333,8 @@ func (s *Service) NextCmdSeq(req *NextCmdSeqRequest, res *NextCmdSeqResponse) er
 }
 
 func (s *Service) AddCmd(req *AddCmdRequest, res *AddCmdResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -132,7 +343,49 @@ func (s *Service) AddCmd(req *AddCmdRequest, res *AddCmdResponse) error {
 	return err
 }
 
+func (s *Service) AddCmdWithMeta(req *AddCmdWithMetaRequest, res *AddCmdWithMetaResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	seq, err := s.store.AddCmdWithMeta(req.Text, req.Meta)
+	res.Seq = seq
+	return err
+}
+
+func (s *Service) AddCmds(req *AddCmdsRequest, res *AddCmdsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.AddCmds(req.Cmds)
+}
+
+func (s *Service) RemoveCmd(req *RemoveCmdRequest, res *RemoveCmdResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.RemoveCmd(req.Seq)
+}
+
+func (s *Service) DedupCmds(req *DedupCmdsRequest, res *DedupCmdsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	removed, err := s.store.DedupCmds()
+	res.Removed = removed
+	return err
+}
+
 func (s *Service) Cmd(req *CmdRequest, res *CmdResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -142,6 +395,8 @@ func (s *Service) Cmd(req *CmdRequest, res *CmdResponse) error {
 }
 
 func (s *Service) Cmds(req *CmdsRequest, res *CmdsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -151,6 +406,8 @@ func (s *Service) Cmds(req *CmdsRequest, res *CmdsResponse) error {
 }
 
 func (s *Service) NextCmd(req *NextCmdRequest, res *NextCmdResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -160,6 +417,8 @@ func (s *Service) NextCmd(req *NextCmdRequest, res *NextCmdResponse) error {
 }
 
 func (s *Service) PrevCmd(req *PrevCmdRequest, res *PrevCmdResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -168,23 +427,60 @@ func (s *Service) PrevCmd(req *PrevCmdRequest, res *PrevCmdResponse) error {
 	return err
 }
 
+func (s *Service) CmdsWithMeta(req *CmdsWithMetaRequest, res *CmdsWithMetaResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	cmds, err := s.store.CmdsWithMeta(req.From, req.Upto)
+	res.Cmds = cmds
+	return err
+}
+
+func (s *Service) SetCmdMeta(req *SetCmdMetaRequest, res *SetCmdMetaResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.SetCmdMeta(req.Seq, req.Meta)
+}
+
 func (s *Service) AddDir(req *AddDirRequest, res *AddDirResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
-	return s.store.AddDir(req.Dir, req.IncFactor)
+	return s.store.AddDir(req.Dir, req.IncFactor, req.HalfLife)
 }
 
 func (s *Service) Dirs(req *DirsRequest, res *DirsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
-	dirs, err := s.store.Dirs(req.Blacklist)
+	dirs, err := s.store.Dirs(req.Blacklist, req.HalfLife)
 	res.Dirs = dirs
 	return err
 }
 
+func (s *Service) PruneDirs(req *PruneDirsRequest, res *PruneDirsResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	pruned, err := s.store.PruneDirs()
+	res.Pruned = pruned
+	return err
+}
+
 func (s *Service) SharedVar(req *SharedVarRequest, res *SharedVarResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -193,7 +489,20 @@ func (s *Service) SharedVar(req *SharedVarRequest, res *SharedVarResponse) error
 	return err
 }
 
+func (s *Service) SharedVarNames(req *SharedVarNamesRequest, res *SharedVarNamesResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	names, err := s.store.SharedVarNames()
+	res.Names = names
+	return err
+}
+
 func (s *Service) SetSharedVar(req *SetSharedVarRequest, res *SetSharedVarResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
@@ -201,8 +510,61 @@ func (s *Service) SetSharedVar(req *SetSharedVarRequest, res *SetSharedVarRespon
 }
 
 func (s *Service) DelSharedVar(req *DelSharedVarRequest, res *DelSharedVarResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	if s.err != nil {
 		return s.err
 	}
 	return s.store.DelSharedVar(req.Name)
 }
+
+func (s *Service) CompletionCache(req *CompletionCacheRequest, res *CompletionCacheResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	value, err := s.store.CompletionCache(req.Key)
+	res.Value = value
+	return err
+}
+
+func (s *Service) SetCompletionCache(req *SetCompletionCacheRequest, res *SetCompletionCacheResponse) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.SetCompletionCache(req.Key, req.Value)
+}
+
+// Pub/sub methods. They do not depend on the store and work even if the store
+// could not be opened.
+
+func (s *Service) Publish(req *PublishRequest, res *PublishResponse) error {
+	if err := s.checkHandedOver(); err != nil {
+		return err
+	}
+	res.Delivered = s.pubsub.publish(req.Message)
+	return nil
+}
+
+func (s *Service) Subscribe(req *SubscribeRequest, res *SubscribeResponse) error {
+	if err := s.checkHandedOver(); err != nil {
+		return err
+	}
+	res.ID = s.pubsub.subscribe(req.Channels)
+	return nil
+}
+
+// Poll blocks until there are messages for the subscription, or a timeout
+// expires, in which case there are no messages in the response.
+func (s *Service) Poll(req *PollRequest, res *PollResponse) error {
+	msgs, err := s.pubsub.poll(req.ID, pollTimeout)
+	res.Messages = msgs
+	return err
+}
+
+func (s *Service) Unsubscribe(req *UnsubscribeRequest, res *UnsubscribeResponse) error {
+	return s.pubsub.unsubscribe(req.ID)
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+)
+
+var errSubscriptionClosed = errors.New("subscription closed")
+
+// Publish publishes a message with the given payload to a channel. It returns
+// the number of subscriptions the message was delivered to.
+func (c *Client) Publish(channel, payload string) (int, error) {
+	req := &PublishRequest{Message{channel, payload, os.Getpid()}}
+	res := &PublishResponse{}
+	err := c.call("Publish", req, res)
+	return res.Delivered, err
+}
+
+// Subscription receives messages published to some channels. Since waiting for
+// messages blocks, it uses a connection of its own instead of that of the
+// Client. When the daemon hands over to a new daemon, the Subscription
+// subscribes to the same channels on the new daemon.
+type Subscription struct {
+	connect   func() (net.Conn, error)
+	channels  []string
+	messages  chan Message
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex     sync.Mutex
+	rpcClient *rpc.Client
+	id        int
+}
+
+// Subscribe subscribes to the given channels.
+func (c *Client) Subscribe(channels ...string) (*Subscription, error) {
+	if c == nil {
+		return nil, ErrClientNotInitialized
+	}
+	supported, err := c.Supports("Subscribe")
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, ErrNotSupported
+	}
+	sub := &Subscription{
+		connect: c.connect, channels: channels,
+		messages: make(chan Message), closed: make(chan struct{})}
+	err = sub.subscribe()
+	if err != nil {
+		return nil, err
+	}
+	go sub.poll()
+	return sub, nil
+}
+
+// subscribe makes a new connection and subscribes on it.
+func (s *Subscription) subscribe() error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	rc := rpc.NewClient(conn)
+	req := &SubscribeRequest{s.channels}
+	res := &SubscribeResponse{}
+	err = rc.Call(ServiceName+".Subscribe", req, res)
+	if err != nil {
+		rc.Close()
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.closed:
+		// Closed while subscribing.
+		rc.Close()
+		return errSubscriptionClosed
+	default:
+	}
+	s.rpcClient, s.id = rc, res.ID
+	return nil
+}
+
+// resubscribe subscribes again after the subscription has been lost, typically
+// because the daemon has handed over to a new one. It returns whether it has
+// succeeded.
+func (s *Subscription) resubscribe() bool {
+	// The old connection is closed only after subscribing again, so that the
+	// new daemon does not quit in between; see Serve.
+	s.mutex.Lock()
+	old := s.rpcClient
+	s.mutex.Unlock()
+	defer old.Close()
+	for i := 0; i < maxHandoverWaits; i++ {
+		select {
+		case <-s.closed:
+			return false
+		case <-time.After(handoverPollInterval):
+		}
+		if s.subscribe() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Messages returns a channel on which received messages are sent. The channel
+// is closed when the subscription is closed or the daemon goes away.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *Subscription) poll() {
+	defer close(s.messages)
+	for {
+		s.mutex.Lock()
+		rc, id := s.rpcClient, s.id
+		s.mutex.Unlock()
+		req := &PollRequest{id}
+		res := &PollResponse{}
+		err := rc.Call(ServiceName+".Poll", req, res)
+		if err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			if !s.resubscribe() {
+				return
+			}
+			continue
+		}
+		for _, msg := range res.Messages {
+			select {
+			case s.messages <- msg:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+// Close cancels the subscription and closes its connection. It is safe to
+// call Close multiple times.
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		// Unsubscribing wakes up the pending Poll call, so that the polling
+		// goroutine quits.
+		s.rpcClient.Call(ServiceName+".Unsubscribe", &UnsubscribeRequest{s.id}, &UnsubscribeResponse{})
+		err = s.rpcClient.Close()
+	})
+	return err
+}
@@ -3,6 +3,7 @@ package edit
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 	"unsafe"
 
@@ -151,12 +152,18 @@ func installModules(builtin eval.Ns, ed *Editor) {
 
 	// Functions.
 	eval.AddBuiltinFns(ns,
+		(&eval.BuiltinFn{"edit:add-help-completer", addHelpCompleter}).DeclareOpts("man"),
+		&eval.BuiltinFn{"edit:arguments-completer", makeArgumentsCompleter},
+		(&eval.BuiltinFn{"edit:bash-completer", makeBashCompleter}).DeclareOpts("script", "bash"),
 		&eval.BuiltinFn{"edit:binding-table", makeBindingTable},
 		&eval.BuiltinFn{"edit:command-history", CommandHistory},
+		(&eval.BuiltinFn{"edit:help-completer", makeHelpCompleter}).DeclareOpts("man"),
 		&eval.BuiltinFn{"edit:complete-getopt", complGetopt},
-		&eval.BuiltinFn{"edit:complex-candidate", outputComplexCandidate},
+		(&eval.BuiltinFn{"edit:complex-candidate", outputComplexCandidate}).DeclareOpts(
+			"code-suffix", "display-suffix", "style", "description", "group", "sort-key"),
 		&eval.BuiltinFn{"edit:insert-at-dot", InsertAtDot},
 		&eval.BuiltinFn{"edit:replace-input", ReplaceInput},
+		(&eval.BuiltinFn{"edit:similar-commands", similarCommands}).DeclareOpts("max-distance"),
 		&eval.BuiltinFn{"edit:styled", styled},
 		&eval.BuiltinFn{"edit:key", ui.KeyBuiltin},
 		&eval.BuiltinFn{"edit:wordify", Wordify},
@@ -183,6 +190,12 @@ func installModules(builtin eval.Ns, ed *Editor) {
 		submod["binding"] = bindingVar
 	}
 
+	// Add functions that take arguments to submodules.
+	for _, b := range historyFns {
+		name := b.Name[strings.LastIndexByte(b.Name, ':')+1:]
+		submods[modeHistory][name+eval.FnSuffix] = vartypes.NewRo(b)
+	}
+
 	for name, ns := range submods {
 		builtin["edit:"+name+eval.NsSuffix] = vartypes.NewValidatedPtr(ns, eval.ShouldBeNs)
 	}
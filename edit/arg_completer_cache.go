@@ -0,0 +1,129 @@
+package edit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+)
+
+// Results of argument completers can be cached, which is useful for slow
+// completers. $edit:arg-completer-ttl maps command names to how long, in
+// seconds, results of their argument completers are cached; as with
+// $edit:arg-completer, the entry with an empty key is used for commands
+// without their own entries. Results are cached per list of words, and are not
+// cached by default.
+
+var _ = RegisterVariable("arg-completer-ttl", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(types.EmptyMap, vartypes.ShouldBeMap)
+})
+
+// argCompleterTTL returns the TTL of the results of the argument completer
+// with the given key in $edit:arg-completer.
+func (ed *Editor) argCompleterTTL(key string) time.Duration {
+	m := ed.variables["arg-completer-ttl"].Get().(types.Map)
+	if !m.HasKey(key) {
+		return 0
+	}
+	v, err := m.Index(key)
+	if err != nil {
+		return 0
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+type argCompleterCacheEntry struct {
+	cands  []rawCandidate
+	expiry time.Time
+}
+
+// argCompleterCache caches results of argument completers.
+type argCompleterCache struct {
+	mutex   sync.Mutex
+	entries map[string]argCompleterCacheEntry
+}
+
+var theArgCompleterCache = &argCompleterCache{
+	entries: make(map[string]argCompleterCacheEntry)}
+
+func argCompleterCacheKey(words []string) string {
+	return strings.Join(words, "\x00")
+}
+
+func (c *argCompleterCache) get(key string, now time.Time) ([]rawCandidate, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(entry.expiry) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.cands, true
+}
+
+func (c *argCompleterCache) put(key string, cands []rawCandidate, expiry time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = argCompleterCacheEntry{cands, expiry}
+}
+
+// callArgCompleterCached is like callArgCompleter, but uses cached results if
+// ttl is positive. Results of completers that have been canceled are not
+// cached, since they may be incomplete.
+func callArgCompleterCached(fn eval.Fn, ttl time.Duration, ev *eval.Evaler,
+	words []string, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
+
+	if ttl <= 0 {
+		return callArgCompleter(fn, ev, words, cancel, rawCands)
+	}
+	key := argCompleterCacheKey(words)
+	if cands, ok := theArgCompleterCache.get(key, time.Now()); ok {
+		for _, cand := range cands {
+			rawCands <- cand
+		}
+		return nil
+	}
+
+	var cands []rawCandidate
+	tee := make(chan rawCandidate)
+	teeDone := make(chan struct{})
+	go func() {
+		for cand := range tee {
+			cands = append(cands, cand)
+			rawCands <- cand
+		}
+		close(teeDone)
+	}()
+	err := callArgCompleter(fn, ev, words, cancel, tee)
+	close(tee)
+	<-teeDone
+	if err == nil && !isClosed(cancel) {
+		theArgCompleterCache.put(key, cands, time.Now().Add(ttl))
+	}
+	return err
+}
+
+// isClosed returns whether ch has been closed. A nil channel is never closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
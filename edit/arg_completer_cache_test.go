@@ -0,0 +1,69 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/eval"
+)
+
+func TestArgCompleterCache(t *testing.T) {
+	c := &argCompleterCache{entries: make(map[string]argCompleterCacheEntry)}
+	now := time.Unix(100, 0)
+	key := argCompleterCacheKey([]string{"kubectl", "get", ""})
+	cands := []rawCandidate{plainCandidate("pods"), plainCandidate("nodes")}
+
+	if _, ok := c.get(key, now); ok {
+		t.Errorf("get on empty cache -> ok")
+	}
+	c.put(key, cands, now.Add(time.Second))
+	if got, ok := c.get(key, now); !ok || !reflect.DeepEqual(got, cands) {
+		t.Errorf("get -> (%v, %v), want (%v, true)", got, ok, cands)
+	}
+	if _, ok := c.get(argCompleterCacheKey([]string{"kubectl", "get"}), now); ok {
+		t.Errorf("get with different words -> ok")
+	}
+	if _, ok := c.get(key, now.Add(2*time.Second)); ok {
+		t.Errorf("get after expiry -> ok")
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("expired entry not removed")
+	}
+}
+
+func TestCallArgCompleterCachedCanceled(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	// A completer that outputs a candidate and then runs until interrupted,
+	// ignoring errors like the bundled completers do.
+	err := ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+		"c = [@words]{ put cand; try { while $true { } } except { } }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := ev.Global["c"].Get().(eval.Fn)
+	words := []string{"slow", ""}
+
+	cancel := make(chan struct{})
+	done := make(chan []rawCandidate)
+	go func() {
+		done <- collectRawCandidates(func(ch chan<- rawCandidate) error {
+			return callArgCompleterCached(fn, time.Minute, ev, words, cancel, ch)
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(cancel)
+	select {
+	case cands := <-done:
+		want := []rawCandidate{plainCandidate("cand")}
+		if !reflect.DeepEqual(cands, want) {
+			t.Errorf("canceled completer -> %v, want %v", cands, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("completer not interrupted 1s after canceling")
+	}
+	if _, ok := theArgCompleterCache.get(argCompleterCacheKey(words), time.Now()); ok {
+		t.Errorf("results of canceled completer were cached")
+	}
+}
@@ -98,7 +98,8 @@ func (ed *Editor) argCompleter() types.Map {
 // completeArg calls the correct argument completers according to the command
 // name. It is used by complArg and can also be useful when further dispatching
 // based on command name is needed -- e.g. in the argument completer for "sudo".
-func completeArg(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+// The completer is interrupted when cancel is closed.
+func completeArg(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
 	logger.Printf("completing argument: %q", words)
 	// XXX(xiaq): not the best way to get argCompleter.
 	m := ev.Editor.(*Editor).argCompleter()
@@ -115,12 +116,13 @@ func completeArg(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate)
 	if !ok {
 		return ErrCompleterMustBeFn
 	}
-	return callArgCompleter(fn, ev, words, rawCands)
+	ttl := ev.Editor.(*Editor).argCompleterTTL(index)
+	return callArgCompleterCached(fn, ttl, ev, words, cancel, rawCands)
 }
 
 type builtinArgCompleter struct {
 	name string
-	impl func([]string, *eval.Evaler, chan<- rawCandidate) error
+	impl func([]string, *eval.Evaler, <-chan struct{}, chan<- rawCandidate) error
 }
 
 var _ eval.Fn = &builtinArgCompleter{}
@@ -157,7 +159,7 @@ func (bac *builtinArgCompleter) Call(ec *eval.Frame, args []types.Value, opts ma
 	var err error
 	go func() {
 		defer close(rawCands)
-		err = bac.impl(words, ec.Evaler, rawCands)
+		err = bac.impl(words, ec.Evaler, ec.Interrupts(), rawCands)
 	}()
 
 	output := ec.OutputChan()
@@ -167,32 +169,33 @@ func (bac *builtinArgCompleter) Call(ec *eval.Frame, args []types.Value, opts ma
 	return err
 }
 
-func complFilename(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+func complFilename(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
 	if len(words) < 1 {
 		return ErrTooFewArguments
 	}
 	return complFilenameInner(words[len(words)-1], false, rawCands)
 }
 
-func complSudo(words []string, ev *eval.Evaler, rawCands chan<- rawCandidate) error {
+func complSudo(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
 	if len(words) < 2 {
 		return ErrTooFewArguments
 	}
 	if len(words) == 2 {
 		return complFormHeadInner(words[1], ev, rawCands)
 	}
-	return completeArg(words[1:], ev, rawCands)
+	return completeArg(words[1:], ev, cancel, rawCands)
 }
 
 // callArgCompleter calls a Fn, assuming that it is an arg completer. It calls
 // the Fn with specified arguments and closed input, and converts its output to
-// candidate objects.
-func callArgCompleter(fn eval.Fn,
-	ev *eval.Evaler, words []string, rawCands chan<- rawCandidate) error {
+// candidate objects. If cancel is not nil, the Fn is interrupted when it is
+// closed.
+func callArgCompleter(fn eval.Fn, ev *eval.Evaler, words []string,
+	cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
 
 	// Quick path for builtin arg completers.
 	if builtin, ok := fn.(*builtinArgCompleter); ok {
-		return builtin.impl(words, ev, rawCands)
+		return builtin.impl(words, ev, cancel, rawCands)
 	}
 
 	args := make([]types.Value, len(words))
@@ -237,6 +240,9 @@ func callArgCompleter(fn eval.Fn,
 
 	// XXX There is no source to pass to NewTopEvalCtx.
 	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[editor completer]"), ports)
+	if cancel != nil {
+		ec.SetInterrupts(cancel)
+	}
 	err := ec.PCaptureOutputInner(fn, args, eval.NoOpts, valuesCb, bytesCb)
 	if err != nil {
 		err = errors.New("completer error: " + err.Error())
@@ -0,0 +1,141 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/re"
+	"github.com/elves/elvish/util"
+)
+
+// completerResult is a candidate from a completer, with the parts relevant
+// for the tests.
+type completerResult struct {
+	text, description string
+}
+
+func TestBundledCompleters(t *testing.T) {
+	util.InTempDir(func(dir string) {
+		os.Mkdir("dir", 0700)
+		ioutil.WriteFile("file", nil, 0600)
+		os.MkdirAll(filepath.Join("home", ".ssh"), 0700)
+		ioutil.WriteFile(filepath.Join("home", ".ssh", "config"),
+			[]byte("Host foo bar\nHost *.wild\n"), 0600)
+		ioutil.WriteFile(filepath.Join("home", ".ssh", "known_hosts"),
+			[]byte("[baz]:2222 ssh-rsa AAAA\n|1|hashed ssh-rsa AAAA\n"), 0600)
+
+		withEnvVars(map[string]string{
+			"HOME":               filepath.Join(dir, "home"),
+			"ELVISH_TEST_SECRET": "hunter2",
+		}, func() {
+			ev := eval.NewEvaler()
+			// XXX: Needed for "use" to work.
+			ev.SetLibDir("/non/exist/ent")
+			ev.InstallModule("re", re.Ns())
+			defer ev.Close()
+			null, err := os.Open(os.DevNull)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer null.Close()
+			ed := NewEditor(null, null, nil, ev)
+			defer ed.Close()
+
+			err = ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+				"use completers; completers:install"))
+			if err != nil {
+				t.Fatalf("installing completers -> error %v", err)
+			}
+
+			complete := func(words ...string) map[string]completerResult {
+				ch := make(chan rawCandidate)
+				var err error
+				go func() {
+					err = completeArg(words, ev, nil, ch)
+					close(ch)
+				}()
+				results := make(map[string]completerResult)
+				for c := range ch {
+					r := completerResult{text: c.text()}
+					if cc, ok := c.(*complexCandidate); ok {
+						r.description = cc.description
+					}
+					results[r.text] = r
+				}
+				if err != nil {
+					t.Errorf("completing %q -> error %v", words, err)
+				}
+				return results
+			}
+
+			if r := complete("git", ""); r["commit"].description == "" {
+				t.Errorf("git subcommands %v do not include commit with a description", r)
+			}
+			path := os.Getenv("PATH")
+			if r := complete("cd", ""); len(r) != 2 || r["dir"].text == "" || r["home"].text == "" {
+				t.Errorf("cd completes %v, want only directories", r)
+			}
+			if os.Getenv("PATH") != path {
+				t.Errorf("completing cd changed $E:PATH to %q", os.Getenv("PATH"))
+			}
+			if r := complete("kill", "-"); r["-KILL"].text == "" {
+				t.Errorf("kill - completes %v, want signals", r)
+			}
+			hosts := resultTexts(complete("ssh", ""))
+			if !reflect.DeepEqual(hosts, []string{"bar", "baz", "foo"}) {
+				t.Errorf("ssh completes %v, want [bar baz foo]", hosts)
+			}
+			if r := complete("ssh", "user@"); r["user@foo"].text == "" {
+				t.Errorf("ssh user@ completes %v, want user@foo", r)
+			}
+
+			for _, test := range []struct{ words []string }{
+				{[]string{"env", ""}}, {[]string{"printenv", ""}}, {[]string{"del", "E:"}},
+			} {
+				r := complete(test.words...)
+				want := "ELVISH_TEST_SECRET"
+				if test.words[0] == "del" {
+					want = "E:" + want
+				}
+				c, ok := r[want]
+				if !ok {
+					t.Errorf("completing %q does not include %s", test.words, want)
+				}
+				if c.description != "" {
+					t.Errorf("completing %q shows the value %q", test.words, c.description)
+				}
+			}
+		})
+	})
+}
+
+func withEnvVars(env map[string]string, f func()) {
+	saved := make(map[string]string)
+	for name, value := range env {
+		saved[name] = os.Getenv(name)
+		os.Setenv(name, value)
+	}
+	defer func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}()
+	f()
+}
+
+func resultTexts(m map[string]completerResult) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
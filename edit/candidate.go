@@ -13,8 +13,11 @@ import (
 )
 
 type candidate struct {
-	code string    // This is what will be substituted on the command line.
-	menu ui.Styled // This is what is displayed in the completion menu.
+	code        string    // This is what will be substituted on the command line.
+	menu        ui.Styled // This is what is displayed in the completion menu.
+	description string    // Displayed to the right of the menu text.
+	group       string    // Candidates of the same group are shown together.
+	matched     []int     // Byte indices of matched runes in the menu text.
 }
 
 // rawCandidate is what can be converted to a candidate.
@@ -30,6 +33,61 @@ func (cs rawCandidates) Len() int           { return len(cs) }
 func (cs rawCandidates) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
 func (cs rawCandidates) Less(i, j int) bool { return cs[i].text() < cs[j].text() }
 
+// scoredCandidates sorts rawCandidates by their match scores in descending
+// order, and then by their sort keys.
+type scoredCandidates struct {
+	cands   []rawCandidate
+	results []*matchResult
+}
+
+func (sc scoredCandidates) Len() int { return len(sc.cands) }
+
+func (sc scoredCandidates) Swap(i, j int) {
+	sc.cands[i], sc.cands[j] = sc.cands[j], sc.cands[i]
+	sc.results[i], sc.results[j] = sc.results[j], sc.results[i]
+}
+
+func (sc scoredCandidates) Less(i, j int) bool {
+	if sc.results[i].score != sc.results[j].score {
+		return sc.results[i].score > sc.results[j].score
+	}
+	return sortKey(sc.cands[i]) < sortKey(sc.cands[j])
+}
+
+// sortKey returns the key used for sorting a rawCandidate, which is its text
+// unless a sort key has been specified.
+func sortKey(rc rawCandidate) string {
+	if c, ok := rc.(*complexCandidate); ok && c.sortKey != "" {
+		return c.sortKey
+	}
+	return rc.text()
+}
+
+// groupCandidates sorts candidates by their groups, in the order the groups
+// first appear, keeping the order of candidates within each group.
+func groupCandidates(cands []*candidate) {
+	order := make(map[string]int)
+	for _, cand := range cands {
+		if _, ok := order[cand.group]; !ok {
+			order[cand.group] = len(order)
+		}
+	}
+	if len(order) > 1 {
+		sort.Stable(candidatesByGroup{cands, order})
+	}
+}
+
+type candidatesByGroup struct {
+	cands []*candidate
+	order map[string]int
+}
+
+func (cg candidatesByGroup) Len() int      { return len(cg.cands) }
+func (cg candidatesByGroup) Swap(i, j int) { cg.cands[i], cg.cands[j] = cg.cands[j], cg.cands[i] }
+func (cg candidatesByGroup) Less(i, j int) bool {
+	return cg.order[cg.cands[i].group] < cg.order[cg.cands[j].group]
+}
+
 // plainCandidate is a minimal implementation of rawCandidate.
 type plainCandidate string
 
@@ -66,13 +124,17 @@ type complexCandidate struct {
 	codeSuffix    string    // Appended to the code.
 	displaySuffix string    // Appended to the display.
 	style         ui.Styles // Used in the menu.
+	description   string    // Displayed in a separate column in the menu.
+	group         string    // Name of the group the candidate is shown in.
+	sortKey       string    // Used for sorting instead of stem if non-empty.
 }
 
 func (c *complexCandidate) Kind() string { return "map" }
 
 func (c *complexCandidate) Equal(a interface{}) bool {
 	rhs, ok := a.(*complexCandidate)
-	return ok && c.stem == rhs.stem && c.codeSuffix == rhs.codeSuffix && c.displaySuffix == rhs.displaySuffix && c.style.Eq(rhs.style)
+	return ok && c.stem == rhs.stem && c.codeSuffix == rhs.codeSuffix && c.displaySuffix == rhs.displaySuffix && c.style.Eq(rhs.style) &&
+		c.description == rhs.description && c.group == rhs.group && c.sortKey == rhs.sortKey
 }
 
 func (c *complexCandidate) Hash() uint32 {
@@ -81,14 +143,18 @@ func (c *complexCandidate) Hash() uint32 {
 	h = hash.DJBCombine(h, hash.String(c.codeSuffix))
 	h = hash.DJBCombine(h, hash.String(c.displaySuffix))
 	h = hash.DJBCombine(h, c.style.Hash())
+	h = hash.DJBCombine(h, hash.String(c.description))
+	h = hash.DJBCombine(h, hash.String(c.group))
+	h = hash.DJBCombine(h, hash.String(c.sortKey))
 	return h
 }
 
 func (c *complexCandidate) Repr(indent int) string {
 	// TODO(xiaq): Pretty-print when indent >= 0
-	return fmt.Sprintf("(edit:complex-candidate %s &code-suffix=%s &display-suffix=%s style=%s)",
+	return fmt.Sprintf("(edit:complex-candidate %s &code-suffix=%s &display-suffix=%s style=%s &description=%s &group=%s &sort-key=%s)",
 		parse.Quote(c.stem), parse.Quote(c.codeSuffix),
-		parse.Quote(c.displaySuffix), parse.Quote(c.style.String()))
+		parse.Quote(c.displaySuffix), parse.Quote(c.style.String()),
+		parse.Quote(c.description), parse.Quote(c.group), parse.Quote(c.sortKey))
 }
 
 func (c *complexCandidate) text() string { return c.stem }
@@ -96,8 +162,10 @@ func (c *complexCandidate) text() string { return c.stem }
 func (c *complexCandidate) cook(q parse.PrimaryType) *candidate {
 	quoted, _ := parse.QuoteAs(c.stem, q)
 	return &candidate{
-		code: quoted + c.codeSuffix,
-		menu: ui.Styled{c.stem + c.displaySuffix, c.style},
+		code:        quoted + c.codeSuffix,
+		menu:        ui.Styled{c.stem + c.displaySuffix, c.style},
+		description: c.description,
+		group:       c.group,
 	}
 }
 
@@ -113,6 +181,9 @@ func outputComplexCandidate(ec *eval.Frame,
 		eval.OptToScan{"code-suffix", &c.codeSuffix, ""},
 		eval.OptToScan{"display-suffix", &c.displaySuffix, ""},
 		eval.OptToScan{"style", &style, ""},
+		eval.OptToScan{"description", &c.description, ""},
+		eval.OptToScan{"group", &c.group, ""},
+		eval.OptToScan{"sort-key", &c.sortKey, ""},
 	)
 	if style != "" {
 		c.style = ui.StylesFromString(style)
@@ -121,8 +192,10 @@ func outputComplexCandidate(ec *eval.Frame,
 	ec.OutputChan() <- c
 }
 
+// filterRawCandidates runs the matcher on the raw candidates, and returns
+// those that match, sorted by their scores, along with the match results.
 func filterRawCandidates(ev *eval.Evaler, matcher eval.Fn,
-	seed string, chanRawCandidate <-chan rawCandidate) ([]rawCandidate, error) {
+	seed string, chanRawCandidate <-chan rawCandidate) ([]rawCandidate, []*matchResult, error) {
 
 	matcherInput := make(chan types.Value)
 	stopCollector := make(chan struct{})
@@ -147,17 +220,18 @@ func filterRawCandidates(ev *eval.Evaler, matcher eval.Fn,
 	args := []types.Value{seed}
 	values, err := ec.PCaptureOutput(matcher, args, eval.NoOpts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	} else if len(values) != len(collected) {
-		return nil, errIncorrectNumOfResults
+		return nil, nil, errIncorrectNumOfResults
 	}
 
-	var filtered []rawCandidate
+	var filtered scoredCandidates
 	for i, value := range values {
-		if types.ToBool(value) {
-			filtered = append(filtered, collected[i])
+		if result := parseMatcherOutput(value); result != nil {
+			filtered.cands = append(filtered.cands, collected[i])
+			filtered.results = append(filtered.results, result)
 		}
 	}
-	sort.Sort(rawCandidates(filtered))
-	return filtered, nil
+	sort.Sort(filtered)
+	return filtered.cands, filtered.results, nil
 }
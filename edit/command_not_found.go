@@ -0,0 +1,94 @@
+package edit
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/util"
+)
+
+// The $edit:command-not-found list contains hooks that are called with the
+// name and the arguments (as a list) of an external command that cannot be
+// found, before the error is raised. For instance, to suggest similarly named
+// commands:
+//
+//	edit:command-not-found = [[name args]{
+//	    similar = [(edit:similar-commands $name)]
+//	    if (> (count $similar) 0) {
+//	        echo >&2 'Did you mean: '(joins ', ' $similar)'?'
+//	    }
+//	}]
+
+var _ = RegisterVariable("command-not-found", makeListVariable)
+
+func (ed *Editor) commandNotFound() types.List {
+	return ed.variables["command-not-found"].Get().(types.List)
+}
+
+var _ eval.CommandNotFoundHandler = (*Editor)(nil)
+
+// CommandNotFound calls the hooks in $edit:command-not-found.
+func (ed *Editor) CommandNotFound(fm *eval.Frame, name string, args []types.Value) {
+	hookArgs := []types.Value{name, types.MakeList(args...)}
+	ed.commandNotFound().Iterate(func(v types.Value) bool {
+		(&hookOp{v, hookArgs}).Invoke(fm)
+		return true
+	})
+}
+
+// similarCommands implements edit:similar-commands. It outputs the names of
+// functions and external commands whose edit distances to the argument are at
+// most &max-distance, the closest ones first. A negative &max-distance (the
+// default) means a third of the length of the argument, but at least 1.
+func similarCommands(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		name        string
+		maxDistance int
+	)
+	eval.ScanArgs(args, &name)
+	eval.ScanOpts(opts, eval.OptToScan{"max-distance", &maxDistance, "-1"})
+	if maxDistance < 0 {
+		maxDistance = utf8.RuneCountInString(name) / 3
+		if maxDistance < 1 {
+			maxDistance = 1
+		}
+	}
+
+	distances := make(map[string]int)
+	consider := func(cmd string) {
+		if _, seen := distances[cmd]; seen || cmd == name {
+			return
+		}
+		if d := util.EditDistance(name, cmd); d <= maxDistance {
+			distances[cmd] = d
+		}
+	}
+	for special := range eval.IsBuiltinSpecial {
+		consider(special)
+	}
+	ec.EachVariableInTop("", func(varname string) {
+		if strings.HasSuffix(varname, eval.FnSuffix) {
+			consider(varname[:len(varname)-len(eval.FnSuffix)])
+		}
+	})
+	eval.EachExternal(consider)
+
+	similar := make([]string, 0, len(distances))
+	for cmd := range distances {
+		similar = append(similar, cmd)
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		di, dj := distances[similar[i]], distances[similar[j]]
+		if di != dj {
+			return di < dj
+		}
+		return similar[i] < similar[j]
+	})
+	out := ec.OutputChan()
+	for _, cmd := range similar {
+		out <- cmd
+	}
+}
@@ -0,0 +1,84 @@
+// +build !windows,!plan9
+
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/util"
+)
+
+var similarCommandsTests = []struct {
+	code string
+	want types.Value
+}{
+	// Functions and external commands within a third of the length, with the
+	// closest first and duplicates removed.
+	{"similar = [(edit:similar-commands frobn)]",
+		types.MakeList("frob", "frobq")},
+	{"similar = [(edit:similar-commands &max-distance=2 frobn)]",
+		types.MakeList("frob", "frobq", "fxobx")},
+	// The name itself is not suggested.
+	{"similar = [(edit:similar-commands frob)]",
+		types.MakeList("frobn", "frobq")},
+	{"similar = [(edit:similar-commands &max-distance=0 frobx)]",
+		types.EmptyList},
+}
+
+func TestCommandNotFound(t *testing.T) {
+	util.InTempDir(func(dir string) {
+		for _, name := range []string{"frob", "frobn", "fxobx", "nonexec"} {
+			mode := os.FileMode(0700)
+			if name == "nonexec" {
+				mode = 0600
+			}
+			ioutil.WriteFile(filepath.Join(dir, name), nil, mode)
+		}
+
+		withEnvVars(map[string]string{"PATH": dir}, func() {
+			ev := eval.NewEvaler()
+			defer ev.Close()
+			null, err := os.Open(os.DevNull)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer null.Close()
+			ed := NewEditor(null, null, nil, ev)
+			defer ed.Close()
+
+			source := func(code string) error {
+				return ev.SourceText(eval.NewScriptSource("[test]", "[test]", code))
+			}
+			if err := source("fn frob { }; fn frobq { }"); err != nil {
+				t.Fatal(err)
+			}
+			for _, test := range similarCommandsTests {
+				if err := source(test.code); err != nil {
+					t.Errorf("%s -> error %v", test.code, err)
+					continue
+				}
+				got := ev.Global["similar"].Get()
+				if !types.Equal(got, test.want) {
+					t.Errorf("%s -> %s, want %s", test.code, types.Repr(got, types.NoPretty), types.Repr(test.want, types.NoPretty))
+				}
+			}
+
+			err = source("got = []; edit:command-not-found = [[name args]{ got = [$name $args] }]")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source("no-such-command a b") == nil {
+				t.Errorf("running a missing command -> no error")
+			}
+			want := types.MakeList("no-such-command", types.MakeList("a", "b"))
+			if got := ev.Global["got"].Get(); !types.Equal(got, want) {
+				t.Errorf("command-not-found hook called with %v, want %v", got, want)
+			}
+		})
+	})
+}
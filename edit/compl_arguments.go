@@ -0,0 +1,287 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/getopt"
+)
+
+// This file implements argument completers built from specs in the style of
+// the _arguments function of zsh, so that completion definitions can be
+// ported from zsh with little change:
+//
+//	edit:arg-completer[foo] = (edit:arguments-completer ^
+//	    '(-v --verbose)'{-v,--verbose}'[be verbose]' ^
+//	    '--color=[when to use color]:when:(always never auto)' ^
+//	    '-o[output file]:file:_files' ^
+//	    '1:command:(build run)' '*:file:_files')
+//
+// The supported forms of specs are:
+//
+//	(excluded options)OPTSPEC
+//	-o[description]        {-o,--long}[description]
+//	-o[description]:message:action
+//	N:message:action       :message:action        *:message:action
+//
+// Suffixes of option names that determine how arguments are given (=, +, -)
+// are accepted and ignored, and so are exclusion lists. Supported actions are
+// (word...), ((word\:description...)), _files, _directories and an empty
+// action.
+
+var errBadArgumentsSpec = errors.New("bad arguments spec")
+
+// argumentsSpec is a parsed list of _arguments-style specs.
+type argumentsSpec struct {
+	opts       []*getopt.Option
+	optDesc    map[*getopt.Option]string
+	optAction  map[*getopt.Option]string
+	args       []string // Actions for positional arguments, 0-based.
+	rest       string   // Action for the remaining arguments.
+	hasRest    bool
+	nextArgPos int
+}
+
+func parseArgumentsSpecs(specs []string) (*argumentsSpec, error) {
+	as := &argumentsSpec{
+		optDesc:   make(map[*getopt.Option]string),
+		optAction: make(map[*getopt.Option]string),
+	}
+	for _, spec := range specs {
+		if err := as.parse(spec); err != nil {
+			return nil, fmt.Errorf("%v: %q", err, spec)
+		}
+	}
+	return as, nil
+}
+
+func (as *argumentsSpec) parse(spec string) error {
+	// Skip exclusion list.
+	if strings.HasPrefix(spec, "(") {
+		i := strings.IndexByte(spec, ')')
+		if i == -1 {
+			return errBadArgumentsSpec
+		}
+		spec = spec[i+1:]
+	}
+	switch {
+	case spec == "":
+		return errBadArgumentsSpec
+	case strings.HasPrefix(spec, "*:"):
+		as.rest, as.hasRest = argumentsAction(spec[1:]), true
+	case spec[0] == ':':
+		as.setArg(as.nextArgPos, argumentsAction(spec))
+	case '0' <= spec[0] && spec[0] <= '9':
+		i := strings.IndexByte(spec, ':')
+		if i == -1 {
+			return errBadArgumentsSpec
+		}
+		n, err := strconv.Atoi(spec[:i])
+		if err != nil || n < 1 {
+			return errBadArgumentsSpec
+		}
+		as.setArg(n-1, argumentsAction(spec[i:]))
+	case spec[0] == '-' || spec[0] == '+' || spec[0] == '{':
+		return as.parseOption(spec)
+	default:
+		return errBadArgumentsSpec
+	}
+	return nil
+}
+
+func (as *argumentsSpec) setArg(i int, action string) {
+	for len(as.args) <= i {
+		as.args = append(as.args, "")
+	}
+	as.args[i] = action
+	as.nextArgPos = i + 1
+}
+
+func (as *argumentsSpec) parseOption(spec string) error {
+	var names []string
+	if spec[0] == '{' {
+		i := strings.IndexByte(spec, '}')
+		if i == -1 {
+			return errBadArgumentsSpec
+		}
+		names = strings.Split(spec[1:i], ",")
+		spec = spec[i+1:]
+	} else {
+		i := strings.IndexAny(spec, "[:")
+		if i == -1 {
+			i = len(spec)
+		}
+		names = []string{spec[:i]}
+		spec = spec[i:]
+	}
+
+	desc := ""
+	if strings.HasPrefix(spec, "[") {
+		i := strings.IndexByte(spec, ']')
+		if i == -1 {
+			return errBadArgumentsSpec
+		}
+		desc, spec = spec[1:i], spec[i+1:]
+	}
+	hasArg := getopt.NoArgument
+	action := ""
+	if strings.HasPrefix(spec, ":") {
+		hasArg = getopt.RequiredArgument
+		action = argumentsAction(spec)
+	} else if spec != "" {
+		return errBadArgumentsSpec
+	}
+
+	for _, name := range names {
+		name = strings.TrimRight(name, "=+-")
+		if len(name) < 2 {
+			return errBadArgumentsSpec
+		}
+		opt := &getopt.Option{HasArg: hasArg}
+		if strings.HasPrefix(name, "--") {
+			opt.Long = name[2:]
+		} else {
+			r, size := utf8.DecodeRuneInString(name[1:])
+			if size != len(name)-1 {
+				// Single-dash long options like -name.
+				opt.Long = name[1:]
+			} else {
+				opt.Short = r
+			}
+		}
+		as.opts = append(as.opts, opt)
+		as.optDesc[opt] = desc
+		as.optAction[opt] = action
+	}
+	return nil
+}
+
+// argumentsAction extracts the action from ":message:action".
+func argumentsAction(s string) string {
+	fields := strings.SplitN(s, ":", 3)
+	if len(fields) < 3 {
+		return ""
+	}
+	return fields[2]
+}
+
+// complete completes the last of the words, which do not include the command
+// name.
+func (as *argumentsSpec) complete(words []string, rawCands chan<- rawCandidate) error {
+	g := getopt.Getopt{as.opts, getopt.GNUGetoptLong}
+	_, args, ctx := g.Parse(words)
+	word := words[len(words)-1]
+
+	putOpt := func(opt *getopt.Option, long bool) {
+		c := &complexCandidate{stem: "-" + string(opt.Short)}
+		if long {
+			c.stem = "--" + opt.Long
+		}
+		if opt.HasArg == getopt.RequiredArgument && long {
+			c.codeSuffix = "="
+		}
+		c.description = as.optDesc[opt]
+		rawCands <- c
+	}
+	putOpts := func(short, long bool) {
+		for _, opt := range as.opts {
+			if short && opt.Short != 0 {
+				putOpt(opt, false)
+			}
+			if long && opt.Long != "" {
+				putOpt(opt, true)
+			}
+		}
+	}
+
+	switch ctx.Type {
+	case getopt.NewOptionOrArgument, getopt.Argument:
+		action := ""
+		if len(args) < len(as.args) {
+			action = as.args[len(args)]
+		} else if as.hasRest {
+			action = as.rest
+		}
+		return complArgumentsAction(action, "", word, rawCands)
+	case getopt.NewOption, getopt.ChainShortOption:
+		putOpts(true, true)
+	case getopt.NewLongOption, getopt.LongOption:
+		putOpts(false, true)
+	case getopt.OptionArgument:
+		parsed := ctx.Option
+		action := ""
+		for _, opt := range as.opts {
+			if (parsed.Long && opt.Long == parsed.Option.Long) ||
+				(!parsed.Long && opt == parsed.Option) {
+				action = as.optAction[opt]
+				break
+			}
+		}
+		prefix := word[:len(word)-len(parsed.Argument)]
+		return complArgumentsAction(action, prefix, parsed.Argument, rawCands)
+	}
+	return nil
+}
+
+// complArgumentsAction generates candidates for arg according to an action.
+// All candidates are prefixed with prefix.
+func complArgumentsAction(action, prefix, arg string, rawCands chan<- rawCandidate) error {
+	action = strings.TrimSpace(action)
+	switch {
+	case strings.HasPrefix(action, "((") && strings.HasSuffix(action, "))"):
+		for _, field := range strings.Fields(action[2 : len(action)-2]) {
+			field = strings.Replace(field, `\:`, ":", -1)
+			c := &complexCandidate{stem: prefix + field}
+			if i := strings.IndexByte(field, ':'); i != -1 {
+				c.stem = prefix + field[:i]
+				c.description = field[i+1:]
+			}
+			rawCands <- c
+		}
+	case strings.HasPrefix(action, "(") && strings.HasSuffix(action, ")"):
+		for _, field := range strings.Fields(action[1 : len(action)-1]) {
+			rawCands <- plainCandidate(prefix + field)
+		}
+	case action == "_files", action == "_directories":
+		dirOnly := action == "_directories"
+		fileCands := make(chan rawCandidate)
+		var err error
+		go func() {
+			defer close(fileCands)
+			err = complFilenameInner(arg, false, fileCands)
+		}()
+		for rc := range fileCands {
+			c := rc.(*complexCandidate)
+			if dirOnly && c.codeSuffix != string(filepath.Separator) {
+				continue
+			}
+			c.stem = prefix + c.stem
+			rawCands <- c
+		}
+		return err
+	}
+	return nil
+}
+
+// makeArgumentsCompleter implements edit:arguments-completer.
+func makeArgumentsCompleter(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var specs []string
+	eval.ScanArgsVariadic(args, &specs)
+	eval.TakeNoOpt(opts)
+
+	as, err := parseArgumentsSpecs(specs)
+	maybeThrow(err)
+	ec.OutputChan() <- &builtinArgCompleter{"arguments-completer",
+		func(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
+			if len(words) < 2 {
+				return ErrTooFewArguments
+			}
+			return as.complete(words[1:], rawCands)
+		}}
+}
@@ -0,0 +1,77 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+var argumentsSpecs = []string{
+	"(-v --verbose)" + "{-v,--verbose}[be verbose]",
+	"--color=[when to use color]:when:(always never auto)",
+	"-o[output file]:file:((a.out\\:default b.out))",
+	"1:command:(build run)",
+	"*:target:(x y)",
+}
+
+var argumentsCompleteTests = []struct {
+	words []string
+	want  []rawCandidate
+}{
+	{[]string{""}, []rawCandidate{plainCandidate("build"), plainCandidate("run")}},
+	{[]string{"build", "b"}, []rawCandidate{plainCandidate("x"), plainCandidate("y")}},
+	{[]string{"--"}, []rawCandidate{
+		&complexCandidate{stem: "--verbose", description: "be verbose"},
+		&complexCandidate{stem: "--color", codeSuffix: "=", description: "when to use color"},
+	}},
+	{[]string{"-"}, []rawCandidate{
+		&complexCandidate{stem: "-v", description: "be verbose"},
+		&complexCandidate{stem: "--verbose", description: "be verbose"},
+		&complexCandidate{stem: "--color", codeSuffix: "=", description: "when to use color"},
+		&complexCandidate{stem: "-o", description: "output file"},
+	}},
+	{[]string{"--color=a"}, []rawCandidate{
+		plainCandidate("--color=always"), plainCandidate("--color=never"),
+		plainCandidate("--color=auto")}},
+	{[]string{"-o", ""}, []rawCandidate{
+		&complexCandidate{stem: "a.out", description: "default"},
+		&complexCandidate{stem: "b.out"}}},
+	{[]string{"-vo"}, []rawCandidate{
+		&complexCandidate{stem: "-voa.out", description: "default"},
+		&complexCandidate{stem: "-vob.out"}}},
+}
+
+func TestArgumentsCompleter(t *testing.T) {
+	as, err := parseArgumentsSpecs(argumentsSpecs)
+	if err != nil {
+		t.Fatalf("parseArgumentsSpecs -> error %v", err)
+	}
+	for _, test := range argumentsCompleteTests {
+		cands := collectRawCandidates(func(ch chan<- rawCandidate) error {
+			return as.complete(test.words, ch)
+		})
+		if !reflect.DeepEqual(cands, test.want) {
+			t.Errorf("complete(%q) -> %v, want %v", test.words, cands, test.want)
+		}
+	}
+}
+
+func TestParseArgumentsSpecs_Bad(t *testing.T) {
+	for _, spec := range []string{"", "(-a", "-o[desc", "0:msg:action", "x"} {
+		if _, err := parseArgumentsSpecs([]string{spec}); err == nil {
+			t.Errorf("parseArgumentsSpecs(%q) -> no error", spec)
+		}
+	}
+}
+
+func collectRawCandidates(f func(chan<- rawCandidate) error) []rawCandidate {
+	ch := make(chan rawCandidate)
+	go func() {
+		defer close(ch)
+		f(ch)
+	}()
+	var cands []rawCandidate
+	for c := range ch {
+		cands = append(cands, c)
+	}
+	return cands
+}
@@ -0,0 +1,119 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+)
+
+// This file implements a compatibility layer for bash-completion. A bash
+// completer runs bash in a subprocess, finds the completion spec that bash has
+// for the command (loading bash-completion and, with its dynamic loader, the
+// completion script for the command), evaluates it with COMP_WORDS and
+// COMP_CWORD set up and outputs COMPREPLY.
+//
+// Completers are created with edit:bash-completer, and should be put in
+// $edit:arg-completer for each command that needs them:
+//
+//	edit:arg-completer[git] = (edit:bash-completer)
+//	edit:arg-completer[foo] = (edit:bash-completer &script=~/foo-completion.bash)
+
+// bashCompletionTimeout is how long a bash completer may run.
+var bashCompletionTimeout = 5 * time.Second
+
+// bashCompletionScript is run with the words to complete as positional
+// arguments. It expects $script to contain an additional script to source,
+// which may be empty.
+const bashCompletionScript = `
+shopt -s extglob progcomp
+for f in /usr/share/bash-completion/bash_completion /etc/bash_completion \
+         /usr/local/share/bash-completion/bash_completion \
+         /usr/local/etc/bash_completion; do
+    if [ -r "$f" ]; then
+        . "$f" >/dev/null 2>&1
+        break
+    fi
+done
+if [ -n "$script" ]; then
+    . "$script" >/dev/null 2>&1
+fi
+
+words=("$@")
+cmd=${words[0]}
+cur=${words[${#words[@]}-1]}
+prev=
+if [ ${#words[@]} -ge 2 ]; then
+    prev=${words[${#words[@]}-2]}
+fi
+
+spec=$(complete -p -- "$cmd" 2>/dev/null)
+if [ -z "$spec" ] && declare -F _completion_loader >/dev/null; then
+    _completion_loader "$cmd" >/dev/null 2>&1
+    spec=$(complete -p -- "$cmd" 2>/dev/null)
+fi
+[ -n "$spec" ] || exit 0
+
+COMP_WORDS=("${words[@]}")
+COMP_CWORD=$((${#words[@]} - 1))
+COMP_LINE="${words[*]}"
+COMP_POINT=${#COMP_LINE}
+COMP_TYPE=9
+COMP_KEY=9
+COMPREPLY=()
+
+if [[ $spec =~ \ -F\ ([^ ]+) ]]; then
+    "${BASH_REMATCH[1]}" "$cmd" "$cur" "$prev" >/dev/null 2>&1
+    [ ${#COMPREPLY[@]} -gt 0 ] && printf '%s\n' "${COMPREPLY[@]}"
+else
+    spec=${spec#complete }
+    eval "compgen ${spec% *} -- \"\$cur\"" 2>/dev/null
+fi
+exit 0
+`
+
+// makeBashCompleter implements edit:bash-completer.
+func makeBashCompleter(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var script, bash string
+	eval.ScanArgs(args)
+	eval.ScanOpts(opts,
+		eval.OptToScan{"script", &script, ""},
+		eval.OptToScan{"bash", &bash, "bash"},
+	)
+	ec.OutputChan() <- &builtinArgCompleter{"bash-completer",
+		func(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
+			return complBash(bash, script, words, rawCands)
+		}}
+}
+
+func complBash(bash, script string, words []string, rawCands chan<- rawCandidate) error {
+	if len(words) < 1 {
+		return ErrTooFewArguments
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bashCompletionTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, bash, append(
+		[]string{"-c", bashCompletionScript, "bash"}, words...)...)
+	cmd.Env = append(os.Environ(), "script="+script)
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Completion functions often add a trailing space to signify that the
+		// word is complete; Elvish does not need that.
+		cand := strings.TrimRight(scanner.Text(), " ")
+		if cand != "" {
+			rawCands <- plainCandidate(cand)
+		}
+	}
+	return scanner.Err()
+}
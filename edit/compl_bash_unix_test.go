@@ -0,0 +1,116 @@
+// +build !windows,!plan9
+
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/util"
+)
+
+// bashTestScript defines completions for three commands: foo with a completion
+// function, bar with a word list, and show with a completion function that
+// reveals what it is called with.
+const bashTestScript = `
+_foo() { COMPREPLY=($(compgen -W "alpha beta $3" -- "$2")); }
+complete -F _foo foo
+complete -W "one two" bar
+_show() {
+    COMPREPLY=("cword=$COMP_CWORD" "cur=$2" "prev=$3")
+    for w in "${COMP_WORDS[@]}"; do
+        COMPREPLY+=("word=$w")
+    done
+}
+complete -F _show show
+`
+
+var bashCompleterTests = []struct {
+	words []string
+	want  []rawCandidate
+}{
+	{[]string{"foo", "x", "a"}, []rawCandidate{plainCandidate("alpha")}},
+	{[]string{"foo", "x", ""}, []rawCandidate{
+		plainCandidate("alpha"), plainCandidate("beta"), plainCandidate("x")}},
+	{[]string{"bar", "t"}, []rawCandidate{plainCandidate("two")}},
+	{[]string{"quux", ""}, nil},
+	// Words are passed as they are, even if they contain spaces or quotes.
+	{[]string{"show", "a b", `it's "x"`, ""}, []rawCandidate{
+		plainCandidate("cword=3"), plainCandidate("cur="),
+		plainCandidate(`prev=it's "x"`), plainCandidate("word=show"),
+		plainCandidate("word=a b"), plainCandidate(`word=it's "x"`),
+		plainCandidate("word=")}},
+	{[]string{"show", "$HOME"}, []rawCandidate{
+		plainCandidate("cword=1"), plainCandidate("cur=$HOME"),
+		plainCandidate("prev=show"), plainCandidate("word=show"),
+		plainCandidate("word=$HOME")}},
+}
+
+func TestBashCompleter(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	util.InTempDir(func(dir string) {
+		script := filepath.Join(dir, "foo.bash")
+		err := ioutil.WriteFile(script, []byte(bashTestScript), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range bashCompleterTests {
+			cands := collectRawCandidates(func(ch chan<- rawCandidate) error {
+				return complBash("bash", script, test.words, ch)
+			})
+			if !reflect.DeepEqual(cands, test.want) {
+				t.Errorf("complBash(%q) -> %v, want %v", test.words, cands, test.want)
+			}
+		}
+	})
+}
+
+func TestMakeBashCompleter(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	util.InTempDir(func(dir string) {
+		err := ioutil.WriteFile("foo.bash", []byte(bashTestScript), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := eval.NewEvaler()
+		defer ev.Close()
+		null, err := os.Open(os.DevNull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer null.Close()
+		ed := NewEditor(null, null, nil, ev)
+		defer ed.Close()
+
+		err = ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+			"c = (edit:bash-completer &script="+dir+"/foo.bash)"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn, ok := ev.Global["c"].Get().(eval.Fn)
+		if !ok {
+			t.Fatalf("edit:bash-completer output %v, want a function", ev.Global["c"].Get())
+		}
+		words := []string{"show", "a b", ""}
+		cands := collectRawCandidates(func(ch chan<- rawCandidate) error {
+			return callArgCompleter(fn, ev, words, nil, ch)
+		})
+		want := []rawCandidate{
+			plainCandidate("cword=2"), plainCandidate("cur="),
+			plainCandidate("prev=a b"), plainCandidate("word=show"),
+			plainCandidate("word=a b"), plainCandidate("word=")}
+		if !reflect.DeepEqual(cands, want) {
+			t.Errorf("bash completer called with %q -> %v, want %v", words, cands, want)
+		}
+	})
+}
@@ -99,14 +99,14 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 	putShortOpt := func(opt *getopt.Option) {
 		c := &complexCandidate{stem: "-" + string(opt.Short)}
 		if d, ok := desc[opt]; ok {
-			c.displaySuffix = " (" + d + ")"
+			c.description = d
 		}
 		out <- c
 	}
 	putLongOpt := func(opt *getopt.Option) {
 		c := &complexCandidate{stem: "--" + opt.Long}
 		if d, ok := desc[opt]; ok {
-			c.displaySuffix = " (" + d + ")"
+			c.description = d
 		}
 		out <- c
 	}
@@ -128,7 +128,7 @@ func complGetopt(ec *eval.Frame, a []types.Value, o map[string]types.Value) {
 					out <- rc
 				}
 			}()
-			err := callArgCompleter(argCompl, ec.Evaler, []string{ctx.Text}, rawCands)
+			err := callArgCompleter(argCompl, ec.Evaler, []string{ctx.Text}, ec.Interrupts(), rawCands)
 			maybeThrow(err)
 		}
 		// TODO Notify that there is no suitable argument completer
@@ -0,0 +1,434 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/getopt"
+)
+
+// This file implements argument completers generated from the --help output
+// and optionally the man page of commands. The options of a command are parsed
+// the first time it is completed, and cached in the store, keyed by the path
+// and modification time of the binary, so that they are parsed again only when
+// the command is upgraded.
+//
+//	edit:add-help-completer ls grep &man=$true
+//
+// is equivalent to
+//
+//	edit:arg-completer[ls] = (edit:help-completer &man=$true)
+//	edit:arg-completer[grep] = (edit:help-completer &man=$true)
+
+// helpTimeout is how long a command may take to print its help text or man
+// page path.
+var helpTimeout = 2 * time.Second
+
+// helpOption is an option parsed from help text. It is also the format options
+// are cached in.
+type helpOption struct {
+	Short  string `json:"short,omitempty"`
+	Long   string `json:"long,omitempty"`
+	HasArg bool   `json:"has-arg,omitempty"`
+	Desc   string `json:"desc,omitempty"`
+}
+
+// helpCompleterCache caches parsed options in memory, in addition to the cache
+// in the store.
+var helpCompleterCache = struct {
+	sync.Mutex
+	m map[string]*argumentsSpec
+}{m: make(map[string]*argumentsSpec)}
+
+// makeHelpCompleter implements edit:help-completer.
+func makeHelpCompleter(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var man bool
+	eval.ScanArgs(args)
+	eval.ScanOpts(opts, eval.OptToScan{"man", &man, types.Bool(false)})
+	ec.OutputChan() <- newHelpCompleter(man)
+}
+
+// addHelpCompleter implements edit:add-help-completer.
+func addHelpCompleter(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		cmds []string
+		man  bool
+	)
+	eval.ScanArgsVariadic(args, &cmds)
+	eval.ScanOpts(opts, eval.OptToScan{"man", &man, types.Bool(false)})
+
+	variable := ec.Editor.(*Editor).variables["arg-completer"]
+	var m types.Value = variable.Get()
+	for _, cmd := range cmds {
+		var err error
+		m, err = m.(types.Map).Assoc(cmd, newHelpCompleter(man))
+		maybeThrow(err)
+	}
+	maybeThrow(variable.Set(m))
+}
+
+func newHelpCompleter(man bool) *builtinArgCompleter {
+	return &builtinArgCompleter{"help-completer",
+		func(words []string, ev *eval.Evaler, cancel <-chan struct{}, rawCands chan<- rawCandidate) error {
+			if len(words) < 2 {
+				return ErrTooFewArguments
+			}
+			as, err := helpArgumentsSpec(words[0], man, ev)
+			if err != nil {
+				return err
+			}
+			return as.complete(words[1:], rawCands)
+		}}
+}
+
+// helpArgumentsSpec finds the options of a command, from the in-memory cache,
+// the store or by parsing its help text, in that order.
+func helpArgumentsSpec(cmd string, man bool, ev *eval.Evaler) (*argumentsSpec, error) {
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := path + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10) +
+		"\x00" + strconv.FormatBool(man)
+
+	helpCompleterCache.Lock()
+	as, ok := helpCompleterCache.m[key]
+	helpCompleterCache.Unlock()
+	if ok {
+		return as, nil
+	}
+
+	var store interface {
+		CompletionCache(key string) (string, error)
+		SetCompletionCache(key, value string) error
+	}
+	if ed, ok := ev.Editor.(*Editor); ok && ed.daemon != nil {
+		store = ed.daemon
+	}
+
+	// The help text is parsed without holding the lock, since running the
+	// command may take up to helpTimeout.
+	var helpOpts []helpOption
+	cached := ""
+	if store != nil {
+		cached, err = store.CompletionCache(key)
+		if err != nil {
+			logger.Printf("failed to get completion cache for %s: %v", path, err)
+		}
+	}
+	if cached != "" {
+		err = json.Unmarshal([]byte(cached), &helpOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(helpOpts) == 0 {
+		help, err := commandHelp(path, man)
+		helpOpts = parseHelp(help)
+		if err != nil || len(helpOpts) == 0 {
+			// Failures are not cached, so that the command is tried again
+			// the next time it is completed.
+			return newHelpArgumentsSpec(helpOpts), nil
+		}
+		if store != nil {
+			data, err := json.Marshal(helpOpts)
+			if err == nil {
+				err = store.SetCompletionCache(key, string(data))
+			}
+			if err != nil {
+				logger.Printf("failed to cache options of %s: %v", path, err)
+			}
+		}
+	}
+
+	as = newHelpArgumentsSpec(helpOpts)
+	helpCompleterCache.Lock()
+	helpCompleterCache.m[key] = as
+	helpCompleterCache.Unlock()
+	return as, nil
+}
+
+// newHelpArgumentsSpec builds an argumentsSpec from parsed options. Option
+// arguments and positional arguments are completed as filenames.
+func newHelpArgumentsSpec(helpOpts []helpOption) *argumentsSpec {
+	as := &argumentsSpec{
+		optDesc:   make(map[*getopt.Option]string),
+		optAction: make(map[*getopt.Option]string),
+		rest:      "_files",
+		hasRest:   true,
+	}
+	for _, h := range helpOpts {
+		opt := &getopt.Option{Long: h.Long}
+		opt.Short, _ = utf8.DecodeRuneInString(h.Short)
+		if h.HasArg {
+			opt.HasArg = getopt.RequiredArgument
+			as.optAction[opt] = "_files"
+		}
+		as.opts = append(as.opts, opt)
+		as.optDesc[opt] = h.Desc
+	}
+	return as
+}
+
+// commandHelp returns the output of "$path --help", followed by the man page
+// of the command converted to a similar format if man is true. It returns an
+// error if the command could not be run or did not finish within helpTimeout;
+// the command exiting with a non-zero status is not an error, since many
+// commands do that after printing their help text.
+func commandHelp(path string, man bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helpTimeout)
+	defer cancel()
+	// Some commands print their help text to stderr.
+	help, err := exec.CommandContext(ctx, path, "--help").CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s --help: %v", path, ctx.Err())
+	}
+	if err != nil {
+		if _, exited := err.(*exec.ExitError); !exited {
+			return "", err
+		}
+		logger.Printf("%s --help: %v", path, err)
+	}
+	if !man {
+		return string(help), nil
+	}
+
+	name := path[strings.LastIndexByte(path, '/')+1:]
+	manPath, err := exec.CommandContext(ctx, "man", "-w", name).Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("man -w %s: %v", name, ctx.Err())
+	}
+	if err != nil {
+		logger.Printf("cannot find man page of %s: %v", name, err)
+		return string(help), nil
+	}
+	source, err := readManSource(strings.TrimSpace(string(manPath)))
+	if err != nil {
+		logger.Printf("cannot read man page of %s: %v", name, err)
+		return string(help), nil
+	}
+	return string(help) + "\n" + manToHelp(source), nil
+}
+
+func readManSource(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+var (
+	// Separates the options from the description in a line of help text.
+	helpDescSep = regexp.MustCompile(`\t|  +`)
+	// Matches an option name with an optional argument specification.
+	helpOptionRegexp = regexp.MustCompile(`^(--?[[:alnum:]][-[:alnum:]_.]*)(\[?=)?`)
+)
+
+// parseHelp parses options from help text. Options are recognized on lines
+// that start with optional whitespace and a dash, in the forms commonly used
+// by GNU and BSD tools, such as:
+//
+//	-a, --all              description
+//	-o FILE, --output=FILE description
+//	    --color[=WHEN]     description
+//	-v
+//	    description on the next line
+func parseHelp(text string) []helpOption {
+	var opts []helpOption
+	seen := make(map[string]bool)
+	// Index of options on the last option line that had no description.
+	pending := -1
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "-") {
+			if pending != -1 && line != "" {
+				for i := pending; i < len(opts); i++ {
+					opts[i].Desc = line
+				}
+			}
+			pending = -1
+			continue
+		}
+
+		head, desc := line, ""
+		if loc := helpDescSep.FindStringIndex(line); loc != nil {
+			head, desc = line[:loc[0]], strings.TrimSpace(line[loc[1]:])
+		}
+		opt, ok := parseHelpHead(head)
+		if !ok {
+			pending = -1
+			continue
+		}
+		opt.Desc = desc
+		if seen[opt.Short] && opt.Short != "" || seen[opt.Long] && opt.Long != "" {
+			pending = -1
+			continue
+		}
+		seen[opt.Short], seen[opt.Long] = true, true
+		opts = append(opts, opt)
+		if desc == "" {
+			pending = len(opts) - 1
+		} else {
+			pending = -1
+		}
+	}
+	return opts
+}
+
+// parseHelpHead parses the options part of a line of help text, like
+// "-o FILE, --output=FILE".
+func parseHelpHead(head string) (helpOption, bool) {
+	var opt helpOption
+	for _, field := range strings.FieldsFunc(head, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '|'
+	}) {
+		m := helpOptionRegexp.FindStringSubmatch(field)
+		if m == nil {
+			if opt.Short != "" || opt.Long != "" {
+				// An argument, like the FILE in "-o FILE".
+				opt.HasArg = true
+				continue
+			}
+			return opt, false
+		}
+		name := m[1]
+		if m[2] == "=" {
+			opt.HasArg = true
+		}
+		if strings.HasPrefix(name, "--") {
+			if opt.Long == "" {
+				opt.Long = name[2:]
+			}
+		} else if len(name) == 2 {
+			if opt.Short == "" {
+				opt.Short = name[1:]
+			}
+		} else {
+			// Single-dash long options are not supported by getopt.
+			return opt, false
+		}
+	}
+	return opt, opt.Short != "" || opt.Long != ""
+}
+
+var (
+	manFontEscape = regexp.MustCompile(`\\f(\(..|\[[^]]*\]|.)`)
+	manCharEscape = strings.NewReplacer(`\-`, "-", `\e`, `\`, `\&`, "", `\ `, " ",
+		`\(em`, "--", `\(en`, "-", `\(aq`, "'", `\(dq`, `"`)
+	manFontMacro = regexp.MustCompile(`^\.(B|I|BI|BR|IR|RB|RI|IB)\s+`)
+)
+
+// manToHelp converts the troff source of a man page to something that looks
+// like help text. Options are recognized in the tagged paragraphs (.TP and .IP)
+// that are commonly used to document them.
+func manToHelp(source string) string {
+	var buf bytes.Buffer
+	const (
+		other = iota
+		afterTP
+		inParagraph
+	)
+	state := other
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, ".TP"):
+			state = afterTP
+		case strings.HasPrefix(line, ".IP"):
+			tag := strings.TrimSpace(strings.TrimPrefix(line, ".IP"))
+			if strings.HasPrefix(tag, `"`) {
+				if i := strings.IndexByte(tag[1:], '"'); i != -1 {
+					tag = tag[1 : i+1]
+				}
+			}
+			buf.WriteString("\n" + cleanManLine(tag) + "\n")
+			state = inParagraph
+		case manFontMacro.MatchString(line) && state == afterTP:
+			buf.WriteString("\n" + cleanManLine(joinManFontMacro(line)) + "\n")
+			state = inParagraph
+		case strings.HasPrefix(line, "."), strings.HasPrefix(line, "'"):
+			state = other
+		case state == afterTP:
+			buf.WriteString("\n" + cleanManLine(line) + "\n")
+			state = inParagraph
+		case state == inParagraph:
+			// Only the first line of the description is kept.
+			buf.WriteString("  " + cleanManLine(line) + "\n")
+			state = other
+		}
+	}
+	return buf.String()
+}
+
+// joinManFontMacro returns the text of a font macro line like
+// `.BR \-o ", " \-\-output`. Arguments of macros that alternate between fonts
+// are joined without spaces.
+func joinManFontMacro(line string) string {
+	m := manFontMacro.FindStringSubmatch(line)
+	var args []string
+	rest := line[len(m[0]):]
+	for rest != "" {
+		if rest[0] == '"' {
+			i := strings.IndexByte(rest[1:], '"')
+			if i == -1 {
+				args = append(args, rest[1:])
+				break
+			}
+			args = append(args, rest[1:i+1])
+			rest = strings.TrimLeft(rest[i+2:], " ")
+		} else {
+			i := strings.IndexByte(rest, ' ')
+			if i == -1 {
+				args = append(args, rest)
+				break
+			}
+			args = append(args, rest[:i])
+			rest = strings.TrimLeft(rest[i+1:], " ")
+		}
+	}
+	if len(m[1]) == 1 {
+		return strings.Join(args, " ")
+	}
+	return strings.Join(args, "")
+}
+
+func cleanManLine(line string) string {
+	line = manFontEscape.ReplaceAllString(line, "")
+	line = manCharEscape.Replace(line)
+	return strings.Replace(line, `"`, "", -1)
+}
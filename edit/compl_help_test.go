@@ -0,0 +1,60 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+var helpText = `Usage: foo [OPTION]... [FILE]...
+Do things.
+
+  -a, --all                  do not ignore entries starting with .
+      --color[=WHEN]         colorize the output
+  -o FILE, --output=FILE     write to FILE
+  -v
+        be verbose
+  -a                         duplicate, ignored
+  -name                      single-dash long option, ignored
+      --help     display this help and exit
+`
+
+var wantHelpOptions = []helpOption{
+	{Short: "a", Long: "all", Desc: "do not ignore entries starting with ."},
+	{Long: "color", Desc: "colorize the output"},
+	{Short: "o", Long: "output", HasArg: true, Desc: "write to FILE"},
+	{Short: "v", Desc: "be verbose"},
+	{Long: "help", Desc: "display this help and exit"},
+}
+
+func TestParseHelp(t *testing.T) {
+	opts := parseHelp(helpText)
+	if !reflect.DeepEqual(opts, wantHelpOptions) {
+		t.Errorf("parseHelp -> %v, want %v", opts, wantHelpOptions)
+	}
+}
+
+var manSource = `.TH FOO 1
+.SH OPTIONS
+.TP
+\fB\-a\fR, \fB\-\-all\fR
+do not ignore entries starting with .
+and more.
+.TP
+.BR \-o ", " \-\-output =\fIFILE\fR
+write to FILE
+.IP "\fB\-v\fR" 4
+be verbose
+.SH SEE ALSO
+`
+
+func TestManToHelp(t *testing.T) {
+	opts := parseHelp(manToHelp(manSource))
+	want := []helpOption{
+		{Short: "a", Long: "all", Desc: "do not ignore entries starting with ."},
+		{Short: "o", Long: "output", HasArg: true, Desc: "write to FILE"},
+		{Short: "v", Desc: "be verbose"},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("parseHelp(manToHelp(...)) -> %v, want %v", opts, want)
+	}
+}
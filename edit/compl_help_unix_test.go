@@ -0,0 +1,54 @@
+// +build !windows,!plan9
+
+package edit
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/util"
+)
+
+func TestHelpArgumentsSpecDoesNotCacheFailures(t *testing.T) {
+	util.InTempDir(func(dir string) {
+		// The command only prints its help text once the file "ready" exists.
+		script := "#!/bin/sh\n[ -e " + dir + "/ready ] && cat <<'EOF'\n" + helpText + "EOF\n"
+		err := ioutil.WriteFile("foo", []byte(script), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := &eval.Evaler{}
+
+		as, err := helpArgumentsSpec(dir+"/foo", false, ev)
+		if err != nil || len(as.opts) != 0 {
+			t.Errorf("helpArgumentsSpec -> (%d options, %v), want (0 options, nil)", len(as.opts), err)
+		}
+		ioutil.WriteFile("ready", nil, 0600)
+		as, err = helpArgumentsSpec(dir+"/foo", false, ev)
+		if err != nil || len(as.opts) != len(wantHelpOptions) {
+			t.Errorf("helpArgumentsSpec -> (%d options, %v), want (%d options, nil)",
+				len(as.opts), err, len(wantHelpOptions))
+		}
+	})
+}
+
+func TestCommandHelpTimeout(t *testing.T) {
+	util.InTempDir(func(dir string) {
+		err := ioutil.WriteFile("slow", []byte("#!/bin/sh\nexec sleep 10\n"), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := helpTimeout
+		helpTimeout = 10 * time.Millisecond
+		defer func() { helpTimeout = saved }()
+
+		if _, err := commandHelp(dir+"/slow", false); err == nil {
+			t.Errorf("commandHelp of a slow command -> nil error, want error")
+		}
+		if _, err := commandHelp(dir+"/nonexistent", false); err == nil {
+			t.Errorf("commandHelp of a nonexistent command -> nil error, want error")
+		}
+	})
+}
@@ -67,8 +67,8 @@ func evalFormPure(form *parse.Form, seed string, seedBegin int, ev pureEvaler) [
 
 // To complete an argument, delegate the actual completion work to a suitable
 // complContext.
-func (ctx *argComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
-	return completeArg(ctx.words, ev, ch)
+func (ctx *argComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
+	return completeArg(ctx.words, ev, cancel, ch)
 }
 
 // TODO: getStyle does redundant stats.
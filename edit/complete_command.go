@@ -3,8 +3,6 @@ package edit
 import (
 	"strings"
 
-	"github.com/elves/elvish/edit/ui"
-
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/parse"
 	"github.com/elves/elvish/util"
@@ -57,7 +55,7 @@ func findCommandComplContext(n parse.Node, ev pureEvaler) complContext {
 
 func (*commandComplContext) name() string { return "command" }
 
-func (ctx *commandComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
+func (ctx *commandComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
 	return complFormHeadInner(ctx.seed, ev, ch)
 }
 
@@ -79,7 +77,7 @@ func complFormHeadInner(head string, ev *eval.Evaler, rawCands chan<- rawCandida
 				got(eval.MakeVariableName(false, ns, varname[:len(varname)-len(eval.FnSuffix)]))
 			} else {
 				name := eval.MakeVariableName(false, ns, varname)
-				rawCands <- &complexCandidate{name, " = ", " = ", ui.Styles{}}
+				rawCands <- &complexCandidate{stem: name, codeSuffix: " = ", displaySuffix: " = "}
 			}
 		})
 	}
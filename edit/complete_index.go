@@ -2,6 +2,8 @@ package edit
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
@@ -19,20 +21,22 @@ func (*indexComplContext) name() string { return "index" }
 
 // Find context information for complIndex.
 //
-// Right now we only support cases where there is only one level of indexing,
-// e.g. $a[<Tab> is supported but $a[x][<Tab> is not.
+// Indexing can be nested, e.g. both $a[<Tab> and $a[x][<Tab> are supported,
+// as long as the head and all the preceding indices can be evaluated purely.
 func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 	if parse.IsSep(n) {
-		if parse.IsIndexing(n.Parent()) {
+		if parse.IsIndexing(n.Parent()) && n.SourceText() == "[" {
 			// We are just after an opening bracket.
 			indexing := parse.GetIndexing(n.Parent())
-			if len(indexing.Indicies) == 1 {
-				if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-					return &indexComplContext{
-						complContextCommon{
-							"", quotingForEmptySeed, n.End(), n.End()},
-						indexee,
-					}
+			i := 0
+			for i < len(indexing.Indicies) && indexing.Indicies[i].End() <= n.Begin() {
+				i++
+			}
+			if indexee := ev.PurelyEvalIndexing(indexing, i); indexee != nil {
+				return &indexComplContext{
+					complContextCommon{
+						"", quotingForEmptySeed, n.End(), n.End()},
+					indexee,
 				}
 			}
 		}
@@ -41,13 +45,11 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 			if parse.IsIndexing(array.Parent()) {
 				// We are after an existing index and spaces.
 				indexing := parse.GetIndexing(array.Parent())
-				if len(indexing.Indicies) == 1 {
-					if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-						return &indexComplContext{
-							complContextCommon{
-								"", quotingForEmptySeed, n.End(), n.End()},
-							indexee,
-						}
+				if indexee := purelyEvalIndexee(indexing, array, ev); indexee != nil {
+					return &indexComplContext{
+						complContextCommon{
+							"", quotingForEmptySeed, n.End(), n.End()},
+						indexee,
 					}
 				}
 			}
@@ -63,13 +65,11 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 				if parse.IsIndexing(array.Parent()) {
 					// We are just after an incomplete index.
 					indexing := parse.GetIndexing(array.Parent())
-					if len(indexing.Indicies) == 1 {
-						if indexee := ev.PurelyEvalPrimary(indexing.Head); indexee != nil {
-							return &indexComplContext{
-								complContextCommon{
-									seed, primary.Type, compound.Begin(), compound.End()},
-								indexee,
-							}
+					if indexee := purelyEvalIndexee(indexing, array, ev); indexee != nil {
+						return &indexComplContext{
+							complContextCommon{
+								seed, primary.Type, compound.Begin(), compound.End()},
+							indexee,
 						}
 					}
 				}
@@ -80,12 +80,30 @@ func findIndexComplContext(n parse.Node, ev pureEvaler) complContext {
 	return nil
 }
 
-func (ctx *indexComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
-	m, ok := ctx.indexee.(types.IterateKeyer)
-	if !ok {
+// purelyEvalIndexee evaluates the value that is indexed by the given index of
+// an indexing node, which is the head indexed by all the preceding indices.
+func purelyEvalIndexee(indexing *parse.Indexing, index parse.Node, ev pureEvaler) types.Value {
+	for i, array := range indexing.Indicies {
+		if parse.Node(array) == index {
+			return ev.PurelyEvalIndexing(indexing, i)
+		}
+	}
+	return nil
+}
+
+func (ctx *indexComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
+	switch indexee := ctx.indexee.(type) {
+	case types.IterateKeyer:
+		complIndexInner(indexee, ch)
+	case types.ListLike:
+		for i := 0; i < indexee.Len(); i++ {
+			// Sort indices numerically.
+			ch <- &complexCandidate{
+				stem: strconv.Itoa(i), sortKey: fmt.Sprintf("%020d", i)}
+		}
+	default:
 		return errCannotIterateKey
 	}
-	complIndexInner(m, ch)
 	return nil
 }
 
@@ -21,7 +21,14 @@ func TestFindIndexComplContext(t *testing.T) {
 			complContextCommon{"", quotingForEmptySeed, 4, 4}, testIndexee}},
 		// Not supported when indexee cannot be evaluated statically
 		{"(x)[", nil},
-		// Multi-layer indexing not supported yet
+		// Multi-layer indexing
+		{"a[0][", &indexComplContext{
+			complContextCommon{"", quotingForEmptySeed, 5, 5}, testIndexee}},
+		{"a[0][x", &indexComplContext{
+			complContextCommon{"x", parse.Bareword, 5, 6}, testIndexee}},
+		// Not supported when an index cannot be evaluated statically
+		{"a[(x)][", nil},
+		// Not supported when indexing fails
 		{"a[x][", nil},
 	})
 }
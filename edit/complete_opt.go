@@ -0,0 +1,67 @@
+package edit
+
+import (
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/parse"
+)
+
+// optComplContext is the context for completing the names of options, e.g.
+// &<Tab> or &ma<Tab> in "splits &max=1 , a,b,c".
+type optComplContext struct {
+	complContextCommon
+	fn     eval.Fn
+	suffix string // Appended to candidates; empty when = is already there.
+}
+
+func (*optComplContext) name() string { return "option" }
+
+func findOptComplContext(n parse.Node, ev pureEvaler) complContext {
+	if parse.IsSep(n) && n.SourceText() == "&" {
+		// A lone & at the end of a pipeline is parsed as a background
+		// indicator; it may also be the start of an option.
+		if pipeline, ok := n.Parent().(*parse.Pipeline); ok && len(pipeline.Forms) > 0 {
+			form := pipeline.Forms[len(pipeline.Forms)-1]
+			if fn := formFn(form, ev); fn != nil {
+				return &optComplContext{
+					complContextCommon{"", quotingForEmptySeed, n.End(), n.End()},
+					fn, "=",
+				}
+			}
+		}
+	}
+	if primary, ok := n.(*parse.Primary); ok {
+		if compound, seed := primaryInSimpleCompound(primary, ev); compound != nil {
+			if mapPair, ok := compound.Parent().(*parse.MapPair); ok && mapPair.Key == compound {
+				if fn := formFn(mapPair.Parent(), ev); fn != nil {
+					suffix := "="
+					if mapPair.Value != nil {
+						suffix = ""
+					}
+					return &optComplContext{
+						complContextCommon{
+							seed, primary.Type, compound.Begin(), compound.End()},
+						fn, suffix,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// formFn purely resolves the head of a form to a function. It returns nil if n
+// is not a form, or if its head cannot be resolved purely.
+func formFn(n parse.Node, ev pureEvaler) eval.Fn {
+	form, ok := n.(*parse.Form)
+	if !ok || form.Head == nil {
+		return nil
+	}
+	return ev.PurelyResolveFn(form.Head)
+}
+
+func (ctx *optComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
+	for _, name := range eval.OptNames(ctx.fn) {
+		ch <- &complexCandidate{stem: name, codeSuffix: ctx.suffix}
+	}
+	return nil
+}
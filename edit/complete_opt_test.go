@@ -0,0 +1,59 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/re"
+	"github.com/elves/elvish/parse"
+)
+
+func TestFindOptComplContext(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	ev.InstallModule("re", re.Ns())
+	err := ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+		"use re; fn f [&foo=x &bar=y]{ }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		src      string
+		seed     string
+		wantOpts []string
+	}{
+		{"f &", "", []string{"foo", "bar"}},
+		{"f &b", "b", []string{"foo", "bar"}},
+		{"splits &m", "m", []string{"max"}},
+		{"re:find &", "", []string{"posix", "longest", "max"}},
+		// External commands and functions without options
+		{"x &", "", nil},
+		{"put &x", "x", nil},
+	}
+	for _, test := range tests {
+		n, _ := parse.Parse("[test]", test.src)
+		leaf := findLeafNode(n, len(test.src))
+		ctx, _ := findOptComplContext(leaf, ev).(*optComplContext)
+		var opts []string
+		if ctx != nil {
+			if ctx.seed != test.seed {
+				t.Errorf("For %q, got seed %q, want %q", test.src, ctx.seed, test.seed)
+			}
+			opts = eval.OptNames(ctx.fn)
+		}
+		if !reflect.DeepEqual(opts, test.wantOpts) {
+			t.Errorf("For %q, got options %v, want %v", test.src, opts, test.wantOpts)
+		}
+	}
+}
+
+func TestFindOptComplContextNilEvaler(t *testing.T) {
+	n, _ := parse.Parse("[test]", "$f &")
+	leaf := findLeafNode(n, len("$f &"))
+	var ev *eval.Evaler
+	if ctx := findOptComplContext(leaf, ev); ctx != nil {
+		t.Errorf("got %v, want nil", ctx)
+	}
+}
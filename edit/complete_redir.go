@@ -29,6 +29,6 @@ func findRedirComplContext(n parse.Node, ev pureEvaler) complContext {
 	return nil
 }
 
-func (ctx *redirComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
+func (ctx *redirComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
 	return complFilenameInner(ctx.seed, false, ch)
 }
@@ -38,7 +38,7 @@ type evalerScopes interface {
 	EachNsInTop(func(string))
 }
 
-func (ctx *variableComplContext) generate(ev *eval.Evaler, ch chan<- rawCandidate) error {
+func (ctx *variableComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
 	complVariable(ctx.ns, ctx.nsPart, ev, ch)
 	return nil
 }
@@ -32,16 +32,20 @@ package edit
 // details.
 
 import (
+	"sync"
+	"time"
+
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/parse"
-	"github.com/elves/elvish/util"
 )
 
 type complContext interface {
 	name() string
 	common() *complContextCommon
-	generate(*eval.Evaler, chan<- rawCandidate) error
+	// generate generates the candidates. It should stop early when cancel is
+	// closed.
+	generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error
 }
 
 type complContextCommon struct {
@@ -69,6 +73,8 @@ type pureEvaler interface {
 	PurelyEvalCompound(*parse.Compound) (string, error)
 	PurelyEvalPartialCompound(cn *parse.Compound, upto *parse.Indexing) (string, error)
 	PurelyEvalPrimary(*parse.Primary) types.Value
+	PurelyEvalIndexing(in *parse.Indexing, n int) types.Value
+	PurelyResolveFn(*parse.Compound) eval.Fn
 }
 
 var complContextFinders = []complContextFinder{
@@ -76,13 +82,40 @@ var complContextFinders = []complContextFinder{
 	findCommandComplContext,
 	findIndexComplContext,
 	findRedirComplContext,
+	findOptComplContext,
 	findArgComplContext,
 }
 
-// complete takes a Node and Evaler and tries all complContexts. It returns the
-// name of the complContext, and the result and error it gave. If no complContext is
-// available, it returns an empty complContext name.
-func complete(n parse.Node, ev *eval.Evaler) (string, *complSpec, error) {
+// completionBatchInterval is how often candidates generated by a completion
+// job are delivered. Batches are delivered at this interval even when they are
+// empty, so that the editor can show the progress of slow completers.
+var completionBatchInterval = 50 * time.Millisecond
+
+// complJob is a completion running in the background. Candidates are
+// delivered in batches on the channel returned by Batches, the last of which
+// has done set to true.
+type complJob struct {
+	name    string
+	common  *complContextCommon
+	matcher eval.Fn
+
+	batches    chan complBatch
+	cancelChan chan struct{}
+	cancelOnce sync.Once
+}
+
+// complBatch is a batch of raw candidates delivered by a complJob.
+type complBatch struct {
+	cands []rawCandidate
+	done  bool
+	err   error
+}
+
+// complete takes a Node and Evaler and tries all complContexts. When one
+// applies, it starts generating candidates in the background and returns a
+// complJob that delivers them. If no complContext is available, it returns a
+// nil complJob.
+func complete(n parse.Node, ev *eval.Evaler) (*complJob, error) {
 	ed := ev.Editor.(*Editor)
 	for _, finder := range complContextFinders {
 		ctx := finder(n, ev)
@@ -90,29 +123,95 @@ func complete(n parse.Node, ev *eval.Evaler) (string, *complSpec, error) {
 			continue
 		}
 		name := ctx.name()
-		ctxCommon := ctx.common()
 
 		matcher, ok := ed.lookupMatcher(name)
 		if !ok {
-			return name, nil, errMatcherMustBeFn
+			return nil, errMatcherMustBeFn
+		}
+		job := &complJob{name, ctx.common(), matcher,
+			make(chan complBatch), make(chan struct{}), sync.Once{}}
+		go job.run(ctx, ev)
+		return job, nil
+	}
+	return nil, nil
+}
+
+func (job *complJob) run(ctx complContext, ev *eval.Evaler) {
+	rawCands := make(chan rawCandidate)
+	errGenerate := make(chan error, 1)
+	go func() {
+		err := ctx.generate(ev, job.cancelChan, rawCands)
+		close(rawCands)
+		errGenerate <- err
+	}()
+	// If the job is canceled, keep reading candidates so that the generator
+	// can finish; it is interrupted by the closing of cancelChan.
+	defer func() {
+		for range rawCands {
 		}
+	}()
 
-		chanRawCandidate := make(chan rawCandidate)
-		chanErrGenerate := make(chan error)
-		go func() {
-			err := ctx.generate(ev, chanRawCandidate)
-			close(chanRawCandidate)
-			chanErrGenerate <- err
-		}()
-
-		rawCandidates, errFilter := filterRawCandidates(ev, matcher, ctxCommon.seed, chanRawCandidate)
-		candidates := make([]*candidate, len(rawCandidates))
-		for i, raw := range rawCandidates {
-			candidates[i] = raw.cook(ctxCommon.quoting)
+	ticker := time.NewTicker(completionBatchInterval)
+	defer ticker.Stop()
+	var buf []rawCandidate
+	send := func(batch complBatch) bool {
+		select {
+		case job.batches <- batch:
+			buf = nil
+			return true
+		case <-job.cancelChan:
+			return false
 		}
-		spec := &complSpec{ctxCommon.begin, ctxCommon.end, candidates}
-		return name, spec, util.Errors(<-chanErrGenerate, errFilter)
+	}
+	for {
+		select {
+		case rc, ok := <-rawCands:
+			if !ok {
+				send(complBatch{buf, true, <-errGenerate})
+				return
+			}
+			buf = append(buf, rc)
+		case <-ticker.C:
+			if !send(complBatch{cands: buf}) {
+				return
+			}
+		case <-job.cancelChan:
+			return
+		}
+	}
+}
 
+// Batches returns the channel on which batches of candidates are delivered.
+// It returns nil if job is nil.
+func (job *complJob) Batches() <-chan complBatch {
+	if job == nil {
+		return nil
 	}
-	return "", nil, nil
+	return job.batches
+}
+
+// Cancel stops delivering candidates and interrupts the completers that are
+// generating them. It is safe to call Cancel multiple times, and on a nil
+// complJob.
+func (job *complJob) Cancel() {
+	if job == nil {
+		return
+	}
+	job.cancelOnce.Do(func() { close(job.cancelChan) })
+}
+
+// filter runs the matcher of the job on a batch of raw candidates.
+func (job *complJob) filter(ev *eval.Evaler, cands []rawCandidate) ([]rawCandidate, []*matchResult, error) {
+	ch := make(chan rawCandidate)
+	go func() {
+		defer close(ch)
+		for _, rc := range cands {
+			ch <- rc
+		}
+	}()
+	defer func() {
+		for range ch {
+		}
+	}()
+	return filterRawCandidates(ev, job.matcher, job.common.seed, ch)
 }
@@ -2,7 +2,9 @@ package edit
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/elves/elvish/edit/ui"
@@ -40,8 +42,32 @@ type completion struct {
 	firstShown      int
 	lastShownInFull int
 	height          int
+
+	// Whether candidates are shown one per line, with their descriptions and
+	// under headers of their groups.
+	listLayout bool
+	// The first row shown in the list layout, counting group headers.
+	firstRow int
+
+	// The job generating candidates, nil when all candidates have been
+	// generated.
+	job *complJob
+	// Raw candidates generated so far and their match results, kept for
+	// merging with later batches.
+	raws    []rawCandidate
+	results []*matchResult
+	// Advanced every time a batch is received, used for animating the
+	// loading indicator.
+	spinner int
 }
 
+// asyncCompletionDelay is how long completion waits for all candidates before
+// showing the listing with a loading indicator and receiving the remaining
+// candidates in the background.
+var asyncCompletionDelay = 100 * time.Millisecond
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
 func (*completion) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
 	return getBinding(m[modeCompletion], k)
 }
@@ -51,7 +77,11 @@ func (c *completion) needScrollbar() bool {
 }
 
 func (c *completion) ModeLine() ui.Renderer {
-	ml := modeLineRenderer{fmt.Sprintf(" COMPLETING %s ", c.completer), c.filter}
+	title := fmt.Sprintf(" COMPLETING %s ", c.completer)
+	if c.job != nil {
+		title += spinnerFrames[c.spinner%len(spinnerFrames)] + " "
+	}
+	ml := modeLineRenderer{title, c.filter}
 	if !c.needScrollbar() {
 		return ml
 	}
@@ -105,6 +135,8 @@ func complAccept(ed *Editor) {
 	if 0 <= c.selected && c.selected < len(c.filtered) {
 		ed.buffer, ed.dot = c.apply(ed.buffer, ed.dot)
 	}
+	ed.completion.job.Cancel()
+	ed.completion.job = nil
 	ed.mode = &ed.insert
 }
 
@@ -175,55 +207,161 @@ func startCompletionInner(ed *Editor, acceptPrefix bool) {
 		return
 	}
 
-	completer, complSpec, err := complete(node, ed.evaler)
-
+	ed.completion.job.Cancel()
+	job, err := complete(node, ed.evaler)
 	if err != nil {
 		ed.addTip("%v", err)
-		// We don't show the full stack trace. To make debugging still possible,
-		// we log it.
-		if pprinter, ok := err.(util.Pprinter); ok {
-			logger.Println("matcher error:")
-			logger.Println(pprinter.Pprint(""))
-		}
-	} else if completer == "" {
+		return
+	} else if job == nil {
 		ed.addTip("unsupported completion :(")
 		logger.Println("path to current leaf, leaf first")
 		for n := node; n != nil; n = n.Parent() {
 			logger.Printf("%T (%d-%d)", n, n.Begin(), n.End())
 		}
-	} else if len(complSpec.candidates) == 0 {
-		ed.addTip("no candidate for %s", completer)
-	} else {
-		if acceptPrefix {
-			// If there is a non-empty longest common prefix, insert it and
-			// don't start completion mode.
-			//
-			// As a special case, when there is exactly one candidate, it is
-			// immeidately accepted.
-			prefix := complSpec.candidates[0].code
-			for _, cand := range complSpec.candidates[1:] {
-				prefix = commonPrefix(prefix, cand.code)
-				if prefix == "" {
-					break
-				}
-			}
+		return
+	}
 
-			if prefix != "" && len(prefix) > complSpec.end-complSpec.begin {
-				ed.buffer = ed.buffer[:complSpec.begin] + prefix + ed.buffer[complSpec.end:]
-				ed.dot = complSpec.begin + len(prefix)
+	c := &completion{
+		completer: job.name,
+		complSpec: complSpec{begin: job.common.begin, end: job.common.end},
+		job:       job,
+	}
+	// Wait for the completer to finish for a short while, so that fast
+	// completers work as if they were synchronous.
+	timeout := time.After(asyncCompletionDelay)
+wait:
+	for c.job != nil {
+		select {
+		case batch := <-job.Batches():
+			c.addBatch(ed, batch)
+		case <-timeout:
+			break wait
+		}
+	}
+	if c.job != nil {
+		// Show the listing while the completer is still running.
+		ed.completion = *c
+		ed.mode = &ed.completion
+		return
+	}
 
-				return
+	if len(c.candidates) == 0 {
+		ed.addTip("no candidate for %s", c.completer)
+		return
+	}
+	if acceptPrefix {
+		// If there is a non-empty longest common prefix, insert it and
+		// don't start completion mode.
+		//
+		// As a special case, when there is exactly one candidate, it is
+		// immeidately accepted.
+		prefix := c.candidates[0].code
+		for _, cand := range c.candidates[1:] {
+			prefix = commonPrefix(prefix, cand.code)
+			if prefix == "" {
+				break
 			}
 		}
-		ed.completion = completion{
-			completer: completer,
-			complSpec: *complSpec,
-			filtered:  complSpec.candidates,
+
+		if prefix != "" && len(prefix) > c.end-c.begin {
+			ed.buffer = ed.buffer[:c.begin] + prefix + ed.buffer[c.end:]
+			ed.dot = c.begin + len(prefix)
+
+			return
+		}
+	}
+	ed.completion = *c
+	ed.mode = &ed.completion
+}
+
+// addBatch merges a batch of candidates from the completion job.
+func (c *completion) addBatch(ed *Editor, batch complBatch) {
+	job := c.job
+	c.spinner++
+	if batch.err != nil {
+		ed.addTip("%v", batch.err)
+		// We don't show the full stack trace. To make debugging still possible,
+		// we log it.
+		if pprinter, ok := batch.err.(util.Pprinter); ok {
+			logger.Println("completer error:")
+			logger.Println(pprinter.Pprint(""))
+		}
+	}
+	if batch.done {
+		c.job = nil
+	}
+	if len(batch.cands) == 0 {
+		return
+	}
+
+	raws, results, err := job.filter(ed.evaler, batch.cands)
+	if err != nil {
+		ed.addTip("%v", err)
+		if pprinter, ok := err.(util.Pprinter); ok {
+			logger.Println("matcher error:")
+			logger.Println(pprinter.Pprint(""))
+		}
+		return
+	}
+	c.raws = append(c.raws, raws...)
+	c.results = append(c.results, results...)
+	sort.Sort(scoredCandidates{c.raws, c.results})
+
+	// Keep the selected candidate selected after merging.
+	selectedCode := ""
+	if 0 <= c.selected && c.selected < len(c.filtered) {
+		selectedCode = c.filtered[c.selected].code
+	}
+	c.candidates = make([]*candidate, len(c.raws))
+	for i, raw := range c.raws {
+		c.candidates[i] = raw.cook(job.common.quoting)
+		c.candidates[i].matched = c.results[i].positions
+	}
+	groupCandidates(c.candidates)
+	c.listLayout = needListLayout(c.candidates)
+	c.changeFilter(c.filter)
+	for i, cand := range c.filtered {
+		if cand.code == selectedCode {
+			c.selected = i
+			break
 		}
-		ed.mode = &ed.completion
 	}
 }
 
+// handleComplBatch handles a batch of candidates delivered while the editor is
+// waiting for events.
+func (ed *Editor) handleComplBatch(batch complBatch) {
+	c := &ed.completion
+	if ed.mode != c {
+		// Completion mode has been left.
+		c.job.Cancel()
+		c.job = nil
+		return
+	}
+	c.addBatch(ed, batch)
+	if c.job == nil && len(c.candidates) == 0 {
+		ed.addTip("no candidate for %s", c.completer)
+		ed.mode = &ed.insert
+	}
+}
+
+// abortCompletion cancels a running completion job. If the completion listing
+// is being shown, it also returns to insert mode and returns true.
+func (ed *Editor) abortCompletion() bool {
+	c := &ed.completion
+	if c.job == nil {
+		return false
+	}
+	c.job.Cancel()
+	c.job = nil
+	if ed.mode != c {
+		return false
+	}
+	ed.mode = &ed.insert
+	ed.addTip("completion aborted")
+	return true
+}
+
 // commonPrefix returns the longest common prefix of two strings.
 func commonPrefix(s, t string) string {
 	for i, r := range s {
@@ -242,6 +380,9 @@ const (
 	completionColMarginLeft  = 1
 	completionColMarginRight = 1
 	completionColMarginTotal = completionColMarginLeft + completionColMarginRight
+	// Space between the text and description of candidates in the list
+	// layout.
+	completionDescMargin = 1
 )
 
 // maxWidth finds the maximum wcwidth of display texts of candidates [lo, hi).
@@ -265,13 +406,20 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 	b := ui.NewBuffer(width)
 	cands := c.filtered
 	if len(cands) == 0 {
-		b.WriteString(util.TrimWcwidth("(no result)", width), "")
+		if c.job != nil {
+			b.WriteString(util.TrimWcwidth("(loading...)", width), "")
+		} else {
+			b.WriteString(util.TrimWcwidth("(no result)", width), "")
+		}
 		return b
 	}
 	if maxHeight <= 1 || width <= 2 {
 		b.WriteString(util.TrimWcwidth("(terminal too small)", width), "")
 		return b
 	}
+	if c.listLayout {
+		return c.listRenderList(b, width, maxHeight)
+	}
 
 	// Reserve the the rightmost row as margins.
 	width--
@@ -334,7 +482,7 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 				if j == c.selected {
 					s = append(s, styleForSelectedCompletion.String())
 				}
-				col.WriteString(util.ForceWcwidth(cands[j].menu.Text, colWidth), s.String())
+				writeHighlighted(col, util.ForceWcwidth(cands[j].menu.Text, colWidth), s, cands[j].matched)
 				col.WriteSpaces(completionColMarginRight, styleForCompletion.String())
 				if !trimmed {
 					c.lastShownInFull = j
@@ -363,6 +511,100 @@ func (c *completion) ListRender(width, maxHeight int) *ui.Buffer {
 	return b
 }
 
+// needListLayout returns whether candidates should be shown in the list
+// layout, which is the case when any of them has a description or a group.
+func needListLayout(cands []*candidate) bool {
+	for _, cand := range cands {
+		if cand.description != "" || cand.group != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// completionRows returns the rows of the list layout. Each row is either the
+// index of a candidate, or -1 for the header of the group of the next row.
+func (c *completion) completionRows() []int {
+	var rows []int
+	for i, cand := range c.filtered {
+		if cand.group != "" && (i == 0 || c.filtered[i-1].group != cand.group) {
+			rows = append(rows, -1)
+		}
+		rows = append(rows, i)
+	}
+	return rows
+}
+
+// listRenderList renders the candidates one per line, with descriptions
+// aligned in a column to the right and groups separated by headers.
+func (c *completion) listRenderList(b *ui.Buffer, width, maxHeight int) *ui.Buffer {
+	// Reserve the the rightmost row as margins.
+	width--
+
+	rows := c.completionRows()
+	height := min(maxHeight, len(rows))
+	// Scroll to make the selected candidate visible, along with its group
+	// header when possible.
+	selectedRow := 0
+	for i, row := range rows {
+		if row == c.selected {
+			selectedRow = i
+			break
+		}
+	}
+	first := min(c.firstRow, len(rows)-height)
+	if selectedRow < first {
+		first = selectedRow
+		if first > 0 && rows[first-1] == -1 {
+			first--
+		}
+	} else if selectedRow >= first+height {
+		first = selectedRow - height + 1
+	}
+	c.firstRow = first
+
+	textWidth := c.maxWidth(0, len(c.filtered))
+	if textWidth > width-completionColMarginTotal {
+		textWidth = width - completionColMarginTotal
+	}
+	descWidth := width - textWidth - completionColMarginTotal - completionDescMargin
+
+	c.firstShown, c.lastShownInFull, c.height = -1, -1, 0
+	for i, row := range rows[first : first+height] {
+		if i > 0 {
+			b.Newline()
+		}
+		if row == -1 {
+			group := c.filtered[rows[first+i+1]].group
+			b.WriteString(util.ForceWcwidth(group, width), styleForCompletionGroup.String())
+			continue
+		}
+		if c.firstShown == -1 {
+			c.firstShown = row
+		}
+		c.lastShownInFull = row
+		c.height++
+
+		cand := c.filtered[row]
+		s := ui.JoinStyles(styleForCompletion, cand.menu.Styles)
+		if row == c.selected {
+			s = append(s, styleForSelectedCompletion.String())
+		}
+		b.WriteSpaces(completionColMarginLeft, styleForCompletion.String())
+		writeHighlighted(b, util.ForceWcwidth(cand.menu.Text, textWidth), s, cand.matched)
+		b.WriteSpaces(completionColMarginRight, styleForCompletion.String())
+		if cand.description != "" && descWidth > 0 {
+			b.WriteSpaces(completionDescMargin, styleForCompletion.String())
+			b.WriteString(util.TrimWcwidth(cand.description, descWidth),
+				styleForCompletionDescription.String())
+		}
+	}
+	if c.height == 0 {
+		c.height = 1
+	}
+	return b
+}
+
 func (c *completion) changeFilter(f string) {
 	c.filter = f
 	if f == "" {
@@ -0,0 +1,125 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+)
+
+func TestGroupCandidates(t *testing.T) {
+	cands := []*candidate{
+		{code: "a", group: "files"}, {code: "-b", group: "options"},
+		{code: "c", group: "files"}, {code: "-d", group: "options"},
+	}
+	groupCandidates(cands)
+	var codes []string
+	for _, cand := range cands {
+		codes = append(codes, cand.code)
+	}
+	if want := []string{"a", "c", "-b", "-d"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("groupCandidates -> %v, want %v", codes, want)
+	}
+}
+
+func TestCompletionListLayout(t *testing.T) {
+	cands := []*candidate{
+		{menu: ui.Unstyled("-a"), description: "all", group: "options"},
+		{menu: ui.Unstyled("--long"), description: "a very long description", group: "options"},
+		{menu: ui.Unstyled("file"), group: "files"},
+	}
+	c := &completion{
+		complSpec: complSpec{candidates: cands}, filtered: cands,
+		listLayout: needListLayout(cands)}
+	if !c.listLayout {
+		t.Fatalf("needListLayout -> false for candidates with descriptions")
+	}
+
+	tests := []struct {
+		selected  int
+		maxHeight int
+		want      []string
+	}{
+		{0, 10, []string{
+			"options            ", " -a      all", " --long  a very lon",
+			"files              ", " file   "}},
+		// The group header of the selected candidate is scrolled into view.
+		{2, 2, []string{"files              ", " file   "}},
+		{0, 2, []string{"options            ", " -a      all"}},
+	}
+	for _, test := range tests {
+		c.selected = test.selected
+		b := c.ListRender(20, test.maxHeight)
+		var lines []string
+		for _, line := range b.Lines {
+			s := ""
+			for _, cell := range line {
+				s += cell.Text
+			}
+			lines = append(lines, s)
+		}
+		if !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("selecting %d, ListRender(20, %d) -> %q, want %q",
+				test.selected, test.maxHeight, lines, test.want)
+		}
+	}
+}
+
+type fakeComplContext struct {
+	complContextCommon
+	cands []rawCandidate
+	delay time.Duration
+}
+
+func (*fakeComplContext) name() string { return "fake" }
+
+func (ctx *fakeComplContext) generate(ev *eval.Evaler, cancel <-chan struct{}, ch chan<- rawCandidate) error {
+	for _, cand := range ctx.cands {
+		time.Sleep(ctx.delay)
+		ch <- cand
+	}
+	return nil
+}
+
+func newTestComplJob(ctx complContext) *complJob {
+	job := &complJob{name: ctx.name(), common: ctx.common(),
+		batches: make(chan complBatch), cancelChan: make(chan struct{})}
+	go job.run(ctx, nil)
+	return job
+}
+
+func TestComplJob(t *testing.T) {
+	cands := []rawCandidate{plainCandidate("a"), plainCandidate("b"), plainCandidate("c")}
+	job := newTestComplJob(&fakeComplContext{cands: cands, delay: completionBatchInterval / 2})
+	var got []rawCandidate
+	nBatches := 0
+	for batch := range job.Batches() {
+		nBatches++
+		got = append(got, batch.cands...)
+		if batch.done {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, cands) {
+		t.Errorf("job delivered %v, want %v", got, cands)
+	}
+	if nBatches < 2 {
+		t.Errorf("job delivered %d batches, want at least 2", nBatches)
+	}
+
+	// A canceled job stops delivering batches, and the generator is not
+	// blocked.
+	ctx := &fakeComplContext{cands: cands}
+	job = newTestComplJob(ctx)
+	job.Cancel()
+	job.Cancel()
+	select {
+	case batch := <-job.Batches():
+		if batch.done && len(batch.cands) != len(cands) {
+			t.Errorf("canceled job delivered incomplete batch %v", batch)
+		}
+	case <-time.After(2 * completionBatchInterval):
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
 	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/store/storedefs"
 	"github.com/elves/elvish/sys"
 	"github.com/elves/elvish/util"
 )
@@ -45,6 +46,14 @@ type Editor struct {
 
 	historyFuser *history.Fuser
 	historyMutex sync.RWMutex
+	// Identifies this session in the metadata of commands.
+	sessionID string
+	// The last command added to the history, whose metadata is completed when
+	// it finishes. Protected by historyMutex.
+	lastCmdSeq  int
+	lastCmdMeta *storedefs.CmdMeta
+	// Goroutines writing to the history in the background; see WaitPending.
+	historyWrites sync.WaitGroup
 
 	// notifyPort is a write-only port that turns data written to it into editor
 	// notifications.
@@ -73,6 +82,7 @@ type editorState struct {
 
 	promptContent  []*ui.Styled
 	rpromptContent []*ui.Styled
+	contPrompt     string
 
 	mode Mode
 
@@ -105,6 +115,8 @@ func NewEditor(in *os.File, out *os.File, sigs chan os.Signal, ev *eval.Evaler)
 
 		bindings:  makeBindings(),
 		variables: makeVariables(),
+
+		sessionID: fmt.Sprintf("%d-%d", os.Getpid(), time.Now().Unix()),
 	}
 
 	notifyChan := make(chan types.Value)
@@ -156,12 +168,20 @@ func NewEditor(in *os.File, out *os.File, sigs chan os.Signal, ev *eval.Evaler)
 
 // Close releases resources used by the editor.
 func (ed *Editor) Close() {
+	ed.WaitPending()
 	ed.reader.Close()
 	close(ed.notifyPort.Chan)
 	ed.notifyPort.File.Close()
 	ed.notifyRead.Close()
 }
 
+// WaitPending waits for the commands and their metadata that are being added
+// to the history in the background to be written. It must be called before the
+// daemon client is closed.
+func (ed *Editor) WaitPending() {
+	ed.historyWrites.Wait()
+}
+
 // Active returns the activeness of the Editor.
 func (ed *Editor) Active() bool {
 	return ed.active
@@ -224,6 +244,8 @@ func (ed *Editor) refresh(fullRefresh bool, addErrorsToTips bool) error {
 		ed.styling.Add(ctx.Begin, ctx.End, styleForCompilerError.String())
 	}
 
+	ed.contPrompt = ed.continuationPrompt()
+
 	// Render onto a buffer.
 	height, width := sys.GetWinsize(ed.out)
 	height = min(height, ed.maxHeight())
@@ -374,12 +396,25 @@ MainLoop:
 			goto refresh
 		case m := <-isExternalCh:
 			ed.isExternal = m
+		case batch := <-ed.completion.job.Batches():
+			ed.handleComplBatch(batch)
+		case <-ed.evaler.PendingCalls():
+			// Make the callbacks triggered asynchronously while the editor is
+			// idle, such as those of daemon:subscribe.
+			ed.evaler.RunPendingCallsWith(
+				func(name string, fn eval.Fn, args ...types.Value) {
+					ed.CallFn(fn, args...)
+				})
 		case sig := <-ed.sigs:
 			// TODO(xiaq): Maybe support customizable handling of signals
 			switch sig {
 			case syscall.SIGHUP:
 				return "", io.EOF
 			case syscall.SIGINT:
+				// Abort a running completion if there is one.
+				if ed.abortCompletion() {
+					continue MainLoop
+				}
 				// Start over
 				ed.editorState = editorState{
 					restoreTerminal: ed.restoreTerminal,
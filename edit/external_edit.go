@@ -0,0 +1,70 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/elves/elvish/edit/tty"
+)
+
+// Editing the buffer with an external editor.
+
+// defaultExternalEditor is used when $EDITOR is not set.
+const defaultExternalEditor = "vi"
+
+func editExternally(ed *Editor) {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{defaultExternalEditor}
+	}
+
+	f, err := ioutil.TempFile("", "elvish.edit.")
+	if err != nil {
+		ed.Notify("cannot create temporary file: %v", err)
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(ed.buffer)
+	f.Close()
+	if err != nil {
+		ed.Notify("cannot write temporary file: %v", err)
+		return
+	}
+
+	// Hand over the terminal to the external editor.
+	ed.reader.Stop()
+	defer ed.reader.Start()
+	err = ed.restoreTerminal()
+	if err != nil {
+		ed.Notify("cannot restore terminal: %v", err)
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = ed.in, ed.out, ed.out
+	errRun := cmd.Run()
+
+	restoreTerminal, err := tty.Setup(ed.in, ed.out)
+	if err != nil {
+		ed.Notify("cannot set up terminal: %v", err)
+	}
+	if restoreTerminal != nil {
+		ed.restoreTerminal = restoreTerminal
+	}
+	// The external editor has most likely messed up the screen.
+	defer ed.refresh(true, false)
+
+	if errRun != nil {
+		ed.Notify("%s: %v", editor[0], errRun)
+		return
+	}
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		ed.Notify("cannot read temporary file: %v", err)
+		return
+	}
+	// Drop the trailing newline that most editors add.
+	ed.buffer = strings.TrimSuffix(string(content), "\n")
+	ed.dot = len(ed.buffer)
+}
@@ -0,0 +1,203 @@
+// Package fuzzy implements fuzzy matching of strings with a scoring scheme
+// similar to that of fzf.
+//
+// A pattern matches a text when all the runes of the pattern appear in the
+// text in the same order. Among the matches, the shortest one that ends
+// earliest is chosen. Its score rewards matched runes, especially consecutive
+// ones and those at word boundaries, and penalizes the gaps between them.
+package fuzzy
+
+import "unicode"
+
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// Bonus for a match at the beginning of a word after a whitespace.
+	bonusBoundaryWhite = scoreMatch/2 + 2
+	// Bonus for a match at the beginning of a word after a delimiter such as
+	// "/" or "-".
+	bonusBoundaryDelimiter = scoreMatch/2 + 1
+	// Bonus for a match at the beginning of a word after any other non-word
+	// rune.
+	bonusBoundary = scoreMatch / 2
+	// Bonus for a match of a non-word rune.
+	bonusNonWord = scoreMatch / 2
+	// Bonus for a match at a camelCase or letter-to-number transition.
+	bonusCamel = bonusBoundary + scoreGapExtension
+	// Minimal bonus for consecutive matches. It is large enough to make a
+	// consecutive match no worse than a match after a gap.
+	bonusConsecutive = -(scoreGapStart + scoreGapExtension)
+	// The bonus of the first rune of the pattern is multiplied by this.
+	bonusFirstRuneMultiplier = 2
+)
+
+type runeClass int
+
+const (
+	classWhite runeClass = iota
+	classDelimiter
+	classNonWord
+	classLower
+	classUpper
+	classLetter
+	classNumber
+)
+
+func classOf(r rune) runeClass {
+	switch {
+	case unicode.IsSpace(r):
+		return classWhite
+	case r == '/' || r == '-' || r == '_' || r == '.' || r == ',' ||
+		r == ':' || r == ';' || r == '|':
+		return classDelimiter
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsLetter(r):
+		return classLetter
+	case unicode.IsNumber(r):
+		return classNumber
+	default:
+		return classNonWord
+	}
+}
+
+func bonusFor(prev, cur runeClass) int {
+	if cur > classNonWord {
+		switch prev {
+		case classWhite:
+			return bonusBoundaryWhite
+		case classDelimiter:
+			return bonusBoundaryDelimiter
+		case classNonWord:
+			return bonusBoundary
+		}
+	}
+	switch {
+	case prev == classLower && cur == classUpper,
+		prev != classNumber && cur == classNumber:
+		return bonusCamel
+	case cur == classWhite:
+		return bonusBoundaryWhite
+	case cur <= classNonWord:
+		return bonusNonWord
+	}
+	return 0
+}
+
+// Match matches a pattern against a text. If the text matches, it returns the
+// score of the match, the byte indices of the matched runes in the text and
+// true. Otherwise it returns false. An empty pattern matches every text with a
+// score of 0.
+func Match(text, pattern string, ignoreCase bool) (int, []int, bool) {
+	p := []rune(pattern)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	if ignoreCase {
+		for i, r := range p {
+			p[i] = unicode.ToLower(r)
+		}
+	}
+
+	runes := make([]rune, 0, len(text))
+	indices := make([]int, 0, len(text))
+	for i, r := range text {
+		runes = append(runes, r)
+		indices = append(indices, i)
+	}
+	eq := func(i, j int) bool {
+		r := runes[i]
+		if ignoreCase {
+			r = unicode.ToLower(r)
+		}
+		return r == p[j]
+	}
+
+	// Find the end of the earliest match.
+	j := 0
+	end := -1
+	for i := range runes {
+		if eq(i, j) {
+			j++
+			if j == len(p) {
+				end = i + 1
+				break
+			}
+		}
+	}
+	if end == -1 {
+		return 0, nil, false
+	}
+	// Walk backwards to find the shortest match with that end.
+	j = len(p) - 1
+	start := end - 1
+	for ; start >= 0; start-- {
+		if eq(start, j) {
+			j--
+			if j < 0 {
+				break
+			}
+		}
+	}
+
+	// Calculate the score.
+	score := 0
+	positions := make([]int, 0, len(p))
+	prevClass := classWhite
+	if start > 0 {
+		prevClass = classOf(runes[start-1])
+	}
+	inGap := false
+	consecutive := 0
+	firstBonus := 0
+	j = 0
+	for i := start; i < end; i++ {
+		class := classOf(runes[i])
+		if j < len(p) && eq(i, j) {
+			positions = append(positions, indices[i])
+			score += scoreMatch
+			bonus := bonusFor(prevClass, class)
+			if consecutive == 0 {
+				firstBonus = bonus
+			} else {
+				// Break the consecutive chunk at a boundary.
+				if bonus >= bonusBoundary && bonus > firstBonus {
+					firstBonus = bonus
+				}
+				bonus = max(bonus, firstBonus, bonusConsecutive)
+			}
+			if j == 0 {
+				score += bonus * bonusFirstRuneMultiplier
+			} else {
+				score += bonus
+			}
+			inGap = false
+			consecutive++
+			j++
+		} else {
+			if inGap {
+				score += scoreGapExtension
+			} else {
+				score += scoreGapStart
+			}
+			inGap = true
+			consecutive = 0
+			firstBonus = 0
+		}
+		prevClass = class
+	}
+	return score, positions, true
+}
+
+func max(a int, bs ...int) int {
+	for _, b := range bs {
+		if b > a {
+			a = b
+		}
+	}
+	return a
+}
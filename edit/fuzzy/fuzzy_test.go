@@ -0,0 +1,58 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+var matchTests = []struct {
+	text, pattern string
+	ignoreCase    bool
+	wantPositions []int
+	wantOK        bool
+}{
+	{"anything", "", false, nil, true},
+	{"foo bar", "fb", false, []int{0, 4}, true},
+	{"foo bar", "bf", false, nil, false},
+	{"Foo Bar", "fb", false, nil, false},
+	{"Foo Bar", "fb", true, []int{0, 4}, true},
+	// The shortest match is chosen.
+	{"a-a-b", "ab", false, []int{2, 4}, true},
+	// Positions are byte indices.
+	{"αβγ", "γ", false, []int{4}, true},
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range matchTests {
+		_, positions, ok := Match(test.text, test.pattern, test.ignoreCase)
+		if ok != test.wantOK || !reflect.DeepEqual(positions, test.wantPositions) {
+			t.Errorf("Match(%q, %q, %v) => (_, %v, %v), want (_, %v, %v)",
+				test.text, test.pattern, test.ignoreCase,
+				positions, ok, test.wantPositions, test.wantOK)
+		}
+	}
+}
+
+var rankingTests = []struct {
+	pattern       string
+	better, worse string
+}{
+	// Consecutive matches are better.
+	{"foo", "foobar", "fxoxo"},
+	// Matches at word boundaries are better.
+	{"ab", "app/build", "cabin"},
+	{"fB", "fooBar", "fABr"},
+	// Shorter gaps are better.
+	{"ac", "abc", "abbbbc"},
+}
+
+func TestMatchRanking(t *testing.T) {
+	for _, test := range rankingTests {
+		better, _, _ := Match(test.better, test.pattern, false)
+		worse, _, _ := Match(test.worse, test.pattern, false)
+		if better <= worse {
+			t.Errorf("pattern %q: %q scores %d, not better than %q (%d)",
+				test.pattern, test.better, better, test.worse, worse)
+		}
+	}
+}
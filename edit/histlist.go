@@ -3,10 +3,13 @@ package edit
 import (
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
-	"strings"
 
+	"github.com/elves/elvish/edit/history"
 	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // Command history listing mode.
@@ -15,6 +18,9 @@ var _ = registerBuiltins(modeHistoryListing, map[string]func(*Editor){
 	"start":                   histlistStart,
 	"toggle-dedup":            histlistToggleDedup,
 	"toggle-case-sensitivity": histlistToggleCaseSensitivity,
+	"toggle-dir-filter":       histlistToggleDirFilter,
+	"toggle-session-filter":   histlistToggleSessionFilter,
+	"toggle-failed-filter":    histlistToggleFailedFilter,
 })
 
 // ErrStoreOffline is thrown when an operation requires the storage backend, but
@@ -23,25 +29,59 @@ var ErrStoreOffline = errors.New("store offline")
 
 type histlist struct {
 	all             []string
+	metas           []*storedefs.CmdMeta
+	filter          histlistFilter
 	dedup           bool
 	caseInsensitive bool
 	last            map[string]int
 	shown           []string
 	index           []int
 	indexWidth      int
+	// The matcher to use; nil means the default substring matcher.
+	match      listingMatcher
+	highlights [][]int
 }
 
-func newHistlist(cmds []string) *listing {
+// histlistFilter restricts the commands in the history listing by their
+// metadata. Commands without metadata are not shown when any restriction is in
+// effect.
+type histlistFilter struct {
+	dir     string // If not empty, only show commands run in this directory.
+	session string // If not empty, only show commands from this session.
+	failed  bool   // Only show commands that have failed.
+}
+
+func (f histlistFilter) active() bool {
+	return f.dir != "" || f.session != "" || f.failed
+}
+
+func (f histlistFilter) allows(meta *storedefs.CmdMeta) bool {
+	if !f.active() {
+		return true
+	}
+	return meta != nil &&
+		(f.dir == "" || meta.Dir == f.dir) &&
+		(f.session == "" || meta.Session == f.session) &&
+		(!f.failed || meta.ExitStatus > 0)
+}
+
+func newHistlist(entries []history.Entry, match listingMatcher) *listing {
+	cmds := make([]string, len(entries))
+	metas := make([]*storedefs.CmdMeta, len(entries))
 	last := make(map[string]int)
-	for i, entry := range cmds {
-		last[entry] = i
+	for i, entry := range entries {
+		cmds[i] = entry.Cmd
+		metas[i] = entry.Meta
+		last[entry.Cmd] = i
 	}
 	hl := &histlist{
 		// This has to be here for the initialization to work :(
 		all:        cmds,
+		metas:      metas,
 		dedup:      true,
 		last:       last,
 		indexWidth: len(strconv.Itoa(len(cmds) - 1)),
+		match:      match,
 	}
 	l := newListing(modeHistoryListing, hl)
 	return &l
@@ -55,6 +95,15 @@ func (hl *histlist) ModeTitle(i int) string {
 	if hl.caseInsensitive {
 		s += "(case-insensitive) "
 	}
+	if hl.filter.dir != "" {
+		s += "(this dir) "
+	}
+	if hl.filter.session != "" {
+		s += "(this session) "
+	}
+	if hl.filter.failed {
+		s += "(failed) "
+	}
 	return s
 }
 
@@ -70,27 +119,64 @@ func (hl *histlist) Show(i int) (string, ui.Styled) {
 	return fmt.Sprintf("%d", hl.index[i]), ui.Unstyled(hl.shown[i])
 }
 
+func (hl *histlist) Highlights(i int) []int {
+	return hl.highlights[i]
+}
+
 func (hl *histlist) Filter(filter string) int {
-	hl.shown = nil
-	hl.index = nil
-	dedup := hl.dedup
-	if hl.caseInsensitive {
-		filter = strings.ToLower(filter)
-	}
+	var index []int
+	var entries []string
 	for i, entry := range hl.all {
-		fentry := entry
-		if hl.caseInsensitive {
-			fentry = strings.ToLower(entry)
+		if (!hl.dedup || hl.last[entry] == i) && hl.filter.allows(hl.metas[i]) {
+			index = append(index, i)
+			entries = append(entries, entry)
 		}
-		if (!dedup || hl.last[entry] == i) && strings.Contains(fentry, filter) {
-			hl.index = append(hl.index, i)
-			hl.shown = append(hl.shown, entry)
+	}
+	match := hl.match
+	if match == nil {
+		match = matchSubstrs
+	}
+	results := match(entries, filter, hl.caseInsensitive)
+
+	var matched scoredHistlist
+	for i, result := range results {
+		if result != nil {
+			matched.index = append(matched.index, index[i])
+			matched.results = append(matched.results, result)
 		}
 	}
+	// The best matches are put at the bottom, where the selection starts.
+	sort.Stable(matched)
+
+	hl.index = matched.index
+	hl.shown = make([]string, len(matched.index))
+	hl.highlights = make([][]int, len(matched.index))
+	for i, j := range matched.index {
+		hl.shown[i] = hl.all[j]
+		hl.highlights[i] = matched.results[i].positions
+	}
 	// TODO: Maintain old selection
 	return len(hl.shown) - 1
 }
 
+// scoredHistlist sorts history entries by their match scores in ascending
+// order.
+type scoredHistlist struct {
+	index   []int
+	results []*matchResult
+}
+
+func (s scoredHistlist) Len() int { return len(s.index) }
+
+func (s scoredHistlist) Swap(i, j int) {
+	s.index[i], s.index[j] = s.index[j], s.index[i]
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+}
+
+func (s scoredHistlist) Less(i, j int) bool {
+	return s.results[i].score < s.results[j].score
+}
+
 // Editor interface.
 
 func (hl *histlist) Accept(i int, ed *Editor) {
@@ -102,20 +188,21 @@ func (hl *histlist) Accept(i int, ed *Editor) {
 }
 
 func histlistStart(ed *Editor) {
-	cmds, err := getCmds(ed)
+	entries, err := getHistoryEntries(ed)
 	if err != nil {
 		ed.Notify("%v", err)
 		return
 	}
 
-	ed.mode = newHistlist(cmds)
+	ed.mode = newHistlist(entries, ed.listingMatcher(modeHistoryListing))
 }
 
-func getCmds(ed *Editor) ([]string, error) {
+func getHistoryEntries(ed *Editor) ([]history.Entry, error) {
 	if ed.daemon == nil {
 		return nil, ErrStoreOffline
 	}
-	return ed.historyFuser.AllCmds()
+	ed.refreshHistory()
+	return ed.historyFuser.AllEntries()
 }
 
 func histlistToggleDedup(ed *Editor) {
@@ -132,6 +219,40 @@ func histlistToggleCaseSensitivity(ed *Editor) {
 	}
 }
 
+func histlistToggleDirFilter(ed *Editor) {
+	if l, hl, ok := getHistlist(ed); ok {
+		if hl.filter.dir == "" {
+			dir, err := os.Getwd()
+			if err != nil {
+				ed.Notify("%v", err)
+				return
+			}
+			hl.filter.dir = dir
+		} else {
+			hl.filter.dir = ""
+		}
+		l.refresh()
+	}
+}
+
+func histlistToggleSessionFilter(ed *Editor) {
+	if l, hl, ok := getHistlist(ed); ok {
+		if hl.filter.session == "" {
+			hl.filter.session = ed.sessionID
+		} else {
+			hl.filter.session = ""
+		}
+		l.refresh()
+	}
+}
+
+func histlistToggleFailedFilter(ed *Editor) {
+	if l, hl, ok := getHistlist(ed); ok {
+		hl.filter.failed = !hl.filter.failed
+		l.refresh()
+	}
+}
+
 func getHistlist(ed *Editor) (*listing, *histlist, bool) {
 	if l, ok := ed.mode.(*listing); ok {
 		if hl, ok := l.provider.(*histlist); ok {
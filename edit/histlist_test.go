@@ -3,11 +3,17 @@ package edit
 import (
 	"testing"
 
+	"github.com/elves/elvish/edit/history"
 	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 var (
-	theHistList = newHistlist([]string{"ls", "echo lalala", "ls"})
+	theHistList = newHistlist([]history.Entry{
+		{Seq: 1, Cmd: "ls", Meta: &storedefs.CmdMeta{Dir: "/a", Session: "s1"}},
+		{Seq: 2, Cmd: "echo lalala", Meta: &storedefs.CmdMeta{Dir: "/b", ExitStatus: 1, Session: "s2"}},
+		{Seq: 3, Cmd: "ls"},
+	}, nil)
 
 	histlistDedupFilterTests = []listingFilterTestCases{
 		{"", []shown{
@@ -35,3 +41,20 @@ func TestHistlist(t *testing.T) {
 	theHistList.provider.(*histlist).dedup = false
 	testListingFilter(t, "theHistList", theHistList, histlistNoDedupFilterTests)
 }
+
+func TestHistlistMetaFilter(t *testing.T) {
+	hl := theHistList.provider.(*histlist)
+	hl.dedup = false
+	defer func() { hl.filter = histlistFilter{} }()
+
+	hl.filter = histlistFilter{dir: "/a"}
+	testListingFilter(t, "theHistList", theHistList, []listingFilterTestCases{
+		{"", []shown{{"0", ui.Unstyled("ls")}}}})
+	hl.filter = histlistFilter{session: "s2"}
+	testListingFilter(t, "theHistList", theHistList, []listingFilterTestCases{
+		{"", []shown{{"1", ui.Unstyled("echo lalala")}}}})
+	hl.filter = histlistFilter{failed: true}
+	testListingFilter(t, "theHistList", theHistList, []listingFilterTestCases{
+		{"l", []shown{{"1", ui.Unstyled("echo lalala")}}},
+		{"ls", []shown{}}})
+}
@@ -3,12 +3,16 @@ package edit
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/elves/elvish/edit/history"
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // Command history mode.
@@ -22,6 +26,31 @@ var _ = registerBuiltins("history", map[string]func(*Editor){
 	"default":            wrapHistoryBuiltin(historyDefault),
 })
 
+// When $edit:share-history is true, commands added by other sessions become
+// visible to history mode, history listing and history search as soon as they
+// are started, instead of only to sessions started afterwards. Commands from
+// the current session still come first in history mode.
+var _ = RegisterVariable("share-history", func() vartypes.Variable {
+	b := false
+	return vartypes.NewBool(&b)
+})
+
+func (ed *Editor) shareHistory() bool {
+	return bool(ed.variables["share-history"].Get().(types.Bool))
+}
+
+// refreshHistory makes commands from other sessions visible if
+// $edit:share-history is true.
+func (ed *Editor) refreshHistory() {
+	if ed.historyFuser == nil || !ed.shareHistory() {
+		return
+	}
+	err := ed.historyFuser.Refresh()
+	if err != nil {
+		logger.Println("failed to refresh history:", err)
+	}
+}
+
 type hist struct {
 	*history.Walker
 }
@@ -39,6 +68,7 @@ func historyStart(ed *Editor) {
 		ed.Notify("history offline")
 		return
 	}
+	ed.refreshHistory()
 	prefix := ed.buffer[:ed.dot]
 	walker := ed.historyFuser.Walker(prefix)
 	hist := hist{walker}
@@ -100,21 +130,69 @@ func historyDefault(ed *Editor, hist *hist) {
 }
 
 func (ed *Editor) appendHistory(line string) {
-	// TODO: should have a user variable to control the behavior
-	// Do not add command leading by space into history. This is
-	// useful for confidential operations.
-	if strings.HasPrefix(line, " ") {
+	if prefix := ed.historyIgnorePrefix(); prefix != "" && strings.HasPrefix(line, prefix) {
 		return
 	}
+	line = redact(line, ed.historyRedact())
 
 	if ed.daemon != nil && ed.historyFuser != nil {
+		// Drop the error; an empty dir means that the directory is unknown.
+		dir, _ := os.Getwd()
+		meta := &storedefs.CmdMeta{
+			StartTime: time.Now(), Dir: dir, ExitStatus: -1, Session: ed.sessionID}
 		ed.historyMutex.Lock()
+		ed.historyWrites.Add(1)
 		go func() {
-			err := ed.historyFuser.AddCmd(line)
+			defer ed.historyWrites.Done()
+			seq, err := ed.historyFuser.AddCmdWithMeta(line, meta)
+			if seq != -1 {
+				ed.lastCmdSeq, ed.lastCmdMeta = seq, meta
+			}
 			ed.historyMutex.Unlock()
 			if err != nil {
-				logger.Printf("Failed to AddCmd %q: %v", line, err)
+				logger.Printf("Failed to add %q to history: %v", line, err)
 			}
 		}()
 	}
 }
+
+// RecordCmdResult completes the metadata of the command last added to the
+// history with its duration and exit status. It should be called after the
+// command returned by ReadLine has finished executing, with the error it
+// resulted in.
+func (ed *Editor) RecordCmdResult(err error) {
+	ed.historyMutex.Lock()
+	seq, meta := ed.lastCmdSeq, ed.lastCmdMeta
+	ed.lastCmdMeta = nil
+	ed.historyMutex.Unlock()
+	if meta == nil {
+		return
+	}
+
+	finished := *meta
+	finished.Duration = time.Since(meta.StartTime)
+	finished.ExitStatus = exitStatus(err)
+	ed.historyWrites.Add(1)
+	go func() {
+		defer ed.historyWrites.Done()
+		err := ed.historyFuser.SetCmdMeta(seq, finished)
+		if err != nil {
+			logger.Printf("Failed to SetCmdMeta %d: %v", seq, err)
+		}
+	}()
+}
+
+// exitStatus derives an exit status from the error resulting from executing a
+// command: 0 for success, the exit status of an external command if that
+// caused the failure, and 1 otherwise.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exc, ok := err.(*eval.Exception); ok {
+		if exit, ok := exc.Cause.(eval.ExternalCmdExit); ok && exit.Exited() {
+			return exit.ExitStatus()
+		}
+	}
+	return 1
+}
@@ -2,10 +2,18 @@ package history
 
 import (
 	"sync"
+
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // Fuser provides a unified view into a shared storage-backed command history
 // and per-session history.
+//
+// Commands in the storage with sequence numbers below storeUpper are visible
+// to the Fuser. It is initially the sequence number of the next command at the
+// time of creation, so that commands from other sessions are not visible.
+// Refresh brings it up to date; the commands from the session itself are then
+// also part of the visible storage history.
 type Fuser struct {
 	store      Store
 	storeUpper int
@@ -13,8 +21,9 @@ type Fuser struct {
 	*sync.RWMutex
 
 	// Per-session history.
-	cmds []string
-	seqs []int
+	cmds  []string
+	seqs  []int
+	metas []*storedefs.CmdMeta
 }
 
 func NewFuser(store Store) (*Fuser, error) {
@@ -29,18 +38,100 @@ func NewFuser(store Store) (*Fuser, error) {
 	}, nil
 }
 
-func (f *Fuser) AddCmd(cmd string) error {
+// Refresh makes all commands currently in the storage, including those added
+// by other sessions after the Fuser was created, visible.
+func (f *Fuser) Refresh() error {
 	f.Lock()
 	defer f.Unlock()
-	seq, err := f.store.AddCmd(cmd)
+	upper, err := f.store.NextCmdSeq()
 	if err != nil {
 		return err
 	}
+	f.storeUpper = upper
+	return nil
+}
+
+func (f *Fuser) AddCmd(cmd string) error {
+	_, err := f.AddCmdWithMeta(cmd, nil)
+	return err
+}
+
+// AddCmdWithMeta is like AddCmd, but also records the metadata of the command
+// if it is not nil. It returns the sequence number of the command.
+func (f *Fuser) AddCmdWithMeta(cmd string, meta *storedefs.CmdMeta) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	var (
+		seq int
+		err error
+	)
+	if meta == nil {
+		seq, err = f.store.AddCmd(cmd)
+	} else {
+		seq, err = f.store.AddCmdWithMeta(cmd, *meta)
+	}
+	if err != nil {
+		return -1, err
+	}
 	f.cmds = append(f.cmds, cmd)
 	f.seqs = append(f.seqs, seq)
+	f.metas = append(f.metas, meta)
+	return seq, nil
+}
+
+// SetCmdMeta updates the metadata of a command from the session history.
+func (f *Fuser) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.seqs {
+		if f.seqs[i] == seq {
+			f.metas[i] = &meta
+		}
+	}
+	return f.store.SetCmdMeta(seq, meta)
+}
+
+// RemoveCmd removes a command from both the storage and the session history.
+func (f *Fuser) RemoveCmd(seq int) error {
+	f.Lock()
+	defer f.Unlock()
+	err := f.store.RemoveCmd(seq)
+	if err != nil {
+		return err
+	}
+	f.removeFromSession(map[int]bool{seq: true})
 	return nil
 }
 
+// DedupCmds removes all but the last occurrence of each command from the
+// storage, and removes the same commands from the session history. It returns
+// the sequence numbers of the removed commands.
+func (f *Fuser) DedupCmds() ([]int, error) {
+	f.Lock()
+	defer f.Unlock()
+	removed, err := f.store.DedupCmds()
+	if err != nil {
+		return nil, err
+	}
+	removedSet := make(map[int]bool, len(removed))
+	for _, seq := range removed {
+		removedSet[seq] = true
+	}
+	f.removeFromSession(removedSet)
+	return removed, nil
+}
+
+func (f *Fuser) removeFromSession(seqs map[int]bool) {
+	j := 0
+	for i := range f.cmds {
+		if !seqs[f.seqs[i]] {
+			f.cmds[j], f.seqs[j], f.metas[j] = f.cmds[i], f.seqs[i], f.metas[i]
+			j++
+		}
+	}
+	f.cmds, f.seqs, f.metas = f.cmds[:j], f.seqs[:j], f.metas[:j]
+}
+
 func (f *Fuser) AllCmds() ([]string, error) {
 	f.RLock()
 	defer f.RUnlock()
@@ -48,13 +139,53 @@ func (f *Fuser) AllCmds() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return append(cmds, f.cmds...), nil
+	return append(cmds, f.cmds[f.sessionStart():]...), nil
+}
+
+// sessionStart returns the index of the first session command that is not
+// part of the visible storage history.
+func (f *Fuser) sessionStart() int {
+	i := len(f.seqs)
+	for i > 0 && f.seqs[i-1] >= f.storeUpper {
+		i--
+	}
+	return i
 }
 
 func (f *Fuser) SessionCmds() []string {
 	return f.cmds
 }
 
+// AllEntries is like AllCmds, but returns Entry's.
+func (f *Fuser) AllEntries() ([]Entry, error) {
+	f.RLock()
+	defer f.RUnlock()
+	cmds, err := f.store.CmdsWithMeta(0, f.storeUpper)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, len(cmds), len(cmds)+len(f.cmds))
+	for i, cmd := range cmds {
+		entries[i] = Entry{cmd.Seq, cmd.Text, cmd.Meta}
+	}
+	return append(entries, f.sessionEntries()[f.sessionStart():]...), nil
+}
+
+// SessionEntries returns the session history as Entry's.
+func (f *Fuser) SessionEntries() []Entry {
+	f.RLock()
+	defer f.RUnlock()
+	return f.sessionEntries()
+}
+
+func (f *Fuser) sessionEntries() []Entry {
+	entries := make([]Entry, len(f.cmds))
+	for i, cmd := range f.cmds {
+		entries[i] = Entry{f.seqs[i], cmd, f.metas[i]}
+	}
+	return entries
+}
+
 func (f *Fuser) Walker(prefix string) *Walker {
 	f.RLock()
 	defer f.RUnlock()
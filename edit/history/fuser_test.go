@@ -4,6 +4,8 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
 )
 
 func TestNewFuser(t *testing.T) {
@@ -71,3 +73,111 @@ func TestFuser(t *testing.T) {
 	wantCmd(t, w.Prev, 0, "store 1")
 	wantErr(t, w.Prev, ErrEndOfHistory)
 }
+
+func TestFuserMeta(t *testing.T) {
+	store := &mockStore{cmds: []string{"store 1"},
+		metas: map[int]storedefs.CmdMeta{0: {Dir: "/store"}}}
+	f, err := NewFuser(store)
+	if err != nil {
+		t.Errorf("NewFuser -> error %v, want nil", err)
+	}
+	seq, err := f.AddCmdWithMeta("session 1", &storedefs.CmdMeta{Dir: "/a", ExitStatus: -1})
+	if seq != 1 || err != nil {
+		t.Errorf("AddCmdWithMeta -> (%v, %v), want (1, nil)", seq, err)
+	}
+	f.AddCmd("session 2")
+	// Finishing a command updates the metadata in both the session history and
+	// the storage.
+	f.SetCmdMeta(1, storedefs.CmdMeta{Dir: "/a", ExitStatus: 0})
+	if store.metas[1].ExitStatus != 0 {
+		t.Errorf("SetCmdMeta doesn't update backend storage")
+	}
+
+	entries, err := f.AllEntries()
+	wantEntries := []Entry{
+		{0, "store 1", &storedefs.CmdMeta{Dir: "/store"}},
+		{1, "session 1", &storedefs.CmdMeta{Dir: "/a", ExitStatus: 0}},
+		{2, "session 2", nil},
+	}
+	if !reflect.DeepEqual(entries, wantEntries) || err != nil {
+		t.Errorf("AllEntries -> (%v, %v), want (%v, nil)", entries, err, wantEntries)
+	}
+	if !reflect.DeepEqual(f.SessionEntries(), wantEntries[1:]) {
+		t.Errorf("SessionEntries -> %v, want %v", f.SessionEntries(), wantEntries[1:])
+	}
+}
+
+func TestFuserRemove(t *testing.T) {
+	store := &mockStore{cmds: []string{"store 1"}, duplicates: []int{1}}
+	f, _ := NewFuser(store)
+	f.AddCmd("session 1")
+	f.AddCmd("session 2")
+	f.AddCmd("session 1")
+
+	if err := f.RemoveCmd(2); err != nil {
+		t.Errorf("RemoveCmd -> error %v, want nil", err)
+	}
+	if !reflect.DeepEqual(store.removed, []int{2}) {
+		t.Errorf("RemoveCmd doesn't remove command from backend storage")
+	}
+	if !reflect.DeepEqual(f.SessionCmds(), []string{"session 1", "session 1"}) {
+		t.Errorf("RemoveCmd doesn't remove command from session history")
+	}
+
+	removed, err := f.DedupCmds()
+	if !reflect.DeepEqual(removed, []int{1}) || err != nil {
+		t.Errorf("DedupCmds -> (%v, %v), want ([1], nil)", removed, err)
+	}
+	if !reflect.DeepEqual(f.SessionCmds(), []string{"session 1"}) {
+		t.Errorf("DedupCmds doesn't remove command from session history")
+	}
+}
+
+func TestFuserRefresh(t *testing.T) {
+	store := &mockStore{cmds: []string{"store 1"}}
+	f, _ := NewFuser(store)
+	f.AddCmd("session 1")
+	store.AddCmd("other session 1")
+	f.AddCmd("session 2")
+	store.AddCmd("session 1")
+
+	// Commands from other sessions are invisible before refreshing.
+	cmds, _ := f.AllCmds()
+	if !reflect.DeepEqual(cmds, []string{"store 1", "session 1", "session 2"}) {
+		t.Errorf("AllCmds before Refresh -> %v", cmds)
+	}
+
+	if err := f.Refresh(); err != nil {
+		t.Errorf("Refresh -> error %v, want nil", err)
+	}
+	f.AddCmd("session 3")
+
+	// After refreshing, all commands are in chronological order, and each
+	// session command appears only once.
+	cmds, err := f.AllCmds()
+	wantCmds := []string{"store 1", "session 1", "other session 1",
+		"session 2", "session 1", "session 3"}
+	if !reflect.DeepEqual(cmds, wantCmds) || err != nil {
+		t.Errorf("AllCmds -> (%v, %v), want (%v, nil)", cmds, err, wantCmds)
+	}
+	entries, err := f.AllEntries()
+	if len(entries) != len(wantCmds) || entries[2].Seq != 2 || err != nil {
+		t.Errorf("AllEntries -> (%v, %v)", entries, err)
+	}
+
+	// Walking the history prioritizes commands from the session itself.
+	w := f.Walker("")
+	wantCmd(t, w.Prev, 5, "session 3")
+	wantCmd(t, w.Prev, 3, "session 2")
+	wantCmd(t, w.Prev, 1, "session 1")
+	wantCmd(t, w.Prev, 2, "other session 1")
+	wantCmd(t, w.Prev, 0, "store 1")
+	wantErr(t, w.Prev, ErrEndOfHistory)
+
+	// Refresh forwards backend storage error.
+	mockError := errors.New("mock error")
+	store.oneOffError = mockError
+	if err := f.Refresh(); err != mockError {
+		t.Errorf("Refresh -> error %v, want %v", err, mockError)
+	}
+}
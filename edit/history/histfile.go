@@ -0,0 +1,276 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// ErrUnknownFormat is returned when importing or exporting history in an
+// unsupported format.
+var ErrUnknownFormat = errors.New("unknown history format")
+
+// Formats of history files. The "lines" and "json" formats can be both
+// imported and exported, while the "bash" and "zsh" formats can only be
+// imported.
+//
+// In the "lines" format, each command is on its own line, with backslashes and
+// newlines escaped as \\ and \n. In the "json" format, each command is a JSON
+// object on its own line, with the metadata of the command as fields.
+const (
+	FormatLines = "lines"
+	FormatJSON  = "json"
+	FormatBash  = "bash"
+	FormatZsh   = "zsh"
+)
+
+// Import reads history entries in the given format. The Seq fields of the
+// returned entries are -1 unless they were recorded in the input.
+func Import(r io.Reader, format string) ([]Entry, error) {
+	switch format {
+	case FormatLines:
+		return importLines(r)
+	case FormatJSON:
+		return importJSON(r)
+	case FormatBash:
+		return importBash(r)
+	case FormatZsh:
+		return importZsh(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// CanExport returns whether history can be exported in the given format.
+func CanExport(format string) bool {
+	return format == FormatLines || format == FormatJSON
+}
+
+// Export writes history entries in the given format.
+func Export(w io.Writer, format string, entries []Entry) error {
+	if !CanExport(format) {
+		return ErrUnknownFormat
+	}
+	bw := bufio.NewWriter(w)
+	for _, entry := range entries {
+		var err error
+		switch format {
+		case FormatLines:
+			_, err = fmt.Fprintln(bw, escapeLine(entry.Cmd))
+		case FormatJSON:
+			var data []byte
+			data, err = json.Marshal(newJSONEntry(entry))
+			if err == nil {
+				_, err = fmt.Fprintf(bw, "%s\n", data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	lineEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	lineUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+)
+
+func escapeLine(s string) string   { return lineEscaper.Replace(s) }
+func unescapeLine(s string) string { return lineUnescaper.Replace(s) }
+
+func importLines(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	err := eachLine(r, func(line string) {
+		entries = append(entries, Entry{Seq: -1, Cmd: unescapeLine(line)})
+	})
+	return entries, err
+}
+
+// jsonEntry is the representation of an Entry in the JSON format. Times are
+// in seconds, with the start time measured since the Unix epoch.
+type jsonEntry struct {
+	Seq        int      `json:"seq"`
+	Cmd        string   `json:"cmd"`
+	StartTime  *int64   `json:"start-time,omitempty"`
+	Duration   *float64 `json:"duration,omitempty"`
+	Dir        string   `json:"dir,omitempty"`
+	ExitStatus *int     `json:"exit-status,omitempty"`
+	Session    string   `json:"session,omitempty"`
+}
+
+func newJSONEntry(entry Entry) *jsonEntry {
+	j := &jsonEntry{Seq: entry.Seq, Cmd: entry.Cmd}
+	if meta := entry.Meta; meta != nil {
+		startTime := meta.StartTime.Unix()
+		duration := meta.Duration.Seconds()
+		exitStatus := meta.ExitStatus
+		j.StartTime, j.Duration, j.ExitStatus = &startTime, &duration, &exitStatus
+		j.Dir, j.Session = meta.Dir, meta.Session
+	}
+	return j
+}
+
+func (j *jsonEntry) entry() Entry {
+	entry := Entry{Seq: j.Seq, Cmd: j.Cmd}
+	if j.StartTime != nil || j.Duration != nil || j.Dir != "" ||
+		j.ExitStatus != nil || j.Session != "" {
+
+		meta := &storedefs.CmdMeta{Dir: j.Dir, ExitStatus: -1, Session: j.Session}
+		if j.StartTime != nil {
+			meta.StartTime = time.Unix(*j.StartTime, 0)
+		}
+		if j.Duration != nil {
+			meta.Duration = time.Duration(*j.Duration * float64(time.Second))
+		}
+		if j.ExitStatus != nil {
+			meta.ExitStatus = *j.ExitStatus
+		}
+		entry.Meta = meta
+	}
+	return entry
+}
+
+func importJSON(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	decoder := json.NewDecoder(r)
+	for {
+		j := &jsonEntry{Seq: -1}
+		err := decoder.Decode(j)
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, j.entry())
+	}
+}
+
+// importBash imports a bash history file. When the file contains timestamps
+// (written when $HISTTIMEFORMAT is set), each command is preceded by a line of
+// the form #<timestamp>, and may span multiple lines.
+func importBash(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var lines []string
+	var startTime int64
+	hasTimestamps := false
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		entry := Entry{Seq: -1, Cmd: strings.Join(lines, "\n")}
+		if hasTimestamps {
+			entry.Meta = &storedefs.CmdMeta{
+				StartTime: time.Unix(startTime, 0), ExitStatus: -1}
+		}
+		entries = append(entries, entry)
+		lines = nil
+	}
+	err := eachLine(r, func(line string) {
+		if ts, ok := parseBashTimestamp(line); ok {
+			flush()
+			hasTimestamps = true
+			startTime = ts
+			return
+		}
+		lines = append(lines, line)
+		if !hasTimestamps {
+			flush()
+		}
+	})
+	flush()
+	return entries, err
+}
+
+func parseBashTimestamp(line string) (int64, bool) {
+	if !strings.HasPrefix(line, "#") {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(line[1:], 10, 64)
+	return ts, err == nil
+}
+
+// importZsh imports a zsh history file, in either the plain or the extended
+// format. In the extended format, each command is prefixed with
+// ": <start time>:<duration>;". Lines ending with a backslash are continued on
+// the next line.
+func importZsh(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var buf []string
+	err := eachLine(r, func(line string) {
+		line = unmetafy(line)
+		if strings.HasSuffix(line, `\`) {
+			buf = append(buf, line[:len(line)-1])
+			return
+		}
+		buf = append(buf, line)
+		entries = append(entries, parseZshEntry(strings.Join(buf, "\n")))
+		buf = nil
+	})
+	if len(buf) > 0 {
+		entries = append(entries, parseZshEntry(strings.Join(buf, "\n")))
+	}
+	return entries, err
+}
+
+func parseZshEntry(s string) Entry {
+	if strings.HasPrefix(s, ": ") {
+		if i := strings.IndexByte(s, ';'); i != -1 {
+			fields := strings.SplitN(s[2:i], ":", 2)
+			if len(fields) == 2 {
+				start, err1 := strconv.ParseInt(fields[0], 10, 64)
+				elapsed, err2 := strconv.ParseInt(fields[1], 10, 64)
+				if err1 == nil && err2 == nil {
+					return Entry{Seq: -1, Cmd: s[i+1:], Meta: &storedefs.CmdMeta{
+						StartTime:  time.Unix(start, 0),
+						Duration:   time.Duration(elapsed) * time.Second,
+						ExitStatus: -1,
+					}}
+				}
+			}
+		}
+	}
+	return Entry{Seq: -1, Cmd: s}
+}
+
+// zshMeta is the byte zsh uses to escape special bytes in history files; the
+// byte following it should be XOR'ed with 32.
+const zshMeta = 0x83
+
+func unmetafy(s string) string {
+	if strings.IndexByte(s, zshMeta) == -1 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == zshMeta && i+1 < len(s) {
+			i++
+			b = append(b, s[i]^32)
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+func eachLine(r io.Reader, f func(string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			f(strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package history
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+var importTests = []struct {
+	format string
+	input  string
+	want   []Entry
+}{
+	{FormatLines, "echo a\\nb\nls \\\\\n", []Entry{
+		{-1, "echo a\nb", nil}, {-1, `ls \`, nil}}},
+	{FormatJSON,
+		`{"seq":1,"cmd":"ls"}` + "\n" +
+			`{"seq":2,"cmd":"make","start-time":100,"duration":1.5,"dir":"/a","exit-status":2,"session":"s"}`,
+		[]Entry{
+			{1, "ls", nil},
+			{2, "make", &storedefs.CmdMeta{
+				StartTime: time.Unix(100, 0), Duration: 1500 * time.Millisecond,
+				Dir: "/a", ExitStatus: 2, Session: "s"}}}},
+	{FormatBash, "ls\necho a\n", []Entry{
+		{-1, "ls", nil}, {-1, "echo a", nil}}},
+	{FormatBash, "#100\nls\n#200\nfor x in a; do\necho $x; done\n", []Entry{
+		{-1, "ls", &storedefs.CmdMeta{StartTime: time.Unix(100, 0), ExitStatus: -1}},
+		{-1, "for x in a; do\necho $x; done",
+			&storedefs.CmdMeta{StartTime: time.Unix(200, 0), ExitStatus: -1}}}},
+	{FormatZsh, "ls\n: 100:3;make\\\ninstall\n", []Entry{
+		{-1, "ls", nil},
+		{-1, "make\ninstall", &storedefs.CmdMeta{
+			StartTime: time.Unix(100, 0), Duration: 3 * time.Second, ExitStatus: -1}}}},
+	// Metafied bytes in zsh history: 0x83 0xa2 is 0x82.
+	{FormatZsh, "echo \x83\xa2\n", []Entry{{-1, "echo \x82", nil}}},
+}
+
+func TestImport(t *testing.T) {
+	for _, test := range importTests {
+		entries, err := Import(strings.NewReader(test.input), test.format)
+		if !reflect.DeepEqual(entries, test.want) || err != nil {
+			t.Errorf("Import(%q, %q) -> (%v, %v), want (%v, nil)",
+				test.input, test.format, entries, err, test.want)
+		}
+	}
+	if _, err := Import(strings.NewReader(""), "fish"); err != ErrUnknownFormat {
+		t.Errorf("Import with unknown format -> error %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	entries := []Entry{
+		{1, "echo a\nb", nil},
+		{2, `ls \n`, &storedefs.CmdMeta{
+			StartTime: time.Unix(100, 0), Duration: time.Second, Dir: "/a", Session: "s"}},
+	}
+	for _, format := range []string{FormatLines, FormatJSON} {
+		var buf bytes.Buffer
+		if err := Export(&buf, format, entries); err != nil {
+			t.Errorf("Export(%q) -> error %v", format, err)
+		}
+		imported, err := Import(&buf, format)
+		if err != nil {
+			t.Errorf("Import(%q) -> error %v", format, err)
+		}
+		for i, entry := range imported {
+			if entry.Cmd != entries[i].Cmd {
+				t.Errorf("format %q: command %d is %q after round trip, want %q",
+					format, i, entry.Cmd, entries[i].Cmd)
+			}
+			if format == FormatJSON && !reflect.DeepEqual(entry, entries[i]) {
+				t.Errorf("format %q: entry %d is %v after round trip, want %v",
+					format, i, entry, entries[i])
+			}
+		}
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	for _, format := range []string{FormatBash, "fish"} {
+		if CanExport(format) {
+			t.Errorf("CanExport(%q) -> true, want false", format)
+		}
+		// The format is checked even if there is nothing to export.
+		if err := Export(&bytes.Buffer{}, format, nil); err != ErrUnknownFormat {
+			t.Errorf("Export(%q) -> error %v, want %v", format, err, ErrUnknownFormat)
+		}
+	}
+}
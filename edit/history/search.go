@@ -0,0 +1,155 @@
+package history
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Entry is a command history entry.
+type Entry struct {
+	Seq int
+	Cmd string
+	// The metadata of the command; nil if unknown.
+	Meta *storedefs.CmdMeta
+}
+
+// SearchMode determines how the query of a Searcher matches commands.
+type SearchMode int
+
+// Possible values for SearchMode.
+const (
+	SearchPrefix SearchMode = iota
+	SearchSubstring
+	SearchRegexp
+	numSearchModes
+)
+
+var searchModeNames = [...]string{"prefix", "substring", "regexp"}
+
+func (m SearchMode) String() string {
+	return searchModeNames[m]
+}
+
+// Next returns the search mode after m, cycling back to SearchPrefix after
+// SearchRegexp.
+func (m SearchMode) Next() SearchMode {
+	return (m + 1) % numSearchModes
+}
+
+// Searcher is used for searching incrementally through a list of history
+// entries, from the newest to the oldest. Only the last occurrence of each
+// command is considered, so that duplicates are skipped.
+type Searcher struct {
+	entries []Entry
+	last    map[string]int
+
+	query string
+	mode  SearchMode
+	re    *regexp.Regexp
+	// Index of the current match in entries. If equal to len(entries), there
+	// is no current match.
+	idx int
+}
+
+// NewSearcher creates a new Searcher over the given entries, which should be
+// sorted from the oldest to the newest.
+func NewSearcher(entries []Entry) *Searcher {
+	last := make(map[string]int)
+	for i, entry := range entries {
+		last[entry.Cmd] = i
+	}
+	return &Searcher{entries: entries, last: last, idx: len(entries)}
+}
+
+// Query returns the current query.
+func (s *Searcher) Query() string {
+	return s.query
+}
+
+// Mode returns the current search mode.
+func (s *Searcher) Mode() SearchMode {
+	return s.mode
+}
+
+// Current returns the current match. If there is no current match, it returns
+// -1 and an empty string.
+func (s *Searcher) Current() (int, string) {
+	if s.idx == len(s.entries) {
+		return -1, ""
+	}
+	return s.entries[s.idx].Seq, s.entries[s.idx].Cmd
+}
+
+// Rewind forgets the current match, so that the next search starts from the
+// newest entry.
+func (s *Searcher) Rewind() {
+	s.idx = len(s.entries)
+}
+
+// SetQuery changes the query and the search mode, and finds the newest match
+// that is not newer than the current match. If no such match exists, the
+// current match is kept and ErrEndOfHistory is returned. It also returns an
+// error if the mode is SearchRegexp and the query is not a valid regular
+// expression.
+func (s *Searcher) SetQuery(query string, mode SearchMode) error {
+	var re *regexp.Regexp
+	if mode == SearchRegexp {
+		var err error
+		re, err = regexp.Compile(query)
+		if err != nil {
+			return err
+		}
+	}
+	s.query, s.mode, s.re = query, mode, re
+
+	from := s.idx
+	if from == len(s.entries) {
+		from--
+	}
+	for i := from; i >= 0; i-- {
+		if s.matches(i) {
+			s.idx = i
+			return nil
+		}
+	}
+	return ErrEndOfHistory
+}
+
+// Prev finds the previous (older) match.
+func (s *Searcher) Prev() (int, string, error) {
+	for i := s.idx - 1; i >= 0; i-- {
+		if s.matches(i) {
+			s.idx = i
+			return s.entries[i].Seq, s.entries[i].Cmd, nil
+		}
+	}
+	return -1, "", ErrEndOfHistory
+}
+
+// Next finds the next (newer) match.
+func (s *Searcher) Next() (int, string, error) {
+	for i := s.idx + 1; i < len(s.entries); i++ {
+		if s.matches(i) {
+			s.idx = i
+			return s.entries[i].Seq, s.entries[i].Cmd, nil
+		}
+	}
+	return -1, "", ErrEndOfHistory
+}
+
+func (s *Searcher) matches(i int) bool {
+	cmd := s.entries[i].Cmd
+	if s.last[cmd] != i {
+		return false
+	}
+	switch s.mode {
+	case SearchSubstring:
+		return strings.Contains(cmd, s.query)
+	case SearchRegexp:
+		return s.re.MatchString(cmd)
+	default:
+		return strings.HasPrefix(cmd, s.query)
+	}
+}
@@ -0,0 +1,57 @@
+package history
+
+import "testing"
+
+func TestSearcher(t *testing.T) {
+	s := NewSearcher([]Entry{
+		{Seq: 0, Cmd: "echo"},
+		{Seq: 1, Cmd: "ls -l"},
+		{Seq: 2, Cmd: "echo a"},
+		{Seq: 3, Cmd: "ls -a"},
+		{Seq: 4, Cmd: "echo a"},
+		{Seq: 5, Cmd: "ls a"},
+	})
+
+	// Prefix search; "echo a" at 2 is a duplicate and is skipped.
+	if err := s.SetQuery("ec", SearchPrefix); err != nil {
+		t.Errorf("SetQuery -> %v, want nil", err)
+	}
+	wantSearcherCurrent(t, s, 4, "echo a")
+	wantCmd(t, s.Prev, 0, "echo")
+	wantErr(t, s.Prev, ErrEndOfHistory)
+	wantCmd(t, s.Next, 4, "echo a")
+	wantErr(t, s.Next, ErrEndOfHistory)
+
+	// Refining the query keeps the current match if it still matches.
+	s.SetQuery("echo ", SearchPrefix)
+	wantSearcherCurrent(t, s, 4, "echo a")
+	// When nothing matches, the current match is kept.
+	if err := s.SetQuery("echo b", SearchPrefix); err != ErrEndOfHistory {
+		t.Errorf("SetQuery -> %v, want %v", err, ErrEndOfHistory)
+	}
+	wantSearcherCurrent(t, s, 4, "echo a")
+
+	// Substring search starts from the current match.
+	s.SetQuery("-", SearchSubstring)
+	wantSearcherCurrent(t, s, 3, "ls -a")
+	wantCmd(t, s.Prev, 1, "ls -l")
+
+	// Regexp search, after rewinding.
+	s.Rewind()
+	wantSearcherCurrent(t, s, -1, "")
+	s.SetQuery("^ls [^-]", SearchRegexp)
+	wantSearcherCurrent(t, s, 5, "ls a")
+	if err := s.SetQuery("(", SearchRegexp); err == nil {
+		t.Errorf("SetQuery with invalid regexp -> nil error")
+	}
+}
+
+func wantSearcherCurrent(t *testing.T, s *Searcher, wantSeq int, wantCmd string) {
+	seq, cmd := s.Current()
+	if seq != wantSeq {
+		t.Errorf("got seq %d, want %d", seq, wantSeq)
+	}
+	if cmd != wantCmd {
+		t.Errorf("got cmd %q, want %q", cmd, wantCmd)
+	}
+}
@@ -1,9 +1,16 @@
 package history
 
+import "github.com/elves/elvish/store/storedefs"
+
 // Store is the interface of the storage backend.
 type Store interface {
 	NextCmdSeq() (int, error)
 	AddCmd(cmd string) (int, error)
+	AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error)
 	Cmds(from, upto int) ([]string, error)
 	PrevCmd(upto int, prefix string) (int, string, error)
+	CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error)
+	SetCmdMeta(seq int, meta storedefs.CmdMeta) error
+	RemoveCmd(seq int) error
+	DedupCmds() ([]int, error)
 }
@@ -1,11 +1,20 @@
 package history
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
 
 // mockStore is an implementation of the Store interface that can be used for
 // testing.
 type mockStore struct {
-	cmds []string
+	cmds  []string
+	metas map[int]storedefs.CmdMeta
+	// Sequence numbers passed to RemoveCmd.
+	removed []int
+	// Sequence numbers to be returned by DedupCmds.
+	duplicates []int
 
 	oneOffError error
 }
@@ -28,8 +37,16 @@ func (s *mockStore) AddCmd(cmd string) (int, error) {
 	return len(s.cmds) - 1, nil
 }
 
+func (s *mockStore) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	seq, err := s.AddCmd(cmd)
+	if err != nil {
+		return seq, err
+	}
+	return seq, s.SetCmdMeta(seq, meta)
+}
+
 func (s *mockStore) Cmds(from, upto int) ([]string, error) {
-	return s.cmds[from:upto], s.error()
+	return append([]string(nil), s.cmds[from:upto]...), s.error()
 }
 
 func (s *mockStore) PrevCmd(upto int, prefix string) (int, string, error) {
@@ -46,3 +63,41 @@ func (s *mockStore) PrevCmd(upto int, prefix string) (int, string, error) {
 	}
 	return -1, "", ErrEndOfHistory
 }
+
+func (s *mockStore) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	if s.oneOffError != nil {
+		return nil, s.error()
+	}
+	var cmds []storedefs.Cmd
+	for i := from; i < upto && i < len(s.cmds); i++ {
+		cmd := storedefs.Cmd{Seq: i, Text: s.cmds[i]}
+		if meta, ok := s.metas[i]; ok {
+			cmd.Meta = &meta
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+func (s *mockStore) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	if s.oneOffError != nil {
+		return s.error()
+	}
+	if s.metas == nil {
+		s.metas = make(map[int]storedefs.CmdMeta)
+	}
+	s.metas[seq] = meta
+	return nil
+}
+
+func (s *mockStore) RemoveCmd(seq int) error {
+	if s.oneOffError != nil {
+		return s.error()
+	}
+	s.removed = append(s.removed, seq)
+	return nil
+}
+
+func (s *mockStore) DedupCmds() ([]int, error) {
+	return s.duplicates, s.error()
+}
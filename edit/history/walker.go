@@ -21,6 +21,9 @@ type Walker struct {
 	// The next element to fetch from the session history. If equal to -1, the
 	// next element comes from the storage backend.
 	sessionIdx int
+	// The upper bound of sequence numbers of elements to fetch from the
+	// storage backend.
+	storeIdx int
 	// Index of the next element in the stack that Prev will return on next
 	// call. If equal to len(stack), the next element needs to be fetched,
 	// either from the session history or the storage backend.
@@ -32,7 +35,7 @@ type Walker struct {
 
 func NewWalker(store Store, upper int, cmds []string, seqs []int, prefix string) *Walker {
 	return &Walker{store, upper, cmds, seqs, prefix,
-		len(cmds) - 1, 0, nil, nil, map[string]bool{}}
+		len(cmds) - 1, upper, 0, nil, nil, map[string]bool{}}
 }
 
 // Prefix returns the prefix of the commands that the walker walks through.
@@ -78,22 +81,17 @@ func (w *Walker) Prev() (int, string, error) {
 	// Not found in the session part.
 	w.sessionIdx = -1
 
-	seq := w.storeUpper
-	if len(w.seq) > 0 && seq > w.seq[len(w.seq)-1] {
-		seq = w.seq[len(w.seq)-1]
-	}
+	// The storage might also contain commands from the session history, which
+	// are skipped as duplicates.
 	for {
-		var (
-			cmd string
-			err error
-		)
-		seq, cmd, err = w.store.PrevCmd(seq, w.prefix)
+		seq, cmd, err := w.store.PrevCmd(w.storeIdx, w.prefix)
 		if err != nil {
 			if err.Error() == storedefs.ErrNoMatchingCmd.Error() {
 				err = ErrEndOfHistory
 			}
 			return -1, "", err
 		}
+		w.storeIdx = seq
 		if !w.inStack[cmd] {
 			w.push(cmd, seq)
 			return seq, cmd, nil
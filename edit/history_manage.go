@@ -0,0 +1,117 @@
+package edit
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/elves/elvish/edit/history"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Builtins for managing the command history, installed in the edit:history:
+// namespace.
+
+var historyFns = []*eval.BuiltinFn{
+	{"edit:history:delete", historyDelete},
+	{"edit:history:dedup", historyDedup},
+	(&eval.BuiltinFn{"edit:history:import", historyImport}).DeclareOpts("format"),
+	(&eval.BuiltinFn{"edit:history:export", historyExport}).DeclareOpts("format"),
+}
+
+func getHistoryFuser(ec *eval.Frame) *history.Fuser {
+	ed := ec.Editor.(*Editor)
+	if ed.daemon == nil || ed.historyFuser == nil {
+		throw(ErrStoreOffline)
+	}
+	ed.refreshHistory()
+	return ed.historyFuser
+}
+
+// historyDelete deletes commands with the given sequence numbers. It throws
+// if any of the commands does not exist.
+func historyDelete(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var seqs []int
+	eval.ScanArgsVariadic(args, &seqs)
+	eval.TakeNoOpt(opts)
+
+	fuser := getHistoryFuser(ec)
+	for _, seq := range seqs {
+		maybeThrow(fuser.RemoveCmd(seq))
+	}
+}
+
+// historyDedup removes all but the last occurrence of each command, and
+// outputs the number of removed commands.
+func historyDedup(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	eval.ScanArgs(args)
+	eval.TakeNoOpt(opts)
+
+	removed, err := getHistoryFuser(ec).DedupCmds()
+	maybeThrow(err)
+	ec.OutputChan() <- strconv.Itoa(len(removed))
+}
+
+// historyImport imports commands from a file, and outputs the number of
+// imported commands. Imported commands are added after all existing commands,
+// and are redacted with $edit:history-redact like other commands.
+func historyImport(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		path   string
+		format string
+	)
+	eval.ScanArgs(args, &path)
+	eval.ScanOpts(opts, eval.OptToScan{"format", &format, history.FormatLines})
+
+	getHistoryFuser(ec)
+	file, err := os.Open(path)
+	maybeThrow(err)
+	defer file.Close()
+	entries, err := history.Import(file, format)
+	maybeThrow(err)
+
+	ed := ec.Editor.(*Editor)
+	rules := ed.historyRedact()
+	cmds := make([]storedefs.Cmd, len(entries))
+	for i, entry := range entries {
+		cmds[i] = storedefs.Cmd{Text: redact(entry.Cmd, rules), Meta: entry.Meta}
+	}
+	maybeThrow(ed.daemon.AddCmds(cmds))
+	// Make the imported commands visible in this session.
+	maybeThrow(ed.historyFuser.Refresh())
+	ec.OutputChan() <- strconv.Itoa(len(cmds))
+}
+
+// historyExport exports all commands to a file, or the byte output if no file
+// is given.
+func historyExport(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var (
+		paths  []string
+		format string
+	)
+	eval.ScanArgsVariadic(args, &paths)
+	eval.ScanOpts(opts, eval.OptToScan{"format", &format, history.FormatLines})
+	if len(paths) > 1 {
+		throwf("want at most 1 argument, got %d", len(paths))
+	}
+	// Check the format before the file is truncated.
+	if !history.CanExport(format) {
+		throw(history.ErrUnknownFormat)
+	}
+
+	entries, err := getHistoryFuser(ec).AllEntries()
+	maybeThrow(err)
+
+	var w io.Writer = ec.OutputFile()
+	if len(paths) == 1 {
+		// History may contain secrets; only make the file accessible to the
+		// user.
+		file, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		maybeThrow(err)
+		defer file.Close()
+		w = file
+	}
+	maybeThrow(history.Export(w, format, entries))
+}
@@ -0,0 +1,47 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/store"
+	"github.com/elves/elvish/util"
+)
+
+func TestHistoryImportRedacts(t *testing.T) {
+	util.InTempDir(func(string) {
+		st, err := store.OpenShared("", "db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := daemon.NewLocalClient(st, "")
+		defer client.Close()
+
+		ev := eval.NewEvaler()
+		defer ev.Close()
+		ev.InstallDaemonClient(client)
+		null, err := os.Open(os.DevNull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer null.Close()
+		ed := NewEditor(null, null, nil, ev)
+		defer ed.Close()
+
+		ioutil.WriteFile("cmds", []byte("mysql --password=hunter2\necho hi\n"), 0600)
+		err = ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+			"n = (edit:history:import cmds)"))
+		if err != nil {
+			t.Fatalf("edit:history:import -> error %v", err)
+		}
+		cmds, err := client.Cmds(1, 3)
+		want := []string{"mysql --password=***", "echo hi"}
+		if !reflect.DeepEqual(cmds, want) || err != nil {
+			t.Errorf("imported commands are (%q, %v), want (%q, nil)", cmds, err, want)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package edit
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+)
+
+// Commands starting with $edit:history-ignore-prefix are not added to the
+// history, which is useful for confidential operations. It defaults to a
+// space, like HISTCONTROL=ignorespace in bash; setting it to an empty string
+// records all commands.
+var _ = RegisterVariable("history-ignore-prefix", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(" ", vartypes.ShouldBeString)
+})
+
+func (ed *Editor) historyIgnorePrefix() string {
+	return ed.variables["history-ignore-prefix"].Get().(string)
+}
+
+// Before a command is added to the history, the parts of it that match the
+// regular expressions in $edit:history-redact are replaced with
+// redactionMark. When a regular expression has capturing groups, only the
+// parts matching the groups are replaced. The default rules cover common ways
+// of passing credentials on the command line.
+var _ = RegisterVariable("history-redact", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(defaultHistoryRedact, shouldBeRegexpList)
+})
+
+const redactionMark = "***"
+
+var defaultHistoryRedact = types.MakeList(
+	`(?i)authorization:\s*(?:(?:basic|bearer|token)\s+)?([^\s'"]+)`,
+	`(?i)--(?:password|passwd|secret|token)=([^\s'"]+)`,
+)
+
+var errShouldBeRegexpList = errors.New("should be list of regular expressions")
+
+func shouldBeRegexpList(v types.Value) error {
+	li, ok := v.(types.List)
+	if !ok {
+		return errShouldBeRegexpList
+	}
+	var err error
+	li.Iterate(func(v types.Value) bool {
+		s, ok := v.(string)
+		if !ok {
+			err = errShouldBeRegexpList
+			return false
+		}
+		_, err = regexp.Compile(s)
+		return err == nil
+	})
+	return err
+}
+
+func (ed *Editor) historyRedact() []*regexp.Regexp {
+	var rules []*regexp.Regexp
+	ed.variables["history-redact"].Get().(types.List).Iterate(
+		func(v types.Value) bool {
+			// The list has been validated.
+			rules = append(rules, regexp.MustCompile(v.(string)))
+			return true
+		})
+	return rules
+}
+
+// redact replaces the parts of a command matching the redaction rules with
+// redactionMark.
+func redact(cmd string, rules []*regexp.Regexp) string {
+	for _, rule := range rules {
+		var b bytes.Buffer
+		last := 0
+		for _, match := range rule.FindAllStringSubmatchIndex(cmd, -1) {
+			groups := match[2:]
+			if len(groups) == 0 {
+				groups = match[:2]
+			}
+			for i := 0; i < len(groups); i += 2 {
+				begin, end := groups[i], groups[i+1]
+				if begin < last {
+					// Unmatched or nested group.
+					continue
+				}
+				b.WriteString(cmd[last:begin])
+				b.WriteString(redactionMark)
+				last = end
+			}
+		}
+		b.WriteString(cmd[last:])
+		cmd = b.String()
+	}
+	return cmd
+}
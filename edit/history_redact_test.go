@@ -0,0 +1,50 @@
+package edit
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/elves/elvish/eval/types"
+)
+
+var redactTests = []struct {
+	cmd  string
+	want string
+}{
+	{"echo hello", "echo hello"},
+	{"curl -H 'Authorization: Bearer abc.def' http://x",
+		"curl -H 'Authorization: Bearer ***' http://x"},
+	{"curl -H authorization:xyz", "curl -H authorization:***"},
+	{"mysql --password=hunter2 --user=me", "mysql --password=*** --user=me"},
+	{"tool --token=a --secret=b", "tool --token=*** --secret=***"},
+}
+
+func TestRedact(t *testing.T) {
+	var rules []*regexp.Regexp
+	defaultHistoryRedact.Iterate(func(v types.Value) bool {
+		rules = append(rules, regexp.MustCompile(v.(string)))
+		return true
+	})
+	for _, test := range redactTests {
+		if got := redact(test.cmd, rules); got != test.want {
+			t.Errorf("redact(%q) -> %q, want %q", test.cmd, got, test.want)
+		}
+	}
+
+	// Without capturing groups, whole matches are redacted.
+	rules = []*regexp.Regexp{regexp.MustCompile(`sk-[0-9a-z]+`)}
+	if got := redact("export KEY=sk-123 X=sk-4", rules); got != "export KEY=*** X=***" {
+		t.Errorf("redact with no groups -> %q", got)
+	}
+}
+
+func TestShouldBeRegexpList(t *testing.T) {
+	if shouldBeRegexpList(types.MakeList("a+", "[b]")) != nil {
+		t.Errorf("valid list of regexps rejected")
+	}
+	for _, v := range []types.Value{"a", types.MakeList("("), types.MakeList(types.EmptyList)} {
+		if shouldBeRegexpList(v) == nil {
+			t.Errorf("shouldBeRegexpList(%v) -> nil, want error", v)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/elves/elvish/edit/history"
+	"github.com/elves/elvish/edit/ui"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/vartypes"
+)
+
+// Incremental history search mode.
+
+var _ = registerBuiltins(modeHistorySearch, map[string]func(*Editor){
+	"start":              histsearchStart,
+	"prev":               wrapHistsearchBuiltin(histsearchPrev),
+	"next":               wrapHistsearchBuiltin(histsearchNext),
+	"backspace":          wrapHistsearchBuiltin(histsearchBackspace),
+	"toggle-mode":        wrapHistsearchBuiltin(histsearchToggleMode),
+	"toggle-scope":       wrapHistsearchBuiltin(histsearchToggleScope),
+	"accept":             wrapHistsearchBuiltin(histsearchAccept),
+	"abort":              wrapHistsearchBuiltin(histsearchAbort),
+	"switch-to-histlist": wrapHistsearchBuiltin(histsearchSwitchToHistlist),
+	"default":            wrapHistsearchBuiltin(histsearchDefault),
+})
+
+// histsearchScope determines which history entries are searched.
+type histsearchScope int
+
+const (
+	// All commands.
+	histsearchAll histsearchScope = iota
+	// Commands run in the current directory.
+	histsearchDir
+	// Commands run in the current session.
+	histsearchSession
+	numHistsearchScopes
+)
+
+var histsearchScopeNames = [...]string{"all", "dir", "session"}
+
+type histsearch struct {
+	*history.Searcher
+	scope histsearchScope
+	// Whether the last search has failed.
+	failing bool
+	// Whether the query is not a valid regular expression.
+	badRegexp bool
+}
+
+func (*histsearch) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
+	return getBinding(m[modeHistorySearch], k)
+}
+
+func (hs *histsearch) ModeLine() ui.Renderer {
+	title := " HISTORY SEARCH "
+	if seq, _ := hs.Current(); seq >= 0 {
+		title = fmt.Sprintf(" HISTORY SEARCH #%d ", seq)
+	}
+	title += fmt.Sprintf("(%s, %s) ", hs.Mode(), histsearchScopeNames[hs.scope])
+	if hs.badRegexp {
+		title += "(bad regexp) "
+	} else if hs.failing {
+		title += "(failing) "
+	}
+	return modeLineRenderer{title, hs.Query()}
+}
+
+func (*histsearch) CursorOnModeLine() bool {
+	return true
+}
+
+// update sets the query and the mode, and records whether the search has
+// failed.
+func (hs *histsearch) update(query string, mode history.SearchMode) {
+	err := hs.SetQuery(query, mode)
+	hs.failing = err != nil
+	hs.badRegexp = err != nil && err != history.ErrEndOfHistory
+}
+
+func histsearchStart(ed *Editor) {
+	if ed.historyFuser == nil {
+		ed.Notify("history offline")
+		return
+	}
+	hs, err := newHistsearch(ed, histsearchAll)
+	if err != nil {
+		ed.Notify("%v", err)
+		return
+	}
+	ed.mode = hs
+}
+
+func newHistsearch(ed *Editor, scope histsearchScope) (*histsearch, error) {
+	var entries []history.Entry
+	ed.refreshHistory()
+	if scope == histsearchSession {
+		entries = ed.historyFuser.SessionEntries()
+	} else {
+		var err error
+		entries, err = ed.historyFuser.AllEntries()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if scope == histsearchDir {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		var inDir []history.Entry
+		for _, entry := range entries {
+			if entry.Meta != nil && entry.Meta.Dir == pwd {
+				inDir = append(inDir, entry)
+			}
+		}
+		entries = inDir
+	}
+	return &histsearch{Searcher: history.NewSearcher(entries), scope: scope}, nil
+}
+
+var errNotHistsearch = errors.New("not in history search mode")
+
+func wrapHistsearchBuiltin(f func(*Editor, *histsearch)) func(*Editor) {
+	return func(ed *Editor) {
+		hs, ok := ed.mode.(*histsearch)
+		if !ok {
+			throw(errNotHistsearch)
+		}
+		f(ed, hs)
+	}
+}
+
+func histsearchPrev(ed *Editor, hs *histsearch) {
+	_, _, err := hs.Prev()
+	hs.failing = err != nil
+}
+
+func histsearchNext(ed *Editor, hs *histsearch) {
+	_, _, err := hs.Next()
+	hs.failing = err != nil
+}
+
+func histsearchBackspace(ed *Editor, hs *histsearch) {
+	query := hs.Query()
+	_, size := utf8.DecodeLastRuneInString(query)
+	if size == 0 {
+		return
+	}
+	hs.Rewind()
+	hs.update(query[:len(query)-size], hs.Mode())
+}
+
+func histsearchToggleMode(ed *Editor, hs *histsearch) {
+	hs.Rewind()
+	hs.update(hs.Query(), hs.Mode().Next())
+}
+
+func histsearchToggleScope(ed *Editor, hs *histsearch) {
+	newHs, err := newHistsearch(ed, (hs.scope+1)%numHistsearchScopes)
+	if err != nil {
+		ed.Notify("%v", err)
+		return
+	}
+	newHs.update(hs.Query(), hs.Mode())
+	ed.mode = newHs
+}
+
+// histsearchAccept replaces the buffer with the current match and returns to
+// insert mode.
+func histsearchAccept(ed *Editor, hs *histsearch) {
+	if _, cmd := hs.Current(); cmd != "" {
+		ed.buffer = cmd
+		ed.dot = len(ed.buffer)
+	}
+	ed.mode = &ed.insert
+}
+
+// histsearchAbort returns to insert mode, leaving the buffer intact.
+func histsearchAbort(ed *Editor, hs *histsearch) {
+	ed.mode = &ed.insert
+}
+
+func histsearchSwitchToHistlist(ed *Editor, hs *histsearch) {
+	histlistStart(ed)
+	if l, _, ok := getHistlist(ed); ok {
+		l.changeFilter(hs.Query())
+	}
+}
+
+func histsearchDefault(ed *Editor, hs *histsearch) {
+	k := ed.lastKey
+	if likeChar(k) {
+		hs.update(hs.Query()+string(k.Rune), hs.Mode())
+		return
+	}
+	histsearchAccept(ed, hs)
+	ed.setAction(reprocessKey)
+}
@@ -30,6 +30,8 @@ var (
 		"move-dot-eol":        moveDotEOL,
 		"move-dot-up":         moveDotUp,
 		"move-dot-down":       moveDotDown,
+		"move-dot-sob":        moveDotSOB,
+		"move-dot-eob":        moveDotEOB,
 
 		"insert-last-word": insertLastWord,
 		"insert-key":       insertKey,
@@ -40,6 +42,7 @@ var (
 
 		"toggle-quote-paste": toggleQuotePaste,
 		"insert-raw":         startInsertRaw,
+		"edit-externally":    editExternally,
 
 		"end-of-history": endOfHistory,
 		"redraw":         redraw,
@@ -213,6 +216,14 @@ func moveDotEOL(ed *Editor) {
 	ed.dot = eol
 }
 
+func moveDotSOB(ed *Editor) {
+	ed.dot = 0
+}
+
+func moveDotEOB(ed *Editor) {
+	ed.dot = len(ed.buffer)
+}
+
 func moveDotUp(ed *Editor) {
 	sol := util.FindLastSOL(ed.buffer[:ed.dot])
 	if sol == 0 {
@@ -270,10 +281,9 @@ func returnLine(ed *Editor) {
 
 func smartEnter(ed *Editor) {
 	if ed.parseErrorAtEnd {
-		// There is a parsing error at the end. ui.Insert a newline and copy
-		// indents from previous line.
-		indent := findLastIndent(ed.buffer[:ed.dot])
-		ed.insertAtDot("\n" + indent)
+		// There is a parsing error at the end. Insert a newline and indent it
+		// according to the nesting of brackets.
+		ed.insertAtDot("\n" + ed.indentAt(ed.dot))
 	} else {
 		returnLine(ed)
 	}
@@ -306,6 +316,10 @@ func redraw(ed *Editor) {
 func insertDefault(ed *Editor) {
 	k := ed.lastKey
 	if likeChar(k) {
+		if isCloser(k.Rune) && ed.dedentForCloser() {
+			// The removed indentation may have been typed literally.
+			ed.insert.literalInserts = 0
+		}
 		insertKey(ed)
 		// Match abbreviations.
 		expanded := false
@@ -48,6 +48,12 @@ type listingProvider interface {
 	ModeTitle(int) string
 }
 
+// highlighter is an optional interface for listingProviders. Highlights
+// returns the byte indices of matched runes in the content of an entry.
+type highlighter interface {
+	Highlights(i int) []int
+}
+
 type placeholderer interface {
 	Placeholder() string
 }
@@ -120,25 +126,40 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 	high := low
 	height := 0
 	var listOfLines list.List
-	getEntry := func(i int) []ui.Styled {
+	hl, hasHighlights := l.provider.(highlighter)
+	getEntry := func(i int) []listingLine {
 		header, content := l.provider.Show(i)
+		var highlights []int
+		if hasHighlights {
+			highlights = hl.Highlights(i)
+		}
 		lines := strings.Split(content.Text, "\n")
 		styles := content.Styles
 		if i == l.selected {
 			styles = append(styles, styleForSelected...)
 		}
-		styleds := make([]ui.Styled, len(lines))
+		entry := make([]listingLine, len(lines))
+		offset := 0
 		for i, line := range lines {
+			prefix := ""
 			if l.headerWidth > 0 {
 				if i == 0 {
-					line = fmt.Sprintf("%*s %s", l.headerWidth, header, line)
+					prefix = fmt.Sprintf("%*s ", l.headerWidth, header)
 				} else {
-					line = fmt.Sprintf("%*s %s", l.headerWidth, "", line)
+					prefix = fmt.Sprintf("%*s ", l.headerWidth, "")
+				}
+			}
+			entry[i].Styled = ui.Styled{prefix + line, styles}
+			// Translate highlights into byte indices within this line.
+			for _, p := range highlights {
+				if offset <= p && p < offset+len(line) {
+					entry[i].highlights = append(
+						entry[i].highlights, p-offset+len(prefix))
 				}
 			}
-			styleds[i] = ui.Styled{line, styles}
+			offset += len(line) + 1
 		}
-		return styleds
+		return entry
 	}
 	// We start by extending high, so that the first entry to include is
 	// l.selected.
@@ -178,11 +199,19 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 
 	// Convert the List to a slice.
 	lines := make([]ui.Styled, 0, listOfLines.Len())
+	var highlights [][]int
+	if hasHighlights {
+		highlights = make([][]int, 0, listOfLines.Len())
+	}
 	for p := listOfLines.Front(); p != nil; p = p.Next() {
-		lines = append(lines, p.Value.(ui.Styled))
+		line := p.Value.(listingLine)
+		lines = append(lines, line.Styled)
+		if hasHighlights {
+			highlights = append(highlights, line.highlights)
+		}
 	}
 
-	ls := listingRenderer{lines}
+	ls := listingRenderer{lines, highlights}
 	if low > 0 || high < n || lastShownIncomplete {
 		// Need scrollbar
 		return listingWithScrollBarRenderer{ls, n, low, high, height}
@@ -190,6 +219,13 @@ func (l *listing) List(maxHeight int) ui.Renderer {
 	return ls
 }
 
+// listingLine is a line in the listing, along with the byte indices of
+// matched runes in it.
+type listingLine struct {
+	ui.Styled
+	highlights []int
+}
+
 func writeHorizontalScrollbar(b *ui.Buffer, n, low, high, width int) {
 	slow, shigh := findScrollInterval(n, low, high, width)
 	for i := 0; i < width; i++ {
@@ -38,7 +38,7 @@ func TestListing(t *testing.T) {
 	// Selecting the first element and rendering with height=2. We expect to see
 	// the first 2 elements, with the first being shown as selected.
 	testListingList(t, 0, 2, listingWithScrollBarRenderer{
-		listingRenderer: listingRenderer{[]ui.Styled{
+		listingRenderer: listingRenderer{lines: []ui.Styled{
 			{"0 foo", styleForSelected},
 			{"1 bar", ui.Styles{}},
 		}},
@@ -47,7 +47,7 @@ func TestListing(t *testing.T) {
 	// Selecting the last element and rendering with height=2. We expect to see
 	// the last 2 elements, with the last being shown as selected.
 	testListingList(t, 4, 2, listingWithScrollBarRenderer{
-		listingRenderer: listingRenderer{[]ui.Styled{
+		listingRenderer: listingRenderer{lines: []ui.Styled{
 			{"3 lorem", ui.Styles{}},
 			{"4 ipsum", styleForSelected},
 		}},
@@ -57,7 +57,7 @@ func TestListing(t *testing.T) {
 	// see the middle element and two elements around it, with the middle being
 	// shown as selected.
 	testListingList(t, 2, 3, listingWithScrollBarRenderer{
-		listingRenderer: listingRenderer{[]ui.Styled{
+		listingRenderer: listingRenderer{lines: []ui.Styled{
 			{"1 bar", ui.Styles{}},
 			{"2 foobar", styleForSelected},
 			{"3 lorem", ui.Styles{}},
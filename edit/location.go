@@ -1,15 +1,14 @@
 package edit
 
 import (
-	"bytes"
 	"fmt"
 	"math"
 	"os"
-	"regexp"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/elves/elvish/edit/ui"
-	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
 	"github.com/elves/elvish/parse"
@@ -28,13 +27,15 @@ var _ = registerBuiltins(modeLocation, map[string]func(*Editor){
 var PinnedScore = math.Inf(1)
 
 type location struct {
-	home     string // The home directory; leave empty if unknown.
-	all      []storedefs.Dir
-	filtered []storedefs.Dir
+	home       string // The home directory; leave empty if unknown.
+	all        []storedefs.Dir
+	filtered   []storedefs.Dir
+	highlights [][]int
+	match      listingMatcher // Custom matcher; leave nil to use the default.
 }
 
-func newLocation(dirs []storedefs.Dir, home string) *listing {
-	l := newListing(modeLocation, &location{all: dirs, home: home})
+func newLocation(dirs []storedefs.Dir, home string, match listingMatcher) *listing {
+	l := newListing(modeLocation, &location{all: dirs, home: home, match: match})
 	return &l
 }
 
@@ -61,13 +62,17 @@ func (loc *location) Show(i int) (string, ui.Styled) {
 	return header, ui.Unstyled(showPath(loc.filtered[i].Path, loc.home))
 }
 
+func (loc *location) Highlights(i int) []int {
+	return loc.highlights[i]
+}
+
 func (loc *location) Filter(filter string) int {
 	loc.filtered = nil
-	pattern := makeLocationFilterPattern(filter)
-	for _, item := range loc.all {
-		if pattern.MatchString(showPath(item.Path, loc.home)) {
-			loc.filtered = append(loc.filtered, item)
-		}
+	loc.highlights = nil
+	if loc.match != nil {
+		loc.filterWithMatcher(filter)
+	} else {
+		loc.filterWithTerms(filter)
 	}
 
 	if len(loc.filtered) == 0 {
@@ -76,41 +81,178 @@ func (loc *location) Filter(filter string) int {
 	return 0
 }
 
-func showPath(path, home string) string {
-	if home != "" && path == home {
-		return "~"
-	} else if home != "" && strings.HasPrefix(path, home+"/") {
-		return "~/" + parse.Quote(path[len(home)+1:])
-	} else {
-		return parse.Quote(path)
+// filterWithMatcher filters the directories with the custom matcher, putting
+// the best matches first. Directories with the same score keep their order.
+func (loc *location) filterWithMatcher(filter string) {
+	texts := make([]string, len(loc.all))
+	for i, item := range loc.all {
+		texts[i] = showPath(item.Path, loc.home)
+	}
+	var matched scoredDirs
+	for i, result := range loc.match(texts, filter, false) {
+		if result != nil {
+			matched.dirs = append(matched.dirs, loc.all[i])
+			matched.results = append(matched.results, result)
+		}
+	}
+	sort.Stable(matched)
+	loc.filtered = matched.dirs
+	loc.highlights = make([][]int, len(matched.results))
+	for i, result := range matched.results {
+		loc.highlights[i] = result.positions
+	}
+}
+
+// filterWithTerms filters the directories by matching the space-separated
+// terms in the filter against their path components, and ranks them by both
+// the quality of the match and their scores. See matchLocation for details.
+// Without any terms, all directories are shown in their original order, which
+// puts the directories of the current workspace first.
+func (loc *location) filterWithTerms(filter string) {
+	terms := strings.FieldsFunc(filter, func(r rune) bool { return r == ' ' })
+	if len(terms) == 0 {
+		loc.filtered = loc.all
+		loc.highlights = make([][]int, len(loc.all))
+		return
+	}
+	var matched scoredDirs
+	for _, item := range loc.all {
+		quality, positions, ok := matchLocation(showPath(item.Path, loc.home), terms)
+		if ok {
+			matched.dirs = append(matched.dirs, item)
+			matched.results = append(matched.results,
+				&matchResult{item.Score * (1 + quality), positions})
+		}
+	}
+	sort.Stable(matched)
+	loc.filtered = matched.dirs
+	loc.highlights = make([][]int, len(matched.results))
+	for i, result := range matched.results {
+		loc.highlights[i] = result.positions
 	}
 }
 
-var emptyRegexp = regexp.MustCompile("")
+// Bonuses to the quality of location matches.
+const (
+	locBonusLastComponent   = 2 // The last term matches in the last component.
+	locBonusComponentPrefix = 1 // The last term matches a prefix of a component.
+	locBonusWholeComponent  = 1 // The last term matches a whole component.
+)
 
-func makeLocationFilterPattern(s string) *regexp.Regexp {
-	var b bytes.Buffer
-	b.WriteString(".*")
-	segs := strings.Split(s, "/")
-	for i, seg := range segs {
-		if i > 0 {
-			b.WriteString(".*/.*")
+// matchLocation matches the terms against a path in the style of z and
+// autojump. The terms must match the path in order, e.g. "proj api" matches
+// "~/src/project/services/api". Within a term, a slash requires the part after
+// it to match in a later path component than the part before it, e.g. "s/a"
+// matches "~/src/api" but not "~/sa". A part of a term containing no uppercase letters
+// is matched case-insensitively.
+//
+// It returns whether the terms match, along with the byte indices of the
+// matched runes and the quality of the match, which is higher when the last
+// term matches (a prefix of) the last component.
+func matchLocation(path string, terms []string) (float64, []int, bool) {
+	var positions []int
+	pos := 0
+	begin, end := 0, 0
+	for i, term := range terms {
+		parts := strings.Split(term, "/")
+		for j, part := range parts {
+			if j > 0 {
+				slash := strings.IndexByte(path[pos:], '/')
+				if slash == -1 {
+					return 0, nil, false
+				}
+				pos += slash + 1
+			}
+			last := i == len(terms)-1 && j == len(parts)-1
+			begin = indexSmartCase(path, part, pos, last)
+			if begin == -1 {
+				return 0, nil, false
+			}
+			end = begin + len(part)
+			for k := range path[begin:end] {
+				positions = append(positions, begin+k)
+			}
+			pos = end
 		}
-		b.WriteString(regexp.QuoteMeta(seg))
 	}
-	b.WriteString(".*")
-	p, err := regexp.Compile(b.String())
-	if err != nil {
-		logger.Printf("failed to compile regexp %q: %v", b.String(), err)
-		return emptyRegexp
+	if len(terms) == 0 {
+		return 0, nil, true
+	}
+
+	quality := 0.0
+	componentBegin := strings.LastIndexByte(path[:begin], '/') + 1
+	componentEnd := len(path)
+	if i := strings.IndexByte(path[end:], '/'); i != -1 {
+		componentEnd = end + i
+	} else {
+		quality += locBonusLastComponent
+	}
+	if begin == componentBegin {
+		quality += locBonusComponentPrefix
+		if end == componentEnd {
+			quality += locBonusWholeComponent
+		}
+	}
+	return quality, positions, true
+}
+
+// indexSmartCase finds the first, or the last if last is true, occurrence of
+// substr in s at or after from, ignoring case if substr has no uppercase
+// letters. It returns -1 if there is no occurrence.
+func indexSmartCase(s, substr string, from int, last bool) int {
+	haystack := s[from:]
+	if strings.ToLower(substr) == substr {
+		// Lowercasing may change the byte length of some runes, in which case
+		// fall back to matching the original string.
+		if lower := strings.ToLower(haystack); len(lower) == len(haystack) {
+			haystack = lower
+		}
+	}
+	var i int
+	if last {
+		i = strings.LastIndex(haystack, substr)
+	} else {
+		i = strings.Index(haystack, substr)
+	}
+	if i == -1 {
+		return -1
 	}
-	return p
+	return from + i
+}
+
+// scoredDirs sorts directories by their match scores in descending order.
+type scoredDirs struct {
+	dirs    []storedefs.Dir
+	results []*matchResult
+}
+
+func (s scoredDirs) Len() int { return len(s.dirs) }
+
+func (s scoredDirs) Swap(i, j int) {
+	s.dirs[i], s.dirs[j] = s.dirs[j], s.dirs[i]
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+}
+
+func (s scoredDirs) Less(i, j int) bool {
+	return s.results[i].score > s.results[j].score
+}
+
+// showPath shows a path abbreviated like tilde-abbr, quoting the part after ~/
+// if needed.
+func showPath(path, home string) string {
+	abbr := util.TildeAbbrHome(path, home)
+	if abbr == "~" {
+		return abbr
+	} else if abbr != path {
+		return abbr[:2] + parse.Quote(abbr[2:])
+	}
+	return parse.Quote(path)
 }
 
 // Editor interface.
 
 func (loc *location) Accept(i int, ed *Editor) {
-	err := eval.Chdir(loc.filtered[i].Path, ed.daemon)
+	err := ed.evaler.Chdir(loc.filtered[i].Path)
 	if err != nil {
 		ed.Notify("%v", err)
 	}
@@ -130,11 +272,16 @@ func locStart(ed *Editor) {
 	if err == nil {
 		black[pwd] = struct{}{}
 	}
-	stored, err := ed.daemon.Dirs(black)
+	stored, err := ed.daemon.Dirs(black, ed.evaler.DirHalfLife())
 	if err != nil {
 		ed.Notify("store error: %v", err)
 		return
 	}
+	if pwd != "" {
+		if root := findWorkspace(pwd, ed.locWorkspaceMarkers()); root != "" {
+			workspaceFirst(stored, root)
+		}
+	}
 
 	// Concatenate pinned and stored dirs, pinned first.
 	pinned := convertListToDirs(ed.locPinned())
@@ -145,7 +292,7 @@ func locStart(ed *Editor) {
 	// Drop the error. When there is an error, home is "", which is used to
 	// signify "no home known" in location.
 	home, _ := util.GetHome("")
-	ed.mode = newLocation(dirs, home)
+	ed.mode = newLocation(dirs, home, ed.listingMatcher(modeLocation))
 }
 
 // convertListToDirs converts a list of strings to []storedefs.Dir. It uses the
@@ -162,6 +309,45 @@ func convertListToDirs(li types.List) []storedefs.Dir {
 	return pinned
 }
 
+// findWorkspace finds the workspace that contains dir, which is the nearest
+// ancestor of dir (including itself) that contains any of the markers. It
+// returns "" if there is none.
+func findWorkspace(dir string, markers []string) string {
+	for {
+		for _, marker := range markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// workspaceFirst moves the directories within the workspace root to the front,
+// keeping the order of directories otherwise.
+func workspaceFirst(dirs []storedefs.Dir, root string) {
+	sort.Stable(dirsByWorkspace{dirs, root})
+}
+
+type dirsByWorkspace struct {
+	dirs []storedefs.Dir
+	root string
+}
+
+func (dw dirsByWorkspace) Len() int      { return len(dw.dirs) }
+func (dw dirsByWorkspace) Swap(i, j int) { dw.dirs[i], dw.dirs[j] = dw.dirs[j], dw.dirs[i] }
+func (dw dirsByWorkspace) Less(i, j int) bool {
+	return dw.within(dw.dirs[i].Path) && !dw.within(dw.dirs[j].Path)
+}
+
+func (dw dirsByWorkspace) within(path string) bool {
+	return path == dw.root || strings.HasPrefix(path, dw.root+string(filepath.Separator))
+}
+
 func convertListsToSet(lis ...types.List) map[string]struct{} {
 	set := make(map[string]struct{})
 	// XXX(xiaq): silently drops non-string items.
@@ -193,3 +379,24 @@ var _ = RegisterVariable("loc-pinned", func() vartypes.Variable {
 func (ed *Editor) locPinned() types.List {
 	return ed.variables["loc-pinned"].Get().(types.List)
 }
+
+// $edit:loc-workspace-markers contains the names of files or directories that
+// mark the root of a workspace, such as a repository. When the current
+// directory is within a workspace, the location mode shows directories in the
+// workspace first.
+var _ = RegisterVariable("loc-workspace-markers", func() vartypes.Variable {
+	return vartypes.NewValidatedPtr(
+		types.MakeList(".git", ".hg", ".svn", ".bzr"), vartypes.ShouldBeList)
+})
+
+func (ed *Editor) locWorkspaceMarkers() []string {
+	var markers []string
+	ed.variables["loc-workspace-markers"].Get().(types.List).Iterate(
+		func(v types.Value) bool {
+			if s, ok := v.(string); ok {
+				markers = append(markers, s)
+			}
+			return true
+		})
+	return markers
+}
@@ -1,10 +1,14 @@
 package edit
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
 )
 
 var (
@@ -15,7 +19,7 @@ var (
 		{"/home/dir", 100},
 		{"/foo/\nbar", 77},
 		{"/usr/elves/elvish", 6},
-	}, "/home")
+	}, "/home", nil)
 
 	locationFilterTests = []listingFilterTestCases{
 		{"", []shown{
@@ -42,9 +46,89 @@ var (
 		//    not by the actual form.
 		{"\n", []shown{}},
 		{"\\n", []shown{{"77", ui.Unstyled(`"/foo/\nbar"`)}}},
+		// Space-separated terms match in order.
+		{"src elvish", []shown{
+			{"300", ui.Unstyled("/src/github.com/elves/elvish")}}},
+		{"xyz home", []shown{}},
+		// Terms with uppercase letters are matched case-sensitively.
+		{"XYZ", []shown{}},
 	}
 )
 
 func TestLocation(t *testing.T) {
 	testListingFilter(t, "theLocation", theLocation, locationFilterTests)
 }
+
+func TestLocationHighlights(t *testing.T) {
+	loc := theLocation.provider.(*location)
+	loc.Filter("/e/xy")
+	want := [][]int{{8, 10, 11}}
+	if !reflect.DeepEqual(loc.highlights, want) {
+		t.Errorf("highlights = %v, want %v", loc.highlights, want)
+	}
+}
+
+var matchLocationTests = []struct {
+	path        string
+	terms       []string
+	wantQuality float64
+	wantOK      bool
+}{
+	{"~/src/project/services/api", []string{"proj", "api"}, 4, true},
+	{"~/src/project/services/api", []string{"api", "proj"}, 0, false},
+	{"~/src/project/services/api", []string{"serv"}, 1, true},
+	{"~/src/project/services/api", []string{"rvic"}, 0, true},
+	{"~/src/project/services/api", []string{"pi"}, 2, true},
+	{"~/src/project/services/api", []string{"s/a"}, 3, true},
+	{"~/src/project/services/api", []string{"api/s"}, 0, false},
+	{"~/src/project/services/api", []string{"API"}, 0, false},
+	{"~/src/project", nil, 0, true},
+}
+
+func TestMatchLocation(t *testing.T) {
+	for _, test := range matchLocationTests {
+		quality, _, ok := matchLocation(test.path, test.terms)
+		if quality != test.wantQuality || ok != test.wantOK {
+			t.Errorf("matchLocation(%q, %q) -> (%v, %v), want (%v, %v)",
+				test.path, test.terms, quality, ok, test.wantQuality, test.wantOK)
+		}
+	}
+}
+
+func TestWorkspaceFirst(t *testing.T) {
+	dirs := []storedefs.Dir{
+		{"/home/x", 300},
+		{"/src/repo/a", 200},
+		{"/src/repo2", 100},
+		{"/src/repo", 50},
+	}
+	wantDirs := []storedefs.Dir{
+		{"/src/repo/a", 200},
+		{"/src/repo", 50},
+		{"/home/x", 300},
+		{"/src/repo2", 100},
+	}
+	workspaceFirst(dirs, "/src/repo")
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("workspaceFirst -> %v, want %v", dirs, wantDirs)
+	}
+	// An empty filter keeps the workspace first instead of sorting by score.
+	loc := &location{all: dirs}
+	loc.Filter("")
+	if !reflect.DeepEqual(loc.filtered, wantDirs) {
+		t.Errorf("Filter(\"\") -> %v, want %v", loc.filtered, wantDirs)
+	}
+}
+
+func TestFindWorkspace(t *testing.T) {
+	util.InTempDir(func(root string) {
+		os.MkdirAll("a/.git", 0700)
+		os.MkdirAll("a/b/c", 0700)
+		if ws := findWorkspace(filepath.Join(root, "a/b/c"), []string{".git"}); ws != filepath.Join(root, "a") {
+			t.Errorf("findWorkspace -> %q, want %q", ws, filepath.Join(root, "a"))
+		}
+		if ws := findWorkspace(filepath.Join(root, "a/b/c"), []string{".hg"}); ws != "" {
+			t.Errorf("findWorkspace -> %q, want \"\"", ws)
+		}
+	})
+}
@@ -2,8 +2,12 @@ package edit
 
 import (
 	"errors"
+	"os"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/elves/elvish/edit/fuzzy"
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
 	"github.com/elves/elvish/eval/vartypes"
@@ -11,22 +15,29 @@ import (
 )
 
 var (
-	errIncorrectNumOfResults    = errors.New("matcher must return a bool for each candidate")
+	errIncorrectNumOfResults    = errors.New("matcher must return a result for each candidate")
 	errMatcherMustBeFn          = errors.New("matcher must be a function")
 	errMatcherInputMustBeString = errors.New("matcher input must be string")
 )
 
 var (
-	matchPrefix = &eval.BuiltinFn{
-		"edit:match-prefix", wrapMatcher(strings.HasPrefix)}
-	matchSubstr = &eval.BuiltinFn{
-		"edit:match-substr", wrapMatcher(strings.Contains)}
-	matchSubseq = &eval.BuiltinFn{
-		"edit:match-subseq", wrapMatcher(util.HasSubseq)}
+	matchPrefix = (&eval.BuiltinFn{
+		"edit:match-prefix", wrapMatcher(strings.HasPrefix)}).DeclareOpts(
+		"ignore-case", "smart-case")
+	matchSubstr = (&eval.BuiltinFn{
+		"edit:match-substr", wrapMatcher(strings.Contains)}).DeclareOpts(
+		"ignore-case", "smart-case")
+	matchSubseq = (&eval.BuiltinFn{
+		"edit:match-subseq", wrapMatcher(util.HasSubseq)}).DeclareOpts(
+		"ignore-case", "smart-case")
+	matchFuzzy = (&eval.BuiltinFn{
+		"edit:match-fuzzy", matchFuzzyImpl}).DeclareOpts(
+		"ignore-case", "smart-case")
 	matchers = []*eval.BuiltinFn{
 		matchPrefix,
 		matchSubstr,
 		matchSubseq,
+		matchFuzzy,
 	}
 
 	_ = RegisterVariable("-matcher", func() vartypes.Variable {
@@ -51,6 +62,170 @@ func (ed *Editor) lookupMatcher(name string) (eval.Fn, bool) {
 	return matcher, ok
 }
 
+// listingMatcher returns the matcher configured for a listing mode, or nil if
+// there is none. Unlike completers, listing modes do not use the fallback
+// matcher, since their default matching is done with substrings and
+// highlighting.
+func (ed *Editor) listingMatcher(mode string) listingMatcher {
+	m := ed.variables["-matcher"].Get().(types.Map)
+	if !m.HasKey(mode) {
+		return nil
+	}
+	matcher, ok := types.MustIndex(m, mode).(eval.Fn)
+	if !ok {
+		return nil
+	}
+	return func(texts []string, pattern string, ignoreCase bool) []*matchResult {
+		results, err := callMatcher(ed.evaler, matcher, pattern, texts, ignoreCase)
+		if err != nil {
+			ed.Notify("matcher error: %v", err)
+			return matchSubstrs(texts, pattern, ignoreCase)
+		}
+		return results
+	}
+}
+
+// matchResult is the result of matching a text against a pattern.
+type matchResult struct {
+	score float64
+	// Byte indices of matched runes in the text, in ascending order.
+	positions []int
+}
+
+var matchResultDescriptor = types.NewStructDescriptor("score", "positions")
+
+func (r *matchResult) toValue() types.Value {
+	positions := make([]types.Value, len(r.positions))
+	for i, p := range r.positions {
+		positions[i] = strconv.Itoa(p)
+	}
+	return types.NewStruct(matchResultDescriptor, []types.Value{
+		strconv.FormatFloat(r.score, 'g', -1, 64),
+		types.MakeList(positions...)})
+}
+
+// parseMatcherOutput converts one output of a matcher to a *matchResult. A
+// matcher may output a boolean, or a map with a "score" field and an optional
+// "positions" field. It returns nil if the output indicates no match.
+func parseMatcherOutput(v types.Value) *matchResult {
+	if !types.ToBool(v) {
+		return nil
+	}
+	m, ok := v.(types.MapLike)
+	if !ok {
+		return &matchResult{}
+	}
+	r := &matchResult{}
+	if m.HasKey("score") {
+		r.score, _ = strconv.ParseFloat(types.ToString(types.MustIndex(m, "score")), 64)
+	}
+	if m.HasKey("positions") {
+		types.Iterate(types.MustIndex(m, "positions"), func(v types.Value) bool {
+			if i, err := strconv.Atoi(types.ToString(v)); err == nil {
+				r.positions = append(r.positions, i)
+			}
+			return true
+		})
+	}
+	return r
+}
+
+// callMatcher calls a matcher with all the texts as input, and returns one
+// result for each text.
+func callMatcher(ev *eval.Evaler, matcher eval.Fn, pattern string, texts []string, ignoreCase bool) ([]*matchResult, error) {
+	input := make(chan types.Value, len(texts))
+	for _, text := range texts {
+		input <- text
+	}
+	close(input)
+
+	ports := []*eval.Port{
+		{Chan: input, File: eval.DevNull}, {File: os.Stdout}, {File: os.Stderr}}
+	ec := eval.NewTopFrame(ev, eval.NewInternalSource("[editor matcher]"), ports)
+
+	opts := eval.NoOpts
+	if ignoreCase {
+		opts = map[string]types.Value{"ignore-case": types.Bool(true)}
+	}
+	values, err := ec.PCaptureOutput(matcher, []types.Value{pattern}, opts)
+	if err != nil {
+		return nil, err
+	} else if len(values) != len(texts) {
+		return nil, errIncorrectNumOfResults
+	}
+	results := make([]*matchResult, len(values))
+	for i, value := range values {
+		results[i] = parseMatcherOutput(value)
+	}
+	return results, nil
+}
+
+// listingMatcher matches texts against a pattern, returning one result for
+// each text.
+type listingMatcher func(texts []string, pattern string, ignoreCase bool) []*matchResult
+
+// matchSubstrs is the default listingMatcher. It matches substrings and
+// records the positions of the matched runes.
+func matchSubstrs(texts []string, pattern string, ignoreCase bool) []*matchResult {
+	results := make([]*matchResult, len(texts))
+	for i, text := range texts {
+		results[i] = matchSubstr1(text, pattern, ignoreCase)
+	}
+	return results
+}
+
+func matchSubstr1(text, pattern string, ignoreCase bool) *matchResult {
+	s := text
+	if ignoreCase {
+		s, pattern = strings.ToLower(s), strings.ToLower(pattern)
+	}
+	i := strings.Index(s, pattern)
+	if i == -1 {
+		return nil
+	}
+	if len(s) != len(text) {
+		// Lowering the case has changed byte indices; don't bother mapping
+		// them back.
+		return &matchResult{}
+	}
+	var positions []int
+	for j := i; j < i+len(pattern); {
+		positions = append(positions, j)
+		_, size := utf8.DecodeRuneInString(text[j:])
+		j += size
+	}
+	return &matchResult{0, positions}
+}
+
+func matchFuzzyImpl(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+	var pattern string
+	iterate := eval.ScanArgsOptionalInput(ec, args, &pattern)
+	var options struct {
+		IgnoreCase bool
+		SmartCase  bool
+	}
+	eval.ScanOptsToStruct(opts, &options)
+	if options.IgnoreCase && options.SmartCase {
+		throwf("-ignore-case and -smart-case cannot be used together")
+	}
+	ignoreCase := options.IgnoreCase ||
+		(options.SmartCase && pattern == strings.ToLower(pattern))
+
+	out := ec.OutputChan()
+	iterate(func(v types.Value) {
+		s, ok := v.(string)
+		if !ok {
+			throw(errMatcherInputMustBeString)
+		}
+		score, positions, ok := fuzzy.Match(s, pattern, ignoreCase)
+		if ok {
+			out <- (&matchResult{float64(score), positions}).toValue()
+		} else {
+			out <- types.Bool(false)
+		}
+	})
+}
+
 func wrapMatcher(matcher func(s, p string) bool) eval.BuiltinFnImpl {
 	return func(ec *eval.Frame,
 		args []types.Value, opts map[string]types.Value) {
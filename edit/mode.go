@@ -15,6 +15,7 @@ const (
 	modeNavigation     = "navigation"
 	modeHistory        = "history"
 	modeHistoryListing = "histlist"
+	modeHistorySearch  = "histsearch"
 	modeLastCmd        = "lastcmd"
 	modeLocation       = "location"
 	modeListing        = "listing" // A "super mode" for histlist, lastcmd, loc
@@ -0,0 +1,83 @@
+package edit
+
+import (
+	"strings"
+
+	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/util"
+)
+
+// Support for editing multi-line buffers.
+
+var (
+	// $edit:continuation-prompt is written at the beginning of every line of
+	// the buffer except the first one. When it is empty, continuation lines
+	// are aligned with the end of the prompt instead.
+	_ = RegisterVariable("continuation-prompt", func() vartypes.Variable {
+		s := ""
+		return vartypes.NewString(&s)
+	})
+	// $edit:indent-unit is inserted once for each level of brackets when
+	// auto-indenting. When it is empty, the indentation of the previous line
+	// is copied instead.
+	_ = RegisterVariable("indent-unit", func() vartypes.Variable {
+		s := "    "
+		return vartypes.NewString(&s)
+	})
+)
+
+func (ed *Editor) continuationPrompt() string {
+	return ed.variables["continuation-prompt"].Get().(string)
+}
+
+func (ed *Editor) indentUnit() string {
+	return ed.variables["indent-unit"].Get().(string)
+}
+
+// indentAt returns the indentation suitable for a new line started at the
+// given position of the buffer.
+func (ed *Editor) indentAt(p int) string {
+	unit := ed.indentUnit()
+	if unit == "" {
+		return findLastIndent(ed.buffer[:p])
+	}
+	n, _ := parse.Parse("[interactive]", ed.buffer)
+	if inQuoted(n, p) {
+		// Indentation would become part of the string.
+		return ""
+	}
+	return strings.Repeat(unit, nestingDepth(n, p))
+}
+
+// inQuoted returns whether a position is inside a quoted string.
+func inQuoted(n parse.Node, p int) bool {
+	leaf := findLeafNode(n, p)
+	pn, ok := leaf.(*parse.Primary)
+	return ok && p > pn.Begin() &&
+		(pn.Type == parse.SingleQuoted || pn.Type == parse.DoubleQuoted)
+}
+
+// dedentForCloser removes one level of indentation from the current line if
+// it only contains auto-inserted indentation before the dot. It is called
+// before a closing bracket is inserted, so that the bracket lines up with the
+// line that contains the opening bracket. It returns whether the buffer was
+// changed.
+func (ed *Editor) dedentForCloser() bool {
+	unit := ed.indentUnit()
+	sol := util.FindLastSOL(ed.buffer[:ed.dot])
+	if unit == "" || sol == 0 {
+		return false
+	}
+	indent := ed.indentAt(ed.dot)
+	if indent == "" || ed.buffer[sol:ed.dot] != indent {
+		return false
+	}
+	ed.buffer = ed.buffer[:sol] + indent[len(unit):] + ed.buffer[ed.dot:]
+	ed.dot -= len(unit)
+	return true
+}
+
+func isCloser(r rune) bool {
+	return r == ')' || r == ']' || r == '}'
+}
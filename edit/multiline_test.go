@@ -0,0 +1,30 @@
+package edit
+
+import (
+	"testing"
+
+	"github.com/elves/elvish/parse"
+	"github.com/elves/elvish/tt"
+)
+
+var nestingDepthTests = tt.Table{
+	tt.Args("echo", 4).Rets(0),
+	// Unclosed brackets enclose the end of the source.
+	tt.Args("if $x {", 7).Rets(1),
+	tt.Args("fn f { put [", 12).Rets(2),
+	tt.Args("put (put [a", 11).Rets(2),
+	// Closed brackets only enclose positions between the brackets.
+	tt.Args("put [a]", 7).Rets(0),
+	tt.Args("put [a]", 6).Rets(1),
+	tt.Args("{ put [a] }", 9).Rets(1),
+	tt.Args("{ put [a] }", 11).Rets(0),
+	// Positions before the opening bracket are not enclosed.
+	tt.Args("put [a", 4).Rets(0),
+}
+
+func TestNestingDepth(t *testing.T) {
+	tt.Test(t, tt.Fn("nestingDepth", func(src string, p int) int {
+		n, _ := parse.Parse("[test]", src)
+		return nestingDepth(n, p)
+	}), nestingDepthTests)
+}
@@ -3,10 +3,12 @@ package edit
 import (
 	"container/list"
 	"errors"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
 
+	"github.com/elves/elvish/edit/history"
 	"github.com/elves/elvish/edit/ui"
 	"github.com/elves/elvish/eval"
 	"github.com/elves/elvish/eval/types"
@@ -51,9 +53,11 @@ type narrow struct {
 	placehold string
 	source    func() []narrowItem
 	action    func(*Editor, narrowItem)
-	match     func(string, string) bool
+	match     listingMatcher
 	filtered  []narrowItem
-	opts      narrowOptions
+	// Byte indices of matched runes in the display text of filtered items.
+	highlights [][]int
+	opts       narrowOptions
 }
 
 func (l *narrow) Binding(m map[string]vartypes.Variable, k ui.Key) eval.Fn {
@@ -111,18 +115,25 @@ func (l *narrow) List(maxHeight int) ui.Renderer {
 	high := low
 	height := 0
 	var listOfLines list.List
-	getEntry := func(i int) []ui.Styled {
+	getEntry := func(i int) []listingLine {
 		display := l.filtered[i].Display()
 		lines := strings.Split(display.Text, "\n")
 		styles := display.Styles
 		if i == l.selected {
 			styles = append(styles, styleForSelected...)
 		}
-		styleds := make([]ui.Styled, len(lines))
-		for i, line := range lines {
-			styleds[i] = ui.Styled{line, styles}
+		entry := make([]listingLine, len(lines))
+		offset := 0
+		for j, line := range lines {
+			entry[j].Styled = ui.Styled{line, styles}
+			for _, p := range l.highlights[i] {
+				if offset <= p && p < offset+len(line) {
+					entry[j].highlights = append(entry[j].highlights, p-offset)
+				}
+			}
+			offset += len(line) + 1
 		}
-		return styleds
+		return entry
 	}
 	// We start by extending high, so that the first entry to include is
 	// l.selected.
@@ -162,11 +173,14 @@ func (l *narrow) List(maxHeight int) ui.Renderer {
 
 	// Convert the List to a slice.
 	lines := make([]ui.Styled, 0, listOfLines.Len())
+	highlights := make([][]int, 0, listOfLines.Len())
 	for p := listOfLines.Front(); p != nil; p = p.Next() {
-		lines = append(lines, p.Value.(ui.Styled))
+		line := p.Value.(listingLine)
+		lines = append(lines, line.Styled)
+		highlights = append(highlights, line.highlights)
 	}
 
-	ls := listingRenderer{lines}
+	ls := listingRenderer{lines, highlights}
 	if low > 0 || high < n || lastShownIncomplete {
 		// Need scrollbar
 		return listingWithScrollBarRenderer{ls, n, low, high, height}
@@ -179,22 +193,22 @@ func (l *narrow) refresh() {
 	if l.source != nil {
 		candidates = l.source()
 	}
-	l.filtered = make([]narrowItem, 0, len(candidates))
-
-	filter := l.filter
-	if l.opts.IgnoreCase {
-		filter = strings.ToLower(filter)
+	texts := make([]string, len(candidates))
+	for i, item := range candidates {
+		texts[i] = item.FilterText()
 	}
+	match := l.match
+	if match == nil {
+		match = matchSubstrs
+	}
+	results := match(texts, l.filter, l.opts.IgnoreCase)
 
+	var filtered scoredNarrowItems
 	set := make(map[string]struct{})
 
-	for _, item := range candidates {
-		text := item.FilterText()
-		s := text
-		if l.opts.IgnoreCase {
-			s = strings.ToLower(s)
-		}
-		if !l.match(s, filter) {
+	for i, item := range candidates {
+		text := texts[i]
+		if results[i] == nil {
 			continue
 		}
 		if l.opts.IgnoreDuplication {
@@ -203,7 +217,21 @@ func (l *narrow) refresh() {
 			}
 			set[text] = struct{}{}
 		}
-		l.filtered = append(l.filtered, item)
+		filtered.items = append(filtered.items, item)
+		filtered.results = append(filtered.results, results[i])
+	}
+	// Put the best matches nearest to the initial selection.
+	filtered.bestLast = l.opts.KeepBottom
+	sort.Stable(filtered)
+
+	l.filtered = make([]narrowItem, len(filtered.items))
+	l.highlights = make([][]int, len(filtered.items))
+	for i, item := range filtered.items {
+		l.filtered[i] = item
+		// Positions are only meaningful when the filter text is displayed.
+		if item.Display().Text == item.FilterText() {
+			l.highlights[i] = filtered.results[i].positions
+		}
 	}
 
 	if l.opts.KeepBottom {
@@ -213,6 +241,28 @@ func (l *narrow) refresh() {
 	}
 }
 
+// scoredNarrowItems sorts narrowItems by their match scores, in ascending
+// order if bestLast is true and descending order otherwise.
+type scoredNarrowItems struct {
+	items    []narrowItem
+	results  []*matchResult
+	bestLast bool
+}
+
+func (s scoredNarrowItems) Len() int { return len(s.items) }
+
+func (s scoredNarrowItems) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+}
+
+func (s scoredNarrowItems) Less(i, j int) bool {
+	if s.bestLast {
+		return s.results[i].score < s.results[j].score
+	}
+	return s.results[i].score > s.results[j].score
+}
+
 func (l *narrow) changeFilter(newfilter string) {
 	l.filter = newfilter
 	l.refresh()
@@ -413,11 +463,10 @@ func NarrowRead(ec *eval.Frame, args []types.Value, opts map[string]types.Value)
 	l.action = func(ed *Editor, item narrowItem) {
 		ed.CallFn(action, item)
 	}
-	// TODO: user customize varible
-	l.match = strings.Contains
+	ed := ec.Editor.(*Editor)
+	l.match = ed.listingMatcher(modeNarrow)
 
 	l.changeFilter("")
-	ed := ec.Editor.(*Editor)
 	ed.mode = l
 }
 
@@ -453,7 +502,8 @@ func CommandHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Va
 
 	out := ec.OutputChan()
 	ed := ec.Editor.(*Editor)
-	cmds, err := ed.historyFuser.AllCmds()
+	ed.refreshHistory()
+	cmds, err := ed.historyFuser.AllEntries()
 	if err != nil {
 		return
 	}
@@ -482,11 +532,26 @@ func CommandHistory(ec *eval.Frame, args []types.Value, opts map[string]types.Va
 	}
 
 	for i := start; i < end; i++ {
-		out <- types.MakeMap(map[types.Value]types.Value{
-			"id":  strconv.Itoa(i),
-			"cmd": cmds[i],
-		})
+		out <- historyEntryToMap(i, cmds[i])
+	}
+}
+
+// historyEntryToMap converts a history entry to a map. The metadata fields are
+// only present when the metadata of the entry is known.
+func historyEntryToMap(id int, entry history.Entry) types.Map {
+	m := map[types.Value]types.Value{
+		"id":  strconv.Itoa(id),
+		"seq": strconv.Itoa(entry.Seq),
+		"cmd": entry.Cmd,
+	}
+	if meta := entry.Meta; meta != nil {
+		m["start-time"] = strconv.FormatInt(meta.StartTime.Unix(), 10)
+		m["duration"] = strconv.FormatFloat(meta.Duration.Seconds(), 'f', -1, 64)
+		m["dir"] = meta.Dir
+		m["exit-status"] = strconv.Itoa(meta.ExitStatus)
+		m["session"] = meta.Session
 	}
+	return types.MakeMap(m)
 }
 
 func InsertAtDot(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
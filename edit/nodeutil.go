@@ -58,3 +58,48 @@ func wordifyInner(n parse.Node, words []string) []string {
 	}
 	return words
 }
+
+// bracketClosers maps types of Primary nodes that are delimited by brackets to
+// their closing brackets.
+var bracketClosers = map[parse.PrimaryType]string{
+	parse.ExceptionCapture: ")",
+	parse.OutputCapture:    ")",
+	parse.List:             "]",
+	parse.Map:              "]",
+	parse.Lambda:           "}",
+	parse.Braced:           "}",
+}
+
+// nestingDepth returns the number of brackets in the AST that enclose a
+// position. A bracket that is not yet closed encloses everything up to the end
+// of the source.
+func nestingDepth(n parse.Node, p int) int {
+	depth := 0
+	if pn, ok := n.(*parse.Primary); ok && bracketEncloses(pn, p) {
+		depth = 1
+	}
+	for _, ch := range n.Children() {
+		if ch.Begin() < p && p <= ch.End() {
+			return depth + nestingDepth(ch, p)
+		}
+	}
+	return depth
+}
+
+func bracketEncloses(pn *parse.Primary, p int) bool {
+	closer, ok := bracketClosers[pn.Type]
+	if !ok || p <= pn.Begin() {
+		return false
+	}
+	if p < pn.End() {
+		return true
+	}
+	// The position is at the end of the node; it is only enclosed when the
+	// closing bracket is missing.
+	children := pn.Children()
+	if len(children) < 2 {
+		return true
+	}
+	last := children[len(children)-1]
+	return !(parse.IsSep(last) && strings.HasSuffix(last.SourceText(), closer))
+}
@@ -44,6 +44,8 @@ func (lp placeholderRenderer) Render(b *ui.Buffer) {
 
 type listingRenderer struct {
 	lines []ui.Styled
+	// Byte indices of matched runes in each line; may be nil.
+	highlights [][]int
 }
 
 func (ls listingRenderer) Render(b *ui.Buffer) {
@@ -51,10 +53,36 @@ func (ls listingRenderer) Render(b *ui.Buffer) {
 		if i > 0 {
 			b.Newline()
 		}
-		b.WriteString(util.ForceWcwidth(line.Text, b.Width), line.Styles.String())
+		var highlights []int
+		if i < len(ls.highlights) {
+			highlights = ls.highlights[i]
+		}
+		writeHighlighted(b, util.ForceWcwidth(line.Text, b.Width), line.Styles, highlights)
 	}
 }
 
+// writeHighlighted writes text with the given styles, additionally applying
+// styleForMatched to the runes starting at the byte indices in highlights.
+func writeHighlighted(b *ui.Buffer, text string, styles ui.Styles, highlights []int) {
+	style := styles.String()
+	if len(highlights) == 0 {
+		b.WriteString(text, style)
+		return
+	}
+	matchedStyle := ui.JoinStyles(append(ui.Styles(nil), styles...), styleForMatched).String()
+	start := 0
+	for _, p := range highlights {
+		if p < start || p >= len(text) {
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[p:])
+		b.WriteString(text[start:p], style)
+		b.WriteString(text[p:p+size], matchedStyle)
+		start = p + size
+	}
+	b.WriteString(text[start:], style)
+}
+
 type listingWithScrollBarRenderer struct {
 	listingRenderer
 	n, low, high, height int
@@ -114,6 +142,9 @@ type cmdlineRenderer struct {
 	styling *highlight.Styling
 	dot     int
 	rprompt []*ui.Styled
+	// Written after every newline in line. When empty, continuation lines are
+	// indented to align with the end of the prompt instead.
+	contPrompt string
 
 	hasComp   bool
 	compBegin int
@@ -144,8 +175,9 @@ func (clr *cmdlineRenderer) Render(b *ui.Buffer) {
 
 	b.WriteStyleds(clr.prompt)
 
-	// If the prompt takes less than half of a line, set the indent.
-	if len(b.Lines) == 1 && b.Col*2 < b.Width {
+	// If the prompt takes less than half of a line and there is no
+	// continuation prompt, set the indent.
+	if clr.contPrompt == "" && len(b.Lines) == 1 && b.Col*2 < b.Width {
 		b.Indent = b.Col
 	}
 
@@ -167,17 +199,20 @@ func (clr *cmdlineRenderer) Render(b *ui.Buffer) {
 	nowAt(0)
 
 	for _, r := range clr.line {
+		if clr.hasHist && i == clr.histBegin {
+			break
+		}
 		if clr.hasComp && clr.compBegin <= i && i < clr.compEnd {
 			// Do nothing. This part is replaced by the completion candidate.
 		} else {
 			b.Write(r, applier.Get())
+			if r == '\n' && clr.contPrompt != "" {
+				b.WriteString(clr.contPrompt, styleForContinuationPrompt.String())
+			}
 		}
 		i += utf8.RuneLen(r)
 
 		nowAt(i)
-		if clr.hasHist && i == clr.histBegin {
-			break
-		}
 	}
 
 	if clr.hasHist {
@@ -222,6 +257,7 @@ func (er *editorRenderer) Render(buf *ui.Buffer) {
 
 	// bufLine
 	clr := newCmdlineRenderer(es.promptContent, es.buffer, es.styling, es.dot, es.rpromptContent)
+	clr.contPrompt = es.contPrompt
 	// TODO(xiaq): Instead of doing a type switch, expose an API for modes to
 	// modify the text (and mark their part as modified).
 	switch mode := es.mode.(type) {
@@ -231,6 +267,10 @@ func (er *editorRenderer) Render(buf *ui.Buffer) {
 	case *hist:
 		begin := len(mode.Prefix())
 		clr.setHist(begin, mode.CurrentCmd()[begin:])
+	case *histsearch:
+		if _, cmd := mode.Current(); cmd != "" {
+			clr.setHist(0, cmd)
+		}
 	}
 	bufLine = ui.Render(clr, width)
 
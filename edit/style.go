@@ -23,4 +23,13 @@ var (
 	styleForCompletion = ui.Styles{}
 	// Use inverse style for selected completion entry
 	styleForSelectedCompletion = ui.Styles{"inverse"}
+	// Styles for descriptions and group headers of completion candidates
+	styleForCompletionDescription = ui.Styles{"dim"}
+	styleForCompletionGroup       = ui.Styles{"bold", "underlined"}
 )
+
+// Use default style for continuation prompts
+var styleForContinuationPrompt = ui.Styles{}
+
+// Styles for the matched parts of candidates in completion and listing modes
+var styleForMatched = ui.Styles{"bold", "underlined"}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -51,6 +52,34 @@ func (b *BuiltinFn) Call(ec *Frame, args []types.Value, opts map[string]types.Va
 	return util.PCall(func() { b.Impl(ec, args, opts) })
 }
 
+var (
+	builtinFnOptsMutex sync.RWMutex
+	builtinFnOpts      = make(map[*BuiltinFn][]string)
+)
+
+// DeclareOpts records the names of the options b accepts, so that they can be
+// discovered with OptNames. It returns b.
+func (b *BuiltinFn) DeclareOpts(names ...string) *BuiltinFn {
+	builtinFnOptsMutex.Lock()
+	defer builtinFnOptsMutex.Unlock()
+	builtinFnOpts[b] = names
+	return b
+}
+
+// OptNames returns the names of the options a function accepts. For builtin
+// functions, these are the names declared with DeclareOpts.
+func OptNames(fn Fn) []string {
+	switch fn := fn.(type) {
+	case *Closure:
+		return fn.OptNames
+	case *BuiltinFn:
+		builtinFnOptsMutex.RLock()
+		defer builtinFnOptsMutex.RUnlock()
+		return builtinFnOpts[fn]
+	}
+	return nil
+}
+
 var builtinFns []*BuiltinFn
 
 func addToBuiltinFns(moreFns []*BuiltinFn) {
@@ -86,6 +86,9 @@ func exit(ec *Frame, args []types.Value, opts map[string]types.Value) {
 }
 
 func preExit(ec *Frame) {
+	if waiter, ok := ec.Editor.(PendingWaiter); ok {
+		waiter.WaitPending()
+	}
 	err := ec.DaemonClient.Close()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -15,7 +15,7 @@ func init() {
 	addToBuiltinFns([]*BuiltinFn{
 		{"ns", nsFn},
 
-		{"range", rangeFn},
+		(&BuiltinFn{"range", rangeFn}).DeclareOpts("step"),
 		{"repeat", repeat},
 		{"explode", explode},
 
@@ -18,7 +18,10 @@ func init() {
 	addToBuiltinFns([]*BuiltinFn{
 		// Directory
 		{"cd", cd},
-		{"dir-history", dirs},
+		(&BuiltinFn{"dir-history", dirHistory}).DeclareOpts("prune"),
+		{"pushd", pushd},
+		{"popd", popd},
+		{"dirs", dirs},
 
 		// Path
 		{"path-abs", WrapStringToStringError(filepath.Abs)},
@@ -66,6 +69,9 @@ func mustGetOneString(args []types.Value) string {
 	return s
 }
 
+// cd changes the current directory. "cd -" changes to the previous directory,
+// and relative directories not found in the current directory are searched in
+// $cdpath.
 func cd(ec *Frame, args []types.Value, opts map[string]types.Value) {
 	TakeNoOpt(opts)
 
@@ -73,7 +79,9 @@ func cd(ec *Frame, args []types.Value, opts map[string]types.Value) {
 	if len(args) == 0 {
 		dir = mustGetHome("")
 	} else if len(args) == 1 {
-		dir = types.ToString(args[0])
+		var err error
+		dir, err = ec.resolveCdPath(types.ToString(args[0]))
+		maybeThrow(err)
 	} else {
 		throw(ErrArgs)
 	}
@@ -82,7 +90,48 @@ func cd(ec *Frame, args []types.Value, opts map[string]types.Value) {
 }
 
 func cdInner(dir string, ec *Frame) {
-	maybeThrow(Chdir(dir, ec.DaemonClient))
+	maybeThrow(ec.Chdir(dir))
+}
+
+// pushd changes to a directory like cd, pushing the current directory onto
+// the directory stack. Without arguments, it exchanges the current directory
+// with the top of the stack.
+func pushd(ec *Frame, args []types.Value, opts map[string]types.Value) {
+	TakeNoOpt(opts)
+
+	switch len(args) {
+	case 0:
+		maybeThrow(ec.popDir(true))
+	case 1:
+		dir, err := ec.resolveCdPath(types.ToString(args[0]))
+		maybeThrow(err)
+		maybeThrow(ec.pushDir(dir))
+	default:
+		throw(ErrArgs)
+	}
+}
+
+// popd removes the top of the directory stack and changes to it.
+func popd(ec *Frame, args []types.Value, opts map[string]types.Value) {
+	TakeNoArg(args)
+	TakeNoOpt(opts)
+
+	maybeThrow(ec.popDir(false))
+}
+
+// dirs outputs the current directory, followed by the directory stack from
+// the top.
+func dirs(ec *Frame, args []types.Value, opts map[string]types.Value) {
+	TakeNoArg(args)
+	TakeNoOpt(opts)
+
+	pwd, err := os.Getwd()
+	maybeThrow(err)
+	out := ec.ports[1].Chan
+	out <- pwd
+	for _, dir := range ec.dirStackSnapshot() {
+		out <- dir
+	}
 }
 
 var dirDescriptor = types.NewStructDescriptor("path", "score")
@@ -92,14 +141,23 @@ func newDirStruct(path string, score float64) *types.Struct {
 		[]types.Value{path, floatToString(score)})
 }
 
-func dirs(ec *Frame, args []types.Value, opts map[string]types.Value) {
+// dirHistory outputs the directory history. With &prune, directories that no
+// longer exist are removed from the history first.
+func dirHistory(ec *Frame, args []types.Value, opts map[string]types.Value) {
 	TakeNoArg(args)
-	TakeNoOpt(opts)
+	var prune bool
+	ScanOpts(opts, OptToScan{"prune", &prune, types.Bool(false)})
 
 	if ec.DaemonClient == nil {
 		throw(ErrStoreNotConnected)
 	}
-	dirs, err := ec.DaemonClient.Dirs(storedefs.NoBlacklist)
+	if prune {
+		_, err := ec.DaemonClient.PruneDirs()
+		if err != nil {
+			throw(errors.New("store error: " + err.Error()))
+		}
+	}
+	dirs, err := ec.DaemonClient.Dirs(storedefs.NoBlacklist, ec.DirHalfLife())
 	if err != nil {
 		throw(errors.New("store error: " + err.Error()))
 	}
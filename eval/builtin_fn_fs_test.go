@@ -3,6 +3,8 @@ package eval
 import (
 	"path/filepath"
 	"testing"
+
+	"github.com/elves/elvish/eval/types"
 )
 
 func TestBuiltinFnFS(t *testing.T) {
@@ -14,5 +16,19 @@ func TestBuiltinFnFS(t *testing.T) {
 
 		{`-is-dir ~/dir`, wantTrue}, // see testmain_test.go for setup
 		{`-is-dir ~/lorem`, wantFalse},
+
+		// Directory changing; all tests change back to the original directory.
+		{`h = $pwd; cd dir; cd -; eq $pwd $h; cd -; path-base $pwd; cd $h`,
+			want{out: []types.Value{types.Bool(true), "dir"}}},
+		{`h = $pwd; cdpath = [$h]; cd /; cd dir; path-base $pwd; cd $h; cdpath = []`,
+			want{out: strs("dir")}},
+		{`h = $pwd; pushd dir; pushd ../dir2; dirs | take 2 | each $path-base~
+		  popd; path-base $pwd; popd; eq $pwd $h`,
+			want{out: []types.Value{"dir2", "dir", "dir", types.Bool(true)}}},
+		{`h = $pwd; pushd dir; pushd; eq $pwd $h; pushd; path-base $pwd; popd`,
+			want{out: []types.Value{types.Bool(true), "dir"}}},
+		{`popd`, want{err: errDirStackEmpty}},
+		{`n = 0; after-chdir = [[d]{ n = (+ $n 1) }]; cd dir; cd ..; put $n`,
+			want{out: strs("2")}},
 	})
 }
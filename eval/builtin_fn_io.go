@@ -18,8 +18,8 @@ func init() {
 		{"put", put},
 
 		// Bytes output
-		{"print", print},
-		{"echo", echo},
+		(&BuiltinFn{"print", print}).DeclareOpts("sep"),
+		(&BuiltinFn{"echo", echo}).DeclareOpts("sep"),
 		{"pprint", pprint},
 		{"repr", repr},
 
@@ -33,8 +33,8 @@ func init() {
 		{"to-string", toString},
 
 		{"joins", joins},
-		{"splits", splits},
-		{"replaces", replaces},
+		(&BuiltinFn{"splits", splits}).DeclareOpts("max"),
+		(&BuiltinFn{"replaces", replaces}).DeclareOpts("max"),
 
 		{"ord", ord},
 		{"base", base},
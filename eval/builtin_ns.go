@@ -11,13 +11,13 @@ import (
 
 func makeBuiltinNs() Ns {
 	ns := Ns{
-		"_":     vartypes.NewBlackhole(),
-		"pid":   vartypes.NewRo(strconv.Itoa(syscall.Getpid())),
-		"ok":    vartypes.NewRo(OK),
-		"true":  vartypes.NewRo(types.Bool(true)),
-		"false": vartypes.NewRo(types.Bool(false)),
-		"paths": &EnvList{envName: "PATH"},
-		"pwd":   PwdVariable{},
+		"_":      vartypes.NewBlackhole(),
+		"pid":    vartypes.NewRo(strconv.Itoa(syscall.Getpid())),
+		"ok":     vartypes.NewRo(OK),
+		"true":   vartypes.NewRo(types.Bool(true)),
+		"false":  vartypes.NewRo(types.Bool(false)),
+		"paths":  &EnvList{envName: "PATH"},
+		"cdpath": &EnvList{envName: "CDPATH"},
 	}
 	AddBuiltinFns(ns, builtinFns...)
 	return ns
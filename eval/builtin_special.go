@@ -104,8 +104,10 @@ func compileDel(cp *compiler, fn *parse.Form) OpBody {
 				f = delLocalVarOp{name}
 			case "E":
 				f = delEnvVarOp{name}
+			case "shared":
+				f = delSharedVarOp{name}
 			default:
-				cp.errorf("only variables in local: or E: can be deleted")
+				cp.errorf("only variables in local:, E: or shared: can be deleted")
 				continue
 			}
 		} else {
@@ -162,7 +164,11 @@ func (op *delElemOp) Invoke(fm *Frame) error {
 		}
 		indicies = append(indicies, indexValues[0])
 	}
-	err := vartypes.DelElement(fm.ResolveVar(op.ns, op.name), indicies)
+	variable := fm.ResolveVar(op.ns, op.name)
+	if _, err := getVar(variable); err != nil {
+		return err
+	}
+	err := vartypes.DelElement(variable, indicies)
 	if err != nil {
 		if level := vartypes.GetElementErrorLevel(err); level >= 0 {
 			fm.errorpf(op.begin, op.ends[level], "%s", err.Error())
@@ -316,7 +322,7 @@ func loadModule(ec *Frame, name string) (Ns, error) {
 		ec.Evaler, meta,
 		modGlobal, make(Ns),
 		ec.ports,
-		0, len(code), ec.addTraceback(), false,
+		0, len(code), ec.addTraceback(), false, ec.interrupts,
 	}
 
 	op, err := newEc.Compile(n, meta)
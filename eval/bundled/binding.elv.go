@@ -29,7 +29,7 @@ fn install {
         &Ctrl-K=     $edit:kill-line-right~
         &Ctrl-L=     $edit:location:start~
         &Ctrl-N=     $edit:navigation:start~
-        &Ctrl-R=     $edit:histlist:start~
+        &Ctrl-R=     $edit:histsearch:start~
         &Ctrl-U=     $edit:kill-line-left~
         &Ctrl-V=     $edit:insert-raw~
         &Ctrl-W=     $edit:kill-word-left~
@@ -58,6 +58,18 @@ fn install {
         &'Ctrl-['= $edit:insert:start~
     ])
 
+    edit:histsearch:binding = (edit:binding-table [
+        &Default=   $edit:histsearch:default~
+        &Backspace= $edit:histsearch:backspace~
+        &Tab=       $edit:histsearch:switch-to-histlist~
+        &Ctrl-R=    $edit:histsearch:prev~
+        &Ctrl-S=    $edit:histsearch:next~
+        &Ctrl-T=    $edit:histsearch:toggle-mode~
+        &Ctrl-D=    $edit:histsearch:toggle-scope~
+        &Ctrl-G=    $edit:histsearch:abort~
+        &'Ctrl-['=  $edit:histsearch:abort~
+    ])
+
     edit:completion:binding = (edit:binding-table [
         &Default=   $edit:completion:default~
         &Up=        $edit:completion:up~
@@ -88,6 +100,9 @@ fn install {
     edit:histlist:binding = (edit:binding-table [
         &Ctrl-D= $edit:histlist:toggle-dedup~
         &Ctrl-G= $edit:histlist:toggle-case-sensitivity~
+        &Alt-d=  $edit:histlist:toggle-dir-filter~
+        &Alt-s=  $edit:histlist:toggle-session-filter~
+        &Alt-f=  $edit:histlist:toggle-failed-filter~
     ])
 
     edit:location:binding = (edit:binding-table [&])
@@ -5,6 +5,7 @@ package bundled
 func Get() map[string]string {
 	return map[string]string{
 		"binding":          bindingElv,
+		"completers":       completersElv,
 		"epm":              epmElv,
 		"narrow":           narrowElv,
 		"readline-binding": readlineBindingElv,
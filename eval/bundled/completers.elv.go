@@ -0,0 +1,337 @@
+package bundled
+
+const completersElv = `
+# Argument completers for some common commands.
+#
+# Usage:
+#   use completers
+#   completers:install
+#
+# completers:install installs all the completers into $edit:arg-completer.
+# To install only some of them, pass their names:
+#   completers:install git kill
+#
+# The completers can also be installed individually, possibly for other
+# commands:
+#   edit:arg-completer[hub] = $completers:git~
+#
+# Available completers:
+#   git    subcommands, branches, tags, remotes and files
+#   ssh    hosts from ~/.ssh/config and ~/.ssh/known_hosts (also for scp,
+#          sftp and mosh)
+#   kill   process IDs, with process names as descriptions, and signals
+#   cd     directories
+#   env    environment variable names (also for printenv)
+#   E      environment variable names as E:name (for del)
+#
+# Values of environment variables are never shown, since they may contain
+# secrets.
+
+use re
+
+# The commands each completer is installed for.
+commands = [
+  &git=[git]
+  &ssh=[ssh scp sftp mosh]
+  &kill=[kill]
+  &cd=[cd]
+  &env=[env printenv]
+  &E=[del]
+]
+
+fn -cand [stem &desc='' &group='' &suffix='']{
+  edit:complex-candidate $stem &description=$desc &group=$group &code-suffix=$suffix
+}
+
+# Outputs lines of a file, or nothing if the file cannot be read.
+fn -lines [path]{
+  try {
+    from-lines < $path
+  } except e {
+  }
+}
+
+fn -files [seed]{
+  edit:complete-filename $seed
+}
+
+# Outputs directories whose paths start with $seed.
+fn -dirs [seed]{
+  # Not named $paths, which would overwrite the builtin $paths and thus $E:PATH.
+  matches = []
+  try {
+    if (re:match '(^|/)\.[^/]*$' $seed) {
+      matches = [$seed*[match-hidden]]
+    } else {
+      matches = [$seed*]
+    }
+    for path $matches {
+      if (-is-dir $path) {
+        -cand $path &suffix=/
+      }
+    }
+  } except e {
+    # No match.
+  }
+}
+
+########################################################################
+# git
+
+git-subcommands = [
+  &add='add file contents to the index'
+  &bisect='find the commit that introduced a bug'
+  &blame='show what revision last modified each line'
+  &branch='list, create, or delete branches'
+  &checkout='switch branches or restore files'
+  &cherry-pick='apply the changes of existing commits'
+  &clean='remove untracked files'
+  &clone='clone a repository into a new directory'
+  &commit='record changes to the repository'
+  &config='get and set options'
+  &describe='describe a commit using the most recent tag'
+  &diff='show changes between commits, commit and working tree, etc'
+  &fetch='download objects and refs from another repository'
+  &grep='print lines matching a pattern'
+  &init='create an empty repository'
+  &log='show commit logs'
+  &merge='join two or more development histories together'
+  &mv='move or rename a file'
+  &pull='fetch from and integrate with another repository or branch'
+  &push='update remote refs along with associated objects'
+  &rebase='reapply commits on top of another base tip'
+  &reflog='manage reflog information'
+  &remote='manage set of tracked repositories'
+  &reset='reset current HEAD to the specified state'
+  &restore='restore working tree files'
+  &revert='revert some existing commits'
+  &rm='remove files from the working tree and from the index'
+  &show='show various types of objects'
+  &stash='stash the changes in a dirty working directory away'
+  &status='show the working tree status'
+  &submodule='initialize, update or inspect submodules'
+  &switch='switch branches'
+  &tag='create, list, delete or verify tags'
+  &worktree='manage multiple working trees'
+]
+
+# Subcommands whose arguments are revisions, as opposed to files.
+git-rev-subcommands = [
+  &branch=$true &checkout=$true &cherry-pick=$true &diff=$true &log=$true
+  &merge=$true &rebase=$true &reset=$true &revert=$true &show=$true
+  &switch=$true &tag=$true
+]
+
+fn -git-refs [prefix group]{
+  try {
+    e:git for-each-ref '--format=%(refname:short)' $prefix 2>/dev/null | each [ref]{
+      -cand $ref &group=$group
+    }
+  } except e {
+  }
+}
+
+fn -git-remotes {
+  try {
+    e:git remote 2>/dev/null | each [remote]{
+      -cand $remote &group=remotes
+    }
+  } except e {
+  }
+}
+
+fn git [@words]{
+  n = (count $words)
+  seed = $words[-1]
+  if (== $n 2) {
+    for sub [(keys $git-subcommands)] {
+      -cand $sub &desc=$git-subcommands[$sub] &group=subcommands
+    }
+    try {
+      e:git config --get-regexp '^alias\.' 2>/dev/null | each [line]{
+        re:find '^alias\.([^ ]+) (.*)' $line | each [m]{
+          -cand $m[groups][1][text] &desc=$m[groups][2][text] &group=aliases
+        }
+      }
+    } except e {
+    }
+    return
+  }
+
+  sub = $words[1]
+  if (has-key $git-rev-subcommands $sub) {
+    -git-refs refs/heads 'local branches'
+    -git-refs refs/remotes 'remote branches'
+    -git-refs refs/tags tags
+    if (not-eq $sub branch) {
+      -files $seed
+    }
+  } elif (or (eq $sub push) (eq $sub pull) (eq $sub fetch)) {
+    if (== $n 3) {
+      -git-remotes
+    } else {
+      -git-refs refs/heads 'local branches'
+      -git-refs refs/tags tags
+    }
+  } elif (eq $sub remote) {
+    if (== $n 3) {
+      for sub [add remove rename set-url show prune] {
+        -cand $sub &group=subcommands
+      }
+    } else {
+      -git-remotes
+    }
+  } else {
+    -files $seed
+  }
+}
+
+########################################################################
+# ssh
+
+# Outputs hosts from ~/.ssh/config and ~/.ssh/known_hosts.
+fn hosts {
+  -lines ~/.ssh/config | each [line]{
+    re:find '^\s*[Hh]ost\s+(.*)$' $line | each [m]{
+      for host [(splits ' ' $m[groups][1][text])] {
+        if (and (not-eq $host '') (not (re:match '[*?!]' $host))) {
+          put $host
+        }
+      }
+    }
+  }
+  -lines ~/.ssh/known_hosts | each [line]{
+    # Hashed hosts cannot be completed.
+    if (and (not-eq $line '') (not (has-prefix $line '|')) (not (has-prefix $line '#'))) {
+      names = (splits ' ' $line | take 1)
+      for host [(splits , $names)] {
+        # Hosts with non-standard ports are written as [host]:port.
+        put (re:replace '^\[(.*)\]:\d+$' '$1' $host)
+      }
+    }
+  }
+}
+
+fn ssh [@words]{
+  seed = $words[-1]
+  if (has-prefix $seed -) {
+    return
+  }
+  # Complete the host part of user@host.
+  user = ''
+  if (re:match '@' $seed) {
+    user = (re:replace '@.*$' '@' $seed)
+  }
+  suffix = ''
+  if (not-eq $words[0] ssh) {
+    if (not-eq $words[0] mosh) {
+      # scp and sftp take host:path.
+      if (re:match : $seed) {
+        return
+      }
+      suffix = ':'
+      -files $seed
+    }
+  }
+  seen = [&]
+  hosts | each [host]{
+    if (not (has-key $seen $host)) {
+      seen[$host] = $true
+      -cand $user$host &suffix=$suffix &group=hosts
+    }
+  }
+}
+
+########################################################################
+# kill
+
+signals = [HUP INT QUIT KILL USR1 USR2 PIPE ALRM TERM CHLD CONT STOP TSTP TTIN TTOU WINCH]
+
+fn -processes {
+  if (-is-dir /proc/self) {
+    for dir [/proc/*[set:0123456789]] {
+      try {
+        name = (re:replace '\n$' '' (slurp < $dir/comm))
+        -cand (path-base $dir) &desc=$name &group=processes
+      } except e {
+        # The process has exited.
+      }
+    }
+  } else {
+    e:ps -A -o pid= -o comm= | eawk [line pid @cmd]{
+      -cand $pid &desc=(joins ' ' $cmd) &group=processes
+    }
+  }
+}
+
+fn kill [@words]{
+  seed = $words[-1]
+  if (has-prefix $seed -) {
+    for sig $signals {
+      -cand -$sig &group=signals
+    }
+  } else {
+    -processes
+  }
+}
+
+########################################################################
+# cd
+
+fn cd [@words]{
+  if (== (count $words) 2) {
+    -dirs $words[-1]
+  }
+}
+
+########################################################################
+# env
+
+# Outputs the names of environment variables.
+fn -env-names {
+  e:env | each [line]{
+    re:find '^([A-Za-z_][A-Za-z0-9_]*)=' $line | each [m]{
+      put $m[groups][1][text]
+    }
+  }
+}
+
+fn env [@words]{
+  suffix = ''
+  if (eq $words[0] env) {
+    suffix = '='
+  }
+  -env-names | each [name]{
+    -cand $name &suffix=$suffix &group='environment variables'
+  }
+}
+
+########################################################################
+# E:
+
+fn E [@words]{
+  -env-names | each [name]{
+    -cand E:$name &group='environment variables'
+  }
+}
+
+completers = [
+  &git=$git~
+  &ssh=$ssh~
+  &kill=$kill~
+  &cd=$cd~
+  &env=$env~
+  &E=$E~
+]
+
+fn install [@names]{
+  if (== (count $names) 0) {
+    names = [(keys $commands)]
+  }
+  for name $names {
+    for cmd $commands[$name] {
+      edit:arg-completer[$cmd] = $completers[$name]
+    }
+  }
+}
+`
@@ -25,8 +25,7 @@ debug-mode = $false
 ]
 
 # Internal configuration
--data-dir = ~/.elvish
--lib-dir = $-data-dir/lib
+-lib-dir = $lib-dir
 
 # General utility functions
 
@@ -276,7 +275,7 @@ fn installed {
   e:ls $-lib-dir | each [dom]{
     cfg = (-domain-config $dom)
     # Only list domains for which we know the config, so that the user
-    # can have his own non-package directories under ~/.elvish/lib
+    # can have his own non-package directories under the lib directory
     # without conflicts.
     if $cfg {
       lvl = $cfg[levels]
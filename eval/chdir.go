@@ -1,7 +1,17 @@
 package eval
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
 )
 
 // AddDirer wraps the AddDir function.
@@ -34,3 +44,199 @@ func Chdir(path string, store AddDirer) error {
 	}
 	return nil
 }
+
+var (
+	errNoOldPwd      = errors.New("no previous directory")
+	errDirStackEmpty = errors.New("directory stack empty")
+)
+
+// dirState keeps the per-session states related to changing directories.
+type dirState struct {
+	// Lists of hooks called before and after changing directories. Exposed as
+	// $before-chdir and $after-chdir.
+	beforeChdir vartypes.Variable
+	afterChdir  vartypes.Variable
+
+	// The half-life of scores in the directory history, in seconds. Exposed
+	// as $dir-history-half-life. Directories whose scores have decayed to
+	// almost 0 are removed from the history when a directory is added, but
+	// at most once a day; directories that no longer exist are only removed
+	// by dir-history &prune.
+	dirHalfLife float64
+
+	dirMutex *sync.Mutex
+	// The previous directory, used by "cd -".
+	oldPwd string
+	// The directory stack manipulated by pushd and popd; the top is at the
+	// end.
+	dirStack []string
+}
+
+func newDirState() dirState {
+	return dirState{
+		beforeChdir: vartypes.NewValidatedPtr(types.EmptyList, vartypes.ShouldBeList),
+		afterChdir:  vartypes.NewValidatedPtr(types.EmptyList, vartypes.ShouldBeList),
+		dirHalfLife: storedefs.DefaultDirHalfLife,
+		dirMutex:    new(sync.Mutex),
+	}
+}
+
+// dirHistoryAdder adds directories to the directory history of the daemon, using
+// the half-life in $dir-history-half-life.
+type dirHistoryAdder struct {
+	client   *daemon.Client
+	halfLife float64
+}
+
+func (dh dirHistoryAdder) AddDir(dir string, weight float64) error {
+	return dh.client.AddDir(dir, weight, dh.halfLife)
+}
+
+// DirHalfLife returns the half-life of scores in the directory history, as
+// set in $dir-history-half-life.
+func (ev *Evaler) DirHalfLife() float64 {
+	return ev.dirHalfLife
+}
+
+// Chdir changes the current directory with the package-level Chdir, using the
+// daemon client as the directory history store. The hooks in $before-chdir are
+// called with the new directory before changing, and the hooks in $after-chdir
+// are called with the old directory after changing successfully.
+//
+// All changes of the current directory, including those done by the editor,
+// should go through this method.
+func (ev *Evaler) Chdir(path string) error {
+	oldPwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	ev.callHooks(ev.beforeChdir, path)
+
+	var store AddDirer
+	if ev.DaemonClient != nil {
+		store = dirHistoryAdder{ev.DaemonClient, ev.dirHalfLife}
+	}
+	err = Chdir(path, store)
+	if err != nil {
+		return err
+	}
+	ev.dirMutex.Lock()
+	ev.oldPwd = oldPwd
+	ev.dirMutex.Unlock()
+	os.Setenv("OLDPWD", oldPwd)
+
+	ev.callHooks(ev.afterChdir, oldPwd)
+	return nil
+}
+
+// callHooks calls each function in the list held by a variable with the
+// given arguments. Errors are printed instead of being raised.
+func (ev *Evaler) callHooks(hooks vartypes.Variable, args ...types.Value) {
+	li, ok := hooks.Get().(types.List)
+	if !ok || li.Len() == 0 {
+		return
+	}
+	li.Iterate(func(v types.Value) bool {
+		fn, ok := v.(Fn)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "not a function: %s\n", types.Repr(v, types.NoPretty))
+			return true
+		}
+		ev.CallInTop("[hooks]", fn, args...)
+		return true
+	})
+}
+
+// resolveCdPath resolves the argument of cd and pushd. A lone "-" is the
+// previous directory. Relative paths that are not found in the current
+// directory are looked up in the directories in $E:CDPATH.
+func (ev *Evaler) resolveCdPath(dir string) (string, error) {
+	if dir == "-" {
+		ev.dirMutex.Lock()
+		defer ev.dirMutex.Unlock()
+		if ev.oldPwd == "" {
+			return "", errNoOldPwd
+		}
+		return ev.oldPwd, nil
+	}
+	if filepath.IsAbs(dir) || isDirInner(dir) || startsWithDotComponent(dir) {
+		return dir, nil
+	}
+	for _, root := range filepath.SplitList(os.Getenv("CDPATH")) {
+		if root == "" {
+			continue
+		}
+		if path := filepath.Join(root, dir); isDirInner(path) {
+			return path, nil
+		}
+	}
+	return dir, nil
+}
+
+// startsWithDotComponent returns whether the first component of a path is
+// "." or "..", in which case $E:CDPATH is not searched.
+func startsWithDotComponent(path string) bool {
+	first := strings.SplitN(filepath.ToSlash(path), "/", 2)[0]
+	return first == "." || first == ".."
+}
+
+// pushDir changes to a directory, and pushes the old directory onto the
+// directory stack on success.
+func (ev *Evaler) pushDir(dir string) error {
+	oldPwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	err = ev.Chdir(dir)
+	if err != nil {
+		return err
+	}
+	ev.dirMutex.Lock()
+	defer ev.dirMutex.Unlock()
+	ev.dirStack = append(ev.dirStack, oldPwd)
+	return nil
+}
+
+// popDir removes the top of the directory stack and changes to it. If the
+// top is passed as swap, it is replaced with the current directory instead of
+// being removed.
+func (ev *Evaler) popDir(swap bool) error {
+	ev.dirMutex.Lock()
+	if len(ev.dirStack) == 0 {
+		ev.dirMutex.Unlock()
+		return errDirStackEmpty
+	}
+	top := ev.dirStack[len(ev.dirStack)-1]
+	ev.dirMutex.Unlock()
+
+	oldPwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	err = ev.Chdir(top)
+	if err != nil {
+		return err
+	}
+
+	ev.dirMutex.Lock()
+	defer ev.dirMutex.Unlock()
+	if n := len(ev.dirStack); n > 0 && ev.dirStack[n-1] == top {
+		if swap {
+			ev.dirStack[n-1] = oldPwd
+		} else {
+			ev.dirStack = ev.dirStack[:n-1]
+		}
+	}
+	return nil
+}
+
+// dirStackSnapshot returns a copy of the directory stack, top first.
+func (ev *Evaler) dirStackSnapshot() []string {
+	ev.dirMutex.Lock()
+	defer ev.dirMutex.Unlock()
+	dirs := make([]string, len(ev.dirStack))
+	for i, dir := range ev.dirStack {
+		dirs[len(dirs)-1-i] = dir
+	}
+	return dirs
+}
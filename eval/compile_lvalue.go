@@ -177,6 +177,9 @@ func (op *elemOp) Invoke(ec *Frame) ([]vartypes.Variable, error) {
 	if variable == nil {
 		return nil, fmt.Errorf("variable $%s:%s does not exist, compiler bug", op.ns, op.name)
 	}
+	if _, err := getVar(variable); err != nil {
+		return nil, err
+	}
 
 	indicies := make([]types.Value, len(op.indexOps))
 	for i, op := range op.indexOps {
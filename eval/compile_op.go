@@ -73,6 +73,7 @@ func (op *pipelineOp) Invoke(ec *Frame) error {
 	if op.bg {
 		ec = ec.fork("background job" + op.source)
 		ec.intCh = nil
+		ec.interrupts = nil
 		ec.background = true
 
 		if ec.Editor != nil {
@@ -283,7 +284,10 @@ func (op *formOp) Invoke(ec *Frame) (errRet error) {
 				v = u
 				saveVars[i] = v
 			}
-			val := v.Get()
+			val, err := getVar(v)
+			if err != nil {
+				return err
+			}
 			saveVals = append(saveVals, val)
 			logger.Printf("saved %s = %s", v, val)
 		}
@@ -456,6 +460,11 @@ func fixNilVariables(vs []vartypes.Variable, perr *error) {
 		if vartypes.IsBlackhole(v) {
 			continue
 		}
+		if _, ok := v.(sharedVariable); ok {
+			// Shared variables are never nil, and getting one that does not
+			// exist yet throws an exception.
+			continue
+		}
 		if v.Get() == nil {
 			err := v.Set("")
 			*perr = util.Errors(*perr, err)
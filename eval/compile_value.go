@@ -298,7 +298,10 @@ func (op variableOp) Invoke(ec *Frame) ([]types.Value, error) {
 	if variable == nil {
 		return nil, fmt.Errorf("variable $%s:%s not found", op.ns, op.name)
 	}
-	value := variable.Get()
+	value, err := getVar(variable)
+	if err != nil {
+		return nil, err
+	}
 	if op.explode {
 		return types.Collect(value)
 	}
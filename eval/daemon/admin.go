@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/util"
+)
+
+// adminFns returns the builtin functions for administering the daemon. Times
+// are output in RFC 3339 format, and durations in seconds.
+func adminFns(client *daemon.Client) []*eval.BuiltinFn {
+	status := func() *daemon.StatusResponse {
+		status, err := client.Status()
+		if err != nil {
+			util.Throw(err)
+		}
+		return status
+	}
+
+	// Output a map describing the health of the daemon
+	daemonStatus := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		s := status()
+		ec.OutputChan() <- types.MakeMap(map[types.Value]types.Value{
+			"started":     formatTime(s.Started),
+			"store-error": s.StoreError,
+			"clients":     strconv.Itoa(len(s.Clients)),
+		})
+	}
+
+	// Output a map for each client connected to the daemon
+	daemonClients := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		out := ec.OutputChan()
+		for _, c := range status().Clients {
+			out <- types.MakeMap(map[types.Value]types.Value{
+				"id":        strconv.Itoa(c.ID),
+				"pid":       strconv.Itoa(c.Pid),
+				"connected": formatTime(c.Connected),
+				"requests":  strconv.Itoa(c.Requests),
+			})
+		}
+	}
+
+	// Output a map of statistics for each RPC method that has been requested
+	daemonMetrics := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		out := ec.OutputChan()
+		for _, m := range status().Methods {
+			out <- types.MakeMap(map[types.Value]types.Value{
+				"method":        m.Method,
+				"count":         strconv.Itoa(m.Count),
+				"errors":        strconv.Itoa(m.Errors),
+				"total-latency": formatDuration(m.Total),
+				"max-latency":   formatDuration(m.Max),
+			})
+		}
+	}
+
+	// Output a map of statistics of the database
+	daemonDBStats := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		stats, err := client.DBStats()
+		if err != nil {
+			util.Throw(err)
+		}
+		var buckets []types.Value
+		for _, b := range stats.Buckets {
+			buckets = append(buckets, types.MakeMap(map[types.Value]types.Value{
+				"name":  b.Name,
+				"keys":  strconv.Itoa(b.Keys),
+				"bytes": strconv.FormatInt(b.Bytes, 10),
+			}))
+		}
+		ec.OutputChan() <- types.MakeMap(map[types.Value]types.Value{
+			"backend": stats.Backend,
+			"path":    stats.Path,
+			"size":    strconv.FormatInt(stats.Size, 10),
+			"buckets": types.MakeList(buckets...),
+		})
+	}
+
+	// Compact the database
+	daemonCompact := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		_, _, err := client.Compact()
+		if err != nil {
+			util.Throw(err)
+		}
+	}
+
+	// Change the log level of the daemon
+	daemonSetLogLevel := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var level string
+		eval.ScanArgs(args, &level)
+		eval.TakeNoOpt(opts)
+		_, err := client.SetLogLevel(level)
+		if err != nil {
+			util.Throw(err)
+		}
+	}
+
+	return []*eval.BuiltinFn{
+		{"daemon:status", daemonStatus},
+		{"daemon:clients", daemonClients},
+		{"daemon:metrics", daemonMetrics},
+		{"daemon:db-stats", daemonDBStats},
+		{"daemon:compact", daemonCompact},
+		{"daemon:set-log-level", daemonSetLogLevel},
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
@@ -3,7 +3,9 @@ package daemon
 
 import (
 	"errors"
+	"os"
 	"strconv"
+	"sync"
 
 	"github.com/elves/elvish/daemon"
 	"github.com/elves/elvish/eval"
@@ -13,15 +15,23 @@ import (
 	"github.com/elves/elvish/util"
 )
 
-// errDontKnowHowToSpawnDaemon is thrown by daemon:spawn when the Evaler's
-// DaemonSpawner field is nil.
-var errDontKnowHowToSpawnDaemon = errors.New("don't know how to spawn daemon")
+var (
+	// errDontKnowHowToSpawnDaemon is thrown by daemon:spawn when the Evaler's
+	// DaemonSpawner field is nil.
+	errDontKnowHowToSpawnDaemon = errors.New("don't know how to spawn daemon")
+	// errNoSubscription is thrown by daemon:unsubscribe when the argument is
+	// not a subscription made by daemon:subscribe.
+	errNoSubscription = errors.New("no such subscription")
+	// errSubscribeNotInteractive is thrown by daemon:subscribe when there is
+	// no editor, in which case nothing would make the callbacks.
+	errSubscribeNotInteractive = errors.New("daemon:subscribe can only be used in interactive mode")
+)
 
 // Ns makes the daemon: namespace.
-func Ns(daemon *daemon.Client, spawner *daemonp.Daemon) eval.Ns {
+func Ns(client *daemon.Client, spawner *daemonp.Daemon) eval.Ns {
 	// Obtain process ID
 	daemonPid := func() types.Value {
-		pid, err := daemon.Pid()
+		pid, err := client.Pid()
 		if err != nil {
 			util.Throw(err)
 		}
@@ -39,10 +49,114 @@ func Ns(daemon *daemon.Client, spawner *daemonp.Daemon) eval.Ns {
 			util.Throw(err)
 		}
 	}
-	return eval.Ns{
+	// Output the names of all shared variables
+	daemonSharedVars := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		eval.TakeNoArg(args)
+		eval.TakeNoOpt(opts)
+		names, err := client.SharedVarNames()
+		if err != nil {
+			util.Throw(err)
+		}
+		out := ec.OutputChan()
+		for _, name := range names {
+			out <- name
+		}
+	}
+
+	// Publish a value to a channel
+	daemonPublish := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var (
+			channel string
+			value   types.Value
+		)
+		eval.ScanArgs(args, &channel, &value)
+		eval.TakeNoOpt(opts)
+		payload, err := eval.EncodeSharedValue(value)
+		if err != nil {
+			util.Throw(err)
+		}
+		_, err = client.Publish(channel, payload)
+		if err != nil {
+			util.Throw(err)
+		}
+	}
+
+	// Subscriptions made by daemon:subscribe, keyed by their IDs
+	var (
+		subsMutex sync.Mutex
+		subs      = make(map[string]*daemon.Subscription)
+		nextSubID int
+	)
+
+	// Subscribe to a channel, calling the callback with each value published
+	// to it from other processes; output the ID of the subscription. The
+	// callbacks are made between interactive commands and while the editor is
+	// idle, so that they never run concurrently with other code.
+	daemonSubscribe := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var (
+			channel  string
+			callback eval.Fn
+		)
+		eval.ScanArgs(args, &channel, &callback)
+		eval.TakeNoOpt(opts)
+		if ec.Editor == nil {
+			util.Throw(errSubscribeNotInteractive)
+		}
+		sub, err := client.Subscribe(channel)
+		if err != nil {
+			util.Throw(err)
+		}
+
+		subsMutex.Lock()
+		nextSubID++
+		id := strconv.Itoa(nextSubID)
+		subs[id] = sub
+		subsMutex.Unlock()
+
+		ev := ec.Evaler
+		pid := os.Getpid()
+		go func() {
+			for msg := range sub.Messages() {
+				if msg.Pid == pid {
+					continue
+				}
+				ev.CallLater("[daemon:subscribe]", callback,
+					eval.DecodeSharedValue(msg.Payload))
+			}
+			subsMutex.Lock()
+			delete(subs, id)
+			subsMutex.Unlock()
+		}()
+		ec.OutputChan() <- id
+	}
+
+	// Cancel a subscription made by daemon:subscribe
+	daemonUnsubscribe := func(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
+		var id string
+		eval.ScanArgs(args, &id)
+		eval.TakeNoOpt(opts)
+		subsMutex.Lock()
+		sub, ok := subs[id]
+		subsMutex.Unlock()
+		if !ok {
+			util.Throw(errNoSubscription)
+		}
+		err := sub.Close()
+		if err != nil {
+			util.Throw(err)
+		}
+	}
+
+	ns := eval.Ns{
 		"pid":  vartypes.NewRoCallback(daemonPid),
-		"sock": vartypes.NewRo(string(daemon.SockPath())),
+		"sock": vartypes.NewRo(string(client.SockPath())),
 
-		"spawn" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:spawn", daemonSpawn}),
+		"spawn" + eval.FnSuffix:       vartypes.NewRo(&eval.BuiltinFn{"daemon:spawn", daemonSpawn}),
+		"shared-vars" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:shared-vars", daemonSharedVars}),
+		"publish" + eval.FnSuffix:     vartypes.NewRo(&eval.BuiltinFn{"daemon:publish", daemonPublish}),
+		"subscribe" + eval.FnSuffix:   vartypes.NewRo(&eval.BuiltinFn{"daemon:subscribe", daemonSubscribe}),
+		"unsubscribe" + eval.FnSuffix: vartypes.NewRo(&eval.BuiltinFn{"daemon:unsubscribe", daemonUnsubscribe}),
 	}
+	eval.AddBuiltinFns(ns, adminFns(client)...)
+	return ns
 }
@@ -1,7 +1,22 @@
 package daemon
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/elves/elvish/eval"
+)
 
 func TestDaemon(t *testing.T) {
 	// TODO
 }
+
+func TestSubscribeNotInteractive(t *testing.T) {
+	ev := eval.NewEvaler()
+	defer ev.Close()
+	ev.InstallModule("daemon", Ns(nil, nil))
+	err := ev.SourceText(eval.NewScriptSource("[test]", "[test]",
+		"use daemon; daemon:subscribe ch [x]{ }"))
+	if exc, ok := err.(*eval.Exception); !ok || exc.Cause != errSubscribeNotInteractive {
+		t.Errorf("daemon:subscribe -> %v, want %v", err, errSubscribeNotInteractive)
+	}
+}
@@ -1,6 +1,10 @@
 package eval
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/elves/elvish/eval/types"
+)
 
 // Editor is the interface that the line editor has to satisfy. It is needed so
 // that this package does not depend on the edit package.
@@ -9,3 +13,16 @@ type Editor interface {
 	ActiveMutex() *sync.Mutex
 	Notify(string, ...interface{})
 }
+
+// PendingWaiter may be implemented by the line editor to finish work that
+// uses the daemon client, such as writing the command history, before the
+// client is closed when Elvish exits.
+type PendingWaiter interface {
+	WaitPending()
+}
+
+// CommandNotFoundHandler may be implemented by the line editor to get notified
+// when an external command cannot be found, before the error is raised.
+type CommandNotFoundHandler interface {
+	CommandNotFound(fm *Frame, name string, args []types.Value)
+}
@@ -51,6 +51,8 @@ type Evaler struct {
 	Editor  Editor
 	libDir  string
 	intCh   chan struct{}
+	dirState
+	pendingCalls
 }
 
 type evalerScopes struct {
@@ -73,12 +75,21 @@ func NewEvaler() *Evaler {
 		bundled: bundled.Get(),
 		Editor:  nil,
 		intCh:   nil,
+
+		pendingCalls: newPendingCalls(),
 	}
 
 	valueOutIndicator := defaultValueOutIndicator
 	ev.evalerPorts = newEvalerPorts(os.Stdin, os.Stdout, os.Stderr, &valueOutIndicator)
 	builtin["value-out-indicator"] = vartypes.NewString(&valueOutIndicator)
 
+	ev.dirState = newDirState()
+	builtin["pwd"] = PwdVariable{ev}
+	builtin["before-chdir"] = ev.beforeChdir
+	builtin["after-chdir"] = ev.afterChdir
+	builtin["dir-history-half-life"] = vartypes.NewNumber(&ev.dirHalfLife)
+	builtin["lib-dir"] = vartypes.NewRo("")
+
 	return ev
 }
 
@@ -90,8 +101,6 @@ func (ev *Evaler) Close() {
 // InstallDaemonClient installs a daemon client to the Evaler.
 func (ev *Evaler) InstallDaemonClient(client *daemon.Client) {
 	ev.DaemonClient = client
-	// XXX This is really brittle
-	ev.Builtin["pwd"] = PwdVariable{client}
 }
 
 // InstallModule installs a module to the Evaler so that it can be used with
@@ -115,9 +124,10 @@ func (ev *Evaler) SetArgs(args []string) {
 }
 
 // SetLibDir sets the library directory, in which external modules are to be
-// found.
+// found, and the $lib-dir builtin variable.
 func (ev *Evaler) SetLibDir(libDir string) {
 	ev.libDir = libDir
+	ev.Builtin["lib-dir"] = vartypes.NewRo(libDir)
 }
 
 func searchPaths() []string {
@@ -141,6 +151,18 @@ func (ev *Evaler) eval(op Op, ports []*Port, src *Source) error {
 	return ec.PEval(op)
 }
 
+// CallInTop calls a function in a new top-level Frame with the standard ports.
+// It is used for callbacks triggered outside the evaluation of any code, and
+// prints errors instead of returning them. The name is used in diagnostic
+// messages.
+func (ev *Evaler) CallInTop(name string, fn Fn, args ...types.Value) {
+	ec := NewTopFrame(ev, NewInternalSource(name), ev.ports[:])
+	err := ec.PCall(fn, args, NoOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "function error: %s\n", err.Error())
+	}
+}
+
 // Eval sets up the Evaler with standard ports and evaluates an Op. The supplied
 // name and text are used in diagnostic messages.
 func (ev *Evaler) Eval(op Op, src *Source) error {
@@ -70,6 +70,11 @@ func (e ExternalCmd) Call(ec *Frame, argVals []types.Value, opts map[string]type
 
 	path, err := exec.LookPath(e.Name)
 	if err != nil {
+		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+			if h, ok := ec.Editor.(CommandNotFoundHandler); ok {
+				h.CommandNotFound(ec, e.Name, argVals)
+			}
+		}
 		return err
 	}
 
@@ -0,0 +1,48 @@
+package eval
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/elves/elvish/eval/types"
+)
+
+// cmdNotFoundEditor is an Editor that records the calls to CommandNotFound.
+type cmdNotFoundEditor struct {
+	mutex sync.Mutex
+	calls [][]types.Value
+}
+
+func (*cmdNotFoundEditor) Active() bool                  { return false }
+func (ed *cmdNotFoundEditor) ActiveMutex() *sync.Mutex   { return &ed.mutex }
+func (*cmdNotFoundEditor) Notify(string, ...interface{}) {}
+
+func (ed *cmdNotFoundEditor) CommandNotFound(fm *Frame, name string, args []types.Value) {
+	ed.calls = append(ed.calls, append([]types.Value{name}, args...))
+}
+
+func TestCommandNotFoundHandler(t *testing.T) {
+	ev := NewEvaler()
+	defer ev.Close()
+	ed := &cmdNotFoundEditor{}
+	ev.Editor = ed
+
+	err := ev.SourceText(NewScriptSource("[test]", "[test]",
+		"elvish-test-no-such-command a [b c]"))
+	if err == nil {
+		t.Errorf("running a missing command -> no error")
+	}
+	want := [][]types.Value{
+		{"elvish-test-no-such-command", "a", types.MakeList("b", "c")}}
+	if !reflect.DeepEqual(ed.calls, want) {
+		t.Errorf("CommandNotFound called with %v, want %v", ed.calls, want)
+	}
+
+	// Errors other than a missing command do not invoke the handler.
+	ed.calls = nil
+	ev.SourceText(NewScriptSource("[test]", "[test]", "fail x"))
+	if len(ed.calls) != 0 {
+		t.Errorf("CommandNotFound called with %v for fail", ed.calls)
+	}
+}
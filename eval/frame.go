@@ -25,6 +25,9 @@ type Frame struct {
 	traceback  *util.SourceRange
 
 	background bool
+	// If not nil, used instead of the interrupt channel of the Evaler; see
+	// SetInterrupts.
+	interrupts <-chan struct{}
 }
 
 // NewTopFrame creates a top-level Frame.
@@ -33,7 +36,7 @@ func NewTopFrame(ev *Evaler, src *Source, ports []*Port) *Frame {
 		ev, src,
 		ev.Global, make(Ns),
 		ports,
-		0, len(src.code), nil, false,
+		0, len(src.code), nil, false, nil,
 	}
 }
 
@@ -110,7 +113,7 @@ func (ec *Frame) fork(name string) *Frame {
 		ec.Evaler, ec.srcMeta,
 		ec.local, ec.up,
 		newPorts,
-		ec.begin, ec.end, ec.traceback, ec.background,
+		ec.begin, ec.end, ec.traceback, ec.background, ec.interrupts,
 	}
 }
 
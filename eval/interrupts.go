@@ -4,9 +4,20 @@ import "errors"
 
 // Interrupts returns a channel that is closed when an interrupt signal comes.
 func (ec *Frame) Interrupts() <-chan struct{} {
+	if ec.interrupts != nil {
+		return ec.interrupts
+	}
 	return ec.intCh
 }
 
+// SetInterrupts makes the Frame and Frames forked from it interrupted when ch
+// is closed, instead of upon interrupt signals. It is used to stop code that
+// runs in the background, such as completers, and must be called before the
+// Frame is used.
+func (ec *Frame) SetInterrupts(ch <-chan struct{}) {
+	ec.interrupts = ch
+}
+
 var ErrInterrupted = errors.New("interrupted")
 
 // IsInterrupted reports whether there has been an interrupt.
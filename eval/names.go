@@ -11,7 +11,7 @@ import (
 
 // EachVariableInTop calls the passed function for each variable name in
 // namespace ns that can be found from the top context.
-func (ev *evalerScopes) EachVariableInTop(ns string, f func(s string)) {
+func (ev *Evaler) EachVariableInTop(ns string, f func(s string)) {
 	switch ns {
 	case "builtin":
 		for name := range ev.Builtin {
@@ -34,6 +34,8 @@ func (ev *evalerScopes) EachVariableInTop(ns string, f func(s string)) {
 				f(s[:i])
 			}
 		}
+	case "shared":
+		eachSharedVar(ev.DaemonClient, f)
 	default:
 		mod := ev.Global[ns+NsSuffix]
 		if mod == nil {
@@ -68,6 +70,7 @@ func (ev *evalerScopes) EachNsInTop(f func(s string)) {
 	f("builtin")
 	f("e")
 	f("E")
+	f("shared")
 	ev.EachModInTop(f)
 }
 
@@ -95,6 +98,10 @@ func (ec *Frame) ResolveVar(ns, name string) vartypes.Variable {
 		}
 	case "E":
 		return vartypes.NewEnv(name)
+	case "shared":
+		if !strings.HasSuffix(name, FnSuffix) {
+			return sharedVariable{ec.DaemonClient, name}
+		}
 	default:
 		ns := ec.ResolveMod(ns)
 		if ns != nil {
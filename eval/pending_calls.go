@@ -0,0 +1,67 @@
+package eval
+
+import (
+	"sync"
+
+	"github.com/elves/elvish/eval/types"
+)
+
+// pendingCalls keeps the calls queued by CallLater.
+type pendingCalls struct {
+	callsMutex sync.Mutex
+	calls      []pendingCall
+	// Receives a value when calls are queued; buffered, so that CallLater
+	// never blocks.
+	callsCh chan struct{}
+}
+
+func newPendingCalls() pendingCalls {
+	return pendingCalls{callsCh: make(chan struct{}, 1)}
+}
+
+type pendingCall struct {
+	name string
+	fn   Fn
+	args []types.Value
+}
+
+// CallLater queues a call to a function, to be made by the next call to
+// RunPendingCalls. It is safe to use from any goroutine, and is used for
+// callbacks that are triggered asynchronously, so that they never run
+// concurrently with other code.
+func (ev *Evaler) CallLater(name string, fn Fn, args ...types.Value) {
+	ev.callsMutex.Lock()
+	defer ev.callsMutex.Unlock()
+	ev.calls = append(ev.calls, pendingCall{name, fn, args})
+	select {
+	case ev.callsCh <- struct{}{}:
+	default:
+	}
+}
+
+// PendingCalls returns a channel that receives a value when calls are queued
+// by CallLater, so that they can be made while waiting for other events, such
+// as when the editor is idle.
+func (ev *Evaler) PendingCalls() <-chan struct{} {
+	return ev.callsCh
+}
+
+// RunPendingCalls makes the calls queued by CallLater in the order they were
+// queued, in the same way as CallInTop. The interactive shell calls it
+// between commands.
+func (ev *Evaler) RunPendingCalls() {
+	ev.RunPendingCallsWith(ev.CallInTop)
+}
+
+// RunPendingCallsWith makes the calls queued by CallLater in the order they
+// were queued, using the passed function to make each call.
+func (ev *Evaler) RunPendingCallsWith(call func(name string, fn Fn, args ...types.Value)) {
+	ev.callsMutex.Lock()
+	calls := ev.calls
+	ev.calls = nil
+	ev.callsMutex.Unlock()
+
+	for _, c := range calls {
+		call(c.name, c.fn, c.args...)
+	}
+}
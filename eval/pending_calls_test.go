@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/elves/elvish/eval/types"
+)
+
+func TestCallLater(t *testing.T) {
+	ev := NewEvaler()
+	defer ev.Close()
+
+	var called []types.Value
+	record := &BuiltinFn{"record", func(fm *Frame, args []types.Value, opts map[string]types.Value) {
+		called = append(called, args...)
+	}}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ev.CallLater("[test]", record, "a")
+		ev.CallLater("[test]", record, "b")
+		wg.Done()
+	}()
+	wg.Wait()
+	if len(called) != 0 {
+		t.Errorf("CallLater made the calls %v immediately", called)
+	}
+	select {
+	case <-ev.PendingCalls():
+	default:
+		t.Errorf("PendingCalls does not receive a value after CallLater")
+	}
+
+	ev.RunPendingCalls()
+	if want := []types.Value{"a", "b"}; !reflect.DeepEqual(called, want) {
+		t.Errorf("RunPendingCalls made calls %v, want %v", called, want)
+	}
+	ev.RunPendingCalls()
+	if len(called) != 2 {
+		t.Errorf("RunPendingCalls made the calls again: %v", called)
+	}
+}
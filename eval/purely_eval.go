@@ -68,13 +68,15 @@ func (ev *Evaler) PurelyEvalPartialCompound(cn *parse.Compound, upto *parse.Inde
 // If this cannot be done, it returns nil.
 //
 // Currently, only string literals and variables with no @ can be evaluated.
+// Variables in the shared: namespace are not evaluated, since that requires
+// talking to the daemon.
 func (ev *Evaler) PurelyEvalPrimary(pn *parse.Primary) types.Value {
 	switch pn.Type {
 	case parse.Bareword, parse.SingleQuoted, parse.DoubleQuoted:
 		return pn.Value
 	case parse.Variable:
 		explode, ns, name := ParseVariable(pn.Value)
-		if explode {
+		if explode || ns == "shared" {
 			return nil
 		}
 		ec := NewTopFrame(ev, NewInternalSource("[purely eval]"), nil)
@@ -85,3 +87,61 @@ func (ev *Evaler) PurelyEvalPrimary(pn *parse.Primary) types.Value {
 	}
 	return nil
 }
+
+// PurelyEvalIndexing evaluates the head of an indexing node and the first n of
+// its indices without causing any side effects. If this cannot be done, it
+// returns nil.
+//
+// Each index must consist of exactly one compound that can be evaluated with
+// PurelyEvalCompound.
+func (ev *Evaler) PurelyEvalIndexing(in *parse.Indexing, n int) types.Value {
+	if n > len(in.Indicies) {
+		return nil
+	}
+	v := ev.PurelyEvalPrimary(in.Head)
+	if v == nil {
+		return nil
+	}
+	for _, index := range in.Indicies[:n] {
+		if len(index.Compounds) != 1 {
+			return nil
+		}
+		key, err := ev.PurelyEvalCompound(index.Compounds[0])
+		if err != nil {
+			return nil
+		}
+		v, err = types.Index(v, key)
+		if err != nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// PurelyResolveFn resolves the head of a form to a function without causing
+// any side effects. It returns nil if the head cannot be evaluated purely, or
+// does not resolve to a function defined in Elvish, such as when it refers to
+// an external command.
+func (ev *Evaler) PurelyResolveFn(cn *parse.Compound) Fn {
+	if ev == nil {
+		return nil
+	}
+	if len(cn.Indexings) == 1 && cn.Indexings[0].Head.Type == parse.Variable {
+		fn, _ := ev.PurelyEvalIndexing(cn.Indexings[0], len(cn.Indexings[0].Indicies)).(Fn)
+		return fn
+	}
+	head, err := ev.PurelyEvalCompound(cn)
+	if err != nil {
+		return nil
+	}
+	explode, ns, name := ParseVariable(head)
+	if explode || ns == "shared" {
+		return nil
+	}
+	ec := NewTopFrame(ev, NewInternalSource("[purely eval]"), nil)
+	if v := ec.ResolveVar(ns, name+FnSuffix); v != nil {
+		fn, _ := v.Get().(Fn)
+		return fn
+	}
+	return nil
+}
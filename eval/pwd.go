@@ -10,7 +10,7 @@ import (
 // PwdVariable is a variable whose value always reflects the current working
 // directory. Setting it changes the current working directory.
 type PwdVariable struct {
-	store AddDirer
+	ev *Evaler
 }
 
 var _ vartypes.Variable = PwdVariable{}
@@ -26,5 +26,5 @@ func (pwd PwdVariable) Set(v types.Value) error {
 	if !ok {
 		return ErrPathMustBeString
 	}
-	return Chdir(path, pwd.store)
+	return pwd.ev.Chdir(path)
 }
@@ -19,10 +19,10 @@ func Ns() eval.Ns {
 
 var fns = []*eval.BuiltinFn{
 	{"quote", eval.WrapStringToString(regexp.QuoteMeta)},
-	{"match", match},
-	{"find", find},
-	{"replace", replace},
-	{"split", split},
+	(&eval.BuiltinFn{"match", match}).DeclareOpts("posix"),
+	(&eval.BuiltinFn{"find", find}).DeclareOpts("posix", "longest", "max"),
+	(&eval.BuiltinFn{"replace", replace}).DeclareOpts("posix", "longest", "literal"),
+	(&eval.BuiltinFn{"split", split}).DeclareOpts("posix", "longest", "max"),
 }
 
 func match(ec *eval.Frame, args []types.Value, opts map[string]types.Value) {
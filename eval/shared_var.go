@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/eval/vartypes"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Variables in the shared: namespace are stored in the daemon and are thus
+// visible to all Elvish sessions. Strings are stored as they are, so that they
+// are compatible with older sessions; other values are serialized as JSON
+// behind sharedJSONPrefix, so only strings, booleans, lists and maps with
+// string keys can be stored.
+
+var errNoSharedVar = errors.New("no such shared variable")
+
+// sharedJSONPrefix marks a value stored as JSON. It starts with a NUL byte,
+// which is not found in strings stored by older sessions in practice.
+const sharedJSONPrefix = "\x00json:"
+
+type sharedVariable struct {
+	client *daemon.Client
+	name   string
+}
+
+var _ vartypes.Variable = sharedVariable{}
+
+// Get returns the value of the shared variable. Since it cannot return an
+// error, it returns an empty string when the variable cannot be retrieved;
+// code that evaluates variables uses getVar instead, which returns the error.
+func (sv sharedVariable) Get() types.Value {
+	v, err := sv.get()
+	if err != nil {
+		return ""
+	}
+	return v
+}
+
+func (sv sharedVariable) get() (types.Value, error) {
+	if sv.client == nil {
+		return nil, ErrStoreNotConnected
+	}
+	s, err := sv.client.SharedVar(sv.name)
+	if err != nil {
+		if err.Error() == storedefs.ErrNoSharedVar.Error() {
+			return nil, fmt.Errorf("%v: %s", errNoSharedVar, sv.name)
+		}
+		return nil, errors.New("store error: " + err.Error())
+	}
+	return DecodeSharedValue(s), nil
+}
+
+func (sv sharedVariable) Set(v types.Value) error {
+	if sv.client == nil {
+		return ErrStoreNotConnected
+	}
+	s, err := EncodeSharedValue(v)
+	if err != nil {
+		return err
+	}
+	return sv.client.SetSharedVar(sv.name, s)
+}
+
+// getVar gets the value of a variable, returning the error when a shared
+// variable cannot be retrieved.
+func getVar(v vartypes.Variable) (types.Value, error) {
+	if sv, ok := v.(sharedVariable); ok {
+		return sv.get()
+	}
+	return v.Get(), nil
+}
+
+// EncodeSharedValue serializes a value to be stored in a shared variable or
+// sent to other sessions.
+func EncodeSharedValue(v types.Value) (string, error) {
+	if s, ok := v.(string); ok && !strings.HasPrefix(s, sharedJSONPrefix) {
+		return s, nil
+	}
+	plain, err := toPlainValue(v)
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+	return sharedJSONPrefix + string(buf), nil
+}
+
+// DecodeSharedValue deserializes a value serialized by EncodeSharedValue.
+// Anything else, such as strings stored by older sessions, is returned as a
+// string.
+func DecodeSharedValue(s string) types.Value {
+	if !strings.HasPrefix(s, sharedJSONPrefix) {
+		return s
+	}
+	var plain interface{}
+	if json.Unmarshal([]byte(s[len(sharedJSONPrefix):]), &plain) != nil {
+		return s
+	}
+	return FromJSONInterface(plain)
+}
+
+// toPlainValue converts a value to a tree of Go values that can be marshaled
+// into JSON and converted back by FromJSONInterface.
+func toPlainValue(v types.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case types.Bool:
+		return bool(v), nil
+	case types.List:
+		plain := make([]interface{}, 0, v.Len())
+		var err error
+		v.Iterate(func(elem types.Value) bool {
+			var plainElem interface{}
+			plainElem, err = toPlainValue(elem)
+			plain = append(plain, plainElem)
+			return err == nil
+		})
+		return plain, err
+	case types.Map:
+		plain := make(map[string]interface{})
+		var err error
+		v.IteratePair(func(k, elem types.Value) bool {
+			ks, ok := k.(string)
+			if !ok {
+				err = fmt.Errorf("shared variable cannot contain map key of type %s", types.Kind(k))
+				return false
+			}
+			plain[ks], err = toPlainValue(elem)
+			return err == nil
+		})
+		return plain, err
+	default:
+		return nil, fmt.Errorf("shared variable cannot contain value of type %s", types.Kind(v))
+	}
+}
+
+// delSharedVarOp deletes a shared variable.
+type delSharedVarOp struct{ name string }
+
+func (op delSharedVarOp) Invoke(fm *Frame) error {
+	if fm.DaemonClient == nil {
+		return ErrStoreNotConnected
+	}
+	return fm.DaemonClient.DelSharedVar(op.name)
+}
+
+// eachSharedVar calls the passed function with the name of each shared
+// variable. Errors are ignored.
+func eachSharedVar(client *daemon.Client, f func(string)) {
+	if client == nil {
+		return
+	}
+	names, err := client.SharedVarNames()
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		f(name)
+	}
+}
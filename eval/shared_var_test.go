@@ -0,0 +1,85 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/elves/elvish/eval/types"
+	"github.com/elves/elvish/parse"
+)
+
+var sharedValueTests = []types.Value{
+	"",
+	"lorem ipsum",
+	"12",
+	"true",
+	`["a"]`,
+	sharedJSONPrefix + `"x"`,
+	types.Bool(true),
+	types.MakeList(),
+	types.MakeList("a", types.MakeList("b", types.Bool(false))),
+	types.MakeMap(map[types.Value]types.Value{
+		"k": "v", "l": types.MakeList("x"), "m": types.MakeMap(nil)}),
+}
+
+func TestSharedValueRoundTrip(t *testing.T) {
+	for _, v := range sharedValueTests {
+		s, err := EncodeSharedValue(v)
+		if err != nil {
+			t.Errorf("EncodeSharedValue(%s) -> error %v", types.Repr(v, types.NoPretty), err)
+			continue
+		}
+		got := DecodeSharedValue(s)
+		if !types.Equal(got, v) {
+			t.Errorf("DecodeSharedValue(EncodeSharedValue(%s)) -> %s",
+				types.Repr(v, types.NoPretty), types.Repr(got, types.NoPretty))
+		}
+	}
+}
+
+func TestEncodeSharedValueErrors(t *testing.T) {
+	for _, v := range []types.Value{
+		&BuiltinFn{"f", nop},
+		types.MakeList(&BuiltinFn{"f", nop}),
+		types.MakeMap(map[types.Value]types.Value{types.MakeList(): "v"}),
+	} {
+		if _, err := EncodeSharedValue(v); err == nil {
+			t.Errorf("EncodeSharedValue(%s) -> no error", types.Repr(v, types.NoPretty))
+		}
+	}
+}
+
+func TestDecodeSharedValueRaw(t *testing.T) {
+	// Values not stored as JSON, such as those stored by older sessions, are
+	// strings.
+	for _, raw := range []string{"not json", "true", "123", `["a"]`, sharedJSONPrefix + "{"} {
+		if got := DecodeSharedValue(raw); got != raw {
+			t.Errorf("DecodeSharedValue(%q) -> %s", raw, types.Repr(got, types.NoPretty))
+		}
+	}
+}
+
+func TestSharedVariableWithoutDaemon(t *testing.T) {
+	sv := sharedVariable{nil, "x"}
+	if v := sv.Get(); v != "" {
+		t.Errorf("Get -> %v, want empty string", v)
+	}
+
+	ev := NewEvaler()
+	defer ev.Close()
+	// The error surfaces wherever the value of the variable is needed.
+	for _, code := range []string{"put $shared:x", "del shared:x[a]", "shared:x=y nop"} {
+		err := ev.SourceText(NewScriptSource("[test]", "[test]", code))
+		if exc, ok := err.(*Exception); !ok || exc.Cause != ErrStoreNotConnected {
+			t.Errorf("%s -> %v, want %v", code, err, ErrStoreNotConnected)
+		}
+	}
+
+	n, err := parse.Parse("[test]", "put $shared:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := n.Pipelines[0].Forms[0].Args[0].Indexings[0].Head
+	if v := ev.PurelyEvalPrimary(primary); v != nil {
+		t.Errorf("PurelyEvalPrimary($shared:x) -> %v, want nil", v)
+	}
+}
@@ -12,6 +12,7 @@ var (
 	errShouldBeMap    = errors.New("should be map")
 	errShouldBeBool   = errors.New("should be bool")
 	errShouldBeNumber = errors.New("should be number")
+	errShouldBeString = errors.New("should be string")
 )
 
 func ShouldBeList(v types.Value) error {
@@ -42,3 +43,10 @@ func ShouldBeNumber(v types.Value) error {
 	_, err := strconv.ParseFloat(string(v.(string)), 64)
 	return err
 }
+
+func ShouldBeString(v types.Value) error {
+	if _, ok := v.(string); !ok {
+		return errShouldBeString
+	}
+	return nil
+}
@@ -18,26 +18,33 @@ type Daemon struct {
 	BinPath string
 	// DbPath is the path to the database.
 	DbPath string
+	// DbBackend is the backend of the database. If empty, it is detected from
+	// the database if it exists.
+	DbBackend string
 	// SockPath is the path to the socket on which the daemon will serve
 	// requests.
 	SockPath string
 	// LogPathPrefix is used to derive the name of the log file by adding the
 	// pid.
 	LogPathPrefix string
+	// HistoryKeyPath is the path to the file containing the key for encrypting
+	// the command history. If empty, the command history is not encrypted.
+	HistoryKeyPath string
 }
 
 // Main is the entry point of the daemon sub-program. It simply sets the umask
 // (if relevant) and runs serve. It always return a nil error, since any errors
 // encountered is logged in the serve function.
-func (d *Daemon) Main(serve func(string, string)) error {
+func (d *Daemon) Main(serve func(string, string, string, string)) error {
 	setUmask()
-	serve(d.SockPath, d.DbPath)
+	serve(d.SockPath, d.DbPath, d.DbBackend, d.HistoryKeyPath)
 	return nil
 }
 
 // Spawn spawns a daemon process in the background by invoking BinPath, passing
-// DbPath, SockPath and LogPathPrefix as command-line arguments after resolving
-// them to absolute paths. A suitable ProcAttr is chosen depending on the OS and
+// DbPath, SockPath, LogPathPrefix and HistoryKeyPath (if not empty) as
+// command-line arguments after resolving them to absolute paths, as well as
+// DbBackend if not empty. A suitable ProcAttr is chosen depending on the OS and
 // makes sure that the daemon is detached from the current terminal (so that it
 // is not affected by I/O or signals in the current terminal), and keeps running
 // after the current process quits.
@@ -83,6 +90,15 @@ func (d *Daemon) Spawn() error {
 		"-sock", sockPath,
 		"-logprefix", logPathPrefix,
 	}
+	if d.DbBackend != "" {
+		args = append(args, "-dbbackend", d.DbBackend)
+	}
+	if d.HistoryKeyPath != "" {
+		args = append(args, "-historykey", abs("HistoryKeyPath", d.HistoryKeyPath))
+		if pathError != nil {
+			return pathError
+		}
+	}
 
 	// TODO Redirect daemon stdout and stderr
 
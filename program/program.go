@@ -18,6 +18,7 @@ import (
 	"github.com/elves/elvish/program/daemon"
 	"github.com/elves/elvish/program/shell"
 	"github.com/elves/elvish/program/web"
+	"github.com/elves/elvish/runtime"
 	"github.com/elves/elvish/util"
 )
 
@@ -39,10 +40,19 @@ type flagSet struct {
 	Web  bool
 	Port int
 
-	Daemon bool
-	Forked int
+	Daemon      bool
+	DaemonAdmin bool
+	Forked      int
 
-	Bin, DB, Sock string
+	MigrateStatus, MigrateDryRun bool
+
+	ConvertDB bool
+
+	MoveLegacyDir bool
+
+	Bin, DB, DBBackend, Sock, Profile string
+
+	HistoryKey string
 }
 
 func newFlagSet() *flagSet {
@@ -68,10 +78,20 @@ func newFlagSet() *flagSet {
 	f.IntVar(&f.Port, "port", defaultWebPort, "the port of the web backend")
 
 	f.BoolVar(&f.Daemon, "daemon", false, "run daemon instead of shell")
+	f.BoolVar(&f.DaemonAdmin, "daemon-admin", false, "administer the running daemon; the first argument is one of "+daemonAdminCommands+", defaulting to status")
+	f.BoolVar(&f.MigrateStatus, "migrate-status", false, "with -daemon, show the status of schema migrations of the database and quit")
+	f.BoolVar(&f.MigrateDryRun, "migrate-dry-run", false, "with -daemon, try applying pending schema migrations to the database without saving the result, and quit")
+
+	f.BoolVar(&f.ConvertDB, "convertdb", false, "convert the database given as the first argument to a new database given as the second argument, using the backend given by -dbbackend, or the other backend if not given")
+
+	f.BoolVar(&f.MoveLegacyDir, "move-legacy-dir", false, "move ~/.elvish to the data directory, and rc.elv in it to the config directory, and quit")
 
 	f.StringVar(&f.Bin, "bin", "", "path to the elvish binary")
 	f.StringVar(&f.DB, "db", "", "path to the database")
+	f.StringVar(&f.DBBackend, "dbbackend", "", "backend of the database, bolt or sqlite; detected for existing databases, and bolt for new databases if not given")
 	f.StringVar(&f.Sock, "sock", "", "path to the daemon socket")
+	f.StringVar(&f.Profile, "profile", "", "name of the profile, which has its own rc.elv, libraries, database and daemon")
+	f.StringVar(&f.HistoryKey, "historykey", "", "with -daemon, a file containing the key for encrypting the command history")
 
 	return &f
 }
@@ -135,16 +155,38 @@ func FindProgram(flag *flagSet) Program {
 		return ShowVersion{}
 	case flag.BuildInfo:
 		return ShowBuildInfo{flag.JSON}
+	case !runtime.IsValidProfile(flag.Profile):
+		return ShowCorrectUsage{runtime.ErrBadProfile.Error(), flag}
 	case flag.Daemon:
 		if len(flag.Args()) > 0 {
 			return ShowCorrectUsage{"arguments are not allowed with -daemon", flag}
 		}
-		return Daemon{inner: &daemon.Daemon{
-			BinPath:       flag.Bin,
-			DbPath:        flag.DB,
-			SockPath:      flag.Sock,
-			LogPathPrefix: flag.LogPrefix,
+		if flag.MigrateStatus || flag.MigrateDryRun {
+			return MigrateStatus{flag.DB, flag.DBBackend, flag.Sock, flag.Profile, flag.MigrateDryRun}
+		}
+		return Daemon{profile: flag.Profile, inner: &daemon.Daemon{
+			BinPath:        flag.Bin,
+			DbPath:         flag.DB,
+			DbBackend:      flag.DBBackend,
+			SockPath:       flag.Sock,
+			LogPathPrefix:  flag.LogPrefix,
+			HistoryKeyPath: flag.HistoryKey,
 		}}
+	case flag.DaemonAdmin:
+		return DaemonAdmin{flag.Sock, flag.Profile}
+	case flag.ConvertDB:
+		if len(flag.Args()) != 2 {
+			return ShowCorrectUsage{"-convertdb requires a source and a destination database", flag}
+		}
+		return ConvertDB{flag.DBBackend}
+	case flag.MoveLegacyDir:
+		if len(flag.Args()) > 0 {
+			return ShowCorrectUsage{"arguments are not allowed with -move-legacy-dir", flag}
+		}
+		if flag.Profile != "" {
+			return ShowCorrectUsage{"-move-legacy-dir cannot be used with -profile", flag}
+		}
+		return MoveLegacyDir{}
 	case flag.Web:
 		if len(flag.Args()) > 0 {
 			return ShowCorrectUsage{"arguments are not allowed with -web", flag}
@@ -152,8 +194,8 @@ func FindProgram(flag *flagSet) Program {
 		if flag.CodeInArg {
 			return ShowCorrectUsage{"-c cannot be used together with -web", flag}
 		}
-		return web.New(flag.Bin, flag.Sock, flag.DB, flag.Port)
+		return web.New(flag.Bin, flag.Sock, flag.DB, flag.DBBackend, flag.Profile, flag.Port)
 	default:
-		return shell.New(flag.Bin, flag.Sock, flag.DB, flag.CodeInArg, flag.CompileOnly)
+		return shell.New(flag.Bin, flag.Sock, flag.DB, flag.DBBackend, flag.Profile, flag.CodeInArg, flag.CompileOnly)
 	}
 }
@@ -33,6 +33,20 @@ var findProgramTests = []struct {
 	}},
 	{[]string{"-daemon"}, isDaemon},
 	{[]string{"-daemon", "x"}, isShowCorrectUsage},
+	{[]string{"-daemon", "-migrate-status"}, func(p Program) bool {
+		return p.(MigrateStatus) == MigrateStatus{}
+	}},
+	{[]string{"-daemon", "-migrate-dry-run", "-db", "/db"}, func(p Program) bool {
+		return p.(MigrateStatus) == MigrateStatus{DbPath: "/db", DryRun: true}
+	}},
+	{[]string{"-daemon", "-migrate-status", "-sock", "/sock"}, func(p Program) bool {
+		return p.(MigrateStatus) == MigrateStatus{SockPath: "/sock"}
+	}},
+	{[]string{"-move-legacy-dir"}, func(p Program) bool {
+		return p.(MoveLegacyDir) == MoveLegacyDir{}
+	}},
+	{[]string{"-move-legacy-dir", "x"}, isShowCorrectUsage},
+	{[]string{"-move-legacy-dir", "-profile", "work"}, isShowCorrectUsage},
 
 	{[]string{"-bin", "/elvish"}, func(p Program) bool {
 		return p.(*shell.Shell).BinPath == "/elvish"
@@ -43,6 +57,9 @@ var findProgramTests = []struct {
 	{[]string{"-sock", "/sock"}, func(p Program) bool {
 		return p.(*shell.Shell).SockPath == "/sock"
 	}},
+	{[]string{"-dbbackend", "sqlite"}, func(p Program) bool {
+		return p.(*shell.Shell).DbBackend == "sqlite"
+	}},
 
 	{[]string{"-web", "-bin", "/elvish"}, func(p Program) bool {
 		return p.(*web.Web).BinPath == "/elvish"
@@ -63,6 +80,34 @@ var findProgramTests = []struct {
 	{[]string{"-daemon", "-sock", "/sock"}, func(p Program) bool {
 		return p.(Daemon).inner.SockPath == "/sock"
 	}},
+	{[]string{"-daemon", "-dbbackend", "sqlite"}, func(p Program) bool {
+		return p.(Daemon).inner.DbBackend == "sqlite"
+	}},
+	{[]string{"-daemon", "-historykey", "/key"}, func(p Program) bool {
+		return p.(Daemon).inner.HistoryKeyPath == "/key"
+	}},
+	{[]string{"-daemon", "-profile", "work"}, func(p Program) bool {
+		return p.(Daemon).profile == "work"
+	}},
+	{[]string{"-profile", "work"}, func(p Program) bool {
+		return p.(*shell.Shell).Profile == "work"
+	}},
+	{[]string{"-profile", "../work"}, isShowCorrectUsage},
+
+	{[]string{"-daemon-admin", "-sock", "/sock"}, func(p Program) bool {
+		return p.(DaemonAdmin).SockPath == "/sock"
+	}},
+	{[]string{"-daemon-admin", "-profile", "work"}, func(p Program) bool {
+		return p.(DaemonAdmin).Profile == "work"
+	}},
+
+	{[]string{"-convertdb", "a", "b"}, func(p Program) bool {
+		return p.(ConvertDB).Backend == ""
+	}},
+	{[]string{"-convertdb", "-dbbackend", "bolt", "a", "b"}, func(p Program) bool {
+		return p.(ConvertDB).Backend == "bolt"
+	}},
+	{[]string{"-convertdb", "a"}, isShowCorrectUsage},
 }
 
 func isShowHelp(p Program) bool         { _, ok := p.(ShowHelp); return ok }
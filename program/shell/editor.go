@@ -13,6 +13,12 @@ type editor interface {
 	Close()
 }
 
+// cmdResultRecorder is an optional interface for editors that record the
+// result of each command in the command history.
+type cmdResultRecorder interface {
+	RecordCmdResult(err error)
+}
+
 type minEditor struct {
 	in  *bufio.Reader
 	out io.Writer
@@ -16,7 +16,7 @@ import (
 	"github.com/elves/elvish/util"
 )
 
-func interact(ev *eval.Evaler, dataDir string) {
+func interact(ev *eval.Evaler, configDir string) {
 	// Build Editor.
 	var ed editor
 	if sys.IsATTY(os.Stdin) {
@@ -29,8 +29,8 @@ func interact(ev *eval.Evaler, dataDir string) {
 	defer ed.Close()
 
 	// Source rc.elv.
-	if dataDir != "" {
-		err := sourceRC(ev, dataDir)
+	if configDir != "" {
+		err := sourceRC(ev, configDir)
 		if err != nil {
 			util.PprintError(err)
 		}
@@ -48,6 +48,10 @@ func interact(ev *eval.Evaler, dataDir string) {
 	for {
 		cmdNum++
 
+		// Make the callbacks that were triggered asynchronously, such as by
+		// daemon:subscribe, before reading the next command.
+		ev.RunPendingCalls()
+
 		line, err := readLine()
 
 		if err == io.EOF {
@@ -73,14 +77,17 @@ func interact(ev *eval.Evaler, dataDir string) {
 		cooldown = time.Second
 
 		err = ev.SourceText(eval.NewInteractiveSource(line))
+		if recorder, ok := ed.(cmdResultRecorder); ok && !usingBasic {
+			recorder.RecordCmdResult(err)
+		}
 		if err != nil {
 			util.PprintError(err)
 		}
 	}
 }
 
-func sourceRC(ev *eval.Evaler, dataDir string) error {
-	absPath, err := filepath.Abs(filepath.Join(dataDir, "rc.elv"))
+func sourceRC(ev *eval.Evaler, configDir string) error {
+	absPath, err := filepath.Abs(filepath.Join(configDir, "rc.elv"))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -19,12 +19,14 @@ type Shell struct {
 	BinPath     string
 	SockPath    string
 	DbPath      string
+	DbBackend   string
+	Profile     string
 	Cmd         bool
 	CompileOnly bool
 }
 
-func New(binpath, sockpath, dbpath string, cmd, compileonly bool) *Shell {
-	return &Shell{binpath, sockpath, dbpath, cmd, compileonly}
+func New(binpath, sockpath, dbpath, dbbackend, profile string, cmd, compileonly bool) *Shell {
+	return &Shell{binpath, sockpath, dbpath, dbbackend, profile, cmd, compileonly}
 }
 
 // Main runs Elvish using the default terminal interface. It blocks until Elvish
@@ -32,7 +34,7 @@ func New(binpath, sockpath, dbpath string, cmd, compileonly bool) *Shell {
 func (sh *Shell) Main(args []string) int {
 	defer rescue()
 
-	ev, dataDir := runtime.InitRuntime(sh.BinPath, sh.SockPath, sh.DbPath)
+	ev, paths := runtime.InitRuntime(sh.BinPath, sh.SockPath, sh.DbPath, sh.DbBackend, sh.Profile)
 	defer runtime.CleanupRuntime(ev)
 
 	handleSignals()
@@ -44,7 +46,11 @@ func (sh *Shell) Main(args []string) int {
 			return 2
 		}
 	} else {
-		interact(ev, dataDir)
+		configDir := ""
+		if paths != nil {
+			configDir = paths.Config
+		}
+		interact(ev, configDir)
 	}
 
 	return 0
@@ -3,10 +3,15 @@ package program
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/elves/elvish/build"
 	daemonsvc "github.com/elves/elvish/daemon"
 	"github.com/elves/elvish/program/daemon"
+	"github.com/elves/elvish/runtime"
+	"github.com/elves/elvish/store"
 )
 
 // ShowHelp shows help message.
@@ -54,12 +59,27 @@ func (info ShowBuildInfo) Main([]string) int {
 	return 0
 }
 
-// Daemon runs the daemon subprogram.
+// Daemon runs the daemon subprogram. The database and the socket default to
+// those of the profile.
 type Daemon struct {
-	inner *daemon.Daemon
+	profile string
+	inner   *daemon.Daemon
 }
 
 func (d Daemon) Main([]string) int {
+	if d.inner.DbPath == "" || d.inner.SockPath == "" {
+		paths, err := runtime.GetPaths(d.profile)
+		if err != nil {
+			logger.Println("cannot determine Elvish directories:", err)
+			return 2
+		}
+		if d.inner.DbPath == "" {
+			d.inner.DbPath = filepath.Join(paths.Data, "db")
+		}
+		if d.inner.SockPath == "" {
+			d.inner.SockPath = filepath.Join(paths.Runtime, "sock")
+		}
+	}
 	err := d.inner.Main(daemonsvc.Serve)
 	if err != nil {
 		logger.Println("daemon error:", err)
@@ -67,3 +87,309 @@ func (d Daemon) Main([]string) int {
 	}
 	return 0
 }
+
+// ConvertDB converts a database to a new database with another backend.
+type ConvertDB struct {
+	Backend string
+}
+
+func (c ConvertDB) Main(args []string) int {
+	src, dst := args[0], args[1]
+	srcBackend, err := store.DetectBackend(src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot read source database:", err)
+		return 2
+	}
+	if srcBackend == "" {
+		fmt.Fprintln(os.Stderr, "source database does not exist or is empty:", src)
+		return 2
+	}
+	if _, err := os.Stat(dst); err == nil {
+		fmt.Fprintln(os.Stderr, "destination database already exists:", dst)
+		return 2
+	}
+	dstBackend := c.Backend
+	if dstBackend == "" {
+		if srcBackend == store.BackendBolt {
+			dstBackend = store.BackendSQLite
+		} else {
+			dstBackend = store.BackendBolt
+		}
+	}
+
+	srcStore, err := store.Open(srcBackend, src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot open source database (is the daemon using it?):", err)
+		return 2
+	}
+	defer srcStore.Close()
+	dstStore, err := store.Open(dstBackend, dst)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot create destination database:", err)
+		return 2
+	}
+	defer dstStore.Close()
+
+	err = store.Convert(dstStore, srcStore)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot convert database:", err)
+		return 2
+	}
+	fmt.Printf("converted %s database %s to %s database %s\n",
+		srcBackend, src, dstBackend, dst)
+	return 0
+}
+
+// MoveLegacyDir moves ~/.elvish, used by older versions of Elvish, to the
+// directories of the default profile.
+type MoveLegacyDir struct{}
+
+func (MoveLegacyDir) Main([]string) int {
+	paths, err := runtime.MoveLegacyDir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot move legacy directory:", err)
+		return 2
+	}
+	fmt.Printf("moved ~/.elvish to %s; rc.elv is now in %s\n", paths.Data, paths.Config)
+	return 0
+}
+
+// MigrateStatus shows the status of schema migrations of a database, and
+// optionally tries applying the pending migrations without saving the result.
+type MigrateStatus struct {
+	DbPath    string
+	DbBackend string
+	SockPath  string
+	Profile   string
+	DryRun    bool
+}
+
+func (m MigrateStatus) Main([]string) int {
+	dbpath, sockpath := m.DbPath, m.SockPath
+	if dbpath == "" || sockpath == "" {
+		paths, err := runtime.GetPaths(m.Profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot find Elvish directories:", err)
+			return 2
+		}
+		if dbpath == "" {
+			dbpath = filepath.Join(paths.Data, "db")
+		}
+		if sockpath == "" {
+			sockpath = filepath.Join(paths.Runtime, "sock")
+		}
+	}
+
+	check := store.CheckMigrations
+	if m.DryRun {
+		check = store.DryRunMigrations
+	}
+	status, err := check(m.DbBackend, dbpath)
+	if err == store.ErrNoDB {
+		fmt.Fprintln(os.Stderr, "database does not exist:", dbpath)
+		return 2
+	} else if status == nil {
+		if pid, ok := daemonUsing(sockpath, dbpath); ok {
+			fmt.Fprintf(os.Stderr, "database %s is in use by the daemon (pid %d), "+
+				"which applies the pending migrations when it starts; "+
+				"stop the daemon to check the database\n", dbpath, pid)
+		} else {
+			fmt.Fprintf(os.Stderr, "cannot open database %s: %v\n", dbpath, err)
+		}
+		return 2
+	}
+
+	fmt.Printf("database %s (%s): schema version %d, latest version %d\n",
+		dbpath, status.Backend, status.Version, status.LatestVersion)
+	if len(status.Applied) > 0 {
+		fmt.Println("applied migrations:")
+		for _, record := range status.Applied {
+			applied := "(not recorded)"
+			if !record.Time.IsZero() {
+				applied = record.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  %3d  %-19s  %s\n", record.Version, applied, record.Description)
+		}
+	}
+	if len(status.Pending) > 0 {
+		fmt.Println("pending migrations:")
+		for _, m := range status.Pending {
+			fmt.Printf("  %3d  %s\n", m.Version, m.Description)
+		}
+		if status.Version > 0 {
+			fmt.Println("the database will be backed up to",
+				store.BackupPath(dbpath, status.Version), "before migrating")
+		}
+	}
+
+	if m.DryRun && len(status.Pending) > 0 {
+		if err != nil {
+			fmt.Println("dry run failed:", err)
+			return 1
+		}
+		fmt.Println("dry run succeeded; no changes were saved")
+	}
+	return 0
+}
+
+// daemonUsing returns the pid of the daemon listening on sockpath, and
+// whether it is running and using the database at dbpath. A daemon that cannot
+// report its database is assumed to be using it.
+func daemonUsing(sockpath, dbpath string) (int, bool) {
+	if _, err := os.Stat(sockpath); err != nil {
+		return 0, false
+	}
+	client := daemonsvc.NewClient(sockpath)
+	defer client.Close()
+	pid, err := client.Pid()
+	if err != nil {
+		return 0, false
+	}
+	if stats, err := client.DBStats(); err == nil && !samePath(stats.Path, dbpath) {
+		return pid, false
+	}
+	return pid, true
+}
+
+func samePath(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// DaemonAdmin shows the status of the running daemon, or runs an
+// administrative command on it.
+type DaemonAdmin struct {
+	SockPath string
+	Profile  string
+}
+
+const daemonAdminCommands = "status, clients, metrics, db-stats, compact and log-level"
+
+func (a DaemonAdmin) Main(args []string) int {
+	sockpath := a.SockPath
+	if sockpath == "" {
+		paths, err := runtime.GetPaths(a.Profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot find runtime directory:", err)
+			return 2
+		}
+		sockpath = filepath.Join(paths.Runtime, "sock")
+	}
+	if _, err := os.Stat(sockpath); os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "daemon is not running; no socket at", sockpath)
+		return 2
+	}
+	client := daemonsvc.NewClient(sockpath)
+	defer client.Close()
+
+	command := "status"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if command == "log-level" {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "usage: elvish -daemon-admin log-level none|info|debug")
+			return 2
+		}
+	} else if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "%s does not take arguments\n", command)
+		return 2
+	}
+
+	err := runDaemonAdmin(client, command, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+	return 0
+}
+
+func runDaemonAdmin(client *daemonsvc.Client, command string, args []string) error {
+	switch command {
+	case "status":
+		pid, err := client.Pid()
+		if err != nil {
+			return err
+		}
+		version, err := client.DaemonVersion()
+		if err != nil {
+			return err
+		}
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("daemon pid %d, API version %d, serving %s\n",
+			pid, version, client.SockPath())
+		fmt.Printf("up since %s, %d client(s) connected\n",
+			status.Started.Format("2006-01-02 15:04:05"), len(status.Clients))
+		if status.StoreError != "" {
+			fmt.Println("store error:", status.StoreError)
+		} else {
+			fmt.Println("store ok")
+		}
+		if status.HistoryEncrypted {
+			fmt.Println("command history encrypted")
+		} else {
+			fmt.Println("command history not encrypted")
+		}
+	case "clients":
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%5s  %7s  %-19s  %s\n", "ID", "PID", "CONNECTED", "REQUESTS")
+		for _, c := range status.Clients {
+			pid := "?"
+			if c.Pid != 0 {
+				pid = strconv.Itoa(c.Pid)
+			}
+			fmt.Printf("%5d  %7s  %-19s  %d\n", c.ID, pid,
+				c.Connected.Format("2006-01-02 15:04:05"), c.Requests)
+		}
+	case "metrics":
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-20s  %8s  %6s  %12s  %12s\n", "METHOD", "COUNT", "ERRORS", "AVG", "MAX")
+		for _, m := range status.Methods {
+			fmt.Printf("%-20s  %8d  %6d  %12v  %12v\n", m.Method, m.Count, m.Errors,
+				m.Total/time.Duration(m.Count), m.Max)
+		}
+	case "db-stats":
+		stats, err := client.DBStats()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s database %s, %d bytes\n", stats.Backend, stats.Path, stats.Size)
+		fmt.Printf("%-20s  %8s  %10s\n", "BUCKET", "KEYS", "BYTES")
+		for _, b := range stats.Buckets {
+			bytes := "?"
+			if b.Bytes != 0 {
+				bytes = strconv.FormatInt(b.Bytes, 10)
+			}
+			fmt.Printf("%-20s  %8d  %10s\n", b.Name, b.Keys, bytes)
+		}
+	case "compact":
+		before, after, err := client.Compact()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("compacted database from %d to %d bytes\n", before, after)
+	case "log-level":
+		previous, err := client.SetLogLevel(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("changed log level from %s to %s\n", previous, args[0])
+	default:
+		return fmt.Errorf("unknown command %s, should be one of %s",
+			command, daemonAdminCommands)
+	}
+	return nil
+}
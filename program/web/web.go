@@ -20,10 +20,12 @@ import (
 )
 
 type Web struct {
-	BinPath  string
-	SockPath string
-	DbPath   string
-	Port     int
+	BinPath   string
+	SockPath  string
+	DbPath    string
+	DbBackend string
+	Profile   string
+	Port      int
 }
 
 type httpHandler struct {
@@ -37,12 +39,12 @@ type ExecuteResponse struct {
 	Err       string
 }
 
-func New(binpath, sockpath, dbpath string, port int) *Web {
-	return &Web{binpath, sockpath, dbpath, port}
+func New(binpath, sockpath, dbpath, dbbackend, profile string, port int) *Web {
+	return &Web{binpath, sockpath, dbpath, dbbackend, profile, port}
 }
 
 func (web *Web) Main([]string) int {
-	ev, _ := runtime.InitRuntime(web.BinPath, web.SockPath, web.DbPath)
+	ev, _ := runtime.InitRuntime(web.BinPath, web.SockPath, web.DbPath, web.DbBackend, web.Profile)
 	defer runtime.CleanupRuntime(ev)
 
 	h := httpHandler{ev}
@@ -0,0 +1,241 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/elves/elvish/daemon"
+	"github.com/elves/elvish/util"
+)
+
+// Elvish uses four directories, following the XDG base directory
+// specification:
+//
+// * The config directory contains rc.elv.
+//
+// * The data directory contains the library directory, the database and the
+//   key for encrypting the command history.
+//
+// * The cache directory contains the logs of the daemon.
+//
+// * The runtime directory contains the socket of the daemon.
+//
+// The config, data and cache directories are elvish under $XDG_CONFIG_HOME,
+// $XDG_DATA_HOME and $XDG_CACHE_HOME, which default to ~/.config,
+// ~/.local/share and ~/.cache. The runtime directory is elvish under
+// $XDG_RUNTIME_DIR, or elvish-$uid under the temp dir if $XDG_RUNTIME_DIR is
+// not set.
+//
+// Named profiles have their own directories, so that they don't share the
+// rc.elv, the libraries or the database with the default profile. The config,
+// data and cache directories of a profile are elvish-$profile instead of
+// elvish, and its runtime directory is a subdirectory $profile of the runtime
+// directory of the default profile.
+//
+// Older versions of Elvish kept all but the runtime directory in ~/.elvish, and
+// always used elvish-$uid under the temp dir as the runtime directory. If
+// ~/.elvish exists, the default profile keeps using it as both the config and
+// data directory, until it is moved with MoveLegacyDir (elvish
+// -move-legacy-dir). Likewise, if there is a socket in the old runtime
+// directory, the default profile keeps using that directory, so that a daemon
+// started by an older version is found and taken over.
+
+// Paths contains the directories of a profile.
+type Paths struct {
+	Config  string
+	Data    string
+	Cache   string
+	Runtime string
+}
+
+// ErrBadProfile is returned when the name of a profile is invalid.
+var ErrBadProfile = errors.New("profile names may only contain letters, digits, _, - and .")
+
+var profilePattern = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
+
+// IsValidProfile returns whether name is a valid name of a profile. The empty
+// string is valid and means the default profile.
+func IsValidProfile(name string) bool {
+	return name == "" ||
+		(profilePattern.MatchString(name) && name != "." && name != "..")
+}
+
+// GetPaths returns the directories of a profile, which is the default profile
+// if the name is empty. It does not create the directories.
+func GetPaths(profile string) (*Paths, error) {
+	p, legacy, err := xdgPaths(profile)
+	if err != nil {
+		return nil, err
+	}
+	if legacy != "" {
+		if isDir(legacy) {
+			p.Config, p.Data = legacy, legacy
+		}
+		if runDir := defaultRunDir(); exists(filepath.Join(runDir, "sock")) {
+			p.Runtime = runDir
+		}
+	}
+	return p, nil
+}
+
+// EnsurePaths is like GetPaths, but also creates the directories. Problems
+// with individual directories are reported on stderr; if the runtime directory
+// cannot be used, the data directory is used instead.
+func EnsurePaths(profile string) (*Paths, error) {
+	p, err := GetPaths(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{p.Config, p.Data, p.Cache} {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning: cannot create directory:", err)
+		}
+	}
+	err = ensureRunDir(p.Runtime, profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot use runtime dir %s, falling back to data dir %s: %v\n",
+			p.Runtime, p.Data, err)
+		p.Runtime = p.Data
+	}
+	return p, nil
+}
+
+// xdgPaths returns the XDG directories of a profile, and the path of the
+// legacy data directory if the profile is the default one.
+func xdgPaths(profile string) (*Paths, string, error) {
+	if !IsValidProfile(profile) {
+		return nil, "", ErrBadProfile
+	}
+	home, err := util.GetHome("")
+	if err != nil {
+		return nil, "", err
+	}
+	name := "elvish"
+	runDir := xdgRunDir()
+	legacy := filepath.Join(home, ".elvish")
+	if profile != "" {
+		name += "-" + profile
+		runDir = filepath.Join(runDir, profile)
+		legacy = ""
+	}
+	p := &Paths{
+		Config:  filepath.Join(xdgDir("XDG_CONFIG_HOME", home, ".config"), name),
+		Data:    filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local/share"), name),
+		Cache:   filepath.Join(xdgDir("XDG_CACHE_HOME", home, ".cache"), name),
+		Runtime: runDir,
+	}
+	return p, legacy, nil
+}
+
+// xdgDir returns the value of an XDG environment variable, or the fallback
+// under home if it is not set. As required by the specification, relative
+// paths are ignored.
+func xdgDir(env, home, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(home, filepath.FromSlash(fallback))
+}
+
+func xdgRunDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "elvish")
+	}
+	return defaultRunDir()
+}
+
+// ensureRunDir makes sure that the runtime directory and, for a named profile,
+// its parent directory are only accessible by the current user.
+func ensureRunDir(dir, profile string) error {
+	if profile != "" {
+		err := ensureSecureDir(filepath.Dir(dir))
+		if err != nil {
+			return err
+		}
+	}
+	return ensureSecureDir(dir)
+}
+
+// MoveLegacyDir moves ~/.elvish to the data directory of the default profile,
+// and rc.elv in it to the config directory, and returns the new directories. It
+// refuses to do so if ~/.elvish is a symlink, if the data directory or the new
+// rc.elv already exists, or if a daemon is running, since the daemon keeps the
+// database open.
+func MoveLegacyDir() (*Paths, error) {
+	p, legacy, err := xdgPaths("")
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(legacy)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s is a symlink; move it by hand", legacy)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", legacy)
+	}
+	if exists(p.Data) {
+		return nil, fmt.Errorf("%s already exists", p.Data)
+	}
+	for _, runDir := range []string{p.Runtime, defaultRunDir()} {
+		sockpath := filepath.Join(runDir, "sock")
+		cl := daemon.NewClient(sockpath)
+		status, _ := detectDaemon(sockpath, cl)
+		cl.Close()
+		if status != sockfileMissing && status != connectionShutdown {
+			return nil, fmt.Errorf("%s exists, so a daemon may be using the database; stop the daemon or remove the socket first", sockpath)
+		}
+	}
+	err = migrateLegacyDir(legacy, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// migrateLegacyDir moves the legacy data directory to the data directory, and
+// rc.elv in it to the config directory. The data directory must not exist.
+func migrateLegacyDir(legacy string, p *Paths) error {
+	err := os.MkdirAll(filepath.Dir(p.Data), 0700)
+	if err != nil {
+		return err
+	}
+	oldRC := filepath.Join(legacy, "rc.elv")
+	newRC := filepath.Join(p.Config, "rc.elv")
+	movedRC := false
+	if exists(oldRC) {
+		if exists(newRC) {
+			return fmt.Errorf("%s already exists", newRC)
+		}
+		err := os.MkdirAll(p.Config, 0700)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(oldRC, newRC)
+		if err != nil {
+			return err
+		}
+		movedRC = true
+	}
+	err = os.Rename(legacy, p.Data)
+	if err != nil && movedRC {
+		os.Rename(newRC, oldRC)
+	}
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+// withEnv runs f with the environment variables set to the given values and
+// restores them afterwards.
+func withEnv(env map[string]string, f func()) {
+	saved := make(map[string]string)
+	for name, value := range env {
+		saved[name] = os.Getenv(name)
+		os.Setenv(name, value)
+	}
+	defer func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}()
+	f()
+}
+
+func withHome(f func(home string)) {
+	util.WithTempDir(func(home string) {
+		withEnv(map[string]string{
+			"HOME": home, "XDG_CONFIG_HOME": "", "XDG_DATA_HOME": "",
+			"XDG_CACHE_HOME": "", "XDG_RUNTIME_DIR": filepath.Join(home, "run"),
+			// Make the legacy runtime directory independent of the system.
+			"TMPDIR": home,
+		}, func() { f(home) })
+	})
+}
+
+func TestGetPaths(t *testing.T) {
+	withHome(func(home string) {
+		paths, err := GetPaths("")
+		want := &Paths{
+			Config:  filepath.Join(home, ".config", "elvish"),
+			Data:    filepath.Join(home, ".local", "share", "elvish"),
+			Cache:   filepath.Join(home, ".cache", "elvish"),
+			Runtime: filepath.Join(home, "run", "elvish"),
+		}
+		if !reflect.DeepEqual(paths, want) || err != nil {
+			t.Errorf("GetPaths() -> (%v, %v), want (%v, nil)", paths, err, want)
+		}
+
+		paths, err = GetPaths("work")
+		want = &Paths{
+			Config:  filepath.Join(home, ".config", "elvish-work"),
+			Data:    filepath.Join(home, ".local", "share", "elvish-work"),
+			Cache:   filepath.Join(home, ".cache", "elvish-work"),
+			Runtime: filepath.Join(home, "run", "elvish", "work"),
+		}
+		if !reflect.DeepEqual(paths, want) || err != nil {
+			t.Errorf("GetPaths(work) -> (%v, %v), want (%v, nil)", paths, err, want)
+		}
+
+		withEnv(map[string]string{
+			"XDG_CONFIG_HOME": "/config", "XDG_DATA_HOME": "relative",
+		}, func() {
+			paths, _ := GetPaths("")
+			if paths.Config != filepath.Join("/config", "elvish") {
+				t.Errorf("GetPaths ignored $XDG_CONFIG_HOME")
+			}
+			if paths.Data != filepath.Join(home, ".local", "share", "elvish") {
+				t.Errorf("GetPaths used relative $XDG_DATA_HOME")
+			}
+		})
+
+		for _, bad := range []string{"..", "a/b", "a b"} {
+			if _, err := GetPaths(bad); err != ErrBadProfile {
+				t.Errorf("GetPaths(%q) -> error %v, want %v", bad, err, ErrBadProfile)
+			}
+		}
+	})
+}
+
+func TestGetPathsUsesLegacyDir(t *testing.T) {
+	withHome(func(home string) {
+		legacy := filepath.Join(home, ".elvish")
+		os.MkdirAll(legacy, 0700)
+		ioutil.WriteFile(filepath.Join(legacy, "rc.elv"), []byte("rc"), 0600)
+		// The legacy directory is used even if the new directories exist.
+		os.MkdirAll(filepath.Join(home, ".local", "share", "elvish"), 0700)
+
+		for _, get := range []func(string) (*Paths, error){GetPaths, EnsurePaths} {
+			paths, err := get("")
+			if err != nil || paths.Config != legacy || paths.Data != legacy {
+				t.Errorf("-> (%v, %v), want legacy dir", paths, err)
+			}
+		}
+		if content, _ := ioutil.ReadFile(filepath.Join(legacy, "rc.elv")); string(content) != "rc" {
+			t.Errorf("legacy rc.elv changed to %q", content)
+		}
+
+		// Named profiles never use the legacy directory.
+		paths, _ := GetPaths("work")
+		if paths.Data == legacy {
+			t.Errorf("GetPaths(work) used legacy dir")
+		}
+	})
+}
+
+func TestGetPathsUsesLegacyRunDir(t *testing.T) {
+	withHome(func(home string) {
+		runDir := defaultRunDir()
+		paths, _ := GetPaths("")
+		if paths.Runtime == runDir {
+			t.Fatalf("GetPaths -> %v, want runtime dir other than %s", paths, runDir)
+		}
+
+		// A daemon started by an older version is listening there.
+		os.MkdirAll(runDir, 0700)
+		ioutil.WriteFile(filepath.Join(runDir, "sock"), nil, 0600)
+		paths, _ = GetPaths("")
+		if paths.Runtime != runDir {
+			t.Errorf("GetPaths -> runtime dir %s, want %s", paths.Runtime, runDir)
+		}
+		paths, _ = GetPaths("work")
+		if paths.Runtime == runDir {
+			t.Errorf("GetPaths(work) used legacy runtime dir")
+		}
+	})
+}
+
+func TestMoveLegacyDir(t *testing.T) {
+	withHome(func(home string) {
+		legacy := filepath.Join(home, ".elvish")
+		os.MkdirAll(filepath.Join(legacy, "lib"), 0700)
+		ioutil.WriteFile(filepath.Join(legacy, "rc.elv"), []byte("rc"), 0600)
+		ioutil.WriteFile(filepath.Join(legacy, "db"), []byte("db"), 0600)
+
+		paths, err := MoveLegacyDir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Errorf("legacy dir still exists")
+		}
+		for _, name := range []string{
+			filepath.Join(paths.Config, "rc.elv"), filepath.Join(paths.Data, "db"),
+			filepath.Join(paths.Data, "lib")} {
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("%s not moved: %v", name, err)
+			}
+		}
+
+		newPaths, _ := GetPaths("")
+		if !reflect.DeepEqual(newPaths, paths) {
+			t.Errorf("GetPaths after moving -> %v, want %v", newPaths, paths)
+		}
+	})
+}
+
+func TestMoveLegacyDirRefuses(t *testing.T) {
+	setups := map[string]func(home, legacy string){
+		"symlink": func(home, legacy string) {
+			target := filepath.Join(home, "dotfiles", "elvish")
+			os.MkdirAll(target, 0700)
+			os.Symlink(target, legacy)
+		},
+		"data dir exists": func(home, legacy string) {
+			os.MkdirAll(legacy, 0700)
+			os.MkdirAll(filepath.Join(home, ".local", "share", "elvish"), 0700)
+		},
+		"rc.elv exists": func(home, legacy string) {
+			os.MkdirAll(legacy, 0700)
+			ioutil.WriteFile(filepath.Join(legacy, "rc.elv"), []byte("old"), 0600)
+			config := filepath.Join(home, ".config", "elvish")
+			os.MkdirAll(config, 0700)
+			ioutil.WriteFile(filepath.Join(config, "rc.elv"), []byte("new"), 0600)
+		},
+		"daemon running": func(home, legacy string) {
+			os.MkdirAll(legacy, 0700)
+			runDir := filepath.Join(home, "run", "elvish")
+			os.MkdirAll(runDir, 0700)
+			ioutil.WriteFile(filepath.Join(runDir, "sock"), nil, 0600)
+		},
+	}
+	for name, setup := range setups {
+		withHome(func(home string) {
+			legacy := filepath.Join(home, ".elvish")
+			setup(home, legacy)
+			if _, err := MoveLegacyDir(); err == nil {
+				t.Errorf("%s: MoveLegacyDir -> nil error, want error", name)
+			}
+			if _, err := os.Lstat(legacy); err != nil {
+				t.Errorf("%s: legacy dir moved: %v", name, err)
+			}
+		})
+	}
+}
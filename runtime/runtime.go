@@ -16,6 +16,7 @@ import (
 	"github.com/elves/elvish/eval/re"
 	"github.com/elves/elvish/eval/str"
 	daemonp "github.com/elves/elvish/program/daemon"
+	"github.com/elves/elvish/store"
 	"github.com/elves/elvish/store/storedefs"
 	"github.com/elves/elvish/util"
 )
@@ -41,61 +42,115 @@ const (
 
 const (
 	daemonWontWorkMsg     = "Daemon-related functions will likely not work."
+	usingLocalStoreMsg    = "Using the database directly without a daemon."
+	dbLockedMsg           = "The database is in use by a daemon, using the daemon."
 	connectionShutdownFmt = "Socket file %s exists but is not responding to request. This is likely due to abnormal shutdown of the daemon. Going to remove socket file and re-spawn a daemon.\n"
 )
 
 var errInvalidDB = errors.New("daemon reported that database is invalid. If you upgraded Elvish from a pre-0.10 version, you need to upgrade your database by following instructions in https://github.com/elves/upgrade-db-for-0.10/")
 
-// InitRuntime initializes the runtime. The caller is responsible for calling
+// InitRuntime initializes the runtime, using the directories of the given
+// profile (see EnsurePaths). It returns the Evaler and the directories, which
+// are nil if they cannot be determined. The caller is responsible for calling
 // CleanupRuntime at some point.
-func InitRuntime(binpath, sockpath, dbpath string) (*eval.Evaler, string) {
-	var dataDir string
-	var err error
-
-	// Determine data directory.
-	dataDir, err = storedefs.EnsureDataDir()
+func InitRuntime(binpath, sockpath, dbpath, dbbackend, profile string) (*eval.Evaler, *Paths) {
+	paths, err := EnsurePaths(profile)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "warning: cannot create data directory ~/.elvish")
+		fmt.Fprintln(os.Stderr, "warning: cannot determine Elvish directories:", err)
 	} else {
 		if dbpath == "" {
-			dbpath = filepath.Join(dataDir, "db")
+			dbpath = filepath.Join(paths.Data, "db")
+		}
+		if sockpath == "" {
+			sockpath = filepath.Join(paths.Runtime, "sock")
 		}
-	}
-
-	// Determine runtime directory.
-	runDir, err := getSecureRunDir()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "cannot get runtime dir /tmp/elvish-$uid, falling back to data dir ~/.elvish:", err)
-		runDir = dataDir
-	}
-	if sockpath == "" {
-		sockpath = filepath.Join(runDir, "sock")
 	}
 
 	ev := eval.NewEvaler()
-	ev.SetLibDir(filepath.Join(dataDir, "lib"))
+	if paths != nil {
+		ev.SetLibDir(filepath.Join(paths.Data, "lib"))
+	}
 	ev.InstallModule("re", re.Ns())
 	ev.InstallModule("str", str.Ns())
 	if sockpath != "" && dbpath != "" {
 		spawner := &daemonp.Daemon{
 			BinPath:       binpath,
 			DbPath:        dbpath,
+			DbBackend:     dbbackend,
 			SockPath:      sockpath,
-			LogPathPrefix: filepath.Join(runDir, "daemon.log-"),
+			LogPathPrefix: filepath.Join(filepath.Dir(sockpath), "daemon.log-"),
+		}
+		if paths != nil {
+			spawner.LogPathPrefix = filepath.Join(paths.Cache, "daemon.log-")
+			// The command history is encrypted if there is a key file in the
+			// data directory.
+			keyPath := filepath.Join(paths.Data, "history-key")
+			if _, err := os.Stat(keyPath); err == nil {
+				spawner.HistoryKeyPath = keyPath
+			}
 		}
 		// TODO(xiaq): Connect to daemon and install daemon module
 		// asynchronously.
 		client, err := connectToDaemon(sockpath, spawner)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Cannot connect to daemon:", err)
-			fmt.Fprintln(os.Stderr, daemonWontWorkMsg)
+			st, err := openLocalStore(dbbackend, dbpath, spawner.HistoryKeyPath)
+			if err == storedefs.ErrDBLocked {
+				// A daemon has locked the database in the meantime.
+				fmt.Fprintln(os.Stderr, dbLockedMsg)
+				client = daemon.NewClient(sockpath)
+			} else if err == nil {
+				fmt.Fprintln(os.Stderr, usingLocalStoreMsg)
+				client = daemon.NewLocalClient(st, sockpath)
+			} else {
+				fmt.Fprintln(os.Stderr, "Cannot open database:", err)
+				fmt.Fprintln(os.Stderr, daemonWontWorkMsg)
+			}
+		}
+		if spawner.HistoryKeyPath != "" && client != nil {
+			warnUnencryptedHistory(client, spawner.HistoryKeyPath)
 		}
 		// Even if error is not nil, we install daemon-related functionalities
 		// anyway. Daemon may eventually come online and become functional.
 		ev.InstallDaemonClient(client)
 		ev.InstallModule("daemon", daemonmod.Ns(client, spawner))
 	}
-	return ev, dataDir
+	return ev, paths
+}
+
+// warnUnencryptedHistory warns if the daemon does not encrypt the command
+// history despite the existence of a history key, which happens when the
+// daemon was started before the key was created or by a program that did not
+// pass the key.
+func warnUnencryptedHistory(client *daemon.Client, keyPath string) {
+	status, err := client.Status()
+	if err != nil {
+		logger.Println("cannot get daemon status:", err)
+		return
+	}
+	if !status.HistoryEncrypted {
+		fmt.Fprintf(os.Stderr, "warning: the daemon does not use the history key %s; "+
+			"the command history is stored unencrypted until the daemon is restarted\n",
+			keyPath)
+	}
+}
+
+// openLocalStore opens the database for use without a daemon. The database is
+// only kept open during each operation, so that other sessions without a
+// daemon can use it too.
+func openLocalStore(backend, dbpath, historyKeyPath string) (store.DBStore, error) {
+	st, err := store.OpenShared(backend, dbpath)
+	if err != nil {
+		return nil, err
+	}
+	if historyKeyPath == "" {
+		return st, nil
+	}
+	key, err := store.ReadKeyFile(historyKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewEncryptedStore(st, key)
 }
 
 func connectToDaemon(sockpath string, spawner *daemonp.Daemon) (*daemon.Client, error) {
@@ -121,12 +176,27 @@ func connectToDaemon(sockpath string, spawner *daemonp.Daemon) (*daemon.Client,
 	case daemonInvalidDB:
 		return cl, errInvalidDB
 	case daemonOutdated:
-		fmt.Fprintln(os.Stderr, "Daemon is outdated; going to kill old daemon and re-spawn")
-		err := killDaemon(cl)
-		if err != nil {
-			return cl, fmt.Errorf("failed to kill old daemon: %v", err)
+		canHandover, err := cl.Supports("Handover")
+		switch {
+		case err == nil && canHandover:
+			// The new daemon takes over from the old one without disrupting
+			// other sessions.
+			logger.Println("daemon is outdated; spawning a new daemon to take over")
+			shouldSpawn = true
+		case err == nil:
+			// Keep using the old daemon, so that sessions still using it are
+			// not disrupted. Requests it does not support fail with
+			// daemon.ErrNotSupported.
+			logger.Println("daemon is outdated but compatible; using it anyway")
+			return cl, nil
+		default:
+			fmt.Fprintln(os.Stderr, "Daemon is incompatible; going to kill old daemon and re-spawn")
+			err := killDaemon(cl)
+			if err != nil {
+				return cl, fmt.Errorf("failed to kill old daemon: %v", err)
+			}
+			shouldSpawn = true
 		}
-		shouldSpawn = true
 	default:
 		return cl, fmt.Errorf("code bug: unknown daemon status %d", status)
 	}
@@ -160,7 +230,7 @@ func connectToDaemon(sockpath string, spawner *daemonp.Daemon) (*daemon.Client,
 		case daemonInvalidDB:
 			return cl, errInvalidDB
 		case daemonOutdated:
-			return cl, fmt.Errorf("code bug: newly spawned daemon is outdated")
+			// The new daemon is still taking over; continue waiting
 		default:
 			return cl, fmt.Errorf("code bug: unknown daemon status %d", status)
 		}
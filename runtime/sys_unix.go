@@ -9,23 +9,26 @@ import (
 	"syscall"
 )
 
-// getSecureRunDir stats elvish-$uid under the default temp dir, creating it if
-// it doesn't yet exist, and return the directory name if it has the correct
-// owner and permission.
-func getSecureRunDir() (string, error) {
-	uid := os.Getuid()
-	runDir := filepath.Join(os.TempDir(), fmt.Sprintf("elvish-%d", uid))
-	err := os.MkdirAll(runDir, 0700)
+// defaultRunDir returns elvish-$uid under the default temp dir, which is used
+// as the runtime directory when $XDG_RUNTIME_DIR is not set.
+func defaultRunDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("elvish-%d", os.Getuid()))
+}
+
+// ensureSecureDir stats a directory, creating it if it doesn't yet exist, and
+// returns an error if it doesn't have the correct owner and permission.
+func ensureSecureDir(dir string) error {
+	err := os.MkdirAll(dir, 0700)
 	if err != nil {
-		return "", fmt.Errorf("mkdir: %v", err)
+		return fmt.Errorf("mkdir: %v", err)
 	}
 
-	info, err := os.Stat(runDir)
+	info, err := os.Stat(dir)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return runDir, checkExclusiveAccess(info, uid)
+	return checkExclusiveAccess(info, os.Getuid())
 }
 
 func checkExclusiveAccess(info os.FileInfo, uid int) error {
@@ -6,16 +6,17 @@ import (
 	"path/filepath"
 )
 
-// getSecureRunDir stats elvish-$USERNAME under the default temp dir, creating
-// it if it doesn't yet exist, and return the directory name.
-func getSecureRunDir() (string, error) {
-	username := os.Getenv("USERNAME")
+// defaultRunDir returns elvish-$USERNAME under the default temp dir, which is
+// used as the runtime directory when $XDG_RUNTIME_DIR is not set.
+func defaultRunDir() string {
+	return filepath.Join(os.TempDir(), "elvish-"+os.Getenv("USERNAME"))
+}
 
-	runDir := filepath.Join(os.TempDir(), "elvish-"+username)
-	err := os.MkdirAll(runDir, 0700)
+// ensureSecureDir stats a directory, creating it if it doesn't yet exist.
+func ensureSecureDir(dir string) error {
+	err := os.MkdirAll(dir, 0700)
 	if err != nil {
-		return "", fmt.Errorf("mkdir: %v", err)
+		return fmt.Errorf("mkdir: %v", err)
 	}
-
-	return runDir, nil
+	return nil
 }
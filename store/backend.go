@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Names of storage backends.
+const (
+	BackendBolt   = "bolt"
+	BackendSQLite = "sqlite"
+)
+
+// DefaultBackend is the backend used for new databases when no backend is
+// specified.
+const DefaultBackend = BackendBolt
+
+// ErrUnknownBackend is returned by Open when the backend is not known.
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// DBStore is a storedefs.Store backed by a database file. It is implemented by
+// all storage backends.
+type DBStore interface {
+	storedefs.Store
+	// Stats returns statistics of the database.
+	Stats() (*storedefs.DBStats, error)
+	// Compact reclaims unused space in the database file. It must not be
+	// called concurrently with other methods.
+	Compact() error
+	Close() error
+}
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// DetectBackend returns the backend of an existing database. It returns an
+// empty string if the database does not exist or is empty.
+func DetectBackend(dbpath string) (string, error) {
+	f, err := os.Open(dbpath)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteMagic))
+	n, err := io.ReadFull(f, header)
+	if n == 0 {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", err
+	}
+	if bytes.Equal(header, sqliteMagic) {
+		return BackendSQLite, nil
+	}
+	return BackendBolt, nil
+}
+
+// Open opens the database with the given backend, creating it if it does not
+// exist. If backend is empty, the backend of an existing database is detected,
+// and DefaultBackend is used for new databases. It is an error to specify a
+// backend different from that of an existing database; use Convert to convert
+// databases between backends.
+func Open(backend, dbpath string) (DBStore, error) {
+	detected, err := DetectBackend(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case backend == "" && detected == "":
+		backend = DefaultBackend
+	case backend == "":
+		backend = detected
+	case detected != "" && detected != backend:
+		return nil, fmt.Errorf("%s is a %s database, not %s", dbpath, detected, backend)
+	}
+
+	switch backend {
+	case BackendBolt:
+		st, err := NewStore(dbpath)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	case BackendSQLite:
+		return openSQLiteStore(dbpath)
+	default:
+		return nil, fmt.Errorf("%v: %s", ErrUnknownBackend, backend)
+	}
+}
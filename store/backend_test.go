@@ -0,0 +1,55 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestOpenDetectsBackend(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		for _, backend := range testBackends {
+			dbpath := filepath.Join(dir, backend)
+			if detected, err := DetectBackend(dbpath); detected != "" || err != nil {
+				t.Errorf("DetectBackend on nonexistent database -> (%q, %v), want (\"\", nil)",
+					detected, err)
+			}
+			st, err := Open(backend, dbpath)
+			if err != nil {
+				t.Fatalf("Open(%q, %q) -> error %v", backend, dbpath, err)
+			}
+			st.Close()
+
+			if detected, err := DetectBackend(dbpath); detected != backend || err != nil {
+				t.Errorf("DetectBackend -> (%q, %v), want (%q, nil)", detected, err, backend)
+			}
+			st, err = Open("", dbpath)
+			if err != nil {
+				t.Errorf("Open with no backend -> error %v", err)
+			} else {
+				st.Close()
+			}
+			for _, other := range testBackends {
+				if other == backend {
+					continue
+				}
+				if _, err := Open(other, dbpath); err == nil {
+					t.Errorf("Open(%q) on %s database -> no error", other, backend)
+				}
+			}
+		}
+
+		empty := filepath.Join(dir, "empty")
+		ioutil.WriteFile(empty, nil, 0600)
+		if detected, err := DetectBackend(empty); detected != "" || err != nil {
+			t.Errorf("DetectBackend on empty file -> (%q, %v), want (\"\", nil)",
+				detected, err)
+		}
+
+		if _, err := Open("bad", filepath.Join(dir, "bad")); err == nil {
+			t.Errorf("Open with unknown backend -> no error")
+		}
+	})
+}
@@ -3,21 +3,18 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 
 	"github.com/boltdb/bolt"
 	"github.com/elves/elvish/store/storedefs"
 )
 
-func init() {
-	initDB["initialize command history table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketCmd))
-			return err
-		})
-	}
-}
-
-const BucketCmd = "cmd"
+const (
+	BucketCmd = "cmd"
+	// BucketCmdMeta stores the metadata of commands, keyed by sequence numbers
+	// like BucketCmd. The values are JSON-encoded storedefs.CmdMeta.
+	BucketCmdMeta = "cmd-meta"
+)
 
 // NextCmdSeq returns the next sequence number of the command history.
 func (s *Store) NextCmdSeq() (int, error) {
@@ -47,13 +44,147 @@ func (s *Store) AddCmd(cmd string) (int, error) {
 	return int(seq), err
 }
 
+// AddCmdWithMeta adds a new command along with its metadata to the command
+// history, in one transaction.
+func (s *Store) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return 0, err
+	}
+	var seq uint64
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCmd))
+		seq, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		err = b.Put(marshalSeq(seq), []byte(cmd))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketCmdMeta)).Put(marshalSeq(seq), data)
+	})
+	return int(seq), err
+}
+
+// AddCmds adds commands along with their metadata to the command history, in
+// one transaction. The Seq fields of the commands are ignored; new sequence
+// numbers are allocated for them.
+func (s *Store) AddCmds(cmds []storedefs.Cmd) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCmd))
+		bMeta := tx.Bucket([]byte(BucketCmdMeta))
+		for _, cmd := range cmds {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			err = b.Put(marshalSeq(seq), []byte(cmd.Text))
+			if err != nil {
+				return err
+			}
+			if cmd.Meta != nil {
+				data, err := json.Marshal(cmd.Meta)
+				if err != nil {
+					return err
+				}
+				err = bMeta.Put(marshalSeq(seq), data)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DedupCmds removes all but the last occurrence of each command from the
+// command history. It returns the sequence numbers of the removed commands.
+func (s *Store) DedupCmds() ([]int, error) {
+	var removed []int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCmd))
+		bMeta := tx.Bucket([]byte(BucketCmdMeta))
+		seen := make(map[string]bool)
+		var toRemove [][]byte
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if seen[string(v)] {
+				// Keys are only valid during the transaction; copy them.
+				toRemove = append(toRemove, append([]byte(nil), k...))
+			} else {
+				seen[string(v)] = true
+			}
+		}
+		for i := len(toRemove) - 1; i >= 0; i-- {
+			k := toRemove[i]
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			if err := bMeta.Delete(k); err != nil {
+				return err
+			}
+			removed = append(removed, int(unmarshalSeq(k)))
+		}
+		return nil
+	})
+	return removed, err
+}
+
 // RemoveCmd removes a command from command history referenced by
-// sequence.
+// sequence. It returns storedefs.ErrNoMatchingCmd if there is no such command.
 func (s *Store) RemoveCmd(seq int) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketCmd))
-		return b.Delete(marshalSeq(uint64(seq)))
+		if b.Get(marshalSeq(uint64(seq))) == nil {
+			return storedefs.ErrNoMatchingCmd
+		}
+		err := b.Delete(marshalSeq(uint64(seq)))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketCmdMeta)).Delete(marshalSeq(uint64(seq)))
+	})
+}
+
+// SetCmdMeta sets the metadata of the command with the specified sequence
+// number.
+func (s *Store) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(BucketCmd)).Get(marshalSeq(uint64(seq))) == nil {
+			return storedefs.ErrNoMatchingCmd
+		}
+		b := tx.Bucket([]byte(BucketCmdMeta))
+		return b.Put(marshalSeq(uint64(seq)), data)
+	})
+}
+
+// CmdsWithMeta returns all commands within the specified range, along with
+// their sequence numbers and metadata.
+func (s *Store) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	var cmds []storedefs.Cmd
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCmd))
+		bMeta := tx.Bucket([]byte(BucketCmdMeta))
+		c := b.Cursor()
+		for k, v := c.Seek(marshalSeq(uint64(from))); k != nil && unmarshalSeq(k) < uint64(upto); k, v = c.Next() {
+			cmd := storedefs.Cmd{Seq: int(unmarshalSeq(k)), Text: string(v)}
+			if data := bMeta.Get(k); data != nil {
+				cmd.Meta = &storedefs.CmdMeta{}
+				if err := json.Unmarshal(data, cmd.Meta); err != nil {
+					logger.Printf("bad metadata for command %d: %v", cmd.Seq, err)
+					cmd.Meta = nil
+				}
+			}
+			cmds = append(cmds, cmd)
+		}
+		return nil
 	})
+	return cmds, err
 }
 
 // Cmd queries the command history item with the specified sequence number.
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/elves/elvish/store/storedefs"
 )
@@ -30,54 +32,135 @@ var (
 )
 
 func TestCmd(t *testing.T) {
-	startSeq, err := tStore.NextCmdSeq()
-	if startSeq != 1 || err != nil {
-		t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (1, nil)",
-			startSeq, err)
-	}
-	for i, cmd := range cmds {
-		wantSeq := startSeq + i
-		seq, err := tStore.AddCmd(cmd)
-		if seq != wantSeq || err != nil {
-			t.Errorf("tStore.AddCmd(%v) => (%v, %v), want (%v, nil)",
-				cmd, seq, err, wantSeq)
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		startSeq, err := tStore.NextCmdSeq()
+		if startSeq != 1 || err != nil {
+			t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (1, nil)",
+				startSeq, err)
 		}
-	}
-	endSeq, err := tStore.NextCmdSeq()
-	wantedEndSeq := startSeq + len(cmds)
-	if endSeq != wantedEndSeq || err != nil {
-		t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (%v, nil)",
-			endSeq, err, wantedEndSeq)
-	}
-	for i, wantedCmd := range cmds {
-		seq := i + startSeq
-		cmd, err := tStore.Cmd(seq)
-		if cmd != wantedCmd || err != nil {
-			t.Errorf("tStore.Cmd(%v) => (%v, %v), want (%v, nil)",
-				seq, cmd, err, wantedCmd)
+		for i, cmd := range cmds {
+			wantSeq := startSeq + i
+			seq, err := tStore.AddCmd(cmd)
+			if seq != wantSeq || err != nil {
+				t.Errorf("tStore.AddCmd(%v) => (%v, %v), want (%v, nil)",
+					cmd, seq, err, wantSeq)
+			}
 		}
-	}
-	for _, tt := range searches {
-		f := tStore.PrevCmd
-		funcname := "tStore.PrevCmd"
-		if tt.next {
-			f = tStore.NextCmd
-			funcname = "tStore.NextCmd"
-		}
-		seq, cmd, err := f(tt.seq, tt.prefix)
-		if seq != tt.wantedSeq || cmd != tt.wantedCmd || err != tt.wantedErr {
-			t.Errorf("%s(%v, %v) => (%v, %v, %v), want (%v, %v, %v)",
-				funcname, tt.seq, tt.prefix,
-				seq, cmd, err,
-				tt.wantedSeq, tt.wantedCmd, tt.wantedErr)
+		endSeq, err := tStore.NextCmdSeq()
+		wantedEndSeq := startSeq + len(cmds)
+		if endSeq != wantedEndSeq || err != nil {
+			t.Errorf("tStore.NextCmdSeq() => (%v, %v), want (%v, nil)",
+				endSeq, err, wantedEndSeq)
+		}
+		for i, wantedCmd := range cmds {
+			seq := i + startSeq
+			cmd, err := tStore.Cmd(seq)
+			if cmd != wantedCmd || err != nil {
+				t.Errorf("tStore.Cmd(%v) => (%v, %v), want (%v, nil)",
+					seq, cmd, err, wantedCmd)
+			}
+		}
+		for _, tt := range searches {
+			f := tStore.PrevCmd
+			funcname := "tStore.PrevCmd"
+			if tt.next {
+				f = tStore.NextCmd
+				funcname = "tStore.NextCmd"
+			}
+			seq, cmd, err := f(tt.seq, tt.prefix)
+			if seq != tt.wantedSeq || cmd != tt.wantedCmd || err != tt.wantedErr {
+				t.Errorf("%s(%v, %v) => (%v, %v, %v), want (%v, %v, %v)",
+					funcname, tt.seq, tt.prefix,
+					seq, cmd, err,
+					tt.wantedSeq, tt.wantedCmd, tt.wantedErr)
+			}
 		}
-	}
 
-	if err := tStore.RemoveCmd(1); err != nil {
-		t.Error("Failed to remove cmd")
-	}
-	if seq, err := tStore.Cmd(1); err != storedefs.ErrNoMatchingCmd {
-		t.Errorf("Cmd(1) => (%v, %v), want (%v, %v)",
-			seq, err, "", storedefs.ErrNoMatchingCmd)
-	}
+		if err := tStore.RemoveCmd(1); err != nil {
+			t.Error("Failed to remove cmd")
+		}
+		if seq, err := tStore.Cmd(1); err != storedefs.ErrNoMatchingCmd {
+			t.Errorf("Cmd(1) => (%v, %v), want (%v, %v)",
+				seq, err, "", storedefs.ErrNoMatchingCmd)
+		}
+		if err := tStore.RemoveCmd(1); err != storedefs.ErrNoMatchingCmd {
+			t.Errorf("RemoveCmd(1) again => %v, want %v", err, storedefs.ErrNoMatchingCmd)
+		}
+	})
+}
+
+func TestCmdMeta(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		seq, err := tStore.AddCmd("echo meta")
+		if err != nil {
+			t.Fatalf("tStore.AddCmd -> error %v", err)
+		}
+		meta := storedefs.CmdMeta{
+			StartTime: time.Unix(1500000000, 0).UTC(), Duration: time.Second,
+			Dir: "/tmp", ExitStatus: 1, Session: "1-2"}
+		if err := tStore.SetCmdMeta(seq, meta); err != nil {
+			t.Errorf("tStore.SetCmdMeta -> error %v", err)
+		}
+		if err := tStore.SetCmdMeta(seq+1, meta); err != storedefs.ErrNoMatchingCmd {
+			t.Errorf("tStore.SetCmdMeta on nonexistent command -> error %v, want %v",
+				err, storedefs.ErrNoMatchingCmd)
+		}
+
+		seq2, _ := tStore.AddCmd("echo no meta")
+		meta3 := meta
+		meta3.ExitStatus = -1
+		seq3, err := tStore.AddCmdWithMeta("echo with meta", meta3)
+		if seq3 != seq2+1 || err != nil {
+			t.Errorf("tStore.AddCmdWithMeta -> (%d, %v), want (%d, nil)", seq3, err, seq2+1)
+		}
+		cmds, err := tStore.CmdsWithMeta(seq, seq3+1)
+		wantCmds := []storedefs.Cmd{
+			{Seq: seq, Text: "echo meta", Meta: &meta},
+			{Seq: seq2, Text: "echo no meta"},
+			{Seq: seq3, Text: "echo with meta", Meta: &meta3}}
+		if !reflect.DeepEqual(cmds, wantCmds) || err != nil {
+			t.Errorf("tStore.CmdsWithMeta(%d, %d) => (%v, %v), want (%v, nil)",
+				seq, seq3+1, cmds, err, wantCmds)
+		}
+	})
+}
+
+func TestAddCmdsAndDedupCmds(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		start, _ := tStore.NextCmdSeq()
+		meta := &storedefs.CmdMeta{Dir: "/tmp", ExitStatus: -1}
+		err := tStore.AddCmds([]storedefs.Cmd{
+			{Text: "dup"}, {Text: "uniq", Meta: meta}, {Text: "dup"}})
+		if err != nil {
+			t.Errorf("tStore.AddCmds -> error %v", err)
+		}
+		cmds, _ := tStore.CmdsWithMeta(start, start+3)
+		wantCmds := []storedefs.Cmd{
+			{Seq: start, Text: "dup"},
+			{Seq: start + 1, Text: "uniq", Meta: meta},
+			{Seq: start + 2, Text: "dup"}}
+		if !reflect.DeepEqual(cmds, wantCmds) {
+			t.Errorf("after AddCmds, commands are %v, want %v", cmds, wantCmds)
+		}
+
+		removed, err := tStore.DedupCmds()
+		// Duplicates from earlier tests are removed too, so only check that the
+		// earlier "dup" is among the removed ones.
+		found := false
+		for _, seq := range removed {
+			if seq == start {
+				found = true
+			}
+			if seq == start+2 {
+				t.Errorf("tStore.DedupCmds removed the last occurrence of a command")
+			}
+		}
+		if !found || err != nil {
+			t.Errorf("tStore.DedupCmds() => (%v, %v), want %d to be removed",
+				removed, err, start)
+		}
+		if _, err := tStore.Cmd(start); err != storedefs.ErrNoMatchingCmd {
+			t.Errorf("duplicate command still exists after DedupCmds")
+		}
+	})
 }
@@ -0,0 +1,27 @@
+package store
+
+import "github.com/boltdb/bolt"
+
+// BucketCompletionCache is the bucket for caching data used for completion,
+// such as options parsed from the help text of commands.
+const BucketCompletionCache = "completion-cache"
+
+// CompletionCache gets the cached completion data with the given key. It
+// returns an empty string if there is no such data.
+func (s *Store) CompletionCache(key string) (string, error) {
+	var value string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCompletionCache))
+		value = string(b.Get([]byte(key)))
+		return nil
+	})
+	return value, err
+}
+
+// SetCompletionCache caches completion data with the given key.
+func (s *Store) SetCompletionCache(key, value string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketCompletionCache))
+		return b.Put([]byte(key), []byte(value))
+	})
+}
@@ -0,0 +1,22 @@
+package store
+
+import "testing"
+
+func TestCompletionCache(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		key := "/bin/foo\x00100"
+
+		v, err := tStore.CompletionCache(key)
+		if v != "" || err != nil {
+			t.Errorf("CompletionCache(%q) -> (%q, %v), want (\"\", nil)", key, v, err)
+		}
+		err = tStore.SetCompletionCache(key, "data")
+		if err != nil {
+			t.Errorf("SetCompletionCache -> error %v", err)
+		}
+		v, err = tStore.CompletionCache(key)
+		if v != "data" || err != nil {
+			t.Errorf("CompletionCache(%q) -> (%q, %v), want (\"data\", nil)", key, v, err)
+		}
+	})
+}
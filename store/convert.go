@@ -0,0 +1,79 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// ErrCannotConvert is returned by Convert when either store is not created by
+// this package.
+var ErrCannotConvert = errors.New("can only convert between stores of this package")
+
+// backend is implemented by all storage backends in this package. The
+// additional methods give access to data that cannot be copied faithfully with
+// methods of storedefs.Store.
+type backend interface {
+	DBStore
+	rawDirs() ([]rawDir, error)
+	addRawDirs([]rawDir) error
+	// addDir implements AddDir, pruning decayed directories only if
+	// pruneDecayed is true.
+	addDir(d string, incFactor, halfLife float64, pruneDecayed bool) error
+	// schema returns the schemaDB of the database, for tests.
+	schema() schemaDB
+}
+
+var _ backend = (*Store)(nil)
+
+// Convert copies the command history, the directory history and shared
+// variables from src to dst, which are typically stores of different backends.
+// Commands are added after existing commands in dst, in their original order,
+// and get new sequence numbers. The completion cache is not copied.
+func Convert(dst, src DBStore) error {
+	srcBackend, ok1 := src.(backend)
+	dstBackend, ok2 := dst.(backend)
+	if !ok1 || !ok2 {
+		return ErrCannotConvert
+	}
+
+	next, err := src.NextCmdSeq()
+	if err != nil {
+		return err
+	}
+	cmds, err := src.CmdsWithMeta(0, next)
+	if err != nil {
+		return err
+	}
+	err = dst.AddCmds(cmds)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := srcBackend.rawDirs()
+	if err != nil {
+		return err
+	}
+	err = dstBackend.addRawDirs(dirs)
+	if err != nil {
+		return err
+	}
+
+	names, err := src.SharedVarNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := src.SharedVar(name)
+		if err == storedefs.ErrNoSharedVar {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = dst.SetSharedVar(name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+func TestConvert(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		withFakeTime(func(advance func(int)) {
+			for _, srcBackend := range testBackends {
+				for _, dstBackend := range testBackends {
+					testConvert(t, filepath.Join(dir, srcBackend+"-"+dstBackend),
+						srcBackend, dstBackend, advance)
+				}
+			}
+		})
+	})
+}
+
+func testConvert(t *testing.T, prefix, srcBackend, dstBackend string, advance func(int)) {
+	src, err := Open(srcBackend, prefix+"-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := Open(dstBackend, prefix+"-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	meta := &storedefs.CmdMeta{Dir: "/", ExitStatus: 1}
+	src.AddCmds([]storedefs.Cmd{{Text: "removed"}, {Text: "a"}, {Text: "b", Meta: meta}})
+	src.RemoveCmd(1)
+	src.AddDir("/", 1, testHalfLife)
+	advance(testHalfLife)
+	src.SetSharedVar("x", "foo")
+
+	err = Convert(dst, src)
+	if err != nil {
+		t.Errorf("Convert %s to %s -> error %v", srcBackend, dstBackend, err)
+	}
+
+	cmds, _ := dst.CmdsWithMeta(0, 100)
+	wantCmds := []storedefs.Cmd{{Seq: 1, Text: "a"}, {Seq: 2, Text: "b", Meta: meta}}
+	if !reflect.DeepEqual(cmds, wantCmds) {
+		t.Errorf("Convert %s to %s: commands are %v, want %v",
+			srcBackend, dstBackend, cmds, wantCmds)
+	}
+	// The directory score decays from when it was last updated in src.
+	dirs, _ := dst.Dirs(storedefs.NoBlacklist, testHalfLife)
+	wantDirs := []storedefs.Dir{{Path: "/", Score: scoreIncrement / 2}}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("Convert %s to %s: dirs are %v, want %v",
+			srcBackend, dstBackend, dirs, wantDirs)
+	}
+	if v, err := dst.SharedVar("x"); v != "foo" || err != nil {
+		t.Errorf("Convert %s to %s: shared var x is (%q, %v), want (\"foo\", nil)",
+			srcBackend, dstBackend, v, err)
+	}
+}
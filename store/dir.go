@@ -1,56 +1,137 @@
 package store
 
 import (
+	"math"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/elves/elvish/store/storedefs"
 )
 
 const (
-	scoreDecay     = 0.986 // roughly 0.5^(1/50)
 	scoreIncrement = 10
 	scorePrecision = 6
+	// Directories whose scores have decayed below scoreMin are removed from
+	// the history.
+	scoreMin = 0.01
+	// Decayed directories are looked for at most once per dirPruneInterval,
+	// since that needs a scan of the whole history.
+	dirPruneInterval = 24 * time.Hour
 )
 
 const BucketDir = "dir"
 
-func init() {
-	initDB["initialize directory history table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketDir))
-			return err
-		})
+// timeNow is the function used to get the current time. It is overridden in
+// tests.
+var timeNow = time.Now
+
+// Directory scores are stored along with the time they were last updated, and
+// decay exponentially over time.
+
+func marshalScore(score float64, t time.Time) []byte {
+	return []byte(strconv.FormatFloat(score, 'E', scorePrecision, 64) +
+		" " + strconv.FormatInt(t.Unix(), 10))
+}
+
+func unmarshalScore(data []byte) (float64, time.Time) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, time.Time{}
+	}
+	score, _ := strconv.ParseFloat(fields[0], 64)
+	t := timeNow()
+	if len(fields) > 1 {
+		if sec, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			t = time.Unix(sec, 0)
+		}
+	}
+	return score, t
+}
+
+// decayedScore returns the score of a directory at time now, given its score
+// at time t.
+func decayedScore(score float64, t, now time.Time, halfLife float64) float64 {
+	if halfLife <= 0 {
+		halfLife = storedefs.DefaultDirHalfLife
+	}
+	age := now.Sub(t).Seconds()
+	if age <= 0 {
+		return score
+	}
+	return score * math.Exp2(-age/halfLife)
+}
+
+// dirPruneClock records when decayed directories were last pruned.
+type dirPruneClock struct {
+	mutex sync.Mutex
+	last  time.Time
+}
+
+// due reports whether decayed directories should be pruned at time now, and if
+// so, records now as the time of the last pruning.
+func (c *dirPruneClock) due(now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.last.IsZero() && now.Sub(c.last) < dirPruneInterval {
+		return false
 	}
+	c.last = now
+	return true
 }
 
-func marshalScore(score float64) []byte {
-	return []byte(strconv.FormatFloat(score, 'E', scorePrecision, 64))
+func dirExists(d string) bool {
+	info, err := os.Stat(d)
+	return err == nil && info.IsDir()
 }
-func unmarshalScore(data []byte) float64 {
-	f, _ := strconv.ParseFloat(string(data), 64)
-	return f
+
+// AddDir adds a directory to the directory history, or increments its score
+// if it is already there. Scores decay with the given half-life, in seconds.
+// Directories with negligible scores are pruned in the meanwhile, at most once
+// per dirPruneInterval; directories that no longer exist are only pruned by
+// PruneDirs, since checking them would slow down cd.
+func (s *Store) AddDir(d string, incFactor, halfLife float64) error {
+	return s.addDir(d, incFactor, halfLife, s.dirsPruned.due(timeNow()))
 }
 
-// AddDir adds a directory to the directory history.
-func (s *Store) AddDir(d string, incFactor float64) error {
+// addDir implements AddDir, pruning decayed directories if pruneDecayed is
+// true.
+func (s *Store) addDir(d string, incFactor, halfLife float64, pruneDecayed bool) error {
+	now := timeNow()
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
 
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			score := unmarshalScore(v) * scoreDecay
-			b.Put(k, marshalScore(score))
+		if pruneDecayed {
+			var toDelete [][]byte
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if string(k) == d {
+					continue
+				}
+				score, t := unmarshalScore(v)
+				if decayedScore(score, t, now, halfLife) < scoreMin {
+					toDelete = append(toDelete, k)
+				}
+			}
+			for _, k := range toDelete {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
 		}
 
 		k := []byte(d)
 		score := float64(0)
 		if v := b.Get(k); v != nil {
-			score = unmarshalScore(v)
+			oldScore, t := unmarshalScore(v)
+			score = decayedScore(oldScore, t, now, halfLife)
 		}
 		score = score + scoreIncrement*incFactor
-		return b.Put(k, marshalScore(score))
+		return b.Put(k, marshalScore(score, now))
 	})
 }
 
@@ -58,7 +139,7 @@ func (s *Store) AddDir(d string, incFactor float64) error {
 func (s *Store) AddDirRaw(d string, score float64) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
-		return b.Put([]byte(d), marshalScore(score))
+		return b.Put([]byte(d), marshalScore(score, timeNow()))
 	})
 }
 
@@ -70,30 +151,92 @@ func (s *Store) RemoveDir(d string) error {
 	})
 }
 
+// PruneDirs removes directories that no longer exist from the directory
+// history, and returns them.
+func (s *Store) PruneDirs() ([]string, error) {
+	var pruned []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketDir))
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if !dirExists(string(k)) {
+				pruned = append(pruned, string(k))
+			}
+		}
+		for _, d := range pruned {
+			if err := b.Delete([]byte(d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return pruned, err
+}
+
 // Dirs lists all directories in the directory history whose names are not
-// in the blacklist. The results are ordered by scores in descending order.
-func (s *Store) Dirs(blacklist map[string]struct{}) ([]storedefs.Dir, error) {
-	var dirs []storedefs.Dir
+// in the blacklist, with their scores decayed with the given half-life. The
+// results are ordered by scores in descending order.
+func (s *Store) Dirs(blacklist map[string]struct{}, halfLife float64) ([]storedefs.Dir, error) {
+	raw, err := s.rawDirs()
+	if err != nil {
+		return nil, err
+	}
+	return decayedDirs(raw, blacklist, halfLife), nil
+}
+
+// rawDir is an entry in the directory history, with the score as of the time
+// it was last updated.
+type rawDir struct {
+	path  string
+	score float64
+	time  time.Time
+}
 
+func (s *Store) rawDirs() ([]rawDir, error) {
+	var dirs []rawDir
 	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketDir))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			d := string(k)
-			if _, ok := blacklist[d]; ok {
-				continue
-			}
-			dirs = append(dirs, storedefs.Dir{
-				Path:  d,
-				Score: unmarshalScore(v),
-			})
+			score, t := unmarshalScore(v)
+			dirs = append(dirs, rawDir{string(k), score, t})
 		}
-		sort.Sort(sort.Reverse(dirList(dirs)))
 		return nil
 	})
 	return dirs, err
 }
 
+func (s *Store) addRawDirs(dirs []rawDir) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketDir))
+		for _, dir := range dirs {
+			err := b.Put([]byte(dir.path), marshalScore(dir.score, dir.time))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// decayedDirs returns the directories not in the blacklist with their scores
+// decayed to the current time, ordered by scores in descending order.
+func decayedDirs(raw []rawDir, blacklist map[string]struct{}, halfLife float64) []storedefs.Dir {
+	var dirs []storedefs.Dir
+	now := timeNow()
+	for _, dir := range raw {
+		if _, ok := blacklist[dir.path]; ok {
+			continue
+		}
+		dirs = append(dirs, storedefs.Dir{
+			Path:  dir.path,
+			Score: decayedScore(dir.score, dir.time, now, halfLife),
+		})
+	}
+	sort.Sort(sort.Reverse(dirList(dirs)))
+	return dirs
+}
+
 type dirList []storedefs.Dir
 
 func (dl dirList) Len() int {
@@ -1,31 +1,100 @@
 package store
 
 import (
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
 )
 
-var (
-	dirsToAdd  = []string{"/usr/local", "/usr", "/usr/bin", "/usr"}
-	black      = map[string]struct{}{"/usr/local": {}}
-	wantedDirs = []storedefs.Dir{
-		{"/usr", scoreIncrement*scoreDecay*scoreDecay + scoreIncrement},
-		{"/usr/bin", scoreIncrement * scoreDecay}}
-)
+const testHalfLife = 100
+
+// withFakeTime runs f with timeNow returning a time that can be advanced by
+// calling the passed function.
+func withFakeTime(f func(advance func(seconds int))) {
+	now := time.Unix(1000000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	f(func(seconds int) { now = now.Add(time.Duration(seconds) * time.Second) })
+}
 
 func TestDir(t *testing.T) {
-	for _, path := range dirsToAdd {
-		err := tStore.AddDir(path, 1)
-		if err != nil {
-			t.Errorf("tStore.AddDir(%q) => %v, want <nil>", path, err)
-		}
-	}
-
-	dirs, err := tStore.Dirs(black)
-	if err != nil || !reflect.DeepEqual(dirs, wantedDirs) {
-		t.Errorf(`tStore.ListDirs() => (%v, %v), want (%v, <nil>)`,
-			dirs, err, wantedDirs)
-	}
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		util.WithTempDirs(3, func(dirs []string) {
+			withFakeTime(func(advance func(int)) {
+				a, b, c := dirs[0], dirs[1], dirs[2]
+				for _, path := range []string{c, a, b, a} {
+					err := tStore.AddDir(path, 1, testHalfLife)
+					if err != nil {
+						t.Errorf("tStore.AddDir(%q) => %v, want <nil>", path, err)
+					}
+					advance(testHalfLife)
+				}
+
+				black := map[string]struct{}{c: {}}
+				wantDirs := []storedefs.Dir{
+					{a, scoreIncrement * (1.0/8 + 1.0/2)},
+					{b, scoreIncrement * 1.0 / 4}}
+				gotDirs, err := tStore.Dirs(black, testHalfLife)
+				if err != nil || !reflect.DeepEqual(gotDirs, wantDirs) {
+					t.Errorf("tStore.Dirs() => (%v, %v), want (%v, <nil>)",
+						gotDirs, err, wantDirs)
+				}
+
+				// Negligible directories are pruned when adding directories,
+				// but at most once per dirPruneInterval.
+				advance(testHalfLife * int(math.Ceil(math.Log2(scoreIncrement/scoreMin))))
+				tStore.AddDir(c, 1, testHalfLife)
+				gotDirs, _ = tStore.Dirs(storedefs.NoBlacklist, testHalfLife)
+				if len(gotDirs) != 3 {
+					t.Errorf("tStore.Dirs() => %v before dirPruneInterval, want 3 directories", gotDirs)
+				}
+				advance(int(dirPruneInterval / time.Second))
+				tStore.AddDir(c, 1, testHalfLife)
+				gotDirs, _ = tStore.Dirs(storedefs.NoBlacklist, testHalfLife)
+				if len(gotDirs) != 1 || gotDirs[0].Path != c {
+					t.Errorf("tStore.Dirs() => %v after decaying, want only %s", gotDirs, c)
+				}
+			})
+		})
+	})
+}
+
+func TestPruneDirs(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		util.WithTempDir(func(dir string) {
+			gone := filepath.Join(dir, "gone")
+			if err := os.Mkdir(gone, 0700); err != nil {
+				panic(err)
+			}
+			tStore.AddDir(dir, 1, testHalfLife)
+			tStore.AddDir(gone, 1, testHalfLife)
+			os.Remove(gone)
+
+			// Adding a directory does not prune directories that no longer
+			// exist.
+			tStore.AddDir(dir, 1, testHalfLife)
+			dirs, _ := tStore.Dirs(storedefs.NoBlacklist, testHalfLife)
+			if len(dirs) != 2 {
+				t.Errorf("tStore.Dirs() => %v, want 2 directories", dirs)
+			}
+
+			pruned, err := tStore.PruneDirs()
+			if err != nil || !reflect.DeepEqual(pruned, []string{gone}) {
+				t.Errorf("tStore.PruneDirs() => (%v, %v), want (%v, <nil>)",
+					pruned, err, []string{gone})
+			}
+			dirs, _ = tStore.Dirs(storedefs.NoBlacklist, testHalfLife)
+			for _, d := range dirs {
+				if d.Path == gone {
+					t.Errorf("tStore.Dirs() => %v, contains pruned directory", dirs)
+				}
+			}
+		})
+	})
 }
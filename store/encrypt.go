@@ -0,0 +1,295 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// The command history can be encrypted at rest by wrapping a store with
+// NewEncryptedStore. The text and the directory of each command are encrypted
+// with AES-GCM; other data is stored as is. Commands stored before encryption
+// was enabled remain readable, and commands that cannot be decrypted, e.g.
+// because the key has changed, are left out of the command history.
+//
+// Since the store cannot search or compare encrypted commands, NextCmd,
+// PrevCmd and DedupCmds decrypt the commands and do the work themselves.
+
+// encryptedPrefix marks encrypted data. It starts with a NUL byte, which does
+// not appear in commands typed interactively.
+const encryptedPrefix = "\x00enc1:"
+
+// Number of commands read at a time when searching encrypted commands.
+const scanBatch = 256
+
+// ErrDecrypt is returned when an encrypted command cannot be decrypted.
+var ErrDecrypt = errors.New("cannot decrypt command; the history key may have changed")
+
+type encryptedStore struct {
+	DBStore
+	aead cipher.AEAD
+}
+
+// NewEncryptedStore returns a store that encrypts the command history stored
+// in st with the given 32-byte key. The returned store closes st when closed.
+func NewEncryptedStore(st DBStore, key []byte) (DBStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStore{st, aead}, nil
+}
+
+// IsEncrypted returns whether st encrypts the command history, i.e. whether it
+// is returned by NewEncryptedStore.
+func IsEncrypted(st storedefs.Store) bool {
+	_, ok := st.(*encryptedStore)
+	return ok
+}
+
+// ReadKeyFile derives a key suitable for NewEncryptedStore from the content of
+// a file, by hashing it with SHA-256. The file must not be accessible by other
+// users.
+func ReadKeyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&077 != 0 {
+		return nil, fmt.Errorf("key file %s is accessible by other users", path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	key := sha256.Sum256(content)
+	return key[:], nil
+}
+
+func (s *encryptedStore) encrypt(text string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(text), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *encryptedStore) decrypt(text string) (string, error) {
+	if !strings.HasPrefix(text, encryptedPrefix) {
+		return text, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(text[len(encryptedPrefix):])
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonceSize := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+func (s *encryptedStore) encryptMeta(meta *storedefs.CmdMeta) (*storedefs.CmdMeta, error) {
+	if meta == nil || meta.Dir == "" {
+		return meta, nil
+	}
+	encrypted := *meta
+	dir, err := s.encrypt(meta.Dir)
+	encrypted.Dir = dir
+	return &encrypted, err
+}
+
+// decryptCmd decrypts a command in place.
+func (s *encryptedStore) decryptCmd(cmd *storedefs.Cmd) error {
+	text, err := s.decrypt(cmd.Text)
+	if err != nil {
+		return err
+	}
+	cmd.Text = text
+	if cmd.Meta != nil {
+		dir, err := s.decrypt(cmd.Meta.Dir)
+		if err != nil {
+			return err
+		}
+		cmd.Meta.Dir = dir
+	}
+	return nil
+}
+
+func (s *encryptedStore) AddCmd(text string) (int, error) {
+	encrypted, err := s.encrypt(text)
+	if err != nil {
+		return 0, err
+	}
+	return s.DBStore.AddCmd(encrypted)
+}
+
+func (s *encryptedStore) AddCmdWithMeta(text string, meta storedefs.CmdMeta) (int, error) {
+	encrypted, err := s.encrypt(text)
+	if err != nil {
+		return 0, err
+	}
+	encryptedMeta, err := s.encryptMeta(&meta)
+	if err != nil {
+		return 0, err
+	}
+	return s.DBStore.AddCmdWithMeta(encrypted, *encryptedMeta)
+}
+
+func (s *encryptedStore) AddCmds(cmds []storedefs.Cmd) error {
+	encrypted := make([]storedefs.Cmd, len(cmds))
+	for i, cmd := range cmds {
+		text, err := s.encrypt(cmd.Text)
+		if err != nil {
+			return err
+		}
+		meta, err := s.encryptMeta(cmd.Meta)
+		if err != nil {
+			return err
+		}
+		encrypted[i] = storedefs.Cmd{Seq: cmd.Seq, Text: text, Meta: meta}
+	}
+	return s.DBStore.AddCmds(encrypted)
+}
+
+func (s *encryptedStore) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	encrypted, err := s.encryptMeta(&meta)
+	if err != nil {
+		return err
+	}
+	return s.DBStore.SetCmdMeta(seq, *encrypted)
+}
+
+func (s *encryptedStore) Cmd(seq int) (string, error) {
+	text, err := s.DBStore.Cmd(seq)
+	if err != nil {
+		return "", err
+	}
+	return s.decrypt(text)
+}
+
+// CmdsWithMeta returns all commands within the specified range that can be
+// decrypted, along with their sequence numbers and metadata.
+func (s *encryptedStore) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	cmds, err := s.DBStore.CmdsWithMeta(from, upto)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := cmds[:0]
+	for _, cmd := range cmds {
+		if err := s.decryptCmd(&cmd); err != nil {
+			logger.Printf("command %d: %v", cmd.Seq, err)
+			continue
+		}
+		decrypted = append(decrypted, cmd)
+	}
+	return decrypted, nil
+}
+
+func (s *encryptedStore) Cmds(from, upto int) ([]string, error) {
+	cmds, err := s.CmdsWithMeta(from, upto)
+	if err != nil {
+		return nil, err
+	}
+	var texts []string
+	for _, cmd := range cmds {
+		texts = append(texts, cmd.Text)
+	}
+	return texts, nil
+}
+
+func (s *encryptedStore) NextCmd(from int, prefix string) (int, string, error) {
+	next, err := s.NextCmdSeq()
+	if err != nil {
+		return 0, "", err
+	}
+	for lo := from; lo < next; lo += scanBatch {
+		cmds, err := s.CmdsWithMeta(lo, lo+scanBatch)
+		if err != nil {
+			return 0, "", err
+		}
+		for _, cmd := range cmds {
+			if strings.HasPrefix(cmd.Text, prefix) {
+				return cmd.Seq, cmd.Text, nil
+			}
+		}
+	}
+	return 0, "", storedefs.ErrNoMatchingCmd
+}
+
+func (s *encryptedStore) PrevCmd(upto int, prefix string) (int, string, error) {
+	next, err := s.NextCmdSeq()
+	if err != nil {
+		return 0, "", err
+	}
+	if upto > next {
+		upto = next
+	}
+	for hi := upto; hi > 0; hi -= scanBatch {
+		lo := hi - scanBatch
+		if lo < 0 {
+			lo = 0
+		}
+		cmds, err := s.CmdsWithMeta(lo, hi)
+		if err != nil {
+			return 0, "", err
+		}
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if strings.HasPrefix(cmds[i].Text, prefix) {
+				return cmds[i].Seq, cmds[i].Text, nil
+			}
+		}
+	}
+	return 0, "", storedefs.ErrNoMatchingCmd
+}
+
+func (s *encryptedStore) DedupCmds() ([]int, error) {
+	next, err := s.NextCmdSeq()
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := s.CmdsWithMeta(0, next)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var removed []int
+	for i := len(cmds) - 1; i >= 0; i-- {
+		if seen[cmds[i].Text] {
+			removed = append(removed, cmds[i].Seq)
+		} else {
+			seen[cmds[i].Text] = true
+		}
+	}
+	// Remove in ascending order, like the other implementations.
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	for i, seq := range removed {
+		if err := s.RemoveCmd(seq); err != nil {
+			return removed[:i], err
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		raw, err := Open(BackendBolt, filepath.Join(dir, "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer raw.Close()
+		raw.AddCmd("plain")
+		st, _ := NewEncryptedStore(raw, testKey)
+		seq, _ := st.AddCmd("secret")
+		st.SetCmdMeta(seq, storedefs.CmdMeta{Dir: "/secret/dir"})
+
+		// The underlying store only has the encrypted command.
+		rawCmds, _ := raw.CmdsWithMeta(seq, seq+1)
+		if len(rawCmds) != 1 || strings.Contains(rawCmds[0].Text, "secret") ||
+			strings.Contains(rawCmds[0].Meta.Dir, "secret") {
+			t.Errorf("command stored as %v", rawCmds)
+		}
+
+		// Commands stored before encryption was enabled remain readable.
+		texts, err := st.Cmds(0, seq+1)
+		if !reflect.DeepEqual(texts, []string{"plain", "secret"}) || err != nil {
+			t.Errorf("Cmds -> (%v, %v), want ([plain secret], nil)", texts, err)
+		}
+
+		// Commands that cannot be decrypted are left out.
+		otherKey := make([]byte, 32)
+		otherKey[0] = 1
+		other, _ := NewEncryptedStore(raw, otherKey)
+		texts, err = other.Cmds(0, seq+1)
+		if !reflect.DeepEqual(texts, []string{"plain"}) || err != nil {
+			t.Errorf("Cmds with another key -> (%v, %v), want ([plain], nil)", texts, err)
+		}
+		if _, err := other.Cmd(seq); err != ErrDecrypt {
+			t.Errorf("Cmd with another key -> error %v, want %v", err, ErrDecrypt)
+		}
+	})
+}
+
+func TestReadKeyFile(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "key")
+		ioutil.WriteFile(path, []byte("passphrase"), 0600)
+		key, err := ReadKeyFile(path)
+		if len(key) != 32 || err != nil {
+			t.Errorf("ReadKeyFile -> (%v, %v), want 32-byte key", key, err)
+		}
+
+		ioutil.WriteFile(path, nil, 0600)
+		if _, err := ReadKeyFile(path); err == nil {
+			t.Errorf("ReadKeyFile on empty file -> no error")
+		}
+	})
+}
@@ -0,0 +1,21 @@
+// +build !windows
+
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestReadKeyFileRejectsOpenPermissions(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		path := filepath.Join(dir, "key")
+		ioutil.WriteFile(path, []byte("passphrase"), 0644)
+		if _, err := ReadKeyFile(path); err == nil {
+			t.Errorf("ReadKeyFile on world-readable file -> no error")
+		}
+	})
+}
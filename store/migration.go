@@ -0,0 +1,189 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Each backend has a list of migrations of its schema, ordered by versions
+// starting from 1. A database with schema version v has had all migrations up
+// to version v applied; a new database has version 0, so creating the initial
+// schema is just the first migration.
+//
+// Pending migrations are applied in one transaction, and each of them is
+// recorded in the database along with the time it was applied. Before
+// upgrading a database that has been initialized, a backup of it is written
+// next to it (see BackupPath).
+
+// Migration describes a migration of the schema.
+type Migration struct {
+	// Schema version after the migration.
+	Version     int
+	Description string
+}
+
+// MigrationRecord is a migration that has been applied to a database.
+type MigrationRecord struct {
+	Migration
+	// When the migration was applied. It is zero if the migration was applied
+	// before migrations were recorded.
+	Time time.Time
+}
+
+// MigrationStatus is the status of the schema of a database.
+type MigrationStatus struct {
+	Backend string
+	// Schema version of the database, or 0 if it has not been initialized.
+	Version int
+	// Latest schema version.
+	LatestVersion int
+	Applied       []MigrationRecord
+	Pending       []Migration
+}
+
+// ErrNoDB is returned by CheckMigrations and DryRunMigrations when the
+// database does not exist.
+var ErrNoDB = errors.New("database does not exist")
+
+// Returned from transactions to roll them back in dry runs.
+var errDryRun = errors.New("dry run")
+
+// schemaDB is implemented by the databases of each backend.
+type schemaDB interface {
+	migrations() []Migration
+	schemaVersion() (int, error)
+	// migrationRecords returns the recorded migrations, ordered by versions.
+	migrationRecords() ([]MigrationRecord, error)
+	// applyMigrations applies all migrations after the given version in one
+	// transaction, and records them. If dryRun is true, the transaction is
+	// rolled back.
+	applyMigrations(from int, dryRun bool) error
+	// backup writes a consistent copy of the database to a file.
+	backup(path string) error
+	Close() error
+}
+
+// BackupPath returns the path of the backup made before upgrading the database
+// at dbpath from the given schema version.
+func BackupPath(dbpath string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", dbpath, version)
+}
+
+func latestVersion(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// upgradeSchema applies the pending migrations to a database, backing it up
+// first if it has been initialized.
+func upgradeSchema(db schemaDB, dbpath string) error {
+	version, err := db.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version >= latestVersion(db.migrations()) {
+		logger.Println("DB schema up to date")
+		return nil
+	}
+	if version > 0 {
+		backupPath := BackupPath(dbpath, version)
+		logger.Println("backing up database to", backupPath)
+		os.Remove(backupPath)
+		err := db.backup(backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to back up database: %v", err)
+		}
+	}
+	return db.applyMigrations(version, false)
+}
+
+func migrationStatus(db schemaDB, backend string) (*MigrationStatus, error) {
+	version, err := db.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	records, err := db.migrationRecords()
+	if err != nil {
+		return nil, err
+	}
+	recordTimes := make(map[int]time.Time)
+	for _, record := range records {
+		recordTimes[record.Version] = record.Time
+	}
+
+	migrations := db.migrations()
+	status := &MigrationStatus{
+		Backend: backend, Version: version,
+		LatestVersion: latestVersion(migrations)}
+	for _, m := range migrations {
+		if m.Version <= version {
+			status.Applied = append(status.Applied,
+				MigrationRecord{m, recordTimes[m.Version]})
+		} else {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status, nil
+}
+
+// openSchemaDB opens an existing database without migrating it.
+func openSchemaDB(backend, dbpath string) (schemaDB, string, error) {
+	detected, err := DetectBackend(dbpath)
+	if err != nil {
+		return nil, "", err
+	}
+	if detected == "" {
+		return nil, "", ErrNoDB
+	}
+	if backend != "" && backend != detected {
+		return nil, "", fmt.Errorf("%s is a %s database, not %s", dbpath, detected, backend)
+	}
+	switch detected {
+	case BackendBolt:
+		db, err := DefaultDB(dbpath)
+		if err != nil {
+			return nil, "", err
+		}
+		return boltSchema{db}, detected, nil
+	default:
+		db, err := openSQLiteSchemaDB(dbpath)
+		if err != nil {
+			return nil, "", err
+		}
+		return db, detected, nil
+	}
+}
+
+// CheckMigrations returns the migration status of an existing database,
+// without migrating it.
+func CheckMigrations(backend, dbpath string) (*MigrationStatus, error) {
+	db, backend, err := openSchemaDB(backend, dbpath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrationStatus(db, backend)
+}
+
+// DryRunMigrations applies the pending migrations to an existing database and
+// rolls them back. It returns the migration status of the database, and any
+// error encountered when applying the migrations.
+func DryRunMigrations(backend, dbpath string) (*MigrationStatus, error) {
+	db, backend, err := openSchemaDB(backend, dbpath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	status, err := migrationStatus(db, backend)
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Pending) == 0 {
+		return status, nil
+	}
+	return status, db.applyMigrations(status.Version, true)
+}
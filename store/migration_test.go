@@ -0,0 +1,80 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func TestMigrationLists(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		b, ok := tStore.(backend)
+		if !ok {
+			t.Skip("not a backend")
+		}
+		db := b.schema()
+		migrations := db.migrations()
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("migration %d has version %d", i, m.Version)
+			}
+		}
+		version, err := db.schemaVersion()
+		if latest := latestVersion(migrations); version != latest || err != nil {
+			t.Errorf("new database has version (%d, %v), want latest migration %d",
+				version, err, latest)
+		}
+	})
+}
+
+func TestCheckMigrations(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		if _, err := CheckMigrations("", filepath.Join(dir, "nonexistent")); err != ErrNoDB {
+			t.Errorf("CheckMigrations on nonexistent database -> error %v, want %v",
+				err, ErrNoDB)
+		}
+		for _, backend := range testBackends {
+			dbpath := filepath.Join(dir, backend)
+			st, err := Open(backend, dbpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st.Close()
+			for _, f := range []func(string, string) (*MigrationStatus, error){
+				CheckMigrations, DryRunMigrations} {
+				status, err := f("", dbpath)
+				if err != nil || status.Backend != backend ||
+					status.Version != status.LatestVersion || len(status.Pending) != 0 {
+					t.Errorf("status of new %s database is (%v, %v), want up to date",
+						backend, status, err)
+				}
+			}
+		}
+	})
+}
+
+func TestBackup(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		b, ok := tStore.(backend)
+		if !ok {
+			t.Skip("not a backend")
+		}
+		db := b.schema()
+		tStore.AddCmd("echo backup")
+		util.WithTempDir(func(dir string) {
+			backup := filepath.Join(dir, "backup")
+			if err := db.backup(backup); err != nil {
+				t.Fatalf("backup -> error %v", err)
+			}
+			st, err := Open("", backup)
+			if err != nil {
+				t.Fatalf("Open on backup -> error %v", err)
+			}
+			defer st.Close()
+			if cmd, err := st.Cmd(1); cmd != "echo backup" || err != nil {
+				t.Errorf("Cmd(1) on backup -> (%q, %v), want (\"echo backup\", nil)", cmd, err)
+			}
+		})
+	})
+}
@@ -1,47 +1,199 @@
 package store
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 
 	"github.com/boltdb/bolt"
 )
 
-// SchemaVersion is the current schema version. It should be bumped every time a
-// backwards-incompatible change has been made to the schema.
-const SchemaVersion = 1
+// SchemaVersion is the current schema version of Bolt databases. It should be
+// bumped every time a backwards-incompatible change has been made to the
+// schema, and a migration to the new version should be added to
+// boltMigrations.
+const SchemaVersion = 4
 
-const BucketSchema = "schema"
+const (
+	BucketSchema = "schema"
+	// BucketMigration records applied migrations, keyed by the schema
+	// versions after the migrations like BucketCmd. The values are
+	// JSON-encoded MigrationRecord.
+	BucketMigration = "migration"
+)
 
-func init() {
-	initDB["record schema version"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			b, err := tx.CreateBucketIfNotExists([]byte(BucketSchema))
-			if err != nil {
-				return err
+type boltMigration struct {
+	Migration
+	migrate func(tx *bolt.Tx) error
+}
+
+// boltMigrations contains all migrations of Bolt databases; see comments in
+// migration.go.
+var boltMigrations = []boltMigration{
+	{Migration{1, "create command history, directory history and shared variable buckets"},
+		func(tx *bolt.Tx) error {
+			for _, name := range []string{BucketCmd, BucketDir, BucketSharedVar} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
 			}
-			return b.Put([]byte("schema"), []byte(strconv.FormatUint(uint64(SchemaVersion), 10)))
-		})
+			return nil
+		}},
+	{Migration{2, "add metadata to the command history"},
+		func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(BucketCmdMeta))
+			return err
+		}},
+	{Migration{3, "add the completion cache"},
+		func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(BucketCompletionCache))
+			return err
+		}},
+	{Migration{4, "record when directory scores were last updated"},
+		func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(BucketDir))
+			if b == nil {
+				return nil
+			}
+			now := timeNow()
+			updated := make(map[string][]byte)
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				score, _ := unmarshalScore(v)
+				updated[string(k)] = marshalScore(score, now)
+			}
+			for k, v := range updated {
+				if err := b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+}
+
+func putSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(BucketSchema))
+	if err != nil {
+		return err
 	}
+	return b.Put([]byte("version"), []byte(strconv.Itoa(version)))
 }
 
-// SchemaUpToDate returns whether the database has the current or newer version
-// of the schema.
-func SchemaUpToDate(db *bolt.DB) bool {
-	var version uint64
-	err := db.View(func(tx *bolt.Tx) error {
+// schemaVersion returns the schema version of the database, or 0 if the
+// database has not been initialized.
+func schemaVersion(db *bolt.DB) int {
+	var version int
+	db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketSchema))
 		if b == nil {
-			return ErrInvalidBucket
+			return nil
 		}
-		if v := b.Get([]byte("version")); v != nil {
-			version, _ = strconv.ParseUint(string(v), 0, 0)
+		v := b.Get([]byte("version"))
+		if v == nil {
+			// Version 1 databases recorded the version under a different key.
+			v = b.Get([]byte("schema"))
+		}
+		if v != nil {
+			version, _ = strconv.Atoi(string(v))
 		}
 		return nil
 	})
+	return version
+}
 
-	if err != nil {
-		return false
+// SchemaUpToDate returns whether the database has the current or newer version
+// of the schema.
+func SchemaUpToDate(db *bolt.DB) bool {
+	return schemaVersion(db) >= SchemaVersion
+}
+
+// boltSchema implements schemaDB for Bolt databases.
+type boltSchema struct {
+	db *bolt.DB
+}
+
+func (s *Store) schema() schemaDB {
+	return boltSchema{s.db}
+}
+
+func (b boltSchema) migrations() []Migration {
+	migrations := make([]Migration, len(boltMigrations))
+	for i, m := range boltMigrations {
+		migrations[i] = m.Migration
 	}
+	return migrations
+}
+
+func (b boltSchema) schemaVersion() (int, error) {
+	return schemaVersion(b.db), nil
+}
+
+func (b boltSchema) migrationRecords() ([]MigrationRecord, error) {
+	var records []MigrationRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BucketMigration))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var record MigrationRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				logger.Printf("bad record of migration %d: %v", unmarshalSeq(k), err)
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (b boltSchema) applyMigrations(from int, dryRun bool) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		records, err := tx.CreateBucketIfNotExists([]byte(BucketMigration))
+		if err != nil {
+			return err
+		}
+		version := from
+		for _, m := range boltMigrations {
+			if m.Version <= from {
+				continue
+			}
+			logger.Printf("migrating schema to version %d: %s", m.Version, m.Description)
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("migrating to schema version %d: %v", m.Version, err)
+			}
+			data, err := json.Marshal(MigrationRecord{m.Migration, timeNow()})
+			if err != nil {
+				return err
+			}
+			err = records.Put(marshalSeq(uint64(m.Version)), data)
+			if err != nil {
+				return err
+			}
+			version = m.Version
+		}
+		err = putSchemaVersion(tx, version)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+	return err
+}
+
+func (b boltSchema) backup(path string) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
 
-	return version == SchemaVersion
+func (b boltSchema) Close() error {
+	return b.db.Close()
 }
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestMigrateFromVersion1(t *testing.T) {
+	f, err := ioutil.TempFile("", "elvish.test")
+	if err != nil {
+		t.Fatalf("Failed to open temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	db, err := DefaultDB(f.Name())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Set up a database that looks like one with version 1 of the schema.
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{BucketCmd, BucketDir, BucketSharedVar} {
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		// Directory scores used to be stored without timestamps.
+		err := tx.Bucket([]byte(BucketDir)).Put([]byte("/"), []byte("1.000000E+01"))
+		if err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket([]byte(BucketSchema))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("schema"), []byte("1"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to set up database: %v", err)
+	}
+
+	if SchemaUpToDate(db) {
+		t.Errorf("SchemaUpToDate -> true for version 1 database")
+	}
+
+	// Check and dry-run the migrations with the database closed, since Bolt
+	// databases cannot be opened twice.
+	db.Close()
+	status, err := CheckMigrations("", f.Name())
+	if err != nil || status.Version != 1 || len(status.Pending) != SchemaVersion-1 {
+		t.Errorf("CheckMigrations -> (%v, %v), want version 1 with %d pending migrations",
+			status, err, SchemaVersion-1)
+	}
+	status, err = DryRunMigrations("", f.Name())
+	if err != nil || status.Version != 1 {
+		t.Errorf("DryRunMigrations -> (%v, %v), want version 1 and no error", status, err)
+	}
+	if status, _ := CheckMigrations("", f.Name()); status.Version != 1 {
+		t.Errorf("schema version %d after dry run, want 1", status.Version)
+	}
+
+	db, err = DefaultDB(f.Name())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	st, err := NewStoreDB(db)
+	if err != nil {
+		t.Fatalf("NewStoreDB -> error %v", err)
+	}
+	if !SchemaUpToDate(db) {
+		t.Errorf("SchemaUpToDate -> false after migration")
+	}
+	seq, _ := st.AddCmd("echo")
+	if _, err := st.CmdsWithMeta(seq, seq+1); err != nil {
+		t.Errorf("CmdsWithMeta -> error %v after migration", err)
+	}
+	dirs, err := st.Dirs(nil, 0)
+	if err != nil || len(dirs) != 1 || math.Abs(dirs[0].Score-10) > 0.01 {
+		t.Errorf("Dirs -> (%v, %v) after migration, want score of 10", dirs, err)
+	}
+	st.Close()
+
+	// The database was backed up before migrating.
+	backup := BackupPath(f.Name(), 1)
+	defer os.Remove(backup)
+	if status, err := CheckMigrations("", backup); err != nil || status.Version != 1 {
+		t.Errorf("CheckMigrations on backup -> (%v, %v), want version 1", status, err)
+	}
+
+	// Applied migrations are recorded.
+	status, err = CheckMigrations("", f.Name())
+	if err != nil || status.Version != SchemaVersion || len(status.Pending) != 0 {
+		t.Fatalf("CheckMigrations after migration -> (%v, %v)", status, err)
+	}
+	for _, record := range status.Applied {
+		if record.Time.IsZero() != (record.Version == 1) {
+			t.Errorf("migration to version %d recorded at %v", record.Version, record.Time)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// A shared store opens the database for each operation and closes it
+// afterwards, so that several processes can use the database without a
+// daemon. While another process is using the database, opening it blocks for
+// a while (see DefaultDB and openSQLite); if it still fails because the
+// database is locked, the operation is retried.
+//
+// A daemon keeps the database open, so a Bolt database cannot be used by a
+// shared store while a daemon is running. Operations then fail with
+// storedefs.ErrDBLocked, upon which clients switch to the daemon (see
+// daemon.NewLocalClient). Conversely, a daemon that starts while a shared
+// store is using the database keeps trying to open it (see daemon.Serve).
+
+const (
+	sharedRetries       = 3
+	sharedRetryInterval = 100 * time.Millisecond
+)
+
+type sharedStore struct {
+	backend string
+	dbpath  string
+	// When decayed directories were last pruned. It is kept here since the
+	// stores opened for each operation are short-lived.
+	dirsPruned dirPruneClock
+}
+
+var _ DBStore = (*sharedStore)(nil)
+
+// OpenShared opens a store that only keeps the database open during each
+// operation. Like Open, it creates the database if it does not exist, and
+// detects the backend of an existing database if backend is empty. It fails
+// if the database is locked, e.g. because a daemon is using it.
+func OpenShared(backend, dbpath string) (DBStore, error) {
+	st, err := Open(backend, dbpath)
+	if IsLocked(err) {
+		return nil, storedefs.ErrDBLocked
+	} else if err != nil {
+		return nil, err
+	}
+	err = st.Close()
+	if err != nil {
+		return nil, err
+	}
+	backend, err = DetectBackend(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	return &sharedStore{backend: backend, dbpath: dbpath}, nil
+}
+
+// IsLocked returns whether an error is caused by another process using the
+// database.
+func IsLocked(err error) bool {
+	return err == bolt.ErrTimeout || err == storedefs.ErrDBLocked || isSQLiteLocked(err)
+}
+
+// do opens the database, calls f with it and closes it, retrying if the
+// database is locked.
+func (s *sharedStore) do(f func(DBStore) error) error {
+	var err error
+	for i := 0; i < sharedRetries; i++ {
+		if i > 0 {
+			logger.Printf("database is locked, retrying: %v", err)
+			time.Sleep(sharedRetryInterval)
+		}
+		var st DBStore
+		st, err = Open(s.backend, s.dbpath)
+		if err == nil {
+			err = f(st)
+			closeErr := st.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		if !IsLocked(err) {
+			return err
+		}
+	}
+	logger.Printf("database is still locked, giving up: %v", err)
+	return storedefs.ErrDBLocked
+}
+
+// Close does nothing, since the database is only open during operations.
+func (s *sharedStore) Close() error {
+	return nil
+}
+
+func (s *sharedStore) Stats() (stats *storedefs.DBStats, err error) {
+	err = s.do(func(st DBStore) error {
+		stats, err = st.Stats()
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) Compact() error {
+	return s.do(func(st DBStore) error { return st.Compact() })
+}
+
+func (s *sharedStore) NextCmdSeq() (seq int, err error) {
+	err = s.do(func(st DBStore) error {
+		seq, err = st.NextCmdSeq()
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) AddCmd(text string) (seq int, err error) {
+	err = s.do(func(st DBStore) error {
+		seq, err = st.AddCmd(text)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) AddCmdWithMeta(text string, meta storedefs.CmdMeta) (seq int, err error) {
+	err = s.do(func(st DBStore) error {
+		seq, err = st.AddCmdWithMeta(text, meta)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) AddCmds(cmds []storedefs.Cmd) error {
+	return s.do(func(st DBStore) error { return st.AddCmds(cmds) })
+}
+
+func (s *sharedStore) RemoveCmd(seq int) error {
+	return s.do(func(st DBStore) error { return st.RemoveCmd(seq) })
+}
+
+func (s *sharedStore) DedupCmds() (removed []int, err error) {
+	err = s.do(func(st DBStore) error {
+		removed, err = st.DedupCmds()
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) Cmd(seq int) (text string, err error) {
+	err = s.do(func(st DBStore) error {
+		text, err = st.Cmd(seq)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) Cmds(from, upto int) (cmds []string, err error) {
+	err = s.do(func(st DBStore) error {
+		cmds, err = st.Cmds(from, upto)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) NextCmd(from int, prefix string) (seq int, text string, err error) {
+	err = s.do(func(st DBStore) error {
+		seq, text, err = st.NextCmd(from, prefix)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) PrevCmd(upto int, prefix string) (seq int, text string, err error) {
+	err = s.do(func(st DBStore) error {
+		seq, text, err = st.PrevCmd(upto, prefix)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) CmdsWithMeta(from, upto int) (cmds []storedefs.Cmd, err error) {
+	err = s.do(func(st DBStore) error {
+		cmds, err = st.CmdsWithMeta(from, upto)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	return s.do(func(st DBStore) error { return st.SetCmdMeta(seq, meta) })
+}
+
+func (s *sharedStore) AddDir(dir string, incFactor, halfLife float64) error {
+	pruneDecayed := s.dirsPruned.due(timeNow())
+	return s.do(func(st DBStore) error {
+		return st.(backend).addDir(dir, incFactor, halfLife, pruneDecayed)
+	})
+}
+
+func (s *sharedStore) Dirs(blacklist map[string]struct{}, halfLife float64) (dirs []storedefs.Dir, err error) {
+	err = s.do(func(st DBStore) error {
+		dirs, err = st.Dirs(blacklist, halfLife)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) PruneDirs() (pruned []string, err error) {
+	err = s.do(func(st DBStore) error {
+		pruned, err = st.PruneDirs()
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) SharedVar(name string) (value string, err error) {
+	err = s.do(func(st DBStore) error {
+		value, err = st.SharedVar(name)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) SharedVarNames() (names []string, err error) {
+	err = s.do(func(st DBStore) error {
+		names, err = st.SharedVarNames()
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) SetSharedVar(name, value string) error {
+	return s.do(func(st DBStore) error { return st.SetSharedVar(name, value) })
+}
+
+func (s *sharedStore) DelSharedVar(name string) error {
+	return s.do(func(st DBStore) error { return st.DelSharedVar(name) })
+}
+
+func (s *sharedStore) CompletionCache(key string) (value string, err error) {
+	err = s.do(func(st DBStore) error {
+		value, err = st.CompletionCache(key)
+		return err
+	})
+	return
+}
+
+func (s *sharedStore) SetCompletionCache(key, value string) error {
+	return s.do(func(st DBStore) error { return st.SetCompletionCache(key, value) })
+}
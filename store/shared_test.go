@@ -0,0 +1,64 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/elves/elvish/store/storedefs"
+	"github.com/elves/elvish/util"
+)
+
+func TestSharedStoreConcurrentUse(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			util.WithTempDir(func(dir string) {
+				dbpath := filepath.Join(dir, "db")
+				// Like two shells sharing the database.
+				var stores [2]DBStore
+				for i := range stores {
+					st, err := OpenShared(backend, dbpath)
+					if err != nil {
+						t.Fatalf("OpenShared -> error %v", err)
+					}
+					stores[i] = st
+				}
+
+				var wg sync.WaitGroup
+				for _, st := range stores {
+					wg.Add(1)
+					go func(st DBStore) {
+						defer wg.Done()
+						for i := 0; i < 20; i++ {
+							_, err := st.AddCmd("cmd")
+							if err != nil {
+								t.Errorf("AddCmd -> error %v", err)
+							}
+						}
+					}(st)
+				}
+				wg.Wait()
+
+				next, err := stores[0].NextCmdSeq()
+				if next != 41 || err != nil {
+					t.Errorf("NextCmdSeq -> (%v, %v), want (41, nil)", next, err)
+				}
+			})
+		})
+	}
+}
+
+func TestOpenSharedFailsWhenLocked(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		dbpath := filepath.Join(dir, "db")
+		st, err := Open(BackendBolt, dbpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer st.Close()
+		_, err = OpenShared("", dbpath)
+		if err != storedefs.ErrDBLocked {
+			t.Errorf("OpenShared on locked database -> error %v, want %v", err, storedefs.ErrDBLocked)
+		}
+	})
+}
@@ -1,25 +1,15 @@
 package store
 
 import (
-	"errors"
-
 	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
 )
 
-// ErrNoVar is returned by (*Store).GetSharedVar when there is no such variable.
-var ErrNoVar = errors.New("no such variable")
+// ErrNoVar is returned by (*Store).SharedVar when there is no such variable.
+var ErrNoVar = storedefs.ErrNoSharedVar
 
 const BucketSharedVar = "shared_var"
 
-func init() {
-	initDB["initialize shared variable table"] = func(db *bolt.DB) error {
-		return db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists([]byte(BucketSharedVar))
-			return err
-		})
-	}
-}
-
 // SharedVar gets the value of a shared variable.
 func (s *Store) SharedVar(n string) (string, error) {
 	var value string
@@ -35,6 +25,20 @@ func (s *Store) SharedVar(n string) (string, error) {
 	return value, err
 }
 
+// SharedVarNames returns the names of all shared variables, in lexicographical
+// order.
+func (s *Store) SharedVarNames() ([]string, error) {
+	var names []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketSharedVar))
+		return b.ForEach(func(k, v []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	return names, err
+}
+
 // SetSharedVar sets the value of a shared variable.
 func (s *Store) SetSharedVar(n, v string) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
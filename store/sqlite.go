@@ -0,0 +1,724 @@
+// +build cgo
+
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elves/elvish/store/storedefs"
+
+	// Also registers the "sqlite3" driver.
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore is a storage backend using SQLite. Unlike the Bolt backend, it
+// does not lock the whole database file, so the database can be inspected
+// with other tools while it is in use. It is only available in builds with
+// cgo; see sqlite_nocgo.go.
+//
+// The command history is kept in the cmd table, with the metadata of commands
+// in the meta column as JSON-encoded storedefs.CmdMeta. The directory history
+// is kept in the dir table, with scores as of the times in the time column (in
+// seconds since epoch). Shared variables and the completion cache are kept in
+// the shared_var and completion_cache tables.
+type SQLiteStore struct {
+	db *sql.DB
+	// When decayed directories were last pruned.
+	dirsPruned dirPruneClock
+}
+
+var (
+	_ DBStore = (*SQLiteStore)(nil)
+	_ backend = (*SQLiteStore)(nil)
+)
+
+// SQLiteSchemaVersion is the current schema version of SQLite databases. It
+// is stored as the user_version of the database.
+const SQLiteSchemaVersion = 1
+
+// sqliteMigrations contains all migrations of SQLite databases; see comments
+// in migration.go. Applied migrations are recorded in the migration table.
+var sqliteMigrations = []sqliteMigration{
+	{Migration{1, "create tables"}, []string{
+		`CREATE TABLE cmd (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			meta TEXT)`,
+		`CREATE TABLE dir (
+			path TEXT PRIMARY KEY,
+			score REAL NOT NULL,
+			time INTEGER NOT NULL)`,
+		`CREATE TABLE shared_var (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL)`,
+		`CREATE TABLE completion_cache (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL)`,
+	}},
+}
+
+type sqliteMigration struct {
+	Migration
+	stmts []string
+}
+
+// NewSQLiteStore creates a new SQLiteStore with the database at dbpath,
+// creating it if it does not exist.
+func NewSQLiteStore(dbpath string) (*SQLiteStore, error) {
+	logger.Println("initializing SQLite store")
+	defer logger.Println("initialized SQLite store")
+	db, err := openSQLite(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	err = upgradeSchema(sqliteSchemaDB{db}, dbpath)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func openSQLiteStore(dbpath string) (DBStore, error) {
+	st, err := NewSQLiteStore(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func openSQLiteSchemaDB(dbpath string) (schemaDB, error) {
+	db, err := openSQLite(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteSchemaDB{db}, nil
+}
+
+func openSQLite(dbpath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(dbpath))
+	if err != nil {
+		return nil, err
+	}
+	// Requests are serialized, like with the Bolt backend.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// sqliteDSN returns the data source name for a database at dbpath. The path
+// is written as a file: URI, so that characters like ? and # in it are not
+// taken as the start of the parameters.
+func sqliteDSN(dbpath string) string {
+	u := url.URL{
+		Scheme:   "file",
+		Path:     dbpath,
+		RawQuery: "_busy_timeout=1000&_journal_mode=WAL&_txlock=immediate",
+	}
+	return u.String()
+}
+
+// isSQLiteLocked returns whether an error is caused by another process using
+// a SQLite database.
+func isSQLiteLocked(err error) bool {
+	if e, ok := err.(sqlite3.Error); ok {
+		return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// inTx calls f in a transaction, which is committed if f returns nil and
+// rolled back otherwise.
+func inTx(db *sql.DB, f func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteSchemaDB implements schemaDB for SQLite databases.
+type sqliteSchemaDB struct {
+	db *sql.DB
+}
+
+func (s *SQLiteStore) schema() schemaDB {
+	return sqliteSchemaDB{s.db}
+}
+
+func (s sqliteSchemaDB) migrations() []Migration {
+	migrations := make([]Migration, len(sqliteMigrations))
+	for i, m := range sqliteMigrations {
+		migrations[i] = m.Migration
+	}
+	return migrations
+}
+
+func (s sqliteSchemaDB) schemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+func (s sqliteSchemaDB) migrationRecords() ([]MigrationRecord, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name = 'migration'`).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	rows, err := s.db.Query(
+		"SELECT version, description, time FROM migration ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []MigrationRecord
+	for rows.Next() {
+		var (
+			record MigrationRecord
+			sec    int64
+		)
+		err := rows.Scan(&record.Version, &record.Description, &sec)
+		if err != nil {
+			return nil, err
+		}
+		record.Time = time.Unix(sec, 0)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s sqliteSchemaDB) applyMigrations(from int, dryRun bool) error {
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS migration (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			time INTEGER NOT NULL)`)
+		if err != nil {
+			return err
+		}
+		version := from
+		for _, m := range sqliteMigrations {
+			if m.Version <= from {
+				continue
+			}
+			logger.Printf("migrating schema to version %d: %s", m.Version, m.Description)
+			for _, stmt := range m.stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return fmt.Errorf("migrating to schema version %d: %v", m.Version, err)
+				}
+			}
+			_, err := tx.Exec("INSERT OR REPLACE INTO migration VALUES (?, ?, ?)",
+				m.Version, m.Description, timeNow().Unix())
+			if err != nil {
+				return err
+			}
+			version = m.Version
+		}
+		// PRAGMA statements do not support parameters.
+		_, err = tx.Exec("PRAGMA user_version = " + strconv.Itoa(version))
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+	return err
+}
+
+func (s sqliteSchemaDB) backup(path string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+func (s sqliteSchemaDB) Close() error {
+	return s.db.Close()
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// NextCmdSeq returns the next sequence number of the command history.
+func (s *SQLiteStore) NextCmdSeq() (int, error) {
+	var seq int
+	err := s.db.QueryRow(
+		"SELECT seq FROM sqlite_sequence WHERE name = 'cmd'").Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 1, nil
+	}
+	return seq + 1, err
+}
+
+// AddCmd adds a new command to the command history.
+func (s *SQLiteStore) AddCmd(cmd string) (int, error) {
+	res, err := s.db.Exec("INSERT INTO cmd (text) VALUES (?)", cmd)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := res.LastInsertId()
+	return int(seq), err
+}
+
+// AddCmdWithMeta adds a new command along with its metadata to the command
+// history.
+func (s *SQLiteStore) AddCmdWithMeta(cmd string, meta storedefs.CmdMeta) (int, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.Exec(
+		"INSERT INTO cmd (text, meta) VALUES (?, ?)", cmd, string(data))
+	if err != nil {
+		return 0, err
+	}
+	seq, err := res.LastInsertId()
+	return int(seq), err
+}
+
+// AddCmds adds commands along with their metadata to the command history, in
+// one transaction. The Seq fields of the commands are ignored; new sequence
+// numbers are allocated for them.
+func (s *SQLiteStore) AddCmds(cmds []storedefs.Cmd) error {
+	return inTx(s.db, func(tx *sql.Tx) error {
+		for _, cmd := range cmds {
+			var meta interface{}
+			if cmd.Meta != nil {
+				data, err := json.Marshal(cmd.Meta)
+				if err != nil {
+					return err
+				}
+				meta = string(data)
+			}
+			_, err := tx.Exec(
+				"INSERT INTO cmd (text, meta) VALUES (?, ?)", cmd.Text, meta)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DedupCmds removes all but the last occurrence of each command from the
+// command history. It returns the sequence numbers of the removed commands.
+func (s *SQLiteStore) DedupCmds() ([]int, error) {
+	var removed []int
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		removed = nil
+		rows, err := tx.Query(`SELECT seq FROM cmd WHERE seq NOT IN
+			(SELECT MAX(seq) FROM cmd GROUP BY text) ORDER BY seq`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var seq int
+			if err := rows.Scan(&seq); err != nil {
+				rows.Close()
+				return err
+			}
+			removed = append(removed, seq)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, seq := range removed {
+			if _, err := tx.Exec("DELETE FROM cmd WHERE seq = ?", seq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// RemoveCmd removes a command from command history referenced by
+// sequence. It returns storedefs.ErrNoMatchingCmd if there is no such command.
+func (s *SQLiteStore) RemoveCmd(seq int) error {
+	res, err := s.db.Exec("DELETE FROM cmd WHERE seq = ?", seq)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storedefs.ErrNoMatchingCmd
+	}
+	return nil
+}
+
+// SetCmdMeta sets the metadata of the command with the specified sequence
+// number.
+func (s *SQLiteStore) SetCmdMeta(seq int, meta storedefs.CmdMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(
+		"UPDATE cmd SET meta = ? WHERE seq = ?", string(data), seq)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storedefs.ErrNoMatchingCmd
+	}
+	return nil
+}
+
+// CmdsWithMeta returns all commands within the specified range, along with
+// their sequence numbers and metadata.
+func (s *SQLiteStore) CmdsWithMeta(from, upto int) ([]storedefs.Cmd, error) {
+	rows, err := s.db.Query(`SELECT seq, text, meta FROM cmd
+		WHERE seq >= ? AND seq < ? ORDER BY seq`, from, upto)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cmds []storedefs.Cmd
+	for rows.Next() {
+		var (
+			cmd  storedefs.Cmd
+			meta sql.NullString
+		)
+		if err := rows.Scan(&cmd.Seq, &cmd.Text, &meta); err != nil {
+			return nil, err
+		}
+		if meta.Valid {
+			cmd.Meta = &storedefs.CmdMeta{}
+			if err := json.Unmarshal([]byte(meta.String), cmd.Meta); err != nil {
+				logger.Printf("bad metadata for command %d: %v", cmd.Seq, err)
+				cmd.Meta = nil
+			}
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
+
+// Cmd queries the command history item with the specified sequence number.
+func (s *SQLiteStore) Cmd(seq int) (string, error) {
+	var cmd string
+	err := s.db.QueryRow("SELECT text FROM cmd WHERE seq = ?", seq).Scan(&cmd)
+	if err == sql.ErrNoRows {
+		return "", storedefs.ErrNoMatchingCmd
+	}
+	return cmd, err
+}
+
+// Cmds returns the contents of all commands within the specified range.
+func (s *SQLiteStore) Cmds(from, upto int) ([]string, error) {
+	rows, err := s.db.Query(
+		"SELECT text FROM cmd WHERE seq >= ? AND seq < ? ORDER BY seq", from, upto)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cmds []string
+	for rows.Next() {
+		var cmd string
+		if err := rows.Scan(&cmd); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
+
+// Commands are compared with prefixes as blobs, so that the comparison is
+// bytewise like in the Bolt backend.
+const hasPrefix = "substr(CAST(text AS BLOB), 1, ?) = CAST(? AS BLOB)"
+
+// NextCmd finds the first command after the given sequence number (inclusive)
+// with the given prefix.
+func (s *SQLiteStore) NextCmd(from int, prefix string) (int, string, error) {
+	return s.findCmd(`SELECT seq, text FROM cmd WHERE seq >= ? AND `+hasPrefix+`
+		ORDER BY seq LIMIT 1`, from, len(prefix), prefix)
+}
+
+// PrevCmd finds the last command before the given sequence number (exclusive)
+// with the given prefix.
+func (s *SQLiteStore) PrevCmd(upto int, prefix string) (int, string, error) {
+	return s.findCmd(`SELECT seq, text FROM cmd WHERE seq < ? AND `+hasPrefix+`
+		ORDER BY seq DESC LIMIT 1`, upto, len(prefix), prefix)
+}
+
+func (s *SQLiteStore) findCmd(query string, args ...interface{}) (int, string, error) {
+	var (
+		seq int
+		cmd string
+	)
+	err := s.db.QueryRow(query, args...).Scan(&seq, &cmd)
+	if err == sql.ErrNoRows {
+		return 0, "", storedefs.ErrNoMatchingCmd
+	} else if err != nil {
+		return 0, "", err
+	}
+	return seq, cmd, nil
+}
+
+// AddDir adds a directory to the directory history, or increments its score
+// if it is already there. Scores decay with the given half-life, in seconds.
+// Directories with negligible scores are pruned in the meanwhile, at most once
+// per dirPruneInterval; directories that no longer exist are only pruned by
+// PruneDirs, since checking them would slow down cd.
+func (s *SQLiteStore) AddDir(d string, incFactor, halfLife float64) error {
+	return s.addDir(d, incFactor, halfLife, s.dirsPruned.due(timeNow()))
+}
+
+// addDir implements AddDir, pruning decayed directories if pruneDecayed is
+// true.
+func (s *SQLiteStore) addDir(d string, incFactor, halfLife float64, pruneDecayed bool) error {
+	now := timeNow()
+	return inTx(s.db, func(tx *sql.Tx) error {
+		if pruneDecayed {
+			dirs, err := queryRawDirs(tx)
+			if err != nil {
+				return err
+			}
+			for _, dir := range dirs {
+				if dir.path != d && decayedScore(dir.score, dir.time, now, halfLife) < scoreMin {
+					_, err := tx.Exec("DELETE FROM dir WHERE path = ?", dir.path)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		score := float64(0)
+		var (
+			oldScore float64
+			oldTime  int64
+		)
+		err := tx.QueryRow("SELECT score, time FROM dir WHERE path = ?", d).Scan(&oldScore, &oldTime)
+		if err == nil {
+			score = decayedScore(oldScore, time.Unix(oldTime, 0), now, halfLife)
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		score = score + scoreIncrement*incFactor
+		_, err = tx.Exec("INSERT OR REPLACE INTO dir (path, score, time) VALUES (?, ?, ?)",
+			d, score, now.Unix())
+		return err
+	})
+}
+
+// PruneDirs removes directories that no longer exist from the directory
+// history, and returns them.
+func (s *SQLiteStore) PruneDirs() ([]string, error) {
+	var pruned []string
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		pruned = nil
+		dirs, err := queryRawDirs(tx)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			if dirExists(dir.path) {
+				continue
+			}
+			_, err := tx.Exec("DELETE FROM dir WHERE path = ?", dir.path)
+			if err != nil {
+				return err
+			}
+			pruned = append(pruned, dir.path)
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// Dirs lists all directories in the directory history whose names are not
+// in the blacklist, with their scores decayed with the given half-life. The
+// results are ordered by scores in descending order.
+func (s *SQLiteStore) Dirs(blacklist map[string]struct{}, halfLife float64) ([]storedefs.Dir, error) {
+	raw, err := queryRawDirs(s.db)
+	if err != nil {
+		return nil, err
+	}
+	return decayedDirs(raw, blacklist, halfLife), nil
+}
+
+func (s *SQLiteStore) rawDirs() ([]rawDir, error) {
+	return queryRawDirs(s.db)
+}
+
+func (s *SQLiteStore) addRawDirs(dirs []rawDir) error {
+	return inTx(s.db, func(tx *sql.Tx) error {
+		for _, dir := range dirs {
+			_, err := tx.Exec("INSERT OR REPLACE INTO dir (path, score, time) VALUES (?, ?, ?)",
+				dir.path, dir.score, dir.time.Unix())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryRawDirs(q querier) ([]rawDir, error) {
+	rows, err := q.Query("SELECT path, score, time FROM dir ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dirs []rawDir
+	for rows.Next() {
+		var (
+			dir rawDir
+			sec int64
+		)
+		if err := rows.Scan(&dir.path, &dir.score, &sec); err != nil {
+			return nil, err
+		}
+		dir.time = time.Unix(sec, 0)
+		dirs = append(dirs, dir)
+	}
+	return dirs, rows.Err()
+}
+
+// SharedVar gets the value of a shared variable.
+func (s *SQLiteStore) SharedVar(n string) (string, error) {
+	var value string
+	err := s.db.QueryRow(
+		"SELECT value FROM shared_var WHERE name = ?", n).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", ErrNoVar
+	}
+	return value, err
+}
+
+// SharedVarNames returns the names of all shared variables, in lexicographical
+// order.
+func (s *SQLiteStore) SharedVarNames() ([]string, error) {
+	rows, err := s.db.Query("SELECT name FROM shared_var ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// SetSharedVar sets the value of a shared variable.
+func (s *SQLiteStore) SetSharedVar(n, v string) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO shared_var (name, value) VALUES (?, ?)", n, v)
+	return err
+}
+
+// DelSharedVar deletes a shared variable.
+func (s *SQLiteStore) DelSharedVar(n string) error {
+	_, err := s.db.Exec("DELETE FROM shared_var WHERE name = ?", n)
+	return err
+}
+
+// CompletionCache gets the cached completion data with the given key. It
+// returns an empty string if there is no such data.
+func (s *SQLiteStore) CompletionCache(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(
+		"SELECT value FROM completion_cache WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetCompletionCache caches completion data with the given key.
+func (s *SQLiteStore) SetCompletionCache(key, value string) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO completion_cache (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+// Stats returns statistics of the database. The sizes of tables are unknown.
+func (s *SQLiteStore) Stats() (*storedefs.DBStats, error) {
+	stats := &storedefs.DBStats{Backend: BackendSQLite}
+	var (
+		seq                 int
+		name                string
+		pageCount, pageSize int64
+	)
+	err := s.db.QueryRow("PRAGMA database_list").Scan(&seq, &name, &stats.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow("PRAGMA page_count").Scan(&pageCount)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+	if err != nil {
+		return nil, err
+	}
+	stats.Size = pageCount * pageSize
+
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		var keys int
+		err := s.db.QueryRow(`SELECT COUNT(*) FROM "` + table + `"`).Scan(&keys)
+		if err != nil {
+			return nil, err
+		}
+		stats.Buckets = append(stats.Buckets,
+			storedefs.BucketStats{Name: table, Keys: keys})
+	}
+	return stats, nil
+}
+
+// Compact rebuilds the database with VACUUM, reclaiming the space of removed
+// data.
+func (s *SQLiteStore) Compact() error {
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
@@ -0,0 +1,21 @@
+// +build !cgo
+
+package store
+
+import "errors"
+
+// ErrNoSQLite is returned when opening a SQLite database in builds without
+// cgo, which the SQLite backend requires.
+var ErrNoSQLite = errors.New("SQLite databases are not supported by this build of Elvish, which is built without cgo")
+
+func openSQLiteStore(dbpath string) (DBStore, error) {
+	return nil, ErrNoSQLite
+}
+
+func isSQLiteLocked(err error) bool {
+	return false
+}
+
+func openSQLiteSchemaDB(dbpath string) (schemaDB, error) {
+	return nil, ErrNoSQLite
+}
@@ -0,0 +1,35 @@
+// +build cgo
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
+)
+
+func init() {
+	testBackends = append(testBackends, BackendSQLite)
+}
+
+func TestSQLiteSpecialPath(t *testing.T) {
+	util.WithTempDir(func(dir string) {
+		dbpath := filepath.Join(dir, "a b?c=d#e%41")
+		st, err := NewSQLiteStore(dbpath)
+		if err != nil {
+			t.Fatalf("NewSQLiteStore -> error %v", err)
+		}
+		defer st.Close()
+		if _, err := os.Stat(dbpath); err != nil {
+			t.Errorf("database not created at %q: %v", dbpath, err)
+		}
+	})
+}
+
+func TestSQLiteSchemaVersion(t *testing.T) {
+	if latest := latestVersion(sqliteSchemaDB{}.migrations()); latest != SQLiteSchemaVersion {
+		t.Errorf("latest migration has version %d, want %d", latest, SQLiteSchemaVersion)
+	}
+}
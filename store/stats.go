@@ -0,0 +1,97 @@
+package store
+
+import (
+	"os"
+
+	"github.com/boltdb/bolt"
+	"github.com/elves/elvish/store/storedefs"
+)
+
+// Stats returns statistics of the database.
+func (s *Store) Stats() (*storedefs.DBStats, error) {
+	stats := &storedefs.DBStats{Backend: BackendBolt, Path: s.db.Path()}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.Size = tx.Size()
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bs := b.Stats()
+			stats.Buckets = append(stats.Buckets, storedefs.BucketStats{
+				Name: string(name), Keys: bs.KeyN,
+				Bytes: int64(bs.BranchInuse + bs.LeafInuse + bs.InlineBucketInuse),
+			})
+			return nil
+		})
+	})
+	return stats, err
+}
+
+// Compact rewrites the database to a new file and replaces the database with
+// it. Bolt never shrinks its file, so this is the only way to reclaim the space
+// of removed data. It waits for outstanding operations to finish, and must not
+// be called concurrently with other methods.
+func (s *Store) Compact() error {
+	s.waits.Wait()
+	path := s.db.Path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, info.Mode().Perm(), nil)
+	if err != nil {
+		return err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(dstBucket, b)
+			})
+		})
+	})
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	err = s.db.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	renameErr := os.Rename(tmpPath, path)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	}
+	// Reopen the database, compacted or not.
+	db, err := DefaultDB(path)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	return renameErr
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(nested, src.Bucket(k))
+		}
+		return dst.Put(k, v)
+	})
+}
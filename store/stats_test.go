@@ -0,0 +1,53 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsAndCompact(t *testing.T) {
+	testStores(t, func(t *testing.T, tStore DBStore) {
+		for i := 0; i < 100; i++ {
+			tStore.AddCmd("some command")
+		}
+		tStore.SetSharedVar("foo", "bar")
+
+		stats, err := tStore.Stats()
+		if err != nil {
+			t.Fatalf("Stats() -> error %v", err)
+		}
+		if stats.Size <= 0 || stats.Path == "" {
+			t.Errorf("Stats() -> size %d, path %q", stats.Size, stats.Path)
+		}
+		keys := make(map[string]int)
+		for _, b := range stats.Buckets {
+			keys[b.Name] = b.Keys
+		}
+		if keys["cmd"] != 100 || keys["shared_var"] != 1 {
+			t.Errorf("Stats() -> buckets %v", stats.Buckets)
+		}
+
+		removed, _ := tStore.DedupCmds()
+		if len(removed) != 99 {
+			t.Errorf("DedupCmds removed %d commands, want 99", len(removed))
+		}
+		err = tStore.Compact()
+		if err != nil {
+			t.Errorf("Compact() -> error %v", err)
+		}
+
+		// The data survives the compaction, including the next sequence number.
+		next, err := tStore.NextCmdSeq()
+		if next != 101 || err != nil {
+			t.Errorf("NextCmdSeq() after Compact -> (%d, %v), want (101, nil)", next, err)
+		}
+		cmds, _ := tStore.Cmds(0, next)
+		if !reflect.DeepEqual(cmds, []string{"some command"}) {
+			t.Errorf("Cmds after Compact -> %v", cmds)
+		}
+		v, _ := tStore.SharedVar("foo")
+		if v != "bar" {
+			t.Errorf("SharedVar after Compact -> %q, want bar", v)
+		}
+	})
+}
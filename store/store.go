@@ -14,7 +14,6 @@ import (
 )
 
 var logger = util.GetLogger("[store] ")
-var initDB = map[string](func(*bolt.DB) error){}
 
 var ErrInvalidBucket = errors.New("invalid bucket")
 
@@ -28,6 +27,8 @@ type Store struct {
 	db *bolt.DB
 	// Waits is used for registering outstanding operations on the store.
 	waits sync.WaitGroup
+	// When decayed directories were last pruned.
+	dirsPruned dirPruneClock
 }
 
 var _ storedefs.Store = (*Store)(nil)
@@ -60,15 +61,9 @@ func NewStoreDB(db *bolt.DB) (*Store, error) {
 		waits: sync.WaitGroup{},
 	}
 
-	if SchemaUpToDate(db) {
-		logger.Println("DB schema up to date")
-	} else {
-		for name, fn := range initDB {
-			err := fn(db)
-			if err != nil {
-				return nil, fmt.Errorf("failed to %s: %v", name, err)
-			}
-		}
+	err := upgradeSchema(boltSchema{db}, db.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %v", err)
 	}
 
 	return st, nil
@@ -3,26 +3,44 @@ package store
 // This file also sets up the test fixture.
 
 import (
-	"fmt"
-	"io/ioutil"
-	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elves/elvish/util"
 )
 
-var tStore *Store
+// testBackends contains the backends to test. The SQLite backend is added in
+// sqlite_test.go when cgo is available.
+var testBackends = []string{BackendBolt}
 
-func init() {
-	f, err := ioutil.TempFile("", "elvish.test")
-	if err != nil {
-		panic(fmt.Sprintf("Failed to open temp file: %v", err))
-	}
-	db, err := DefaultDB(f.Name())
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Store instance: %v", err))
-	}
-	os.Remove(f.Name())
+var testKey = make([]byte, 32)
 
-	tStore, err = NewStoreDB(db)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Store instance: %v", err))
+// testStores calls f with a new store of each backend, each backend with the
+// command history encrypted, and each backend shared (see OpenShared), in
+// subtests.
+func testStores(t *testing.T, f func(t *testing.T, tStore DBStore)) {
+	for _, backend := range testBackends {
+		for _, variant := range []string{"", "-encrypted", "-shared"} {
+			t.Run(backend+variant, func(t *testing.T) {
+				util.WithTempDir(func(dir string) {
+					open := Open
+					if variant == "-shared" {
+						open = OpenShared
+					}
+					st, err := open(backend, filepath.Join(dir, "db"))
+					if err != nil {
+						t.Fatalf("Failed to create Store instance: %v", err)
+					}
+					if variant == "-encrypted" {
+						st, err = NewEncryptedStore(st, testKey)
+						if err != nil {
+							t.Fatalf("Failed to create encrypted store: %v", err)
+						}
+					}
+					defer st.Close()
+					f(t, st)
+				})
+			})
+		}
 	}
 }
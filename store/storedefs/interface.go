@@ -4,15 +4,26 @@ package storedefs
 type Store interface {
 	NextCmdSeq() (int, error)
 	AddCmd(text string) (int, error)
+	AddCmdWithMeta(text string, meta CmdMeta) (int, error)
+	AddCmds(cmds []Cmd) error
+	RemoveCmd(seq int) error
+	DedupCmds() ([]int, error)
 	Cmd(seq int) (string, error)
 	Cmds(from, upto int) ([]string, error)
 	NextCmd(from int, prefix string) (int, string, error)
 	PrevCmd(upto int, prefix string) (int, string, error)
+	CmdsWithMeta(from, upto int) ([]Cmd, error)
+	SetCmdMeta(seq int, meta CmdMeta) error
 
-	AddDir(dir string, incFactor float64) error
-	Dirs(blacklist map[string]struct{}) ([]Dir, error)
+	AddDir(dir string, incFactor, halfLife float64) error
+	Dirs(blacklist map[string]struct{}, halfLife float64) ([]Dir, error)
+	PruneDirs() ([]string, error)
 
 	SharedVar(name string) (string, error)
+	SharedVarNames() ([]string, error)
 	SetSharedVar(name, value string) error
 	DelSharedVar(name string) error
+
+	CompletionCache(key string) (string, error)
+	SetCompletionCache(key, value string) error
 }
@@ -1,7 +1,10 @@
 // Package storedefs contains definitions used by the store package.
 package storedefs
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // NoBlacklist is an empty blacklist, to be used in GetDirs.
 var NoBlacklist = map[string]struct{}{}
@@ -10,8 +13,58 @@ var NoBlacklist = map[string]struct{}{}
 // completes with no result.
 var ErrNoMatchingCmd = errors.New("no matching command line")
 
+// ErrNoSharedVar is the error returned when a SharedVar query finds no such
+// variable.
+var ErrNoSharedVar = errors.New("no such variable")
+
+// ErrDBLocked is the error returned when the database cannot be used because
+// another process, typically a daemon, keeps it locked.
+var ErrDBLocked = errors.New("database is locked by another process")
+
 // Dir is an entry in the directory history.
 type Dir struct {
 	Path  string
 	Score float64
 }
+
+// DefaultDirHalfLife is the default half-life of the scores in the directory
+// history, in seconds. It is also used when a non-positive half-life is given.
+const DefaultDirHalfLife = 7 * 24 * 60 * 60
+
+// CmdMeta is the metadata of an entry in the command history.
+type CmdMeta struct {
+	StartTime time.Time
+	Duration  time.Duration
+	// The working directory the command was run in.
+	Dir string
+	// The exit status of the command, or -1 if unknown.
+	ExitStatus int
+	// An identifier of the session the command was run in.
+	Session string
+}
+
+// Cmd is an entry in the command history, along with its metadata. Meta is
+// nil if the metadata is unknown.
+type Cmd struct {
+	Seq  int
+	Text string
+	Meta *CmdMeta
+}
+
+// DBStats contains statistics of a database.
+type DBStats struct {
+	Backend string
+	Path    string
+	// Size of the database in bytes.
+	Size    int64
+	Buckets []BucketStats
+}
+
+// BucketStats contains statistics of a bucket of a Bolt database, or a table
+// of a SQLite database.
+type BucketStats struct {
+	Name string
+	Keys int
+	// Number of bytes used by the bucket, or 0 if unknown.
+	Bytes int64
+}
@@ -0,0 +1,26 @@
+package util
+
+import "testing"
+
+var editDistanceTests = []struct {
+	s, t string
+	want int
+}{
+	{"", "", 0},
+	{"a", "", 1},
+	{"", "abc", 3},
+	{"git", "git", 0},
+	{"gti", "git", 1},
+	{"ab", "bca", 3},
+	{"got", "git", 1},
+	{"kitten", "sitting", 3},
+	{"你好", "你们好", 1},
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range editDistanceTests {
+		if d := EditDistance(test.s, test.t); d != test.want {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", test.s, test.t, d, test.want)
+		}
+	}
+}
@@ -21,7 +21,16 @@ func Getwd() string {
 // TildeAbbr abbreviates the user's home directory to ~.
 func TildeAbbr(path string) string {
 	home, err := GetHome("")
-	if err == nil {
+	if err != nil {
+		return path
+	}
+	return TildeAbbrHome(path, home)
+}
+
+// TildeAbbrHome abbreviates the given home directory to ~. An empty home
+// directory is never abbreviated.
+func TildeAbbrHome(path, home string) string {
+	if home != "" {
 		if path == home {
 			return "~"
 		} else if strings.HasPrefix(path, home+pathSep) {
@@ -1,23 +1,95 @@
 package util
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 var (
-	out io.Writer = ioutil.Discard
+	// Protects out, outFile and loggers.
+	mutex sync.Mutex
+	out   io.Writer = ioutil.Discard
 	// If out is set by SetOutputFile, outFile is set and keeps the same value
 	// as out. Otherwise, outFile is nil.
 	outFile *os.File
 	loggers []*log.Logger
+	// The current LogLevel, accessed atomically.
+	level int32 = int32(LogInfo)
 )
 
+// LogLevel determines which messages are logged.
+type LogLevel int32
+
+const (
+	// LogNone disables all loggers.
+	LogNone LogLevel = iota
+	// LogInfo is the default level. Loggers obtained with GetLogger write at
+	// this level.
+	LogInfo
+	// LogDebug additionally enables messages that are only logged when
+	// GetLogLevel returns LogDebug, such as every request to the daemon.
+	LogDebug
+)
+
+var logLevelNames = []string{"none", "info", "debug"}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel parses the name of a LogLevel.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, levelName := range logLevelNames {
+		if name == levelName {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("bad log level %q, should be one of none, info and debug", name)
+}
+
+// GetLogLevel returns the current log level.
+func GetLogLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(&level))
+}
+
+// SetLogLevel sets the log level. It can be called while loggers are in use.
+func SetLogLevel(l LogLevel) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	atomic.StoreInt32(&level, int32(l))
+	updateLoggers()
+}
+
+// updateLoggers updates the output of all loggers. It must be called with
+// mutex held.
+func updateLoggers() {
+	for _, logger := range loggers {
+		logger.SetOutput(loggerOutput())
+	}
+}
+
+// loggerOutput returns the output of loggers. It must be called with mutex
+// held.
+func loggerOutput() io.Writer {
+	if GetLogLevel() == LogNone {
+		return ioutil.Discard
+	}
+	return out
+}
+
 // GetLogger gets a logger with a prefix.
 func GetLogger(prefix string) *log.Logger {
-	logger := log.New(out, prefix, log.LstdFlags)
+	mutex.Lock()
+	defer mutex.Unlock()
+	logger := log.New(loggerOutput(), prefix, log.LstdFlags)
 	loggers = append(loggers, logger)
 	return logger
 }
@@ -26,15 +98,20 @@ func GetLogger(prefix string) *log.Logger {
 // new io.Writer. If the old output was a file opened by SetOutputFile, it is
 // closed.
 func SetOutput(newout io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	setOutput(newout, nil)
+}
+
+// setOutput sets out and outFile, closing the old outFile. It must be called
+// with mutex held.
+func setOutput(newout io.Writer, newOutFile *os.File) {
 	if outFile != nil {
 		outFile.Close()
-		outFile = nil
 	}
 	out = newout
-	outFile = nil
-	for _, logger := range loggers {
-		logger.SetOutput(out)
-	}
+	outFile = newOutFile
+	updateLoggers()
 }
 
 // SetOutputFile redirects the output of all loggers obtained with GetLogger to
@@ -50,7 +127,8 @@ func SetOutputFile(fname string) error {
 	if err != nil {
 		return err
 	}
-	SetOutput(file)
-	outFile = file
+	mutex.Lock()
+	defer mutex.Unlock()
+	setOutput(file, file)
 	return nil
 }
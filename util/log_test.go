@@ -0,0 +1,48 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(ioutil.Discard)
+	logger := GetLogger("[test] ")
+
+	SetLogLevel(LogNone)
+	logger.Println("hidden")
+	SetLogLevel(LogInfo)
+	logger.Println("shown")
+	if bytes.Contains(buf.Bytes(), []byte("hidden")) ||
+		!bytes.Contains(buf.Bytes(), []byte("shown")) {
+		t.Errorf("log output is %q", buf.String())
+	}
+
+	for _, l := range []LogLevel{LogNone, LogInfo, LogDebug} {
+		parsed, err := ParseLogLevel(l.String())
+		if parsed != l || err != nil {
+			t.Errorf("ParseLogLevel(%q) -> (%v, %v)", l.String(), parsed, err)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("ParseLogLevel(verbose) -> no error")
+	}
+}
+
+func TestLogLevelConcurrent(t *testing.T) {
+	defer SetLogLevel(LogInfo)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			GetLogger("[test] ")
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		SetLogLevel(LogLevel(i % 3))
+	}
+	<-done
+}